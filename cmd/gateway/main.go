@@ -13,9 +13,13 @@ import (
 	"codex-gateway/internal/config"
 	"codex-gateway/internal/database"
 	"codex-gateway/internal/handlers"
+	"codex-gateway/internal/logger"
 	"codex-gateway/internal/middleware"
+	"codex-gateway/internal/modelalias"
 	"codex-gateway/internal/pricing"
 	"codex-gateway/internal/ratelimit"
+	"codex-gateway/internal/statestore"
+	"codex-gateway/internal/tokenizer"
 	"codex-gateway/internal/upstream"
 
 	"github.com/gin-contrib/cors"
@@ -27,6 +31,8 @@ func main() {
 		log.Fatal("Failed to load config:", err)
 	}
 
+	logger.Setup(config.AppConfig.LogLevel, config.AppConfig.LogFormat)
+
 	if err := database.Connect(); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -52,10 +58,31 @@ func main() {
 		log.Fatal("Failed to seed Codex upstreams:", err)
 	}
 
+	if err := database.SeedModelAliasRules(); err != nil {
+		log.Fatal("Failed to seed model alias rules:", err)
+	}
+
+	statestore.Init(config.AppConfig.RedisURL)
 	ratelimit.LoadFromDB()
 
+	if err := pricing.LoadPrices(); err != nil {
+		log.Fatal("Failed to load pricing:", err)
+	}
+	pricing.ListenForChanges()
+	modelalias.LoadFromDB()
+
+	tokenizer.SetDataDir(config.AppConfig.TokenizerDir)
+
 	// Initialize pricing service
 	pricingService := pricing.GetService()
+	if err := pricingService.Configure(pricing.Options{
+		Source:   config.AppConfig.PricingSource,
+		URL:      config.AppConfig.PricingURL,
+		Path:     config.AppConfig.PricingPath,
+		CacheDir: config.AppConfig.PricingCacheDir,
+	}); err != nil {
+		log.Fatal("Invalid pricing source:", err)
+	}
 	if err := pricingService.Initialize(); err != nil {
 		log.Printf("Warning: Pricing service failed to initialize: %v", err)
 	}
@@ -66,22 +93,37 @@ func main() {
 	healthChecker.Start()
 	defer healthChecker.Stop()
 
+	if err := billing.SetQuotaTimezone(config.AppConfig.QuotaTimezone); err != nil {
+		log.Fatal("Invalid QUOTA_TIMEZONE:", err)
+	}
+
 	// Start package expiration job
 	billing.StartPackageExpirationJob()
 	log.Println("Package expiration job started")
 
+	// Start stale balance hold expiration job
+	billing.StartHoldExpirationJob()
+
 	router := gin.Default()
+	if err := middleware.TrustProxies(router, config.AppConfig.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// CORS middleware
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Api-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: false,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Prometheus scrape endpoint; public only with a token
+	if config.AppConfig.MetricsToken != "" {
+		router.GET("/metrics", handlers.Metrics)
+	}
+
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
@@ -116,8 +158,10 @@ func main() {
 			// API Keys
 			protected.GET("/keys", handlers.ListAPIKeys)
 			protected.POST("/keys", handlers.CreateAPIKey)
+			protected.PUT("/keys/:id", handlers.UpdateAPIKey)
 			protected.DELETE("/keys/:id", handlers.DeleteAPIKey)
 			protected.PUT("/keys/:id/status", handlers.UpdateAPIKeyStatus)
+			protected.POST("/keys/:id/rotate", handlers.RotateAPIKey)
 
 			// Usage & Billing
 			protected.GET("/usage/logs", handlers.GetUsageLogs)
@@ -125,6 +169,19 @@ func main() {
 			protected.GET("/usage/daily-trend", handlers.GetDailyTrend)
 			protected.GET("/account/balance", handlers.GetBalance)
 			protected.GET("/account/transactions", handlers.GetTransactions)
+
+			// Organizations
+			protected.GET("/organizations", handlers.ListOrganizations)
+			protected.POST("/organizations", handlers.CreateOrganization)
+			protected.GET("/organizations/:id", handlers.GetOrganization)
+			protected.PUT("/organizations/:id", handlers.UpdateOrganization)
+			protected.GET("/organizations/:id/members", handlers.ListOrganizationMembers)
+			protected.PUT("/organizations/:id/members/:user_id", handlers.UpdateOrganizationMember)
+			protected.DELETE("/organizations/:id/members/:user_id", handlers.RemoveOrganizationMember)
+			protected.GET("/organizations/:id/invitations", handlers.ListOrganizationInvitations)
+			protected.POST("/organizations/:id/invitations", handlers.CreateOrganizationInvitation)
+			protected.DELETE("/organizations/:id/invitations/:invitation_id", handlers.RevokeOrganizationInvitation)
+			protected.POST("/invitations/accept", handlers.AcceptOrganizationInvitation)
 		}
 
 		// Admin Routes
@@ -156,6 +213,17 @@ func main() {
 			admin.GET("/pricing", handlers.AdminListPricing)
 			admin.PUT("/pricing/:id", handlers.AdminUpdatePricing)
 			admin.POST("/pricing/batch-update-markup", handlers.AdminBatchUpdateMarkup)
+			admin.POST("/pricing/sync", handlers.AdminSyncPricing)
+			admin.POST("/pricing/upload", handlers.AdminUploadPricing)
+			admin.GET("/pricing/versions", handlers.AdminListPricingVersions)
+			admin.POST("/pricing/versions", handlers.AdminCreatePricingVersion)
+			admin.DELETE("/pricing/versions/:id", handlers.AdminCancelPricingVersion)
+
+			// Pricing Rules
+			admin.GET("/pricing-rules", handlers.AdminListPricingRules)
+			admin.POST("/pricing-rules", handlers.AdminCreatePricingRule)
+			admin.PUT("/pricing-rules/:id", handlers.AdminUpdatePricingRule)
+			admin.DELETE("/pricing-rules/:id", handlers.AdminDeletePricingRule)
 
 			// Package Management
 			admin.GET("/packages", handlers.AdminListPackages)
@@ -185,6 +253,19 @@ func main() {
 			// Upstream Health Check
 			admin.GET("/codex/upstreams/health", handlers.AdminGetUpstreamHealth)
 			admin.POST("/codex/upstreams/health/check", handlers.AdminTriggerHealthCheck)
+
+			// Rate Limit Policies
+			admin.GET("/rate-limits", handlers.AdminListRateLimitPolicies)
+			admin.POST("/rate-limits", handlers.AdminCreateRateLimitPolicy)
+			admin.PUT("/rate-limits/:id", handlers.AdminUpdateRateLimitPolicy)
+			admin.DELETE("/rate-limits/:id", handlers.AdminDeleteRateLimitPolicy)
+
+			// Model alias rules
+			admin.GET("/model-aliases", handlers.AdminListModelAliasRules)
+			admin.GET("/model-aliases/resolve", handlers.AdminResolveModelAlias)
+			admin.POST("/model-aliases", handlers.AdminCreateModelAliasRule)
+			admin.PUT("/model-aliases/:id", handlers.AdminUpdateModelAliasRule)
+			admin.DELETE("/model-aliases/:id", handlers.AdminDeleteModelAliasRule)
 		}
 
 		// User Routes (authenticated)
@@ -210,7 +291,7 @@ func main() {
 
 	// Data Plane API (OpenAI/Codex Proxy)
 	api := router.Group("/v1")
-	api.Use(middleware.AuthMiddleware())
+	api.Use(middleware.RequestID(), middleware.AuthMiddleware())
 	{
 		// ChatGPT API
 		api.POST("/chat/completions", handlers.ProxyHandler)
@@ -218,11 +299,22 @@ func main() {
 		// Codex API (GitHub Copilot)
 		api.POST("/completions", handlers.ProxyHandler)
 		api.POST("/responses", handlers.ProxyHandler)
+
+		// Anthropic Messages API, translated to the Responses API
+		api.POST("/messages", handlers.ProxyHandler)
 		api.POST("/engines/:engine/completions", handlers.ProxyHandler)
 
 		// Other OpenAI APIs
 		api.POST("/edits", handlers.ProxyHandler)
 		api.POST("/embeddings", handlers.ProxyHandler)
+
+		// Model discovery (not forwarded upstream)
+		api.GET("/models", handlers.ListModels)
+		api.GET("/models/:model", handlers.GetModel)
+
+		// Pre-flight token counting (not forwarded upstream)
+		api.POST("/tokens/count", handlers.CountTokens)
+		api.POST("/messages/count_tokens", handlers.CountMessageTokens)
 	}
 
 	log.Printf("Server starting on port %s", config.AppConfig.ServerPort)
@@ -239,6 +331,19 @@ func main() {
 		}
 	}()
 
+	var metricsSrv *http.Server
+	if addr := config.AppConfig.MetricsAddr; addr != "none" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", handlers.MetricsHandler())
+		metricsSrv = &http.Server{Addr: addr, Handler: mux}
+		log.Printf("Metrics listening on %s", addr)
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Failed to start metrics listener:", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -251,6 +356,9 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
 
 	log.Println("Server exited")
 }
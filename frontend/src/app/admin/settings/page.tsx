@@ -317,7 +317,7 @@ export default function AdminSettings() {
           <div className="flex items-center justify-between pb-4 border-b border-zinc-100">
             <div>
               <label className="text-sm font-medium text-zinc-700">启用限流</label>
-              <p className="text-xs text-zinc-500 mt-1">限制每个 API Key 的请求速率</p>
+              <p className="text-xs text-zinc-500 mt-1">应用下方的系统默认限制；为用户或 API Key 单独设置的限制始终生效</p>
             </div>
             <button
               type="button"
@@ -7,14 +7,83 @@ export interface ModelPricing {
   output_price_per_1k: number;
   cache_read_price_per_1k: number;
   cache_creation_price_per_1k: number;
+  reasoning_price_per_1k: number;       // 0 bills reasoning tokens as output
+  tier_threshold_tokens: number;        // 0 disables the tier
+  tier_input_price_per_1k: number;
+  tier_output_price_per_1k: number;
+  tier_cache_read_price_per_1k: number;
+  max_input_tokens: number;
+  max_output_tokens: number;
   markup_multiplier: number;
   effective_from: string;
+  effective_to: string | null;  // null while no later version is scheduled
+  created_at: string;
+}
+
+// Adjusts the price charged to a user, organization, package or role; the
+// most specific enabled rule applies
+export interface PricingRule {
+  id: number;
+  scope: 'user' | 'organization' | 'package' | 'role';
+  target: string;                     // user or organization ID, package ID or role name
+  model_name: string;                 // empty applies to every model
+  markup_multiplier: number | null;   // null keeps the model's markup
+  discount_percent: number;           // taken off after markup
+  discount_per_1k: number;            // taken off per 1K billed tokens, down to zero
+  input_price_per_1k: number | null;  // replaces the model's price before markup; model rules only
+  output_price_per_1k: number | null;
+  enabled: boolean;
+  description: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export type PricingRuleInput = Omit<PricingRule, 'id' | 'created_at' | 'updated_at' | 'enabled'> & { enabled?: boolean };
+
+export interface FieldChange {
+  field: string;
+  old?: number;  // absent on create
+  new: number;
+}
+
+export interface PriceChange {
+  model_name: string;
+  action: 'create' | 'update';
+  fields: FieldChange[];
+}
+
+export interface PricingSyncResult {
+  dry_run: boolean;
+  source: string;
+  model_count: number;
+  changes: PriceChange[];
+  applied: number;
 }
 
 export const pricingApi = {
-  // List all model pricing
+  // List current model pricing and scheduled price changes
   list: async () => {
-    const response = await api.get<{ pricing: ModelPricing[] }>('/api/admin/pricing');
+    const response = await api.get<{ pricing: ModelPricing[]; scheduled: ModelPricing[] }>('/api/admin/pricing');
+    return response.data;
+  },
+
+  // List price versions, optionally for one model
+  versions: async (model?: string) => {
+    const response = await api.get<{ versions: ModelPricing[] }>('/api/admin/pricing/versions', {
+      params: model ? { model } : undefined,
+    });
+    return response.data;
+  },
+
+  // Add a price version, effective now or at effective_from
+  createVersion: async (data: Omit<ModelPricing, 'id' | 'effective_from' | 'effective_to' | 'created_at'> & { effective_from?: string }) => {
+    const response = await api.post('/api/admin/pricing/versions', data);
+    return response.data;
+  },
+
+  // Cancel a scheduled price version
+  cancelVersion: async (id: number) => {
+    const response = await api.delete(`/api/admin/pricing/versions/${id}`);
     return response.data;
   },
 
@@ -32,9 +101,52 @@ export const pricingApi = {
     return response.data;
   },
 
+  // Sync from the configured source (or litellm, file, manifest); dryRun only diffs
+  sync: async (options: { source?: string; dryRun?: boolean } = {}) => {
+    const response = await api.post<PricingSyncResult>('/api/admin/pricing/sync', undefined, {
+      params: { source: options.source, dry_run: options.dryRun ? 'true' : undefined },
+    });
+    return response.data;
+  },
+
+  // Sync from an uploaded LiteLLM JSON file or YAML manifest; dryRun only diffs
+  upload: async (file: File, dryRun = false) => {
+    const form = new FormData();
+    form.append('file', file);
+    const response = await api.post<PricingSyncResult>('/api/admin/pricing/upload', form, {
+      params: { dry_run: dryRun ? 'true' : undefined },
+    });
+    return response.data;
+  },
+
   // Reset pricing to default values
   reset: async () => {
     const response = await api.post('/api/admin/pricing/reset');
     return response.data;
   },
 };
+
+export const pricingRulesApi = {
+  // List pricing rules, optionally of one scope
+  list: async (scope?: PricingRule['scope']) => {
+    const response = await api.get<{ rules: PricingRule[] }>('/api/admin/pricing-rules', {
+      params: scope ? { scope } : undefined,
+    });
+    return response.data;
+  },
+
+  create: async (data: PricingRuleInput) => {
+    const response = await api.post<PricingRule>('/api/admin/pricing-rules', data);
+    return response.data;
+  },
+
+  update: async (id: number, data: PricingRuleInput) => {
+    const response = await api.put<PricingRule>(`/api/admin/pricing-rules/${id}`, data);
+    return response.data;
+  },
+
+  delete: async (id: number) => {
+    const response = await api.delete(`/api/admin/pricing-rules/${id}`);
+    return response.data;
+  },
+};
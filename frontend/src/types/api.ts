@@ -21,6 +21,30 @@ export interface APIKey {
   status: string;
   created_at: string;
   last_used_at: string | null;
+  allowed_models: string[] | null;
+  allowed_endpoints: string[] | null;
+  allowed_ips: string[] | null;
+  expires_at: string | null;
+  rate_limit_rpm: number;
+  quota_type: 'cost' | 'tokens';
+  quota_period: 'lifetime' | 'daily' | 'weekly' | 'monthly';
+  quota_used: number;
+  quota_period_start: string | null;
+  previous_key_expires_at: string | null;
+  rotated_at: string | null;
+  last_used_secret: '' | 'current' | 'previous';
+  last_used_ip: string;
+  last_used_user_agent: string;
+  budget?: KeyBudget;
+}
+
+export interface KeyBudget {
+  type: 'cost' | 'tokens';
+  period: 'lifetime' | 'daily' | 'weekly' | 'monthly';
+  limit: number | null;
+  used: number;
+  remaining: number | null;
+  resets_at: string | null;
 }
 
 export interface UsageLog {
@@ -32,10 +56,14 @@ export interface UsageLog {
   output_tokens: number;
   cached_tokens: number;
   cache_creation_tokens: number;
+  reasoning_tokens: number;  // part of output_tokens
   total_tokens: number;
   cost: number;
   latency_ms: number;
   status_code: number;
+  price_version_id?: number | null;
+  pricing_rule_id?: number | null;  // rule that adjusted the markup
+  applied_markup?: number;          // markup charged, rules and discounts included
   created_at: string;
 }
 
@@ -90,6 +118,13 @@ export interface LoginResponse {
 export interface CreateKeyRequest {
   name: string;
   quota_limit?: number;
+  quota_type?: 'cost' | 'tokens';
+  quota_period?: 'lifetime' | 'daily' | 'weekly' | 'monthly';
+  allowed_models?: string[];
+  allowed_endpoints?: string[];
+  allowed_ips?: string[];
+  expires_at?: string;
+  rate_limit_rpm?: number;
 }
 
 export interface CreateKeyResponse {
@@ -98,6 +133,10 @@ export interface CreateKeyResponse {
   name: string;
 }
 
+export interface RotateKeyResponse extends CreateKeyResponse {
+  previous_key_expires_at: string | null;
+}
+
 // Admin types
 export interface AdminUser extends User {
   api_key_count?: number;
@@ -127,6 +166,21 @@ export interface SystemSettings {
   rate_limit_rpm: number;
   rate_limit_burst: number;
   user_daily_usage_limit?: number | null;
+  unknown_model_action: 'reject' | 'map';
+  unknown_model_target: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ModelAliasRule {
+  id: number;
+  match_type: 'exact' | 'prefix' | 'regex';
+  pattern: string;
+  target: string;
+  reasoning_effort: '' | 'minimal' | 'low' | 'medium' | 'high';
+  priority: number;     // Lower runs first
+  enabled: boolean;
+  description: string;
   created_at: string;
   updated_at: string;
 }
@@ -189,7 +243,7 @@ export interface DailyUsage {
 
 export interface AdminLog {
   id: number;
-  admin_id: string;
+  admin_id: string | null;  // null for system actions such as scheduled pricing syncs
   action: string;
   target: string;
   details: string;
@@ -0,0 +1,231 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ToResponsesRequest converts an Anthropic Messages API request body into a
+// Codex Responses API request body
+func ToResponsesRequest(req map[string]interface{}) (map[string]interface{}, error) {
+	messages, ok := req["messages"].([]interface{})
+	if !ok || len(messages) == 0 {
+		return nil, fmt.Errorf("messages is required")
+	}
+
+	out := map[string]interface{}{}
+	if model, ok := req["model"].(string); ok {
+		out["model"] = model
+	}
+	if stream, ok := req["stream"].(bool); ok {
+		out["stream"] = stream
+	}
+	if maxTokens, ok := req["max_tokens"].(float64); ok && maxTokens > 0 {
+		out["max_output_tokens"] = maxTokens
+	}
+	for _, field := range []string{"temperature", "top_p"} {
+		if v, ok := req[field]; ok {
+			out[field] = v
+		}
+	}
+
+	if system := systemText(req["system"]); system != "" {
+		out["instructions"] = system
+	}
+
+	var input []interface{}
+	for i, raw := range messages {
+		msg, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("messages[%d] must be an object", i)
+		}
+		role, _ := msg["role"].(string)
+		if role != "user" && role != "assistant" {
+			return nil, fmt.Errorf("messages[%d].role must be user or assistant", i)
+		}
+		items, err := convertMessage(role, msg["content"])
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %v", i, err)
+		}
+		input = append(input, items...)
+	}
+	out["input"] = input
+
+	if tools, ok := req["tools"].([]interface{}); ok && len(tools) > 0 {
+		converted := make([]interface{}, 0, len(tools))
+		for _, raw := range tools {
+			tool, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fn := map[string]interface{}{
+				"type":       "function",
+				"name":       tool["name"],
+				"parameters": tool["input_schema"],
+			}
+			if description, ok := tool["description"].(string); ok && description != "" {
+				fn["description"] = description
+			}
+			converted = append(converted, fn)
+		}
+		out["tools"] = converted
+	}
+
+	if choice, ok := req["tool_choice"].(map[string]interface{}); ok {
+		switch choice["type"] {
+		case "auto":
+			out["tool_choice"] = "auto"
+		case "any":
+			out["tool_choice"] = "required"
+		case "none":
+			out["tool_choice"] = "none"
+		case "tool":
+			out["tool_choice"] = map[string]interface{}{"type": "function", "name": choice["name"]}
+		}
+		if disable, ok := choice["disable_parallel_tool_use"].(bool); ok && disable {
+			out["parallel_tool_calls"] = false
+		}
+	}
+
+	return out, nil
+}
+
+// systemText flattens a system prompt given as a string or text blocks
+func systemText(system interface{}) string {
+	switch s := system.(type) {
+	case string:
+		return s
+	case []interface{}:
+		var parts []string
+		for _, raw := range s {
+			if block, ok := raw.(map[string]interface{}); ok {
+				if text, ok := block["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+// convertMessage turns one Anthropic message into Responses input items.
+// Tool calls and tool results become their own items, so consecutive content
+// blocks are grouped into messages around them to keep the original order.
+func convertMessage(role string, content interface{}) ([]interface{}, error) {
+	if text, ok := content.(string); ok {
+		return []interface{}{textMessage(role, []interface{}{textPart(role, text)})}, nil
+	}
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("content must be a string or an array of blocks")
+	}
+
+	var items, parts []interface{}
+	flush := func() {
+		if len(parts) > 0 {
+			items = append(items, textMessage(role, parts))
+			parts = nil
+		}
+	}
+
+	for _, raw := range blocks {
+		block, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "text":
+			text, _ := block["text"].(string)
+			parts = append(parts, textPart(role, text))
+		case "image":
+			if role != "user" {
+				continue
+			}
+			if url := imageURL(block["source"]); url != "" {
+				parts = append(parts, map[string]interface{}{"type": "input_image", "image_url": url})
+			}
+		case "tool_use":
+			flush()
+			arguments, err := json.Marshal(block["input"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid tool_use input: %v", err)
+			}
+			items = append(items, map[string]interface{}{
+				"type":      "function_call",
+				"call_id":   block["id"],
+				"name":      block["name"],
+				"arguments": string(arguments),
+			})
+		case "tool_result":
+			flush()
+			output := toolResultText(block["content"])
+			if isError, ok := block["is_error"].(bool); ok && isError && output == "" {
+				output = "error"
+			}
+			items = append(items, map[string]interface{}{
+				"type":    "function_call_output",
+				"call_id": block["tool_use_id"],
+				"output":  output,
+			})
+		}
+		// thinking and other block types have no Responses equivalent
+	}
+	flush()
+
+	return items, nil
+}
+
+func textMessage(role string, content []interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "message",
+		"role":    role,
+		"content": content,
+	}
+}
+
+func textPart(role, text string) map[string]interface{} {
+	partType := "input_text"
+	if role == "assistant" {
+		partType = "output_text"
+	}
+	return map[string]interface{}{"type": partType, "text": text}
+}
+
+// imageURL converts a base64 or url image source to an image URL
+func imageURL(source interface{}) string {
+	src, ok := source.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch src["type"] {
+	case "base64":
+		mediaType, _ := src["media_type"].(string)
+		data, _ := src["data"].(string)
+		return "data:" + mediaType + ";base64," + data
+	case "url":
+		url, _ := src["url"].(string)
+		return url
+	}
+	return ""
+}
+
+// toolResultText flattens tool_result content given as a string or text blocks
+func toolResultText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var parts []string
+		for _, raw := range c {
+			if block, ok := raw.(map[string]interface{}); ok {
+				if text, ok := block["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
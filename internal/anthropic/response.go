@@ -0,0 +1,165 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// responsesOutputItem is an item of a Responses API output array
+type responsesOutputItem struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Content   []struct {
+		Type    string `json:"type"`
+		Text    string `json:"text"`
+		Refusal string `json:"refusal"`
+	} `json:"content"`
+}
+
+// responsesResponse is the subset of a Responses API response that is translated
+type responsesResponse struct {
+	ID                string                `json:"id"`
+	Status            string                `json:"status"`
+	Output            []responsesOutputItem `json:"output"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+	Usage struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+	} `json:"usage"`
+}
+
+// Usage is the usage block of a Messages API response
+type Usage struct {
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens"`
+}
+
+// FromResponsesResponse converts a Responses API response body into a
+// Messages API response for the requested model
+func FromResponsesResponse(body []byte, model string) (map[string]interface{}, error) {
+	var resp responsesResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	content := []interface{}{}
+	hasToolUse := false
+	for _, item := range resp.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				text := part.Text
+				if part.Type == "refusal" {
+					text = part.Refusal
+				}
+				if text != "" {
+					content = append(content, map[string]interface{}{"type": "text", "text": text})
+				}
+			}
+		case "function_call":
+			hasToolUse = true
+			content = append(content, map[string]interface{}{
+				"type":  "tool_use",
+				"id":    item.CallID,
+				"name":  item.Name,
+				"input": toolInput(item.Arguments),
+			})
+		}
+	}
+
+	incompleteReason := ""
+	if resp.IncompleteDetails != nil {
+		incompleteReason = resp.IncompleteDetails.Reason
+	}
+
+	return map[string]interface{}{
+		"id":            messageID(resp.ID),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         model,
+		"content":       content,
+		"stop_reason":   stopReason(hasToolUse, incompleteReason),
+		"stop_sequence": nil,
+		"usage":         convertUsage(resp.Usage.InputTokens, resp.Usage.OutputTokens, resp.Usage.InputTokensDetails.CachedTokens),
+	}, nil
+}
+
+// ErrorBody builds a Messages API error response body
+func ErrorBody(statusCode int, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    errorType(statusCode),
+			"message": message,
+		},
+	}
+}
+
+// errorType maps an HTTP status to the Messages API error type
+func errorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusPaymentRequired, http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	}
+	return "api_error"
+}
+
+// stopReason derives the Messages API stop reason
+func stopReason(hasToolUse bool, incompleteReason string) string {
+	switch {
+	case incompleteReason == "max_output_tokens":
+		return "max_tokens"
+	case hasToolUse:
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+// convertUsage reports cached prompt tokens separately, as the Messages API does
+func convertUsage(inputTokens, outputTokens, cachedTokens int) Usage {
+	uncached := inputTokens - cachedTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	return Usage{
+		InputTokens:          uncached,
+		OutputTokens:         outputTokens,
+		CacheReadInputTokens: cachedTokens,
+	}
+}
+
+// messageID derives a Messages API id from the Responses id
+func messageID(responseID string) string {
+	return "msg_" + strings.TrimPrefix(responseID, "resp_")
+}
+
+// toolInput decodes function call arguments, falling back to an empty object
+func toolInput(arguments string) interface{} {
+	var input interface{}
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil || input == nil {
+		return map[string]interface{}{}
+	}
+	return input
+}
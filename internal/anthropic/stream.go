@@ -0,0 +1,225 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StreamTranslator rewrites a Responses API event stream as a Messages API
+// event stream. Responses streams output items one after another, so at most
+// one content block is open at a time.
+type StreamTranslator struct {
+	model      string
+	started    bool
+	finished   bool
+	blockIndex int
+	blockOpen  bool
+	blockType  string // text or tool_use
+	blockCall  string // call_id of the open tool_use block
+	hasToolUse bool
+}
+
+// NewStreamTranslator returns a translator for a stream of the requested model
+func NewStreamTranslator(model string) *StreamTranslator {
+	return &StreamTranslator{model: model}
+}
+
+// streamEvent is the subset of a Responses API stream event that is translated
+type streamEvent struct {
+	Type     string              `json:"type"`
+	Delta    string              `json:"delta"`
+	Item     responsesOutputItem `json:"item"`
+	Message  string              `json:"message"`
+	Response struct {
+		responsesResponse
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"response"`
+}
+
+// WriteLine translates one line of the upstream stream and writes the
+// resulting events. Event name lines, blank lines and events without a
+// Messages API equivalent produce no output.
+func (t *StreamTranslator) WriteLine(w io.Writer, line string) error {
+	if !strings.HasPrefix(line, "data: ") {
+		return nil
+	}
+	data := strings.TrimPrefix(line, "data: ")
+	if data == "[DONE]" || t.finished {
+		return nil
+	}
+
+	var event streamEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "response.created":
+		return t.start(w, event.Response.ID)
+
+	case "response.output_text.delta", "response.refusal.delta":
+		if err := t.openBlock(w, "text", "", ""); err != nil {
+			return err
+		}
+		return t.emit(w, "content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": t.blockIndex,
+			"delta": map[string]interface{}{"type": "text_delta", "text": event.Delta},
+		})
+
+	case "response.output_item.added":
+		if event.Item.Type == "function_call" {
+			return t.openBlock(w, "tool_use", event.Item.CallID, event.Item.Name)
+		}
+
+	case "response.function_call_arguments.delta":
+		if !t.blockOpen || t.blockType != "tool_use" {
+			return nil
+		}
+		return t.emit(w, "content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": t.blockIndex,
+			"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": event.Delta},
+		})
+
+	case "response.output_item.done":
+		if event.Item.Type == "function_call" && !(t.blockOpen && t.blockCall == event.Item.CallID) {
+			// The call arrived complete, without argument deltas
+			if err := t.openBlock(w, "tool_use", event.Item.CallID, event.Item.Name); err != nil {
+				return err
+			}
+			if err := t.emit(w, "content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": t.blockIndex,
+				"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": event.Item.Arguments},
+			}); err != nil {
+				return err
+			}
+		}
+		return t.closeBlock(w)
+
+	case "response.completed", "response.incomplete":
+		return t.finish(w, event.Response.responsesResponse)
+
+	case "response.failed":
+		message := "upstream response failed"
+		if event.Response.Error != nil && event.Response.Error.Message != "" {
+			message = event.Response.Error.Message
+		}
+		return t.fail(w, message)
+
+	case "error":
+		return t.fail(w, event.Message)
+	}
+
+	return nil
+}
+
+// start emits message_start once
+func (t *StreamTranslator) start(w io.Writer, responseID string) error {
+	if t.started {
+		return nil
+	}
+	t.started = true
+	return t.emit(w, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            messageID(responseID),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         t.model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         Usage{},
+		},
+	})
+}
+
+// openBlock starts a content block unless a matching one is already open
+func (t *StreamTranslator) openBlock(w io.Writer, blockType, callID, name string) error {
+	if err := t.start(w, ""); err != nil {
+		return err
+	}
+	if t.blockOpen && t.blockType == blockType && t.blockCall == callID {
+		return nil
+	}
+	if err := t.closeBlock(w); err != nil {
+		return err
+	}
+
+	block := map[string]interface{}{"type": "text", "text": ""}
+	if blockType == "tool_use" {
+		t.hasToolUse = true
+		block = map[string]interface{}{"type": "tool_use", "id": callID, "name": name, "input": map[string]interface{}{}}
+	}
+	t.blockOpen = true
+	t.blockType = blockType
+	t.blockCall = callID
+	return t.emit(w, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         t.blockIndex,
+		"content_block": block,
+	})
+}
+
+// closeBlock ends the open content block, if any
+func (t *StreamTranslator) closeBlock(w io.Writer) error {
+	if !t.blockOpen {
+		return nil
+	}
+	t.blockOpen = false
+	t.blockCall = ""
+	index := t.blockIndex
+	t.blockIndex++
+	return t.emit(w, "content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": index,
+	})
+}
+
+// finish emits the stop reason and final usage, then message_stop
+func (t *StreamTranslator) finish(w io.Writer, resp responsesResponse) error {
+	if err := t.start(w, resp.ID); err != nil {
+		return err
+	}
+	if err := t.closeBlock(w); err != nil {
+		return err
+	}
+	t.finished = true
+
+	incompleteReason := ""
+	if resp.IncompleteDetails != nil {
+		incompleteReason = resp.IncompleteDetails.Reason
+	}
+	if err := t.emit(w, "message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": stopReason(t.hasToolUse, incompleteReason), "stop_sequence": nil},
+		"usage": convertUsage(resp.Usage.InputTokens, resp.Usage.OutputTokens, resp.Usage.InputTokensDetails.CachedTokens),
+	}); err != nil {
+		return err
+	}
+	return t.emit(w, "message_stop", map[string]interface{}{"type": "message_stop"})
+}
+
+// fail emits an error event and ends the stream
+func (t *StreamTranslator) fail(w io.Writer, message string) error {
+	t.finished = true
+	return t.emit(w, "error", map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": "api_error", "message": message},
+	})
+}
+
+func (t *StreamTranslator) emit(w io.Writer, name string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
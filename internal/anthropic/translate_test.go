@@ -0,0 +1,382 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Fixtures under testdata/ are recorded upstream traffic; each has a
+// .want.* file with the expected translation. Run with -update after an
+// intentional change to the translation and review the diff.
+var update = flag.Bool("update", false, "rewrite the expected translations in testdata")
+
+// fixtures lists the recorded inputs in a testdata directory
+func fixtures(t *testing.T, dir, ext string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", dir, "*"+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs []string
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".want"+ext) {
+			inputs = append(inputs, path)
+		}
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no fixtures in testdata/%s", dir)
+	}
+	return inputs
+}
+
+func wantPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".want" + ext
+}
+
+// compareJSON compares got with the expected JSON file, ignoring formatting
+func compareJSON(t *testing.T, path string, got interface{}) {
+	t.Helper()
+	gotJSON, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile(path, append(gotJSON, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	wantJSON, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue interface{}
+	json.Unmarshal(gotJSON, &gotValue)
+	if err := json.Unmarshal(wantJSON, &wantValue); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("translation differs from %s:\n got: %s", path, gotJSON)
+	}
+}
+
+func readJSON(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return value
+}
+
+func TestToResponsesRequestFixtures(t *testing.T) {
+	for _, path := range fixtures(t, "request", ".json") {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			got, err := ToResponsesRequest(readJSON(t, path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareJSON(t, wantPath(path), got)
+		})
+	}
+}
+
+func TestToResponsesRequestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"no messages", `{"model":"claude-sonnet-4-5","max_tokens":10}`, "messages is required"},
+		{"empty messages", `{"model":"claude-sonnet-4-5","messages":[]}`, "messages is required"},
+		{"system role", `{"model":"claude-sonnet-4-5","messages":[{"role":"system","content":"hi"}]}`, "messages[0].role must be user or assistant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ToResponsesRequest(req)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFromResponsesResponseFixtures(t *testing.T) {
+	for _, path := range fixtures(t, "response", ".json") {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			body, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := FromResponsesResponse(body, "claude-sonnet-4-5")
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareJSON(t, wantPath(path), got)
+		})
+	}
+}
+
+func TestFromResponsesResponseStopReason(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    string
+	}{
+		{"text.json", "end_turn"},
+		{"refusal.json", "end_turn"},
+		{"tool_use.json", "tool_use"},
+		{"max_tokens.json", "max_tokens"},
+	}
+	for _, tt := range tests {
+		body, err := os.ReadFile(filepath.Join("testdata", "response", tt.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := FromResponsesResponse(body, "claude-sonnet-4-5")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["stop_reason"] != tt.want {
+			t.Errorf("%s: stop_reason = %v, want %s", tt.fixture, got["stop_reason"], tt.want)
+		}
+	}
+}
+
+func TestFromResponsesResponseRejectsInvalidBody(t *testing.T) {
+	if _, err := FromResponsesResponse([]byte("<html>bad gateway</html>"), "claude-sonnet-4-5"); err == nil {
+		t.Error("invalid upstream body accepted")
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{400, "invalid_request_error"},
+		{401, "authentication_error"},
+		{402, "permission_error"},
+		{403, "permission_error"},
+		{404, "not_found_error"},
+		{413, "request_too_large"},
+		{429, "rate_limit_error"},
+		{500, "api_error"},
+		{502, "api_error"},
+		{503, "overloaded_error"},
+		{529, "overloaded_error"},
+	}
+	for _, tt := range tests {
+		body := ErrorBody(tt.status, "something went wrong")
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Type  string `json:"type"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != "error" || got.Error.Type != tt.want || got.Error.Message != "something went wrong" {
+			t.Errorf("ErrorBody(%d) = %s, want error type %s", tt.status, data, tt.want)
+		}
+	}
+}
+
+// translateStream feeds a recorded upstream stream through a translator line
+// by line, as the proxy does
+func translateStream(t *testing.T, path string) []byte {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var out bytes.Buffer
+	translator := NewStreamTranslator("claude-sonnet-4-5")
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if err := translator.WriteLine(&out, scanner.Text()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestStreamTranslatorFixtures(t *testing.T) {
+	for _, path := range fixtures(t, "stream", ".sse") {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			got := translateStream(t, path)
+			if *update {
+				if err := os.WriteFile(wantPath(path), got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(wantPath(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("translation differs from %s:\n%s", wantPath(path), got)
+			}
+		})
+	}
+}
+
+// sseEvent is one translated event
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+func parseEvents(t *testing.T, stream []byte) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, chunk := range strings.Split(strings.TrimSpace(string(stream)), "\n\n") {
+		lines := strings.SplitN(chunk, "\n", 2)
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "event: ") || !strings.HasPrefix(lines[1], "data: ") {
+			t.Fatalf("malformed event %q", chunk)
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &data); err != nil {
+			t.Fatalf("event data %q: %v", lines[1], err)
+		}
+		if data["type"] != strings.TrimPrefix(lines[0], "event: ") {
+			t.Errorf("event %s carries type %v", lines[0], data["type"])
+		}
+		events = append(events, sseEvent{name: strings.TrimPrefix(lines[0], "event: "), data: data})
+	}
+	return events
+}
+
+func TestStreamTranslatorEvents(t *testing.T) {
+	tests := []struct {
+		fixture        string
+		wantEvents     []string
+		wantStopReason string
+		wantError      string
+	}{
+		{
+			fixture: "text.sse",
+			wantEvents: []string{"message_start", "content_block_start", "content_block_delta", "content_block_delta",
+				"content_block_stop", "message_delta", "message_stop"},
+			wantStopReason: "end_turn",
+		},
+		{
+			fixture: "tool_use.sse",
+			wantEvents: []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop",
+				"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+				"content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"},
+			wantStopReason: "tool_use",
+		},
+		{
+			fixture: "max_tokens.sse",
+			wantEvents: []string{"message_start", "content_block_start", "content_block_delta",
+				"content_block_stop", "message_delta", "message_stop"},
+			wantStopReason: "max_tokens",
+		},
+		{
+			fixture:    "failed.sse",
+			wantEvents: []string{"message_start", "content_block_start", "content_block_delta", "error"},
+			wantError:  "The model produced invalid content.",
+		},
+		{
+			fixture:    "error.sse",
+			wantEvents: []string{"error"},
+			wantError:  "Rate limit reached for requests",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			events := parseEvents(t, translateStream(t, filepath.Join("testdata", "stream", tt.fixture)))
+
+			var names []string
+			for _, event := range events {
+				names = append(names, event.name)
+			}
+			if !reflect.DeepEqual(names, tt.wantEvents) {
+				t.Fatalf("events = %v, want %v", names, tt.wantEvents)
+			}
+
+			last := events[len(events)-1]
+			if tt.wantError != "" {
+				errorBody, _ := last.data["error"].(map[string]interface{})
+				if errorBody["type"] != "api_error" || errorBody["message"] != tt.wantError {
+					t.Errorf("error event = %v, want api_error %q", last.data, tt.wantError)
+				}
+				return
+			}
+			delta, _ := events[len(events)-2].data["delta"].(map[string]interface{})
+			if delta["stop_reason"] != tt.wantStopReason {
+				t.Errorf("stop_reason = %v, want %s", delta["stop_reason"], tt.wantStopReason)
+			}
+		})
+	}
+}
+
+func TestStreamTranslatorToolUseBlocks(t *testing.T) {
+	events := parseEvents(t, translateStream(t, filepath.Join("testdata", "stream", "tool_use.sse")))
+
+	type toolBlock struct {
+		index int
+		id    string
+		name  string
+		input string
+	}
+	var blocks []toolBlock
+	for _, event := range events {
+		index, _ := event.data["index"].(float64)
+		switch event.name {
+		case "content_block_start":
+			block, _ := event.data["content_block"].(map[string]interface{})
+			if block["type"] == "tool_use" {
+				id, _ := block["id"].(string)
+				name, _ := block["name"].(string)
+				blocks = append(blocks, toolBlock{index: int(index), id: id, name: name})
+			}
+		case "content_block_delta":
+			delta, _ := event.data["delta"].(map[string]interface{})
+			if delta["type"] == "input_json_delta" {
+				if len(blocks) == 0 || blocks[len(blocks)-1].index != int(index) {
+					t.Fatalf("input_json_delta for block %d outside a tool_use block", int(index))
+				}
+				partial, _ := delta["partial_json"].(string)
+				blocks[len(blocks)-1].input += partial
+			}
+		}
+	}
+
+	want := []toolBlock{
+		{index: 1, id: "call_abc", name: "get_weather", input: `{"city":"Paris"}`},
+		{index: 2, id: "call_def", name: "noop", input: `{}`},
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("tool_use blocks = %+v, want %+v", blocks, want)
+	}
+}
@@ -0,0 +1,208 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/logger"
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HoldTTL bounds how long a hold may stay open without being extended. Holds
+// left behind by a crash stop counting against the user's funds once they
+// expire; requests in flight extend theirs with ExtendHold.
+const HoldTTL = 30 * time.Minute
+
+// Hold statuses
+const (
+	HoldStatusHeld     = "held"
+	HoldStatusSettled  = "settled"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// ErrInsufficientFunds is returned when a user cannot cover a requested hold
+var ErrInsufficientFunds = errors.New("insufficient balance to cover estimated cost")
+
+// Reserve places a hold for the estimated maximum cost and tokens of a request
+// once the API key's budget covers input. The user row (or the organization
+// row, for organization keys) and then the key row are locked so concurrent
+// reservations see each other's holds.
+func Reserve(userID uuid.UUID, orgID *uuid.UUID, apiKeyID uint, model string, amount float64, tokens int, input KeyEstimate) (*models.BalanceHold, error) {
+	hold := &models.BalanceHold{
+		UserID:         userID,
+		OrganizationID: orgID,
+		APIKeyID:       apiKeyID,
+		Model:          model,
+		Amount:         amount,
+		Tokens:         tokens,
+		Status:         HoldStatusHeld,
+		ExpiresAt:      time.Now().Add(HoldTTL),
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if orgID != nil {
+			if err := reserveOrganization(tx, hold); err != nil {
+				return err
+			}
+			if err := checkKeyQuota(tx, apiKeyID, input); err != nil {
+				return err
+			}
+			return tx.Create(hold).Error
+		}
+
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "balance").
+			Where("id = ?", userID).
+			First(&user).Error; err != nil {
+			return fmt.Errorf("failed to lock user: %v", err)
+		}
+
+		available, err := availableFunds(tx, user)
+		if err != nil {
+			return err
+		}
+		if amount > available {
+			return ErrInsufficientFunds
+		}
+		if err := checkKeyQuota(tx, apiKeyID, input); err != nil {
+			return err
+		}
+
+		return tx.Create(hold).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// SettleHold closes a hold inside the billing transaction that charged the real cost.
+// Any difference between the hold and the real cost is released with it.
+func SettleHold(tx *gorm.DB, holdID uuid.UUID, cost float64) error {
+	if holdID == uuid.Nil {
+		return nil
+	}
+
+	now := time.Now()
+	return tx.Model(&models.BalanceHold{}).
+		Where("id = ? AND status = ?", holdID, HoldStatusHeld).
+		Updates(map[string]interface{}{
+			"status":         HoldStatusSettled,
+			"settled_amount": cost,
+			"settled_at":     now,
+		}).Error
+}
+
+// ReleaseHold releases a hold that was not settled (failed or aborted request).
+// Releasing a settled or expired hold is a no-op.
+func ReleaseHold(holdID uuid.UUID) {
+	if holdID == uuid.Nil {
+		return
+	}
+
+	if err := database.DB.Model(&models.BalanceHold{}).
+		Where("id = ? AND status = ?", holdID, HoldStatusHeld).
+		Update("status", HoldStatusReleased).Error; err != nil {
+		logger.Component("Billing").Error("failed to release hold", "hold_id", holdID, "error", err)
+	}
+}
+
+// ExtendHold pushes the expiry of an open hold to HoldTTL from now, for
+// requests still running. Extending a closed hold is a no-op.
+func ExtendHold(holdID uuid.UUID) {
+	if holdID == uuid.Nil {
+		return
+	}
+
+	if err := database.DB.Model(&models.BalanceHold{}).
+		Where("id = ? AND status = ?", holdID, HoldStatusHeld).
+		Update("expires_at", time.Now().Add(HoldTTL)).Error; err != nil {
+		logger.Component("Billing").Error("failed to extend hold", "hold_id", holdID, "error", err)
+	}
+}
+
+// availableFunds returns what the user can still spend: balance plus today's
+// remaining package quota, capped by the daily usage limit, minus open holds
+func availableFunds(tx *gorm.DB, user models.User) (float64, error) {
+	today := database.GetToday()
+	now := time.Now()
+
+	available := user.Balance
+
+	var dailyUsage models.DailyUsage
+	hasDailyUsage := tx.Where("user_id = ? AND date = ?", user.ID, today).First(&dailyUsage).Error == nil
+
+	var activePackage models.UserPackage
+	if err := tx.Where("user_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		user.ID, "active", today, today).
+		Order("end_date ASC").
+		First(&activePackage).Error; err == nil {
+		remaining := activePackage.DailyLimit
+		if hasDailyUsage {
+			remaining -= dailyUsage.UsedAmount
+		}
+		if remaining > 0 {
+			available += remaining
+		}
+	}
+
+	var settings models.SystemSettings
+	if err := tx.Select("user_daily_usage_limit").First(&settings).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("failed to get daily usage limit: %v", err)
+	}
+	if settings.UserDailyUsageLimit != nil {
+		limitRemaining := *settings.UserDailyUsageLimit
+		if hasDailyUsage {
+			limitRemaining -= dailyUsage.TotalUsedAmount
+		}
+		if limitRemaining < available {
+			available = limitRemaining
+		}
+	}
+
+	var held float64
+	if err := tx.Model(&models.BalanceHold{}).
+		Where("user_id = ? AND organization_id IS NULL AND status = ? AND expires_at > ?", user.ID, HoldStatusHeld, now).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&held).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum holds: %v", err)
+	}
+
+	return available - held, nil
+}
+
+// ExpireStaleHolds marks holds past their expiry as expired
+func ExpireStaleHolds() error {
+	result := database.DB.Model(&models.BalanceHold{}).
+		Where("status = ? AND expires_at <= ?", HoldStatusHeld, time.Now()).
+		Update("status", HoldStatusExpired)
+	if result.Error != nil {
+		return fmt.Errorf("failed to expire holds: %v", result.Error)
+	}
+
+	if result.RowsAffected > 0 {
+		logger.Component("Billing").Info("expired stale holds", "count", result.RowsAffected)
+	}
+	return nil
+}
+
+// StartHoldExpirationJob starts a background job that expires stale holds
+func StartHoldExpirationJob() {
+	ticker := time.NewTicker(1 * time.Minute)
+	go func() {
+		for range ticker.C {
+			if err := ExpireStaleHolds(); err != nil {
+				logger.Component("Billing").Error("failed to expire holds", "error", err)
+			}
+		}
+	}()
+}
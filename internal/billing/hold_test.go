@@ -0,0 +1,168 @@
+package billing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func useDB(t *testing.T) {
+	t.Helper()
+	databasetest.Use(t,
+		&models.User{}, &models.APIKey{}, &models.UsageLog{}, &models.BalanceHold{},
+		&models.DailyUsage{}, &models.UserPackage{}, &models.SystemSettings{},
+		&models.Organization{}, &models.OrganizationMember{}, &models.OrganizationPackage{},
+	)
+}
+
+func create(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := database.DB.Create(value).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance float64
+		held    float64
+		amount  float64
+		wantErr error
+	}{
+		{name: "covered by the balance", balance: 1, amount: 0.5},
+		{name: "covered after open holds", balance: 1, held: 0.4, amount: 0.6},
+		{name: "more than the balance", balance: 1, amount: 1.5, wantErr: ErrInsufficientFunds},
+		{name: "more than left after open holds", balance: 1, held: 0.8, amount: 0.5, wantErr: ErrInsufficientFunds},
+		{name: "unpriced model", balance: 0, amount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useDB(t)
+			user := models.User{Email: "user@example.com", Balance: tt.balance}
+			create(t, &user)
+			if tt.held > 0 {
+				create(t, &models.BalanceHold{UserID: user.ID, APIKeyID: 1, Amount: tt.held, Status: HoldStatusHeld, ExpiresAt: time.Now().Add(HoldTTL)})
+			}
+
+			key := models.APIKey{UserID: user.ID, KeyHash: "hash", KeyPrefix: "sk-test"}
+			create(t, &key)
+
+			hold, err := Reserve(user.ID, nil, key.ID, "gpt-5.1", tt.amount, 1000, KeyEstimate{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (hold.ID == uuid.Nil || hold.Amount != tt.amount || hold.Tokens != 1000) {
+				t.Errorf("hold = %+v, want %v and 1000 tokens held", hold, tt.amount)
+			}
+		})
+	}
+}
+
+func TestReserveMemberSpendLimit(t *testing.T) {
+	limit := func(f float64) *float64 { return &f }
+	tests := []struct {
+		name    string
+		limit   *float64
+		spent   float64
+		held    float64
+		amount  float64
+		wantErr error
+	}{
+		{name: "no limit", spent: 50, amount: 1},
+		{name: "under the limit", limit: limit(10), spent: 5, amount: 4},
+		{name: "would pass the limit", limit: limit(10), spent: 5, amount: 6, wantErr: ErrMemberSpendLimit},
+		{name: "open holds count", limit: limit(10), spent: 5, held: 4, amount: 2, wantErr: ErrMemberSpendLimit},
+		{name: "unpriced model under the limit", limit: limit(10), spent: 5, amount: 0},
+		{name: "unpriced model at the limit", limit: limit(10), spent: 10, amount: 0, wantErr: ErrMemberSpendLimit},
+		{name: "unpriced model over the limit", limit: limit(10), spent: 12, amount: 0, wantErr: ErrMemberSpendLimit},
+		{name: "more than the organization holds", spent: 0, amount: 200, wantErr: ErrInsufficientFunds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useDB(t)
+			user := models.User{Email: "member@example.com"}
+			create(t, &user)
+			org := models.Organization{Name: "Acme", Balance: 100}
+			create(t, &org)
+			create(t, &models.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: "member", DailySpendLimit: tt.limit})
+			if tt.spent > 0 {
+				create(t, &models.UsageLog{
+					UserID: user.ID, APIKeyID: 1, OrganizationID: &org.ID, Cost: tt.spent,
+					CreatedAt: time.Now().In(database.AsiaShanghai),
+				})
+			}
+			if tt.held > 0 {
+				create(t, &models.BalanceHold{UserID: user.ID, APIKeyID: 1, OrganizationID: &org.ID, Amount: tt.held, Status: HoldStatusHeld, ExpiresAt: time.Now().Add(HoldTTL)})
+			}
+
+			key := models.APIKey{UserID: user.ID, OrganizationID: &org.ID, KeyHash: "hash", KeyPrefix: "sk-test"}
+			create(t, &key)
+
+			_, err := Reserve(user.ID, &org.ID, key.ID, "gpt-5.1", tt.amount, 1000, KeyEstimate{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Reserve = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtendHold(t *testing.T) {
+	tests := []struct {
+		status     string
+		wantExtend bool
+	}{
+		{HoldStatusHeld, true},
+		{HoldStatusSettled, false},
+		{HoldStatusReleased, false},
+		{HoldStatusExpired, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			useDB(t)
+			expiresAt := time.Now().Add(time.Minute)
+			hold := models.BalanceHold{UserID: uuid.New(), APIKeyID: 1, Amount: 1, Status: tt.status, ExpiresAt: expiresAt}
+			create(t, &hold)
+
+			ExtendHold(hold.ID)
+
+			var got models.BalanceHold
+			if err := database.DB.First(&got, "id = ?", hold.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			extended := got.ExpiresAt.After(time.Now().Add(HoldTTL - time.Minute))
+			if extended != tt.wantExtend {
+				t.Errorf("expires at %v, extended = %v, want %v", got.ExpiresAt, extended, tt.wantExtend)
+			}
+		})
+	}
+}
+
+func TestExtendedHoldOutlivesTTL(t *testing.T) {
+	useDB(t)
+	hold := models.BalanceHold{UserID: uuid.New(), APIKeyID: 1, Amount: 1, Status: HoldStatusHeld, ExpiresAt: time.Now().Add(-time.Second)}
+	create(t, &hold)
+	stale := models.BalanceHold{UserID: uuid.New(), APIKeyID: 1, Amount: 1, Status: HoldStatusHeld, ExpiresAt: time.Now().Add(-time.Second)}
+	create(t, &stale)
+
+	ExtendHold(hold.ID)
+	if err := ExpireStaleHolds(); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[uuid.UUID]string{hold.ID: HoldStatusHeld, stale.ID: HoldStatusExpired} {
+		var got models.BalanceHold
+		if err := database.DB.First(&got, "id = ?", id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != want {
+			t.Errorf("hold %s status = %s, want %s", id, got.Status, want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// API key budget units
+const (
+	QuotaTypeCost   = "cost"
+	QuotaTypeTokens = "tokens"
+)
+
+// API key budget periods. Windows reset at midnight in the quota timezone (UTC
+// unless set with SetQuotaTimezone); weeks start on Monday.
+const (
+	QuotaPeriodLifetime = "lifetime"
+	QuotaPeriodDaily    = "daily"
+	QuotaPeriodWeekly   = "weekly"
+	QuotaPeriodMonthly  = "monthly"
+)
+
+// quotaLocation is the timezone budget periods reset in
+var quotaLocation = time.UTC
+
+// SetQuotaTimezone sets the IANA timezone API key budget periods reset in.
+// An empty name keeps UTC. Call it before serving requests.
+func SetQuotaTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	quotaLocation = loc
+	return nil
+}
+
+// ErrKeyQuotaExceeded is returned when a request would exceed its API key's budget
+var ErrKeyQuotaExceeded = errors.New("api key quota exceeded")
+
+// KeyBudget describes an API key's budget in its current period
+type KeyBudget struct {
+	Type      string     `json:"type"`
+	Period    string     `json:"period"`
+	Limit     *float64   `json:"limit"` // nil = unlimited
+	Used      float64    `json:"used"`
+	Remaining *float64   `json:"remaining"`
+	ResetsAt  *time.Time `json:"resets_at"` // nil for lifetime budgets
+}
+
+// Exhausted reports whether nothing remains of the budget
+func (b KeyBudget) Exhausted() bool {
+	return b.Remaining != nil && *b.Remaining <= 0
+}
+
+// ValidateKeyQuota normalizes and checks a key's budget settings
+func ValidateKeyQuota(key *models.APIKey) error {
+	if key.QuotaType == "" {
+		key.QuotaType = QuotaTypeCost
+	}
+	if key.QuotaPeriod == "" {
+		key.QuotaPeriod = QuotaPeriodLifetime
+	}
+	if key.QuotaType != QuotaTypeCost && key.QuotaType != QuotaTypeTokens {
+		return fmt.Errorf("quota_type must be cost or tokens")
+	}
+	switch key.QuotaPeriod {
+	case QuotaPeriodLifetime, QuotaPeriodDaily, QuotaPeriodWeekly, QuotaPeriodMonthly:
+	default:
+		return fmt.Errorf("quota_period must be lifetime, daily, weekly or monthly")
+	}
+	if key.QuotaLimit != nil && *key.QuotaLimit < 0 {
+		return fmt.Errorf("quota_limit must not be negative")
+	}
+	return nil
+}
+
+// QuotaPeriodStart returns the start of the period containing now, or nil for
+// lifetime budgets. Periods follow the quota timezone.
+func QuotaPeriodStart(period string, now time.Time) *time.Time {
+	now = now.In(quotaLocation)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, quotaLocation)
+
+	var start time.Time
+	switch period {
+	case QuotaPeriodDaily:
+		start = day
+	case QuotaPeriodWeekly:
+		start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case QuotaPeriodMonthly:
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, quotaLocation)
+	default:
+		return nil
+	}
+	return &start
+}
+
+// quotaPeriodEnd returns when the period starting at start resets
+func quotaPeriodEnd(period string, start time.Time) time.Time {
+	switch period {
+	case QuotaPeriodDaily:
+		return start.AddDate(0, 0, 1)
+	case QuotaPeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// GetKeyBudget returns the key's budget as of now. Usage recorded in an
+// earlier period counts as zero.
+func GetKeyBudget(key *models.APIKey, now time.Time) KeyBudget {
+	budget := KeyBudget{
+		Type:   key.QuotaType,
+		Period: key.QuotaPeriod,
+		Limit:  key.QuotaLimit,
+		Used:   key.QuotaUsed,
+	}
+	if budget.Type == "" {
+		budget.Type = QuotaTypeCost
+	}
+	if budget.Period == "" {
+		budget.Period = QuotaPeriodLifetime
+	}
+
+	if start := QuotaPeriodStart(budget.Period, now); start != nil {
+		if key.QuotaPeriodStart == nil || !key.QuotaPeriodStart.Equal(*start) {
+			budget.Used = 0
+		}
+		resetsAt := quotaPeriodEnd(budget.Period, *start)
+		budget.ResetsAt = &resetsAt
+	}
+
+	if budget.Limit != nil {
+		remaining := *budget.Limit - budget.Used
+		budget.Remaining = &remaining
+	}
+	return budget
+}
+
+// KeyEstimate is what a request must fit in its API key's budget before it is
+// forwarded: its estimated input
+type KeyEstimate struct {
+	Cost   float64
+	Tokens int
+}
+
+// checkKeyQuota rejects a request whose key budget cannot cover its estimate.
+// It runs inside Reserve's transaction with the key row locked, so the key's
+// open holds, which count against the budget, include every concurrent request.
+func checkKeyQuota(tx *gorm.DB, keyID uint, estimate KeyEstimate) error {
+	var key models.APIKey
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "quota_limit", "quota_type", "quota_period", "quota_used", "quota_period_start").
+		Where("id = ?", keyID).
+		First(&key).Error; err != nil {
+		return fmt.Errorf("failed to lock api key: %v", err)
+	}
+
+	budget := GetKeyBudget(&key, time.Now())
+	if budget.Remaining == nil {
+		return nil
+	}
+
+	column := "tokens"
+	needed := float64(estimate.Tokens)
+	if budget.Type == QuotaTypeCost {
+		column = "amount"
+		needed = estimate.Cost
+	}
+
+	var held float64
+	if err := tx.Model(&models.BalanceHold{}).
+		Where("api_key_id = ? AND status = ? AND expires_at > ?", key.ID, HoldStatusHeld, time.Now()).
+		Select("COALESCE(SUM(" + column + "), 0)").
+		Scan(&held).Error; err != nil {
+		return fmt.Errorf("failed to sum key holds: %v", err)
+	}
+	remaining := *budget.Remaining - held
+
+	if remaining <= 0 || needed > remaining {
+		return ErrKeyQuotaExceeded
+	}
+	return nil
+}
+
+// ChargeKeyQuota adds a billed request to its key's budget, starting a new
+// period when the previous one has ended. The charge is unconditional: the
+// upstream has already served the request.
+func ChargeKeyQuota(tx *gorm.DB, keyID uint, cost float64, tokens int) error {
+	var key models.APIKey
+	// Unscoped: a key deleted mid-request is still billed
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "quota_type", "quota_period", "quota_used", "quota_period_start").
+		Where("id = ?", keyID).
+		First(&key).Error; err != nil {
+		return fmt.Errorf("failed to lock api key: %v", err)
+	}
+
+	amount := cost
+	if key.QuotaType == QuotaTypeTokens {
+		amount = float64(tokens)
+	}
+
+	now := time.Now()
+	used := GetKeyBudget(&key, now).Used + amount
+	return tx.Unscoped().Model(&models.APIKey{}).
+		Where("id = ?", keyID).
+		Updates(map[string]interface{}{
+			"quota_used":         used,
+			"quota_period_start": QuotaPeriodStart(key.QuotaPeriod, now),
+			"total_usage":        gorm.Expr("total_usage + ?", tokens),
+		}).Error
+}
@@ -0,0 +1,142 @@
+package billing
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestReserveKeyQuota(t *testing.T) {
+	limit := func(f float64) *float64 { return &f }
+	tests := []struct {
+		name       string
+		quotaType  string
+		limit      *float64
+		used       float64
+		heldAmount float64
+		heldTokens int
+		expired    bool
+		cost       float64
+		tokens     int
+		wantErr    error
+	}{
+		{name: "unlimited", quotaType: QuotaTypeTokens, used: 1e9, heldTokens: 1e6, tokens: 1000},
+		{name: "tokens within budget", quotaType: QuotaTypeTokens, limit: limit(10000), used: 2000, tokens: 1000},
+		{name: "tokens over budget", quotaType: QuotaTypeTokens, limit: limit(10000), used: 9500, tokens: 1000, wantErr: ErrKeyQuotaExceeded},
+		{name: "tokens held by other requests", quotaType: QuotaTypeTokens, limit: limit(10000), used: 2000, heldTokens: 7500, tokens: 1000, wantErr: ErrKeyQuotaExceeded},
+		{name: "tokens held by expired holds", quotaType: QuotaTypeTokens, limit: limit(10000), used: 2000, heldTokens: 7500, expired: true, tokens: 1000},
+		{name: "token budget ignores held cost", quotaType: QuotaTypeTokens, limit: limit(10000), heldAmount: 1e6, tokens: 1000},
+		{name: "cost within budget", quotaType: QuotaTypeCost, limit: limit(5), used: 2, cost: 1},
+		{name: "cost held by other requests", quotaType: QuotaTypeCost, limit: limit(5), used: 2, heldAmount: 2.5, cost: 1, wantErr: ErrKeyQuotaExceeded},
+		{name: "cost budget ignores held tokens", quotaType: QuotaTypeCost, limit: limit(5), heldTokens: 1e6, cost: 1},
+		{name: "budget spent", quotaType: QuotaTypeCost, limit: limit(5), used: 5, wantErr: ErrKeyQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useDB(t)
+			user := models.User{Email: "user@example.com", Balance: 1e6}
+			create(t, &user)
+			key := models.APIKey{
+				UserID: user.ID, KeyHash: "hash", KeyPrefix: "sk-test",
+				QuotaType: tt.quotaType, QuotaPeriod: QuotaPeriodLifetime, QuotaLimit: tt.limit, QuotaUsed: tt.used,
+			}
+			create(t, &key)
+			if tt.heldAmount > 0 || tt.heldTokens > 0 {
+				expiresAt := time.Now().Add(HoldTTL)
+				if tt.expired {
+					expiresAt = time.Now().Add(-time.Second)
+				}
+				create(t, &models.BalanceHold{
+					UserID: uuid.New(), APIKeyID: key.ID, Amount: tt.heldAmount, Tokens: tt.heldTokens,
+					Status: HoldStatusHeld, ExpiresAt: expiresAt,
+				})
+			}
+
+			input := KeyEstimate{Cost: tt.cost, Tokens: tt.tokens}
+			if _, err := Reserve(user.ID, nil, key.ID, "gpt-5.1", tt.cost, tt.tokens, input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Reserve = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReserveKeyQuotaConcurrently(t *testing.T) {
+	useDB(t)
+	user := models.User{Email: "user@example.com", Balance: 1e6}
+	create(t, &user)
+	limit := 10000.0
+	key := models.APIKey{
+		UserID: user.ID, KeyHash: "hash", KeyPrefix: "sk-test",
+		QuotaType: QuotaTypeTokens, QuotaPeriod: QuotaPeriodLifetime, QuotaLimit: &limit,
+	}
+	create(t, &key)
+
+	// Each request holds 3000 tokens and needs 1500 left for its input, so only
+	// three fit in the budget
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Reserve(user.ID, nil, key.ID, "gpt-5.1", 0, 3000, KeyEstimate{Tokens: 1500})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	reserved := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			reserved++
+		case !errors.Is(err, ErrKeyQuotaExceeded):
+			t.Fatal(err)
+		}
+	}
+	if reserved != 3 {
+		t.Errorf("reserved %d holds, want 3", reserved)
+	}
+}
+
+func TestQuotaPeriodStart(t *testing.T) {
+	t.Cleanup(func() { quotaLocation = time.UTC })
+	// Sunday 2026-03-01 20:00 UTC is Monday 04:00 in Shanghai
+	now := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		timezone string
+		period   string
+		want     string // RFC 3339, empty for none
+	}{
+		{"", QuotaPeriodLifetime, ""},
+		{"", QuotaPeriodDaily, "2026-03-01T00:00:00Z"},
+		{"", QuotaPeriodWeekly, "2026-02-23T00:00:00Z"},
+		{"", QuotaPeriodMonthly, "2026-03-01T00:00:00Z"},
+		{"Asia/Shanghai", QuotaPeriodDaily, "2026-03-02T00:00:00+08:00"},
+		{"Asia/Shanghai", QuotaPeriodWeekly, "2026-03-02T00:00:00+08:00"},
+		{"Asia/Shanghai", QuotaPeriodMonthly, "2026-03-01T00:00:00+08:00"},
+	}
+	for _, tt := range tests {
+		quotaLocation = time.UTC
+		if err := SetQuotaTimezone(tt.timezone); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if start := QuotaPeriodStart(tt.period, now); start != nil {
+			got = start.Format(time.RFC3339)
+		}
+		if got != tt.want {
+			t.Errorf("%q %s: QuotaPeriodStart = %q, want %q", tt.timezone, tt.period, got, tt.want)
+		}
+	}
+
+	if err := SetQuotaTimezone("Mars/Olympus"); err == nil {
+		t.Error("SetQuotaTimezone accepted an unknown timezone")
+	}
+}
@@ -0,0 +1,221 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMemberSpendLimit is returned when a request would exceed the member's
+// daily spend cap in their organization
+var ErrMemberSpendLimit = errors.New("organization member daily spend limit exceeded")
+
+// DeductOrganizationCost deducts cost from the organization's package quota or balance
+func DeductOrganizationCost(tx *gorm.DB, orgID uuid.UUID, cost float64) error {
+	return deductOrganizationCost(tx, orgID, cost, false)
+}
+
+// DeductDeliveredOrganizationCost charges an organization for a request whose
+// response was already delivered; past the package quota the balance goes negative
+func DeductDeliveredOrganizationCost(tx *gorm.DB, orgID uuid.UUID, cost float64) error {
+	return deductOrganizationCost(tx, orgID, cost, true)
+}
+
+func deductOrganizationCost(tx *gorm.DB, orgID uuid.UUID, cost float64, allowDebt bool) error {
+	if cost <= 0 {
+		return nil
+	}
+
+	today := database.GetToday()
+
+	// Ensure daily usage record exists for total usage tracking
+	dailyUsage := models.OrganizationDailyUsage{
+		OrganizationID: orgID,
+		Date:           today,
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "date"}},
+		DoNothing: true,
+	}).Create(&dailyUsage).Error; err != nil {
+		return fmt.Errorf("failed to upsert organization daily usage: %v", err)
+	}
+
+	if err := tx.Model(&models.OrganizationDailyUsage{}).
+		Where("organization_id = ? AND date = ?", orgID, today).
+		Update("total_used_amount", gorm.Expr("total_used_amount + ?", cost)).Error; err != nil {
+		return fmt.Errorf("failed to update organization daily total usage: %v", err)
+	}
+
+	// Use the shared package quota first
+	activePackage, err := activeOrganizationPackage(tx, orgID, today)
+	if err == nil {
+		if err := tx.Where("organization_id = ? AND date = ?", orgID, today).First(&dailyUsage).Error; err != nil {
+			return fmt.Errorf("failed to get organization daily usage: %v", err)
+		}
+
+		if dailyUsage.OrganizationPackageID == nil || *dailyUsage.OrganizationPackageID != activePackage.ID {
+			if err := tx.Model(&models.OrganizationDailyUsage{}).
+				Where("id = ?", dailyUsage.ID).
+				Update("organization_package_id", activePackage.ID).Error; err != nil {
+				return fmt.Errorf("failed to update organization daily usage package: %v", err)
+			}
+		}
+
+		remaining := activePackage.DailyLimit - dailyUsage.UsedAmount
+		if remaining > 0 {
+			covered := cost
+			if remaining < cost {
+				covered = remaining
+			}
+			result := tx.Model(&models.OrganizationDailyUsage{}).
+				Where("id = ? AND used_amount + ? <= ?", dailyUsage.ID, covered, activePackage.DailyLimit).
+				Update("used_amount", gorm.Expr("used_amount + ?", covered))
+			if result.Error != nil {
+				return fmt.Errorf("failed to update organization daily usage: %v", result.Error)
+			}
+			// Quota consumed concurrently falls back to the balance
+			if result.RowsAffected > 0 {
+				cost -= covered
+			}
+		}
+		if cost <= 0 {
+			return nil
+		}
+	}
+
+	var result *gorm.DB
+	if allowDebt {
+		result = tx.Exec("UPDATE organizations SET balance = balance - ? WHERE id = ?", cost, orgID)
+	} else {
+		result = tx.Exec("UPDATE organizations SET balance = balance - ? WHERE id = ? AND balance >= ?", cost, orgID, cost)
+	}
+	if result.Error != nil {
+		return fmt.Errorf("failed to update organization balance: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("insufficient balance")
+	}
+
+	return nil
+}
+
+// OrganizationHasFunds reports whether the organization has balance or an active package
+func OrganizationHasFunds(orgID uuid.UUID) bool {
+	var org models.Organization
+	if err := database.DB.Select("id", "balance").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return false
+	}
+	if org.Balance > 0 {
+		return true
+	}
+	_, err := activeOrganizationPackage(database.DB, orgID, database.GetToday())
+	return err == nil
+}
+
+// reserveOrganization places a hold against organization funds, enforcing the
+// member's daily spend cap. The organization row is locked so concurrent
+// reservations see each other's holds.
+func reserveOrganization(tx *gorm.DB, hold *models.BalanceHold) error {
+	orgID := *hold.OrganizationID
+
+	var org models.Organization
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "balance").
+		Where("id = ?", orgID).
+		First(&org).Error; err != nil {
+		return fmt.Errorf("failed to lock organization: %v", err)
+	}
+
+	available, err := availableOrganizationFunds(tx, org)
+	if err != nil {
+		return err
+	}
+	if hold.Amount > available {
+		return ErrInsufficientFunds
+	}
+
+	var member models.OrganizationMember
+	if err := tx.Select("daily_spend_limit").
+		Where("organization_id = ? AND user_id = ?", orgID, hold.UserID).
+		First(&member).Error; err != nil {
+		return fmt.Errorf("failed to get organization member: %v", err)
+	}
+	if member.DailySpendLimit != nil {
+		spent, err := MemberSpendToday(tx, orgID, hold.UserID)
+		if err != nil {
+			return err
+		}
+		// A member at the cap cannot start requests, even unpriced ones
+		if spent >= *member.DailySpendLimit || spent+hold.Amount > *member.DailySpendLimit {
+			return ErrMemberSpendLimit
+		}
+	}
+
+	return nil
+}
+
+// MemberSpendToday returns what a member has spent of the organization's funds
+// today, including the member's open holds
+func MemberSpendToday(tx *gorm.DB, orgID, userID uuid.UUID) (float64, error) {
+	var spent, held float64
+	if err := tx.Model(&models.UsageLog{}).
+		Where("organization_id = ? AND user_id = ? AND created_at >= ?", orgID, userID, database.GetToday()).
+		Select("COALESCE(SUM(cost), 0)").
+		Scan(&spent).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum member spend: %v", err)
+	}
+	if err := tx.Model(&models.BalanceHold{}).
+		Where("organization_id = ? AND user_id = ? AND status = ? AND expires_at > ?", orgID, userID, HoldStatusHeld, time.Now()).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&held).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum member holds: %v", err)
+	}
+	return spent + held, nil
+}
+
+// availableOrganizationFunds returns what the organization can still spend:
+// balance plus today's remaining package quota, minus open holds
+func availableOrganizationFunds(tx *gorm.DB, org models.Organization) (float64, error) {
+	today := database.GetToday()
+	available := org.Balance
+
+	if activePackage, err := activeOrganizationPackage(tx, org.ID, today); err == nil {
+		remaining := activePackage.DailyLimit
+		var dailyUsage models.OrganizationDailyUsage
+		if tx.Where("organization_id = ? AND date = ?", org.ID, today).First(&dailyUsage).Error == nil {
+			remaining -= dailyUsage.UsedAmount
+		}
+		if remaining > 0 {
+			available += remaining
+		}
+	}
+
+	var held float64
+	if err := tx.Model(&models.BalanceHold{}).
+		Where("organization_id = ? AND status = ? AND expires_at > ?", org.ID, HoldStatusHeld, time.Now()).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&held).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum organization holds: %v", err)
+	}
+
+	return available - held, nil
+}
+
+// activeOrganizationPackage returns the organization's package ending soonest among those active today
+func activeOrganizationPackage(tx *gorm.DB, orgID uuid.UUID, today time.Time) (*models.OrganizationPackage, error) {
+	var pkg models.OrganizationPackage
+	if err := tx.Where("organization_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		orgID, "active", today, today).
+		Order("end_date ASC").
+		First(&pkg).Error; err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"codex-gateway/internal/database"
+	"codex-gateway/internal/logger"
 	"codex-gateway/internal/models"
 
 	"github.com/google/uuid"
@@ -15,6 +16,18 @@ import (
 
 // DeductCost deducts cost from user's package quota or balance
 func DeductCost(tx *gorm.DB, userID uuid.UUID, cost float64) error {
+	return deductCost(tx, userID, cost, false)
+}
+
+// DeductDeliveredCost charges a request whose response was already delivered,
+// such as a finished stream. It cannot be refused: past the daily usage limit
+// and the package quota the balance goes negative, a debt that blocks further
+// requests until it is topped up.
+func DeductDeliveredCost(tx *gorm.DB, userID uuid.UUID, cost float64) error {
+	return deductCost(tx, userID, cost, true)
+}
+
+func deductCost(tx *gorm.DB, userID uuid.UUID, cost float64, allowDebt bool) error {
 	if cost <= 0 {
 		return nil
 	}
@@ -43,7 +56,7 @@ func DeductCost(tx *gorm.DB, userID uuid.UUID, cost float64) error {
 		return fmt.Errorf("failed to get daily usage limit: %v", err)
 	}
 
-	if settings.UserDailyUsageLimit != nil {
+	if settings.UserDailyUsageLimit != nil && !allowDebt {
 		limit := *settings.UserDailyUsageLimit
 		result := tx.Model(&models.DailyUsage{}).
 			Where("user_id = ? AND date = ? AND total_used_amount + ? <= ?", userID, today, cost, limit).
@@ -98,10 +111,14 @@ func DeductCost(tx *gorm.DB, userID uuid.UUID, cost float64) error {
 			if result.Error != nil {
 				return fmt.Errorf("failed to update daily usage: %v", result.Error)
 			}
-			if result.RowsAffected == 0 {
+			if result.RowsAffected > 0 {
+				return nil
+			}
+			// A delivered response falls back to the balance when the quota was
+			// consumed concurrently
+			if !allowDebt {
 				return fmt.Errorf("concurrent update conflict or quota exceeded")
 			}
-			return nil
 		} else if remaining > 0 {
 			// Use remaining quota, then deduct from balance
 			// Use atomic update with condition to prevent concurrent over-use
@@ -123,7 +140,12 @@ func DeductCost(tx *gorm.DB, userID uuid.UUID, cost float64) error {
 	}
 
 	// Deduct from balance using atomic operation
-	result := tx.Exec("UPDATE users SET balance = balance - ? WHERE id = ? AND balance >= ?", cost, userID, cost)
+	var result *gorm.DB
+	if allowDebt {
+		result = tx.Exec("UPDATE users SET balance = balance - ? WHERE id = ?", cost, userID)
+	} else {
+		result = tx.Exec("UPDATE users SET balance = balance - ? WHERE id = ? AND balance >= ?", cost, userID, cost)
+	}
 	if result.Error != nil {
 		return fmt.Errorf("failed to update balance: %v", result.Error)
 	}
@@ -134,6 +156,45 @@ func DeductCost(tx *gorm.DB, userID uuid.UUID, cost float64) error {
 	return nil
 }
 
+// HasFunds reports whether the payer for a request has balance or an active
+// package: the organization when orgID is set, the user otherwise
+func HasFunds(user models.User, orgID *uuid.UUID) bool {
+	if orgID != nil {
+		return OrganizationHasFunds(*orgID)
+	}
+	if user.Balance > 0 {
+		return true
+	}
+
+	today := database.GetToday()
+	var activePackage models.UserPackage
+	return database.DB.Where("user_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		user.ID, "active", today, today).
+		First(&activePackage).Error == nil
+}
+
+// ActivePackageID returns the package behind the payer's active package ending
+// soonest, the package billing draws from first, or 0 when none is active
+func ActivePackageID(userID uuid.UUID, orgID *uuid.UUID) uint {
+	today := database.GetToday()
+	if orgID != nil {
+		pkg, err := activeOrganizationPackage(database.DB, *orgID, today)
+		if err != nil {
+			return 0
+		}
+		return pkg.PackageID
+	}
+
+	var activePackage models.UserPackage
+	if err := database.DB.Where("user_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		userID, "active", today, today).
+		Order("end_date ASC").
+		First(&activePackage).Error; err != nil {
+		return 0
+	}
+	return activePackage.PackageID
+}
+
 // CheckAndExpirePackages checks and expires packages that have passed their end date
 func CheckAndExpirePackages() error {
 	today := database.GetToday()
@@ -147,7 +208,19 @@ func CheckAndExpirePackages() error {
 	}
 
 	if result.RowsAffected > 0 {
-		fmt.Printf("Expired %d packages\n", result.RowsAffected)
+		logger.Component("Billing").Info("expired packages", "count", result.RowsAffected)
+	}
+
+	result = database.DB.Model(&models.OrganizationPackage{}).
+		Where("status = ? AND end_date < ?", "active", today).
+		Update("status", "expired")
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to expire organization packages: %v", result.Error)
+	}
+
+	if result.RowsAffected > 0 {
+		logger.Component("Billing").Info("expired organization packages", "count", result.RowsAffected)
 	}
 
 	return nil
@@ -159,7 +232,7 @@ func StartPackageExpirationJob() {
 	go func() {
 		for range ticker.C {
 			if err := CheckAndExpirePackages(); err != nil {
-				fmt.Printf("Error expiring packages: %v\n", err)
+				logger.Component("Billing").Error("failed to expire packages", "error", err)
 			}
 		}
 	}()
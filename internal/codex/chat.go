@@ -0,0 +1,320 @@
+package codex
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChatToResponsesRequest converts a chat completions request body into a
+// Responses API request body. System and developer messages become the
+// instructions; everything else becomes input items.
+func ChatToResponsesRequest(req map[string]interface{}) (map[string]interface{}, error) {
+	messages, ok := req["messages"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("messages is required")
+	}
+
+	out := map[string]interface{}{}
+	for _, field := range []string{"model", "stream", "temperature", "top_p", "parallel_tool_calls", "user"} {
+		if v, ok := req[field]; ok {
+			out[field] = v
+		}
+	}
+	for _, field := range []string{"max_completion_tokens", "max_tokens"} {
+		if v, ok := req[field].(float64); ok && v > 0 {
+			out["max_output_tokens"] = v
+			break
+		}
+	}
+	if effort, ok := req["reasoning_effort"].(string); ok && effort != "" {
+		out["reasoning"] = map[string]interface{}{"effort": effort}
+	}
+
+	var instructions []string
+	var input []interface{}
+	for i, raw := range messages {
+		msg, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("messages[%d] must be an object", i)
+		}
+		role, _ := msg["role"].(string)
+		switch role {
+		case "system", "developer":
+			if text := contentText(msg["content"]); text != "" {
+				instructions = append(instructions, text)
+			}
+		case "user":
+			input = append(input, map[string]interface{}{
+				"type":    "message",
+				"role":    "user",
+				"content": userContent(msg["content"]),
+			})
+		case "assistant":
+			if text := contentText(msg["content"]); text != "" {
+				input = append(input, map[string]interface{}{
+					"type":    "message",
+					"role":    "assistant",
+					"content": []interface{}{map[string]interface{}{"type": "output_text", "text": text}},
+				})
+			}
+			calls, _ := msg["tool_calls"].([]interface{})
+			for _, rawCall := range calls {
+				call, ok := rawCall.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				fn, _ := call["function"].(map[string]interface{})
+				arguments, _ := fn["arguments"].(string)
+				input = append(input, map[string]interface{}{
+					"type":      "function_call",
+					"call_id":   call["id"],
+					"name":      fn["name"],
+					"arguments": arguments,
+				})
+			}
+		case "tool":
+			input = append(input, map[string]interface{}{
+				"type":    "function_call_output",
+				"call_id": msg["tool_call_id"],
+				"output":  contentText(msg["content"]),
+			})
+		default:
+			return nil, fmt.Errorf("messages[%d].role %q is not supported", i, role)
+		}
+	}
+	out["input"] = input
+	if len(instructions) > 0 {
+		out["instructions"] = strings.Join(instructions, "\n\n")
+	}
+
+	if tools, ok := req["tools"].([]interface{}); ok && len(tools) > 0 {
+		converted := make([]interface{}, 0, len(tools))
+		for _, raw := range tools {
+			tool, ok := raw.(map[string]interface{})
+			if !ok || tool["type"] != "function" {
+				continue
+			}
+			fn, _ := tool["function"].(map[string]interface{})
+			item := map[string]interface{}{"type": "function", "name": fn["name"]}
+			for _, field := range []string{"description", "parameters", "strict"} {
+				if v, ok := fn[field]; ok {
+					item[field] = v
+				}
+			}
+			converted = append(converted, item)
+		}
+		out["tools"] = converted
+	}
+
+	switch choice := req["tool_choice"].(type) {
+	case string:
+		out["tool_choice"] = choice
+	case map[string]interface{}:
+		if fn, ok := choice["function"].(map[string]interface{}); ok {
+			out["tool_choice"] = map[string]interface{}{"type": "function", "name": fn["name"]}
+		}
+	}
+
+	if format, ok := req["response_format"].(map[string]interface{}); ok {
+		switch format["type"] {
+		case "json_object":
+			out["text"] = map[string]interface{}{"format": map[string]interface{}{"type": "json_object"}}
+		case "json_schema":
+			schema, _ := format["json_schema"].(map[string]interface{})
+			converted := map[string]interface{}{"type": "json_schema"}
+			for _, field := range []string{"name", "description", "schema", "strict"} {
+				if v, ok := schema[field]; ok {
+					converted[field] = v
+				}
+			}
+			out["text"] = map[string]interface{}{"format": converted}
+		}
+	}
+
+	return out, nil
+}
+
+// userContent converts chat user content to Responses input content parts
+func userContent(content interface{}) []interface{} {
+	if text, ok := content.(string); ok {
+		return []interface{}{map[string]interface{}{"type": "input_text", "text": text}}
+	}
+	parts, _ := content.([]interface{})
+	converted := make([]interface{}, 0, len(parts))
+	for _, raw := range parts {
+		part, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch part["type"] {
+		case "text":
+			converted = append(converted, map[string]interface{}{"type": "input_text", "text": part["text"]})
+		case "image_url":
+			image, _ := part["image_url"].(map[string]interface{})
+			item := map[string]interface{}{"type": "input_image", "image_url": image["url"]}
+			if detail, ok := image["detail"].(string); ok {
+				item["detail"] = detail
+			}
+			converted = append(converted, item)
+		}
+	}
+	return converted
+}
+
+// contentText flattens string or multi-part content to text
+func contentText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var parts []string
+		for _, raw := range c {
+			if part, ok := raw.(map[string]interface{}); ok {
+				if text, ok := part["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// responsesOutputItem is an item of a Responses API output array
+type responsesOutputItem struct {
+	Type      string `json:"type"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Content   []struct {
+		Type    string `json:"type"`
+		Text    string `json:"text"`
+		Refusal string `json:"refusal"`
+	} `json:"content"`
+}
+
+// incompleteDetails explains why a Responses API response is incomplete
+type incompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// responsesResponse is the subset of a Responses API response that is translated
+type responsesResponse struct {
+	ID                string                `json:"id"`
+	CreatedAt         int64                 `json:"created_at"`
+	Output            []responsesOutputItem `json:"output"`
+	IncompleteDetails *incompleteDetails    `json:"incomplete_details"`
+	Usage             *struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
+	} `json:"usage"`
+}
+
+// ResponsesToChatCompletion converts a Responses API response body into a
+// chat.completion object for the requested model
+func ResponsesToChatCompletion(body []byte, model string) (map[string]interface{}, error) {
+	var resp responsesResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	var refusal string
+	var toolCalls []interface{}
+	for _, item := range resp.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				if part.Type == "refusal" {
+					refusal += part.Refusal
+				} else {
+					text.WriteString(part.Text)
+				}
+			}
+		case "function_call":
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   item.CallID,
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      item.Name,
+					"arguments": item.Arguments,
+				},
+			})
+		}
+	}
+
+	message := map[string]interface{}{"role": "assistant", "content": nil}
+	if text.Len() > 0 {
+		message["content"] = text.String()
+	}
+	if refusal != "" {
+		message["refusal"] = refusal
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+
+	return map[string]interface{}{
+		"id":      completionID(resp.ID),
+		"object":  "chat.completion",
+		"created": createdAt(resp.CreatedAt),
+		"model":   model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       message,
+			"finish_reason": finishReason(len(toolCalls) > 0, resp.IncompleteDetails),
+		}},
+		"usage": chatUsage(resp),
+	}, nil
+}
+
+// finishReason derives the chat finish reason
+func finishReason(hasToolCalls bool, incomplete *incompleteDetails) string {
+	switch {
+	case incomplete != nil && incomplete.Reason == "max_output_tokens":
+		return "length"
+	case incomplete != nil && incomplete.Reason == "content_filter":
+		return "content_filter"
+	case hasToolCalls:
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// chatUsage converts Responses usage to the chat usage object
+func chatUsage(resp responsesResponse) map[string]interface{} {
+	if resp.Usage == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"prompt_tokens":     resp.Usage.InputTokens,
+		"completion_tokens": resp.Usage.OutputTokens,
+		"total_tokens":      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		"prompt_tokens_details": map[string]interface{}{
+			"cached_tokens": resp.Usage.InputTokensDetails.CachedTokens,
+		},
+		"completion_tokens_details": map[string]interface{}{
+			"reasoning_tokens": resp.Usage.OutputTokensDetails.ReasoningTokens,
+		},
+	}
+}
+
+// completionID derives a chat completion id from the Responses id
+func completionID(responseID string) string {
+	return "chatcmpl-" + strings.TrimPrefix(responseID, "resp_")
+}
+
+func createdAt(created int64) int64 {
+	if created == 0 {
+		return time.Now().Unix()
+	}
+	return created
+}
@@ -0,0 +1,219 @@
+package codex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ChatStreamTranslator rewrites a Responses API event stream as
+// chat.completion.chunk frames, ending with a usage chunk and [DONE]
+type ChatStreamTranslator struct {
+	model        string
+	id           string
+	created      int64
+	started      bool
+	finished     bool
+	toolIndex    int
+	toolCall     string // call_id of the tool call being streamed
+	hasToolCalls bool
+}
+
+// NewChatStreamTranslator returns a translator for a stream of the requested model
+func NewChatStreamTranslator(model string) *ChatStreamTranslator {
+	return &ChatStreamTranslator{model: model, toolIndex: -1}
+}
+
+// chatStreamEvent is the subset of a Responses API stream event that is translated
+type chatStreamEvent struct {
+	Type     string              `json:"type"`
+	Delta    string              `json:"delta"`
+	Item     responsesOutputItem `json:"item"`
+	Message  string              `json:"message"`
+	Response struct {
+		responsesResponse
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"response"`
+}
+
+// WriteLine translates one line of the upstream stream and writes the
+// resulting chunks. Event name lines, blank lines and events without a chat
+// equivalent produce no output.
+func (t *ChatStreamTranslator) WriteLine(w io.Writer, line string) error {
+	if !strings.HasPrefix(line, "data: ") {
+		return nil
+	}
+	data := strings.TrimPrefix(line, "data: ")
+	if data == "[DONE]" || t.finished {
+		return nil
+	}
+
+	var event chatStreamEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "response.created":
+		t.id = completionID(event.Response.ID)
+		t.created = event.Response.CreatedAt
+		return t.start(w)
+
+	case "response.output_text.delta":
+		if err := t.start(w); err != nil {
+			return err
+		}
+		return t.chunk(w, map[string]interface{}{"content": event.Delta}, nil)
+
+	case "response.refusal.delta":
+		if err := t.start(w); err != nil {
+			return err
+		}
+		return t.chunk(w, map[string]interface{}{"refusal": event.Delta}, nil)
+
+	case "response.output_item.added":
+		if event.Item.Type == "function_call" {
+			return t.startToolCall(w, event.Item)
+		}
+
+	case "response.function_call_arguments.delta":
+		if t.toolCall == "" {
+			return nil
+		}
+		return t.chunk(w, map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+			"index":    t.toolIndex,
+			"function": map[string]interface{}{"arguments": event.Delta},
+		}}}, nil)
+
+	case "response.output_item.done":
+		if event.Item.Type != "function_call" {
+			return nil
+		}
+		if t.toolCall != event.Item.CallID {
+			// The call arrived complete, without argument deltas
+			if err := t.startToolCall(w, event.Item); err != nil {
+				return err
+			}
+			if err := t.chunk(w, map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+				"index":    t.toolIndex,
+				"function": map[string]interface{}{"arguments": event.Item.Arguments},
+			}}}, nil); err != nil {
+				return err
+			}
+		}
+		t.toolCall = ""
+
+	case "response.completed", "response.incomplete":
+		return t.finish(w, event.Response.responsesResponse)
+
+	case "response.failed":
+		message := "upstream response failed"
+		if event.Response.Error != nil && event.Response.Error.Message != "" {
+			message = event.Response.Error.Message
+		}
+		return t.fail(w, message)
+
+	case "error":
+		return t.fail(w, event.Message)
+	}
+
+	return nil
+}
+
+// start emits the assistant role chunk once
+func (t *ChatStreamTranslator) start(w io.Writer) error {
+	if t.started {
+		return nil
+	}
+	t.started = true
+	if t.created == 0 {
+		t.created = time.Now().Unix()
+	}
+	return t.chunk(w, map[string]interface{}{"role": "assistant", "content": ""}, nil)
+}
+
+// startToolCall emits the chunk that opens a tool call
+func (t *ChatStreamTranslator) startToolCall(w io.Writer, item responsesOutputItem) error {
+	if err := t.start(w); err != nil {
+		return err
+	}
+	t.toolIndex++
+	t.toolCall = item.CallID
+	t.hasToolCalls = true
+	return t.chunk(w, map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+		"index":    t.toolIndex,
+		"id":       item.CallID,
+		"type":     "function",
+		"function": map[string]interface{}{"name": item.Name, "arguments": ""},
+	}}}, nil)
+}
+
+// finish emits the finish reason, the usage chunk and [DONE]
+func (t *ChatStreamTranslator) finish(w io.Writer, resp responsesResponse) error {
+	if t.id == "" {
+		t.id = completionID(resp.ID)
+	}
+	if err := t.start(w); err != nil {
+		return err
+	}
+	t.finished = true
+
+	reason := finishReason(t.hasToolCalls, resp.IncompleteDetails)
+	if err := t.chunk(w, map[string]interface{}{}, &reason); err != nil {
+		return err
+	}
+	if usage := chatUsage(resp); usage != nil {
+		if err := t.write(w, map[string]interface{}{
+			"id":      t.id,
+			"object":  "chat.completion.chunk",
+			"created": t.created,
+			"model":   t.model,
+			"choices": []interface{}{},
+			"usage":   usage,
+		}); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "data: [DONE]\n\n")
+	return err
+}
+
+// fail emits an error frame and ends the stream
+func (t *ChatStreamTranslator) fail(w io.Writer, message string) error {
+	t.finished = true
+	if err := t.write(w, map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "type": "upstream_error"},
+	}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprint(w, "data: [DONE]\n\n")
+	return err
+}
+
+// chunk emits a chat.completion.chunk with a single choice
+func (t *ChatStreamTranslator) chunk(w io.Writer, delta map[string]interface{}, finishReason *string) error {
+	return t.write(w, map[string]interface{}{
+		"id":      t.id,
+		"object":  "chat.completion.chunk",
+		"created": t.created,
+		"model":   t.model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	})
+}
+
+func (t *ChatStreamTranslator) write(w io.Writer, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -8,15 +8,28 @@ import (
 )
 
 type Config struct {
-	ServerPort   string
-	DBHost       string
-	DBPort       string
-	DBUser       string
-	DBPassword   string
-	DBName       string
-	DBSSLMode    string
-	JWTSecret    string
-	FrontendURL  string
+	ServerPort     string
+	DBHost         string
+	DBPort         string
+	DBUser         string
+	DBPassword     string
+	DBName         string
+	DBSSLMode      string
+	JWTSecret      string
+	FrontendURL    string
+	TokenizerDir   string // Directory holding <encoding>.tiktoken files overriding the bundled vocabularies
+	MetricsToken   string // Bearer token required on the public /metrics; not routed when empty
+	MetricsAddr    string // Internal listener serving /metrics without auth; "none" disables it
+	LogLevel       string // debug, info, warn, error
+	LogFormat      string // text or json
+	RedisURL       string // Shared state for multiple replicas; in-memory when empty
+	TrustedProxies string // Comma-separated proxy IPs/CIDRs allowed to set X-Forwarded-For; none when empty
+	QuotaTimezone  string // IANA timezone API key budget periods reset in; UTC when empty
+
+	PricingSource   string // litellm, file or manifest
+	PricingURL      string // LiteLLM pricing JSON URL; the public LiteLLM list when empty
+	PricingPath     string // File or directory read by the file pricing source
+	PricingCacheDir string // Where the last fetched prices are cached
 }
 
 var AppConfig *Config
@@ -27,15 +40,28 @@ func Load() error {
 	}
 
 	AppConfig = &Config{
-		ServerPort:  getEnv("SERVER_PORT", "12322"),
-		DBHost:      getEnv("DB_HOST", "localhost"),
-		DBPort:      getEnv("DB_PORT", "5433"),
-		DBUser:      getEnv("DB_USER", "postgres"),
-		DBPassword:  getEnv("DB_PASSWORD", ""),
-		DBName:      getEnv("DB_NAME", "codex_gateway"),
-		DBSSLMode:   getEnv("DB_SSLMODE", "disable"),
-		JWTSecret:   getEnv("JWT_SECRET", ""),
-		FrontendURL: getEnv("FRONTEND_URL", "https://codex.zenscaleai.com"),
+		ServerPort:     getEnv("SERVER_PORT", "12322"),
+		DBHost:         getEnv("DB_HOST", "localhost"),
+		DBPort:         getEnv("DB_PORT", "5433"),
+		DBUser:         getEnv("DB_USER", "postgres"),
+		DBPassword:     getEnv("DB_PASSWORD", ""),
+		DBName:         getEnv("DB_NAME", "codex_gateway"),
+		DBSSLMode:      getEnv("DB_SSLMODE", "disable"),
+		JWTSecret:      getEnv("JWT_SECRET", ""),
+		FrontendURL:    getEnv("FRONTEND_URL", "https://codex.zenscaleai.com"),
+		TokenizerDir:   getEnv("TOKENIZER_DIR", "./data/tokenizer"),
+		MetricsToken:   getEnv("METRICS_TOKEN", ""),
+		MetricsAddr:    getEnv("METRICS_ADDR", "127.0.0.1:9464"),
+		LogLevel:       getEnv("LOG_LEVEL", "info"),
+		LogFormat:      getEnv("LOG_FORMAT", "text"),
+		RedisURL:       getEnv("REDIS_URL", ""),
+		TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
+		QuotaTimezone:  getEnv("QUOTA_TIMEZONE", ""),
+
+		PricingSource:   getEnv("PRICING_SOURCE", "litellm"),
+		PricingURL:      getEnv("PRICING_URL", ""),
+		PricingPath:     getEnv("PRICING_PATH", ""),
+		PricingCacheDir: getEnv("PRICING_CACHE_DIR", "./data/pricing"),
 	}
 
 	if AppConfig.JWTSecret == "" {
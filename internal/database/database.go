@@ -15,13 +15,16 @@ import (
 
 var DB *gorm.DB
 
+// connString is kept for connections outside the pool, such as LISTEN
+var connString string
+
 func Connect() error {
 	cfg := config.AppConfig
 	if cfg.DBPassword == "" {
 		return fmt.Errorf("DB_PASSWORD is required but not set")
 	}
 
-	dsn := fmt.Sprintf(
+	connString = fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
 		cfg.DBHost,
 		cfg.DBUser,
@@ -33,7 +36,7 @@ func Connect() error {
 
 	var err error
 	// Use Error level logging in production to reduce overhead
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	DB, err = gorm.Open(postgres.Open(connString), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Error),
 	})
 	if err != nil {
@@ -69,11 +72,15 @@ func Connect() error {
 }
 
 func AutoMigrate() error {
-	return DB.AutoMigrate(
+	// Key quotas used to be enforced against total_usage in tokens
+	legacyKeyQuotas := DB.Migrator().HasTable(&models.APIKey{}) && !DB.Migrator().HasColumn(&models.APIKey{}, "QuotaType")
+
+	if err := DB.AutoMigrate(
 		&models.User{},
 		&models.APIKey{},
 		&models.ModelPricing{},
 		&models.UsageLog{},
+		&models.UpstreamAttempt{},
 		&models.Transaction{},
 		&models.SystemSettings{},
 		&models.AdminLog{},
@@ -84,7 +91,37 @@ func AutoMigrate() error {
 		&models.DailyUsage{},
 		&models.PaymentOrder{},
 		&models.CouponRedemption{},
-	)
+		&models.BalanceHold{},
+		&models.RateLimitPolicy{},
+		&models.ModelAliasRule{},
+		&models.PricingRule{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.OrganizationInvitation{},
+		&models.OrganizationPackage{},
+		&models.OrganizationDailyUsage{},
+	); err != nil {
+		return err
+	}
+
+	// Model pricing used to hold a single row per model
+	if DB.Migrator().HasIndex(&models.ModelPricing{}, "idx_model_pricings_model_name") {
+		if err := DB.Migrator().DropIndex(&models.ModelPricing{}, "idx_model_pricings_model_name"); err != nil {
+			return fmt.Errorf("failed to drop unique model pricing index: %w", err)
+		}
+	}
+
+	if legacyKeyQuotas {
+		if err := DB.Model(&models.APIKey{}).Unscoped().
+			Where("quota_limit IS NOT NULL").
+			Updates(map[string]interface{}{
+				"quota_type": "tokens",
+				"quota_used": gorm.Expr("total_usage"),
+			}).Error; err != nil {
+			return fmt.Errorf("failed to migrate api key quotas: %w", err)
+		}
+	}
+	return nil
 }
 
 func SeedDefaultPricing() error {
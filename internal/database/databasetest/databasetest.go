@@ -0,0 +1,82 @@
+// Package databasetest points the database package at a throwaway in-memory
+// SQLite database for tests of code that queries through database.DB.
+package databasetest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"codex-gateway/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// randomUUID generates a UUID in SQLite, standing in for Postgres'
+// gen_random_uuid() in column defaults
+const randomUUID = "(lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-' || " +
+	"lower(hex(randomblob(2))) || '-' || lower(hex(randomblob(2))) || '-' || lower(hex(randomblob(6))))"
+
+// Use replaces database.DB with an empty in-memory database holding the
+// tables of the given models, restoring the previous connection when the test
+// ends
+func Use(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	sqlDB, err := sql.Open(sqlite.DriverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens a new database
+	sqlDB.SetMaxOpenConns(1)
+
+	db, err := gorm.Open(sqlite.Dialector{Conn: pool{sqlDB}}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// pool translates the Postgres-only SQL in model definitions
+type pool struct {
+	*sql.DB
+}
+
+func translate(query string) string {
+	return strings.ReplaceAll(query, "gen_random_uuid()", randomUUID)
+}
+
+func (p pool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.DB.PrepareContext(ctx, translate(query))
+}
+
+func (p pool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.DB.ExecContext(ctx, translate(query), args...)
+}
+
+func (p pool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.DB.QueryContext(ctx, translate(query), args...)
+}
+
+func (p pool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.DB.QueryRowContext(ctx, translate(query), args...)
+}
+
+// GetDBConn lets gorm's DB() return the underlying connection
+func (p pool) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// listenRetryDelay is how long Listen waits before reconnecting after an error
+const listenRetryDelay = 5 * time.Second
+
+// Notify publishes a payload on a Postgres notification channel
+func Notify(channel, payload string) error {
+	return DB.Exec("SELECT pg_notify(?, ?)", channel, payload).Error
+}
+
+// Listen passes the payload of each notification on channel to handle until ctx
+// is done, reconnecting after errors. Notifications sent while disconnected are
+// lost, so handle is also called with an empty payload after each reconnect.
+func Listen(ctx context.Context, channel string, handle func(payload string)) {
+	connected := false
+	for ctx.Err() == nil {
+		err := listen(ctx, channel, func() {
+			if connected {
+				handle("")
+			}
+			connected = true
+		}, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[Database] Listener on %s stopped: %v", channel, err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+// listen holds one connection listening on channel until it fails
+func listen(ctx context.Context, channel string, ready func(), handle func(payload string)) error {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	ready()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handle(notification.Payload)
+	}
+}
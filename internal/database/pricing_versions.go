@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrPriceVersionExists is returned when a model already has a version starting
+// at the same time
+var ErrPriceVersionExists = errors.New("a price version already starts at this time")
+
+// ErrPriceVersionNotScheduled is returned when cancelling a version that is
+// already in effect
+var ErrPriceVersionNotScheduled = errors.New("only scheduled price versions can be cancelled")
+
+// EffectiveAt limits a model pricing query to the versions in effect at the given time
+func EffectiveAt(at time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)", at, at)
+	}
+}
+
+// PriceAt returns the price version of a model in effect at the given time,
+// read from the database. Requests are priced through the pricing cache instead.
+func PriceAt(model string, at time.Time) (*models.ModelPricing, error) {
+	var pricing models.ModelPricing
+	if err := DB.Scopes(EffectiveAt(at)).
+		Where("model_name = ?", model).
+		Order("effective_from DESC").
+		First(&pricing).Error; err != nil {
+		return nil, fmt.Errorf("pricing not found for model: %s", model)
+	}
+	return &pricing, nil
+}
+
+// AddPriceVersion inserts a price version starting at version.EffectiveFrom (now
+// when unset). The version it supersedes ends there, and the new version ends
+// where the next scheduled version of the model starts.
+func AddPriceVersion(tx *gorm.DB, version *models.ModelPricing) error {
+	version.ID = 0
+	version.EffectiveTo = nil
+	if version.EffectiveFrom.IsZero() {
+		version.EffectiveFrom = time.Now()
+	}
+
+	var count int64
+	if err := tx.Model(&models.ModelPricing{}).
+		Where("model_name = ? AND effective_from = ?", version.ModelName, version.EffectiveFrom).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPriceVersionExists
+	}
+
+	if err := tx.Model(&models.ModelPricing{}).
+		Where("model_name = ? AND effective_from < ?", version.ModelName, version.EffectiveFrom).
+		Where("(effective_to IS NULL OR effective_to > ?)", version.EffectiveFrom).
+		Update("effective_to", version.EffectiveFrom).Error; err != nil {
+		return err
+	}
+
+	var next models.ModelPricing
+	err := tx.Where("model_name = ? AND effective_from > ?", version.ModelName, version.EffectiveFrom).
+		Order("effective_from ASC").
+		First(&next).Error
+	if err == nil {
+		version.EffectiveTo = &next.EffectiveFrom
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return tx.Create(version).Error
+}
+
+// CancelPriceVersion deletes a scheduled price version, extending the version
+// before it over the cancelled window
+func CancelPriceVersion(tx *gorm.DB, id uint) error {
+	var version models.ModelPricing
+	if err := tx.First(&version, id).Error; err != nil {
+		return err
+	}
+	if !version.EffectiveFrom.After(time.Now()) {
+		return ErrPriceVersionNotScheduled
+	}
+
+	if err := tx.Model(&models.ModelPricing{}).
+		Where("model_name = ? AND effective_to = ?", version.ModelName, version.EffectiveFrom).
+		Update("effective_to", version.EffectiveTo).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&version).Error
+}
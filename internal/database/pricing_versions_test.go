@@ -0,0 +1,177 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+)
+
+// window is a version's effective range, with a zero end while open ended
+type window struct {
+	from, to time.Time
+}
+
+func versionWindows(t *testing.T, model string) []window {
+	t.Helper()
+	var versions []models.ModelPricing
+	if err := database.DB.Where("model_name = ?", model).Order("effective_from ASC").Find(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	windows := make([]window, len(versions))
+	for i, version := range versions {
+		windows[i].from = version.EffectiveFrom
+		if version.EffectiveTo != nil {
+			windows[i].to = *version.EffectiveTo
+		}
+	}
+	return windows
+}
+
+func sameWindows(got, want []window) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].from.Equal(want[i].from) || !got[i].to.Equal(want[i].to) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddPriceVersion(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return base.AddDate(0, 0, n) }
+
+	tests := []struct {
+		name    string
+		add     []time.Time // Start of each version, in insertion order
+		want    []window
+		wantErr error
+	}{
+		{
+			name: "first version is open ended",
+			add:  []time.Time{day(0)},
+			want: []window{{day(0), time.Time{}}},
+		},
+		{
+			name: "later version ends the current one",
+			add:  []time.Time{day(0), day(10)},
+			want: []window{{day(0), day(10)}, {day(10), time.Time{}}},
+		},
+		{
+			name: "version inserted before a scheduled one ends where it starts",
+			add:  []time.Time{day(0), day(20), day(10)},
+			want: []window{{day(0), day(10)}, {day(10), day(20)}, {day(20), time.Time{}}},
+		},
+		{
+			name:    "same start is rejected",
+			add:     []time.Time{day(0), day(0)},
+			want:    []window{{day(0), time.Time{}}},
+			wantErr: database.ErrPriceVersionExists,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databasetest.Use(t, &models.ModelPricing{})
+
+			var err error
+			for _, from := range tt.add {
+				version := models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: 1, OutputPricePer1k: 2, EffectiveFrom: from}
+				if err = database.AddPriceVersion(database.DB, &version); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := versionWindows(t, "gpt-5.1"); !sameWindows(got, tt.want) {
+				t.Errorf("windows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddPriceVersionLeavesOtherModels(t *testing.T) {
+	databasetest.Use(t, &models.ModelPricing{})
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, model := range []string{"gpt-5.1", "gpt-5.1-codex"} {
+		if err := database.AddPriceVersion(database.DB, &models.ModelPricing{ModelName: model, EffectiveFrom: from}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.AddPriceVersion(database.DB, &models.ModelPricing{ModelName: "gpt-5.1", EffectiveFrom: from.AddDate(0, 1, 0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := versionWindows(t, "gpt-5.1-codex"); !sameWindows(got, []window{{from, time.Time{}}}) {
+		t.Errorf("other model's windows = %v, want it left open", got)
+	}
+}
+
+func TestCancelPriceVersion(t *testing.T) {
+	databasetest.Use(t, &models.ModelPricing{})
+	now := time.Now()
+	past, scheduled, later := now.AddDate(0, 0, -10), now.AddDate(0, 0, 10), now.AddDate(0, 0, 20)
+
+	var ids []uint
+	for _, from := range []time.Time{past, scheduled, later} {
+		version := models.ModelPricing{ModelName: "gpt-5.1", EffectiveFrom: from}
+		if err := database.AddPriceVersion(database.DB, &version); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, version.ID)
+	}
+
+	if err := database.CancelPriceVersion(database.DB, ids[0]); !errors.Is(err, database.ErrPriceVersionNotScheduled) {
+		t.Errorf("cancelling the version in effect: %v, want ErrPriceVersionNotScheduled", err)
+	}
+	if err := database.CancelPriceVersion(database.DB, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	want := []window{{past, later}, {later, time.Time{}}}
+	if got := versionWindows(t, "gpt-5.1"); !sameWindows(got, want) {
+		t.Errorf("windows after cancelling = %v, want %v", got, want)
+	}
+}
+
+func TestPriceAt(t *testing.T) {
+	databasetest.Use(t, &models.ModelPricing{})
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, price := range []float64{1, 2} {
+		version := models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: price, EffectiveFrom: base.AddDate(0, 0, 10*i)}
+		if err := database.AddPriceVersion(database.DB, &version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		at      time.Time
+		want    float64
+		wantErr bool
+	}{
+		{at: base.Add(-time.Second), wantErr: true},
+		{at: base, want: 1},
+		{at: base.AddDate(0, 0, 10).Add(-time.Second), want: 1},
+		{at: base.AddDate(0, 0, 10), want: 2},
+		{at: base.AddDate(1, 0, 0), want: 2},
+	}
+	for _, tt := range tests {
+		version, err := database.PriceAt("gpt-5.1", tt.at)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("PriceAt(%v) = %v, want no price", tt.at, version.InputPricePer1k)
+			}
+			continue
+		}
+		if err != nil || version.InputPricePer1k != tt.want {
+			t.Errorf("PriceAt(%v) = %v, %v; want %v", tt.at, version, err, tt.want)
+		}
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"log"
 )
 
-// SeedCodexPricing seeds Codex model pricing based on sub2api reference
+// SeedCodexPricing seeds Codex model pricing based on sub2api reference for
+// models that have no price versions yet
 func SeedCodexPricing() error {
 	// Codex model pricing (per 1K tokens)
 	// Exact pricing from sub2api's model_prices_and_context_window.json
@@ -62,31 +63,20 @@ func SeedCodexPricing() error {
 	}
 
 	for _, pricing := range codexModels {
-		// Check if model already exists
-		var existing models.ModelPricing
-		result := DB.Where("model_name = ?", pricing.ModelName).First(&existing)
-
-		if result.Error != nil {
-			// Model doesn't exist, create it
-			if err := DB.Create(&pricing).Error; err != nil {
-				log.Printf("Failed to seed pricing for %s: %v", pricing.ModelName, err)
-				return err
-			}
-			log.Printf("Seeded pricing for model: %s", pricing.ModelName)
-		} else {
-			// Model exists, update it to ensure correct pricing
-			existing.InputPricePer1k = pricing.InputPricePer1k
-			existing.OutputPricePer1k = pricing.OutputPricePer1k
-			existing.CacheReadPricePer1k = pricing.CacheReadPricePer1k
-			existing.CacheCreationPricePer1k = pricing.CacheCreationPricePer1k
-			existing.MarkupMultiplier = pricing.MarkupMultiplier
-			if err := DB.Save(&existing).Error; err != nil {
-				log.Printf("Failed to update pricing for %s: %v", pricing.ModelName, err)
-				return err
-			}
-			log.Printf("Updated pricing for model: %s (input=$%.6f, output=$%.6f, cache_read=$%.6f, cache_create=$%.6f)",
-				pricing.ModelName, pricing.InputPricePer1k, pricing.OutputPricePer1k, pricing.CacheReadPricePer1k, pricing.CacheCreationPricePer1k)
+		// Only seed models without any price version, so restarts never
+		// override prices set through the admin API
+		var count int64
+		if err := DB.Model(&models.ModelPricing{}).Where("model_name = ?", pricing.ModelName).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := AddPriceVersion(DB, &pricing); err != nil {
+			log.Printf("Failed to seed pricing for %s: %v", pricing.ModelName, err)
+			return err
 		}
+		log.Printf("Seeded pricing for model: %s", pricing.ModelName)
 	}
 
 	log.Println("Codex pricing seeding completed")
@@ -0,0 +1,45 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+)
+
+func TestSeedCodexPricingKeepsAdminEdits(t *testing.T) {
+	databasetest.Use(t, &models.ModelPricing{})
+	if err := database.SeedCodexPricing(); err != nil {
+		t.Fatal(err)
+	}
+	var seeded int64
+	if err := database.DB.Model(&models.ModelPricing{}).Count(&seeded).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// An admin reprices a seeded model, then the gateway restarts
+	edit := models.ModelPricing{ModelName: "gpt-5.1-codex", InputPricePer1k: 0.5, OutputPricePer1k: 1, MarkupMultiplier: 2}
+	if err := database.AddPriceVersion(database.DB, &edit); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SeedCodexPricing(); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.ModelPricing{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != seeded+1 {
+		t.Errorf("%d price versions after restart, want %d", count, seeded+1)
+	}
+	current, err := database.PriceAt("gpt-5.1-codex", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.ID != edit.ID || current.InputPricePer1k != 0.5 {
+		t.Errorf("price in effect = %+v, want the admin edit", current)
+	}
+}
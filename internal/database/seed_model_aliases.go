@@ -0,0 +1,62 @@
+package database
+
+import (
+	"log"
+
+	"codex-gateway/internal/models"
+)
+
+// SeedModelAliasRules seeds the Codex model aliases that used to be compiled in
+func SeedModelAliasRules() error {
+	var count int64
+	DB.Model(&models.ModelAliasRule{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	aliases := []struct {
+		alias, target, effort string
+	}{
+		{"gpt-5.1-codex-low", "gpt-5.1-codex", "low"},
+		{"gpt-5.1-codex-medium", "gpt-5.1-codex", "medium"},
+		{"gpt-5.1-codex-high", "gpt-5.1-codex", "high"},
+		{"gpt-5.1-codex-max-low", "gpt-5.1-codex-max", "low"},
+		{"gpt-5.1-codex-max-medium", "gpt-5.1-codex-max", "medium"},
+		{"gpt-5.1-codex-max-high", "gpt-5.1-codex-max", "high"},
+		{"gpt-5.2-codex-low", "gpt-5.2-codex", "low"},
+		{"gpt-5.2-codex-medium", "gpt-5.2-codex", "medium"},
+		{"gpt-5.2-codex-high", "gpt-5.2-codex", "high"},
+		{"gpt-5-codex", "gpt-5.1-codex", ""},
+		{"codex-mini-latest", "gpt-5.1-codex-mini", ""},
+		{"gpt-5", "gpt-5.1", ""},
+	}
+
+	rules := make([]models.ModelAliasRule, 0, len(aliases)+1)
+	// Strip provider prefixes such as openai/gpt-5.1-codex before the aliases
+	rules = append(rules, models.ModelAliasRule{
+		MatchType:   "regex",
+		Pattern:     "^[^/]+/(.+)$",
+		Target:      "$1",
+		Priority:    10,
+		Enabled:     true,
+		Description: "Strip provider prefix",
+	})
+	for _, a := range aliases {
+		rules = append(rules, models.ModelAliasRule{
+			MatchType:       "exact",
+			Pattern:         a.alias,
+			Target:          a.target,
+			ReasoningEffort: a.effort,
+			Priority:        100,
+			Enabled:         true,
+		})
+	}
+
+	if err := DB.Create(&rules).Error; err != nil {
+		log.Printf("Failed to seed model alias rules: %v", err)
+		return err
+	}
+
+	log.Printf("Seeded %d model alias rules", len(rules))
+	return nil
+}
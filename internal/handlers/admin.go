@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"codex-gateway/internal/database"
+	"codex-gateway/internal/modelalias"
 	"codex-gateway/internal/models"
 	"codex-gateway/internal/pricing"
 	"codex-gateway/internal/ratelimit"
@@ -171,7 +172,7 @@ func AdminUpdateBalance(c *gin.Context) {
 
 		// Log admin action
 		log := models.AdminLog{
-			AdminID:   admin.ID,
+			AdminID:   &admin.ID,
 			Action:    "update_balance",
 			Target:    userID,
 			Details:   fmt.Sprintf("Amount: %.6f, Description: %s", req.Amount, req.Description),
@@ -224,7 +225,7 @@ func AdminUpdateUserStatus(c *gin.Context) {
 
 		// Log admin action
 		log := models.AdminLog{
-			AdminID:   admin.ID,
+			AdminID:   &admin.ID,
 			Action:    "update_user_status",
 			Target:    userID,
 			Details:   fmt.Sprintf("New status: %s", req.Status),
@@ -257,7 +258,11 @@ func AdminGetSettings(c *gin.Context) {
 			RateLimitEnabled:           false,
 			RateLimitRPM:               0,
 			RateLimitBurst:             0,
+			RateLimitTPM:               0,
+			RateLimitConcurrent:        0,
 			UserDailyUsageLimit:        nil,
+			UpstreamStrategy:           upstream.StrategyConsistentHash,
+			UnknownModelAction:         modelalias.UnknownReject,
 		}
 	}
 	settings.EmailRegistrationEnabled = false
@@ -281,6 +286,26 @@ func AdminUpdateSettings(c *gin.Context) {
 		req.OpenAIBaseURL = "https://api.openai.com/v1"
 	}
 
+	if req.UpstreamStrategy == "" {
+		req.UpstreamStrategy = upstream.StrategyConsistentHash
+	}
+	if !upstream.ValidStrategy(req.UpstreamStrategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upstream_strategy"})
+		return
+	}
+
+	if req.UnknownModelAction == "" {
+		req.UnknownModelAction = modelalias.UnknownReject
+	}
+	if !modelalias.ValidUnknownAction(req.UnknownModelAction) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid unknown_model_action"})
+		return
+	}
+	if req.UnknownModelAction == modelalias.UnknownMap && req.UnknownModelTarget == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown_model_target is required when unknown models are mapped"})
+		return
+	}
+
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
 		var settings models.SystemSettings
 		result := tx.First(&settings)
@@ -316,7 +341,12 @@ func AdminUpdateSettings(c *gin.Context) {
 				"rate_limit_enabled":            req.RateLimitEnabled,
 				"rate_limit_rpm":                req.RateLimitRPM,
 				"rate_limit_burst":              req.RateLimitBurst,
+				"rate_limit_tpm":                req.RateLimitTPM,
+				"rate_limit_concurrent":         req.RateLimitConcurrent,
 				"user_daily_usage_limit":        req.UserDailyUsageLimit,
+				"upstream_strategy":             req.UpstreamStrategy,
+				"unknown_model_action":          req.UnknownModelAction,
+				"unknown_model_target":          req.UnknownModelTarget,
 			}
 			if err := tx.Model(&models.SystemSettings{}).Where("id = ?", settings.ID).Updates(updates).Error; err != nil {
 				return err
@@ -369,7 +399,7 @@ func AdminUpdateSettings(c *gin.Context) {
 
 		// Log admin action
 		log := models.AdminLog{
-			AdminID:   admin.ID,
+			AdminID:   &admin.ID,
 			Action:    "update_settings",
 			Target:    "system",
 			Details:   fmt.Sprintf("Updated system settings"),
@@ -389,6 +419,7 @@ func AdminUpdateSettings(c *gin.Context) {
 	// Refresh upstream selector after settings update
 	_ = upstream.GetSelector().RefreshUpstreams()
 	ratelimit.LoadFromDB()
+	modelalias.LoadFromDB()
 }
 
 // AdminGetOverview gets system overview statistics
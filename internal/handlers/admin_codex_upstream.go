@@ -58,6 +58,18 @@ func AdminCreateCodexUpstream(c *gin.Context) {
 	if req.Timeout == 0 {
 		req.Timeout = 120
 	}
+	if req.FirstByteTimeout == 0 {
+		req.FirstByteTimeout = 60
+	}
+	if req.IdleTimeout == 0 {
+		req.IdleTimeout = 60
+	}
+	if req.MaxConns == 0 {
+		req.MaxConns = 100
+	}
+	if req.MaxIdleConns == 0 {
+		req.MaxIdleConns = 10
+	}
 
 	if err := database.DB.Create(&req).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create upstream"})
@@ -96,6 +108,12 @@ func AdminUpdateCodexUpstream(c *gin.Context) {
 	upstream.MaxRetries = req.MaxRetries
 	upstream.Timeout = req.Timeout
 	upstream.HealthCheck = req.HealthCheck
+	upstream.SupportedModels = req.SupportedModels
+	upstream.ModelAliases = req.ModelAliases
+	upstream.FirstByteTimeout = req.FirstByteTimeout
+	upstream.IdleTimeout = req.IdleTimeout
+	upstream.MaxConns = req.MaxConns
+	upstream.MaxIdleConns = req.MaxIdleConns
 
 	if err := database.DB.Save(&upstream).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update upstream"})
@@ -162,6 +180,11 @@ func AdminUpdateCodexUpstreamStatus(c *gin.Context) {
 		return
 	}
 
+	// A manual re-enable gives the upstream a fresh circuit
+	if req.Status == "active" {
+		upstreamSelector.GetCircuitBreaker().Reset(uint(idInt))
+	}
+
 	// Refresh upstream selector
 	upstreamSelector.GetSelector().RefreshUpstreams()
 
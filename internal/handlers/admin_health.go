@@ -34,13 +34,16 @@ func AdminTriggerHealthCheck(c *gin.Context) {
 func AdminGetUpstreamHealth(c *gin.Context) {
 	upstreams := upstream.GetSelector().GetAllUpstreams()
 	checker := upstream.GetHealthChecker()
+	breaker := upstream.GetCircuitBreaker()
 
 	type UpstreamHealth struct {
-		ID            uint   `json:"id"`
-		Name          string `json:"name"`
-		Status        string `json:"status"`
-		FailureCount  int    `json:"failure_count"`
-		LastChecked   string `json:"last_checked"`
+		ID            uint                     `json:"id"`
+		Name          string                   `json:"name"`
+		Status        string                   `json:"status"`
+		FailureCount  int                      `json:"failure_count"`
+		LastChecked   string                   `json:"last_checked"`
+		CircuitState  string                   `json:"circuit_state"`
+		Circuit       upstream.CircuitSnapshot `json:"circuit"`
 	}
 
 	healthStatus := make([]UpstreamHealth, 0, len(upstreams))
@@ -50,12 +53,15 @@ func AdminGetUpstreamHealth(c *gin.Context) {
 			lastChecked = u.LastChecked.Format("2006-01-02 15:04:05")
 		}
 
+		circuit := breaker.Snapshot(u.ID)
 		healthStatus = append(healthStatus, UpstreamHealth{
 			ID:           u.ID,
 			Name:         u.Name,
 			Status:       u.Status,
 			FailureCount: checker.GetFailureCount(u.ID),
 			LastChecked:  lastChecked,
+			CircuitState: circuit.State,
+			Circuit:      circuit,
 		})
 	}
 
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/modelalias"
+	"codex-gateway/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelAliasRuleRequest is the body of create and update requests. Enabled is a
+// pointer so an omitted field keeps new rules enabled.
+type modelAliasRuleRequest struct {
+	MatchType       string `json:"match_type"`
+	Pattern         string `json:"pattern"`
+	Target          string `json:"target"`
+	ReasoningEffort string `json:"reasoning_effort"`
+	Priority        *int   `json:"priority"`
+	Enabled         *bool  `json:"enabled"`
+	Description     string `json:"description"`
+}
+
+// apply copies the request onto a rule, keeping the rule's priority and
+// enabled flag when they are omitted
+func (r modelAliasRuleRequest) apply(rule *models.ModelAliasRule) {
+	rule.MatchType = r.MatchType
+	rule.Pattern = r.Pattern
+	rule.Target = r.Target
+	rule.ReasoningEffort = r.ReasoningEffort
+	rule.Description = r.Description
+	if r.Priority != nil {
+		rule.Priority = *r.Priority
+	}
+	if r.Enabled != nil {
+		rule.Enabled = *r.Enabled
+	}
+}
+
+// AdminListModelAliasRules lists all model alias rules in evaluation order
+func AdminListModelAliasRules(c *gin.Context) {
+	var rules []models.ModelAliasRule
+	if err := database.DB.Order("priority ASC, id ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch model alias rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// AdminCreateModelAliasRule creates a model alias rule
+func AdminCreateModelAliasRule(c *gin.Context) {
+	var req modelAliasRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	rule := models.ModelAliasRule{Priority: 100, Enabled: true}
+	req.apply(&rule)
+	if err := modelalias.Validate(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create model alias rule"})
+		return
+	}
+
+	modelalias.LoadFromDB()
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// AdminUpdateModelAliasRule updates a model alias rule
+func AdminUpdateModelAliasRule(c *gin.Context) {
+	id := c.Param("id")
+
+	var rule models.ModelAliasRule
+	if err := database.DB.Where("id = ?", id).First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model alias rule not found"})
+		return
+	}
+
+	var req modelAliasRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	req.apply(&rule)
+	if err := modelalias.Validate(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update model alias rule"})
+		return
+	}
+
+	modelalias.LoadFromDB()
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// AdminDeleteModelAliasRule deletes a model alias rule
+func AdminDeleteModelAliasRule(c *gin.Context) {
+	id := c.Param("id")
+
+	result := database.DB.Delete(&models.ModelAliasRule{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete model alias rule"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model alias rule not found"})
+		return
+	}
+
+	modelalias.LoadFromDB()
+
+	c.JSON(http.StatusOK, gin.H{"message": "model alias rule deleted successfully"})
+}
+
+// AdminResolveModelAlias shows what a requested model resolves to under the
+// current rules and settings
+// GET /api/admin/model-aliases/resolve?model=
+func AdminResolveModelAlias(c *gin.Context) {
+	model := c.Query("model")
+	if model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	resolution, err := modelalias.Resolve(model)
+	if errors.Is(err, modelalias.ErrUnknownModel) {
+		c.JSON(http.StatusNotFound, gin.H{"error": modelNotSupportedMessage(model)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"model":            model,
+		"resolved_model":   resolution.Model,
+		"reasoning_effort": resolution.ReasoningEffort,
+		"rule_id":          resolution.RuleID,
+	})
+}
@@ -1,26 +1,46 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"codex-gateway/internal/config"
 	"codex-gateway/internal/database"
+	"codex-gateway/internal/modelalias"
 	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// AdminListPricing lists all model pricing
+// AdminListPricing lists the price in effect for each model and the scheduled
+// price changes
 func AdminListPricing(c *gin.Context) {
+	now := time.Now()
+
 	var pricing []models.ModelPricing
-	if err := database.DB.Order("model_name ASC").Find(&pricing).Error; err != nil {
+	if err := database.DB.Scopes(database.EffectiveAt(now)).Order("model_name ASC").Find(&pricing).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch pricing"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"pricing": pricing})
+	var scheduled []models.ModelPricing
+	if err := database.DB.Where("effective_from > ?", now).Order("effective_from ASC, model_name ASC").Find(&scheduled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch pricing"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pricing": pricing, "scheduled": scheduled})
 }
 
-// AdminUpdatePricing updates a model's pricing
+// AdminUpdatePricing starts a new price version of a model, based on the given
+// version. The change applies now, or at effective_from when scheduled.
 func AdminUpdatePricing(c *gin.Context) {
 	id := c.Param("id")
 
@@ -31,11 +51,19 @@ func AdminUpdatePricing(c *gin.Context) {
 	}
 
 	var req struct {
-		InputPricePer1k         *float64 `json:"input_price_per_1k"`
-		OutputPricePer1k        *float64 `json:"output_price_per_1k"`
-		CacheReadPricePer1k     *float64 `json:"cache_read_price_per_1k"`
-		CacheCreationPricePer1k *float64 `json:"cache_creation_price_per_1k"`
-		MarkupMultiplier        *float64 `json:"markup_multiplier"`
+		InputPricePer1k         *float64   `json:"input_price_per_1k"`
+		OutputPricePer1k        *float64   `json:"output_price_per_1k"`
+		CacheReadPricePer1k     *float64   `json:"cache_read_price_per_1k"`
+		CacheCreationPricePer1k *float64   `json:"cache_creation_price_per_1k"`
+		ReasoningPricePer1k     *float64   `json:"reasoning_price_per_1k"`
+		TierThresholdTokens     *int       `json:"tier_threshold_tokens"`
+		TierInputPricePer1k     *float64   `json:"tier_input_price_per_1k"`
+		TierOutputPricePer1k    *float64   `json:"tier_output_price_per_1k"`
+		TierCacheReadPricePer1k *float64   `json:"tier_cache_read_price_per_1k"`
+		MaxInputTokens          *int       `json:"max_input_tokens"`
+		MaxOutputTokens         *int       `json:"max_output_tokens"`
+		MarkupMultiplier        *float64   `json:"markup_multiplier"`
+		EffectiveFrom           *time.Time `json:"effective_from"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -56,16 +84,177 @@ func AdminUpdatePricing(c *gin.Context) {
 	if req.CacheCreationPricePer1k != nil {
 		pricing.CacheCreationPricePer1k = *req.CacheCreationPricePer1k
 	}
+	if req.ReasoningPricePer1k != nil {
+		pricing.ReasoningPricePer1k = *req.ReasoningPricePer1k
+	}
+	if req.TierThresholdTokens != nil {
+		pricing.TierThresholdTokens = *req.TierThresholdTokens
+	}
+	if req.TierInputPricePer1k != nil {
+		pricing.TierInputPricePer1k = *req.TierInputPricePer1k
+	}
+	if req.TierOutputPricePer1k != nil {
+		pricing.TierOutputPricePer1k = *req.TierOutputPricePer1k
+	}
+	if req.TierCacheReadPricePer1k != nil {
+		pricing.TierCacheReadPricePer1k = *req.TierCacheReadPricePer1k
+	}
+	if req.MaxInputTokens != nil {
+		pricing.MaxInputTokens = *req.MaxInputTokens
+	}
+	if req.MaxOutputTokens != nil {
+		pricing.MaxOutputTokens = *req.MaxOutputTokens
+	}
 	if req.MarkupMultiplier != nil {
 		pricing.MarkupMultiplier = *req.MarkupMultiplier
 	}
+	pricing.EffectiveFrom = time.Time{}
+	if req.EffectiveFrom != nil {
+		pricing.EffectiveFrom = *req.EffectiveFrom
+	}
+
+	addPriceVersion(c, pricing, http.StatusOK)
+}
+
+// AdminListPricingVersions lists the price history of a model, or of all
+// models, newest first
+// GET /api/admin/pricing/versions?model=
+func AdminListPricingVersions(c *gin.Context) {
+	query := database.DB.Order("effective_from DESC, model_name ASC")
+	if model := c.Query("model"); model != "" {
+		query = query.Where("model_name = ?", model)
+	}
+
+	var versions []models.ModelPricing
+	if err := query.Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch pricing versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// AdminCreatePricingVersion adds a price version for a model, effective now or
+// at effective_from when scheduled
+// POST /api/admin/pricing/versions
+func AdminCreatePricingVersion(c *gin.Context) {
+	var req struct {
+		ModelName               string     `json:"model_name" binding:"required"`
+		InputPricePer1k         float64    `json:"input_price_per_1k"`
+		OutputPricePer1k        float64    `json:"output_price_per_1k"`
+		CacheReadPricePer1k     float64    `json:"cache_read_price_per_1k"`
+		CacheCreationPricePer1k float64    `json:"cache_creation_price_per_1k"`
+		ReasoningPricePer1k     float64    `json:"reasoning_price_per_1k"`
+		TierThresholdTokens     int        `json:"tier_threshold_tokens"`
+		TierInputPricePer1k     float64    `json:"tier_input_price_per_1k"`
+		TierOutputPricePer1k    float64    `json:"tier_output_price_per_1k"`
+		TierCacheReadPricePer1k float64    `json:"tier_cache_read_price_per_1k"`
+		MaxInputTokens          int        `json:"max_input_tokens"`
+		MaxOutputTokens         int        `json:"max_output_tokens"`
+		MarkupMultiplier        float64    `json:"markup_multiplier"`
+		EffectiveFrom           *time.Time `json:"effective_from"`
+	}
 
-	if err := database.DB.Save(&pricing).Error; err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	version := models.ModelPricing{
+		ModelName:               req.ModelName,
+		InputPricePer1k:         req.InputPricePer1k,
+		OutputPricePer1k:        req.OutputPricePer1k,
+		CacheReadPricePer1k:     req.CacheReadPricePer1k,
+		CacheCreationPricePer1k: req.CacheCreationPricePer1k,
+		ReasoningPricePer1k:     req.ReasoningPricePer1k,
+		TierThresholdTokens:     req.TierThresholdTokens,
+		TierInputPricePer1k:     req.TierInputPricePer1k,
+		TierOutputPricePer1k:    req.TierOutputPricePer1k,
+		TierCacheReadPricePer1k: req.TierCacheReadPricePer1k,
+		MaxInputTokens:          req.MaxInputTokens,
+		MaxOutputTokens:         req.MaxOutputTokens,
+		MarkupMultiplier:        req.MarkupMultiplier,
+	}
+	if version.MarkupMultiplier == 0 {
+		version.MarkupMultiplier = 1.5
+	}
+	if req.EffectiveFrom != nil {
+		version.EffectiveFrom = *req.EffectiveFrom
+	}
+
+	addPriceVersion(c, version, http.StatusCreated)
+}
+
+// AdminCancelPricingVersion cancels a scheduled price version
+// DELETE /api/admin/pricing/versions/:id
+func AdminCancelPricingVersion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return database.CancelPriceVersion(tx, uint(id))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pricing version not found"})
+		return
+	}
+	if errors.Is(err, database.ErrPriceVersionNotScheduled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel pricing version"})
+		return
+	}
+
+	pricing.Invalidate()
+	modelalias.LoadFromDB()
+
+	c.JSON(http.StatusOK, gin.H{"message": "pricing version cancelled successfully"})
+}
+
+// addPriceVersion validates and stores a price version and responds with it
+func addPriceVersion(c *gin.Context, version models.ModelPricing, status int) {
+	if version.InputPricePer1k < 0 || version.OutputPricePer1k < 0 ||
+		version.CacheReadPricePer1k < 0 || version.CacheCreationPricePer1k < 0 ||
+		version.ReasoningPricePer1k < 0 || version.TierInputPricePer1k < 0 ||
+		version.TierOutputPricePer1k < 0 || version.TierCacheReadPricePer1k < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prices cannot be negative"})
+		return
+	}
+	if version.TierThresholdTokens < 0 || version.MaxInputTokens < 0 || version.MaxOutputTokens < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token limits cannot be negative"})
+		return
+	}
+	if version.MarkupMultiplier <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "markup_multiplier must be positive"})
+		return
+	}
+	// Past versions already priced requests; rewriting them would change history
+	if !version.EffectiveFrom.IsZero() && version.EffectiveFrom.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "effective_from cannot be in the past"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return database.AddPriceVersion(tx, &version)
+	})
+	if errors.Is(err, database.ErrPriceVersionExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update pricing"})
 		return
 	}
 
-	c.JSON(http.StatusOK, pricing)
+	pricing.Invalidate()
+	modelalias.LoadFromDB()
+
+	c.JSON(status, version)
 }
 
 // AdminBatchUpdateMarkup updates markup multiplier for all models
@@ -79,42 +268,66 @@ func AdminBatchUpdateMarkup(c *gin.Context) {
 		return
 	}
 
-	// Update all models - use Where clause to ensure all records are updated
-	result := database.DB.Model(&models.ModelPricing{}).
-		Where("id > ?", 0).
-		Updates(map[string]interface{}{
-			"markup_multiplier": req.MarkupMultiplier,
-		})
+	// Start a new version for every model with a price in effect
+	var current []models.ModelPricing
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(database.EffectiveAt(time.Now())).Find(&current).Error; err != nil {
+			return err
+		}
+		for _, version := range current {
+			version.MarkupMultiplier = req.MarkupMultiplier
+			version.EffectiveFrom = time.Time{}
+			if err := database.AddPriceVersion(tx, &version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update markup"})
 		return
 	}
 
+	pricing.Invalidate()
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":           "markup updated successfully",
-		"updated_count":     result.RowsAffected,
+		"updated_count":     len(current),
 		"markup_multiplier": req.MarkupMultiplier,
 	})
 }
 
 // AdminResetPricing resets all model pricing to correct values
 func AdminResetPricing(c *gin.Context) {
-	// Delete all existing pricing
-	if err := database.DB.Where("model_name LIKE ?", "gpt-%").Delete(&models.ModelPricing{}).Error; err != nil {
+	// End all existing pricing, keeping past versions for usage history
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("model_name LIKE ? AND effective_from > ?", "gpt-%", now).Delete(&models.ModelPricing{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ModelPricing{}).
+			Scopes(database.EffectiveAt(now)).
+			Where("model_name LIKE ?", "gpt-%").
+			Update("effective_to", now).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete old pricing"})
 		return
 	}
 
-	// Re-seed pricing
-	if err := database.SeedCodexPricing(); err != nil {
+	// Re-seed pricing; old prices are ended either way
+	err = database.SeedCodexPricing()
+	pricing.Invalidate()
+	modelalias.LoadFromDB()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to seed pricing"})
 		return
 	}
 
 	// Get updated pricing to return
 	var pricing []models.ModelPricing
-	if err := database.DB.Where("model_name LIKE ?", "gpt-%").Find(&pricing).Error; err != nil {
+	if err := database.DB.Scopes(database.EffectiveAt(time.Now())).Where("model_name LIKE ?", "gpt-%").Find(&pricing).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch pricing"})
 		return
 	}
@@ -124,3 +337,91 @@ func AdminResetPricing(c *gin.Context) {
 		"pricing": pricing,
 	})
 }
+
+// maxPricingUploadSize bounds uploaded price files; LiteLLM's full list is a
+// few megabytes
+const maxPricingUploadSize = 32 << 20
+
+// AdminSyncPricing fetches prices from the configured source, or the one named
+// by ?source=, and applies them. With ?dry_run=true only the changes are returned.
+// POST /api/admin/pricing/sync
+func AdminSyncPricing(c *gin.Context) {
+	service := pricing.GetService()
+
+	source := service.Source()
+	if name := c.Query("source"); name != "" {
+		var err error
+		source, err = pricing.NewSource(name, pricing.Options{
+			URL:  config.AppConfig.PricingURL,
+			Path: config.AppConfig.PricingPath,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	runPricingSync(c, service, source, http.StatusBadGateway)
+}
+
+// AdminUploadPricing syncs prices from an uploaded LiteLLM JSON file or YAML
+// manifest (multipart field "file"). With ?dry_run=true only the changes are returned.
+// POST /api/admin/pricing/upload
+func AdminUploadPricing(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPricingUploadSize)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return
+	}
+
+	runPricingSync(c, pricing.GetService(), pricing.NewUploadSource(file.Filename, data), http.StatusBadRequest)
+}
+
+// runPricingSync previews or applies a sync from source and responds with the
+// changes, or with failStatus when the source cannot be read
+func runPricingSync(c *gin.Context, service *pricing.PricingService, source pricing.Source, failStatus int) {
+	admin := c.MustGet("admin").(models.User)
+
+	var result *pricing.SyncResult
+	var err error
+	if c.Query("dry_run") == "true" {
+		result, err = service.Preview(c.Request.Context(), source)
+	} else {
+		result, err = service.Sync(c.Request.Context(), source)
+	}
+	if err != nil {
+		c.JSON(failStatus, gin.H{"error": fmt.Sprintf("failed to load pricing from %s: %v", source.Name(), err)})
+		return
+	}
+	if result.Changes == nil {
+		result.Changes = []pricing.PriceChange{}
+	}
+
+	if !result.DryRun {
+		modelalias.LoadFromDB()
+
+		entry := pricing.SyncAuditLog(result.Source, result.Changes, result.Applied)
+		entry.AdminID = &admin.ID
+		entry.IPAddress = c.ClientIP()
+		if err := database.DB.Create(&entry).Error; err != nil {
+			log.Printf("[Pricing] Failed to audit sync: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pricingRuleRequest is the body of create and update requests. Enabled is a
+// pointer so an omitted field keeps new rules enabled.
+type pricingRuleRequest struct {
+	Scope            string   `json:"scope"`
+	Target           string   `json:"target"`
+	ModelName        string   `json:"model_name"`
+	MarkupMultiplier *float64 `json:"markup_multiplier"`
+	DiscountPercent  float64  `json:"discount_percent"`
+	DiscountPer1k    float64  `json:"discount_per_1k"`
+	InputPricePer1k  *float64 `json:"input_price_per_1k"`
+	OutputPricePer1k *float64 `json:"output_price_per_1k"`
+	Enabled          *bool    `json:"enabled"`
+	Description      string   `json:"description"`
+}
+
+// apply copies the request onto a rule, keeping the rule's enabled flag when
+// it is omitted
+func (r pricingRuleRequest) apply(rule *models.PricingRule) {
+	rule.Scope = r.Scope
+	rule.Target = r.Target
+	rule.ModelName = r.ModelName
+	rule.MarkupMultiplier = r.MarkupMultiplier
+	rule.DiscountPercent = r.DiscountPercent
+	rule.DiscountPer1k = r.DiscountPer1k
+	rule.InputPricePer1k = r.InputPricePer1k
+	rule.OutputPricePer1k = r.OutputPricePer1k
+	rule.Description = r.Description
+	if r.Enabled != nil {
+		rule.Enabled = *r.Enabled
+	}
+}
+
+// AdminListPricingRules lists all pricing rules, optionally of one scope
+// GET /api/admin/pricing-rules?scope=
+func AdminListPricingRules(c *gin.Context) {
+	query := database.DB.Order("scope ASC, target ASC, model_name ASC")
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+
+	var rules []models.PricingRule
+	if err := query.Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch pricing rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// AdminCreatePricingRule creates a pricing rule
+func AdminCreatePricingRule(c *gin.Context) {
+	var req pricingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	rule := models.PricingRule{Enabled: true}
+	req.apply(&rule)
+	if !savePricingRule(c, &rule) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// AdminUpdatePricingRule updates a pricing rule
+func AdminUpdatePricingRule(c *gin.Context) {
+	id := c.Param("id")
+
+	var rule models.PricingRule
+	if err := database.DB.Where("id = ?", id).First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pricing rule not found"})
+		return
+	}
+
+	var req pricingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	req.apply(&rule)
+	if !savePricingRule(c, &rule) {
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// AdminDeletePricingRule deletes a pricing rule. Usage logs keep its ID.
+func AdminDeletePricingRule(c *gin.Context) {
+	id := c.Param("id")
+
+	result := database.DB.Delete(&models.PricingRule{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete pricing rule"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pricing rule not found"})
+		return
+	}
+
+	pricing.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"message": "pricing rule deleted successfully"})
+}
+
+// savePricingRule validates and stores a rule, responding with the error and
+// returning false when it cannot be saved
+func savePricingRule(c *gin.Context, rule *models.PricingRule) bool {
+	if err := pricing.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	var duplicates int64
+	database.DB.Model(&models.PricingRule{}).
+		Where("scope = ? AND target = ? AND model_name = ? AND id <> ?", rule.Scope, rule.Target, rule.ModelName, rule.ID).
+		Count(&duplicates)
+	if duplicates > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "a pricing rule for this target and model already exists"})
+		return false
+	}
+
+	if err := database.DB.Save(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save pricing rule"})
+		return false
+	}
+
+	pricing.Invalidate()
+	return true
+}
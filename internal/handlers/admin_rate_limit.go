@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminListRateLimitPolicies lists all rate limit policies
+func AdminListRateLimitPolicies(c *gin.Context) {
+	var policies []models.RateLimitPolicy
+
+	query := database.DB.Order("id ASC")
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.Find(&policies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rate limit policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// AdminCreateRateLimitPolicy creates a rate limit policy
+func AdminCreateRateLimitPolicy(c *gin.Context) {
+	var req models.RateLimitPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	req.ID = 0
+	if msg := validateRateLimitPolicy(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.Create(&req).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create rate limit policy"})
+		return
+	}
+
+	ratelimit.LoadFromDB()
+
+	c.JSON(http.StatusCreated, req)
+}
+
+// AdminUpdateRateLimitPolicy updates a rate limit policy
+func AdminUpdateRateLimitPolicy(c *gin.Context) {
+	id := c.Param("id")
+
+	var policy models.RateLimitPolicy
+	if err := database.DB.Where("id = ?", id).First(&policy).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rate limit policy not found"})
+		return
+	}
+
+	var req models.RateLimitPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if msg := validateRateLimitPolicy(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	policy.Scope = req.Scope
+	policy.UserID = req.UserID
+	policy.APIKeyID = req.APIKeyID
+	policy.Model = req.Model
+	policy.RPM = req.RPM
+	policy.Burst = req.Burst
+	policy.TPM = req.TPM
+	policy.MaxConcurrent = req.MaxConcurrent
+
+	if err := database.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update rate limit policy"})
+		return
+	}
+
+	ratelimit.LoadFromDB()
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// AdminDeleteRateLimitPolicy deletes a rate limit policy
+func AdminDeleteRateLimitPolicy(c *gin.Context) {
+	id := c.Param("id")
+
+	result := database.DB.Delete(&models.RateLimitPolicy{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete rate limit policy"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rate limit policy not found"})
+		return
+	}
+
+	ratelimit.LoadFromDB()
+
+	c.JSON(http.StatusOK, gin.H{"message": "rate limit policy deleted successfully"})
+}
+
+// validateRateLimitPolicy checks the policy targets exactly what its scope
+// names, clearing targets that do not apply. Returns an error message or "".
+func validateRateLimitPolicy(p *models.RateLimitPolicy) string {
+	switch p.Scope {
+	case ratelimit.ScopeSystem:
+		p.UserID = nil
+		p.APIKeyID = nil
+	case ratelimit.ScopeUser:
+		if p.UserID == nil {
+			return "user_id is required for user scope"
+		}
+		p.APIKeyID = nil
+		if err := database.DB.Select("id").First(&models.User{}, "id = ?", *p.UserID).Error; err != nil {
+			return "user not found"
+		}
+	case ratelimit.ScopeAPIKey:
+		if p.APIKeyID == nil {
+			return "api_key_id is required for api_key scope"
+		}
+		p.UserID = nil
+		if err := database.DB.Select("id").First(&models.APIKey{}, *p.APIKeyID).Error; err != nil {
+			return "api key not found"
+		}
+	default:
+		return "scope must be system, user or api_key"
+	}
+
+	if p.Model != "" {
+		if _, err := path.Match(p.Model, ""); err != nil {
+			return "invalid model pattern"
+		}
+	}
+	return ""
+}
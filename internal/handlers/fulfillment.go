@@ -57,6 +57,24 @@ func createUserPackage(tx *gorm.DB, userID uuid.UUID, pkg *models.Package) (*mod
 	return &userPackage, nil
 }
 
+func createOrganizationPackage(tx *gorm.DB, orgID, purchasedByID uuid.UUID, pkg *models.Package) error {
+	startDate := time.Now().In(database.AsiaShanghai)
+	endDate := startDate.AddDate(0, 0, pkg.DurationDays)
+
+	return tx.Create(&models.OrganizationPackage{
+		OrganizationID: orgID,
+		PurchasedByID:  purchasedByID,
+		PackageID:      pkg.ID,
+		PackageName:    pkg.Name,
+		PackagePrice:   pkg.Price,
+		DurationDays:   pkg.DurationDays,
+		DailyLimit:     pkg.DailyLimit,
+		StartDate:      startDate,
+		EndDate:        endDate,
+		Status:         "active",
+	}).Error
+}
+
 func fulfillPackagePurchase(tx *gorm.DB, order *models.PaymentOrder) error {
 	if order.PackageID == nil {
 		return fmt.Errorf("missing package ID")
@@ -71,7 +89,11 @@ func fulfillPackagePurchase(tx *gorm.DB, order *models.PaymentOrder) error {
 		return err
 	}
 
-	if _, err := createUserPackage(tx, order.UserID, &pkg); err != nil {
+	if order.OrganizationID != nil {
+		if err := createOrganizationPackage(tx, *order.OrganizationID, order.UserID, &pkg); err != nil {
+			return err
+		}
+	} else if _, err := createUserPackage(tx, order.UserID, &pkg); err != nil {
 		return err
 	}
 
@@ -81,10 +103,11 @@ func fulfillPackagePurchase(tx *gorm.DB, order *models.PaymentOrder) error {
 	}
 
 	transaction := models.Transaction{
-		UserID:      order.UserID,
-		Amount:      order.Amount,
-		Type:        "package_purchase",
-		Description: description,
+		UserID:         order.UserID,
+		OrganizationID: order.OrganizationID,
+		Amount:         order.Amount,
+		Type:           "package_purchase",
+		Description:    description,
 	}
 
 	return tx.Create(&transaction).Error
@@ -3,30 +3,109 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
+	"codex-gateway/internal/billing"
 	"codex-gateway/internal/database"
 	"codex-gateway/internal/middleware"
 	"codex-gateway/internal/models"
+	"codex-gateway/internal/organization"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type CreateKeyRequest struct {
-	Name       string   `json:"name" binding:"required"`
-	QuotaLimit *float64 `json:"quota_limit"`
+	Name             string     `json:"name" binding:"required"`
+	QuotaLimit       *float64   `json:"quota_limit"`
+	QuotaType        string     `json:"quota_type"`   // cost (default) or tokens
+	QuotaPeriod      string     `json:"quota_period"` // lifetime (default), daily, weekly or monthly
+	AllowedModels    []string   `json:"allowed_models"`
+	AllowedEndpoints []string   `json:"allowed_endpoints"`
+	AllowedIPs       []string   `json:"allowed_ips"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	RateLimitRPM     int        `json:"rate_limit_rpm"`
+	OrganizationID   *uuid.UUID `json:"organization_id"` // Create only: bill the key to this organization
 }
 
+// applyKeyScopes copies the optional restrictions and budget onto the key and validates them
+func (req *CreateKeyRequest) applyKeyScopes(key *models.APIKey) error {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	key.AllowedModels = req.AllowedModels
+	key.AllowedEndpoints = req.AllowedEndpoints
+	key.AllowedIPs = req.AllowedIPs
+	key.ExpiresAt = req.ExpiresAt
+	key.RateLimitRPM = req.RateLimitRPM
+	if err := middleware.ValidateKeyScopes(key); err != nil {
+		return err
+	}
+
+	key.QuotaLimit = req.QuotaLimit
+	key.QuotaType = req.QuotaType
+	key.QuotaPeriod = req.QuotaPeriod
+	return billing.ValidateKeyQuota(key)
+}
+
+// apiKeyResponse is an API key with its budget in the current period
+type apiKeyResponse struct {
+	models.APIKey
+	Budget billing.KeyBudget `json:"budget"`
+}
+
+// managedKeys limits a query to keys the user may manage: their own, and all
+// keys of organizations they own or administer
+func managedKeys(user models.User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		managedOrgs := database.DB.Model(&models.OrganizationMember{}).
+			Select("organization_id").
+			Where("user_id = ? AND role IN ?", user.ID, []string{organization.RoleOwner, organization.RoleAdmin})
+		return db.Where("(user_id = ? OR organization_id IN (?))", user.ID, managedOrgs)
+	}
+}
+
+// ListAPIKeys lists the user's keys, or an organization's keys with ?organization_id=
+// (all of them for owners and admins, the member's own otherwise)
 func ListAPIKeys(c *gin.Context) {
 	user := c.MustGet("user").(models.User)
 	var keys []models.APIKey
 
-	if err := database.DB.Where("user_id = ?", user.ID).Find(&keys).Error; err != nil {
+	query := database.DB.Where("user_id = ?", user.ID)
+	if orgIDStr := c.Query("organization_id"); orgIDStr != "" {
+		orgID, err := uuid.Parse(orgIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization_id"})
+			return
+		}
+		member, err := organization.Membership(orgID, user.ID)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		query = database.DB.Where("organization_id = ?", orgID)
+		if !organization.CanManage(member.Role) {
+			query = query.Where("user_id = ?", user.ID)
+		}
+	}
+
+	if err := query.Find(&keys).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch keys"})
 		return
 	}
 
-	c.JSON(http.StatusOK, keys)
+	now := time.Now()
+	response := make([]apiKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = apiKeyResponse{APIKey: keys[i], Budget: billing.GetKeyBudget(&keys[i], now)}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func CreateAPIKey(c *gin.Context) {
@@ -37,22 +116,31 @@ func CreateAPIKey(c *gin.Context) {
 		return
 	}
 
-	randomBytes := make([]byte, 24)
-	if _, err := rand.Read(randomBytes); err != nil {
+	rawKey, err := generateAPIKey()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate key"})
 		return
 	}
-	rawKey := "sk-" + hex.EncodeToString(randomBytes)
 
 	keyHash := middleware.HashAPIKey(rawKey)
 
 	apiKey := models.APIKey{
-		UserID:     user.ID,
-		KeyHash:    keyHash,
-		KeyPrefix:  rawKey[:7],
-		Name:       req.Name,
-		QuotaLimit: req.QuotaLimit,
-		Status:     "active",
+		UserID:    user.ID,
+		KeyHash:   keyHash,
+		KeyPrefix: rawKey[:7],
+		Name:      req.Name,
+		Status:    "active",
+	}
+	if err := req.applyKeyScopes(&apiKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.OrganizationID != nil {
+		if _, err := organization.Membership(*req.OrganizationID, user.ID); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		apiKey.OrganizationID = req.OrganizationID
 	}
 
 	if err := database.DB.Create(&apiKey).Error; err != nil {
@@ -67,11 +155,137 @@ func CreateAPIKey(c *gin.Context) {
 	})
 }
 
+// UpdateAPIKey changes a key's name, quota and restrictions
+func UpdateAPIKey(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	id := c.Param("id")
+
+	var apiKey models.APIKey
+	if err := database.DB.Scopes(managedKeys(user)).Where("id = ?", id).First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+
+	var req CreateKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previousType, previousPeriod := apiKey.QuotaType, apiKey.QuotaPeriod
+	apiKey.Name = req.Name
+	if err := req.applyKeyScopes(&apiKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Usage counted in other units or another window no longer applies
+	if apiKey.QuotaType != previousType || apiKey.QuotaPeriod != previousPeriod {
+		apiKey.QuotaUsed = 0
+		apiKey.QuotaPeriodStart = nil
+	}
+
+	if err := database.DB.Model(&apiKey).Select(
+		"name", "allowed_models", "allowed_endpoints", "allowed_ips", "expires_at", "rate_limit_rpm",
+		"quota_limit", "quota_type", "quota_period", "quota_used", "quota_period_start",
+	).Updates(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeyResponse{APIKey: apiKey, Budget: billing.GetKeyBudget(&apiKey, time.Now())})
+}
+
+// Rotation grace period bounds, in hours
+const (
+	defaultRotationGraceHours = 24
+	maxRotationGraceHours     = 30 * 24
+)
+
+// RotateAPIKey issues a new secret for a key. The previous secret keeps working
+// for the grace period so clients can be switched over without an outage.
+// Only the key's owner may rotate it, as the response carries the new secret;
+// organization admins can disable or delete members' keys instead.
+func RotateAPIKey(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	id := c.Param("id")
+
+	var req struct {
+		GracePeriodHours *int `json:"grace_period_hours"` // 0 revokes the old secret immediately
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	graceHours := defaultRotationGraceHours
+	if req.GracePeriodHours != nil {
+		graceHours = *req.GracePeriodHours
+	}
+	if graceHours < 0 || graceHours > maxRotationGraceHours {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("grace_period_hours must be between 0 and %d", maxRotationGraceHours)})
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := database.DB.Where("id = ? AND user_id = ?", id, user.ID).First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+
+	rawKey, err := generateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate key"})
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"key_hash":                middleware.HashAPIKey(rawKey),
+		"key_prefix":              rawKey[:7],
+		"previous_key_hash":       "",
+		"previous_key_expires_at": nil,
+		"rotated_at":              now,
+	}
+	if graceHours > 0 {
+		updates["previous_key_hash"] = apiKey.KeyHash
+		updates["previous_key_expires_at"] = now.Add(time.Duration(graceHours) * time.Hour)
+	}
+
+	// Guard on the old hash so concurrent rotations cannot both succeed
+	result := database.DB.Model(&models.APIKey{}).
+		Where("id = ? AND key_hash = ?", apiKey.ID, apiKey.KeyHash).
+		Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rotate key"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "key was rotated concurrently, please retry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                      apiKey.ID,
+		"key":                     rawKey,
+		"name":                    apiKey.Name,
+		"previous_key_expires_at": updates["previous_key_expires_at"],
+	})
+}
+
+// generateAPIKey returns a new random secret
+func generateAPIKey() (string, error) {
+	randomBytes := make([]byte, 24)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return "sk-" + hex.EncodeToString(randomBytes), nil
+}
+
 func DeleteAPIKey(c *gin.Context) {
 	user := c.MustGet("user").(models.User)
 	id := c.Param("id")
 
-	if err := database.DB.Where("id = ? AND user_id = ?", id, user.ID).Delete(&models.APIKey{}).Error; err != nil {
+	if err := database.DB.Scopes(managedKeys(user)).Where("id = ?", id).Delete(&models.APIKey{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete key"})
 		return
 	}
@@ -91,7 +305,7 @@ func UpdateAPIKeyStatus(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Model(&models.APIKey{}).Where("id = ? AND user_id = ?", id, user.ID).Update("status", req.Status).Error; err != nil {
+	if err := database.DB.Model(&models.APIKey{}).Scopes(managedKeys(user)).Where("id = ?", id).Update("status", req.Status).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update status"})
 		return
 	}
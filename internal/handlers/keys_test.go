@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/organization"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRotateAPIKeyOwnerOnly(t *testing.T) {
+	databasetest.Use(t, &models.User{}, &models.APIKey{}, &models.Organization{}, &models.OrganizationMember{})
+	org := models.Organization{Name: "Acme"}
+	owner := models.User{Email: "owner@example.com"}
+	admin := models.User{Email: "admin@example.com"}
+	member := models.User{Email: "member@example.com"}
+	for _, value := range []interface{}{&org, &owner, &admin, &member} {
+		if err := database.DB.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range []models.OrganizationMember{
+		{OrganizationID: org.ID, UserID: owner.ID, Role: organization.RoleOwner},
+		{OrganizationID: org.ID, UserID: admin.ID, Role: organization.RoleAdmin},
+		{OrganizationID: org.ID, UserID: member.ID, Role: organization.RoleMember},
+	} {
+		if err := database.DB.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		caller models.User
+		want   int
+	}{
+		{"key owner", member, http.StatusOK},
+		{"organization admin", admin, http.StatusNotFound},
+		{"organization owner", owner, http.StatusNotFound},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := models.APIKey{UserID: member.ID, OrganizationID: &org.ID, KeyHash: fmt.Sprintf("hash-%d", i), KeyPrefix: "sk-test"}
+			if err := database.DB.Create(&key).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/keys/rotate", nil)
+			c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(key.ID)}}
+			c.Set("user", tt.caller)
+			RotateAPIKey(c)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var stored models.APIKey
+			if err := database.DB.First(&stored, key.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if rotated := stored.KeyHash != key.KeyHash; rotated != (tt.want == http.StatusOK) {
+				t.Errorf("key rotated = %v, want %v", rotated, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestAPIKeyExpiresAt(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      int
+	}{
+		{"future", time.Now().Add(time.Hour), http.StatusOK},
+		{"past", time.Now().Add(-time.Hour), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databasetest.Use(t, &models.User{}, &models.APIKey{}, &models.Organization{}, &models.OrganizationMember{})
+			user := models.User{Email: "user@example.com"}
+			create(t, &user)
+			body := fmt.Sprintf(`{"name":"key","expires_at":%q}`, tt.expiresAt.Format(time.RFC3339))
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/keys", strings.NewReader(body))
+			c.Set("user", user)
+			CreateAPIKey(c)
+			if created := tt.want == http.StatusOK; (w.Code == http.StatusCreated) != created {
+				t.Errorf("create status = %d, want created %v: %s", w.Code, created, w.Body)
+			}
+
+			key := models.APIKey{UserID: user.ID, KeyHash: "hash", KeyPrefix: "sk-test", Status: "active"}
+			create(t, &key)
+			w = httptest.NewRecorder()
+			c, _ = gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/keys", strings.NewReader(body))
+			c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(key.ID)}}
+			c.Set("user", user)
+			UpdateAPIKey(c)
+			if w.Code != tt.want {
+				t.Errorf("update status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var stored models.APIKey
+			if err := database.DB.First(&stored, key.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if updated := stored.ExpiresAt != nil; updated != (tt.want == http.StatusOK) {
+				t.Errorf("stored expires_at = %v, want updated %v", stored.ExpiresAt, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"codex-gateway/internal/config"
+	"codex-gateway/internal/metrics"
+	"codex-gateway/internal/pricing"
+	"codex-gateway/internal/upstream"
+
+	"github.com/gin-gonic/gin"
+)
+
+var registerStateMetricsOnce sync.Once
+
+// Metrics serves gateway metrics on the public port. It requires the
+// METRICS_TOKEN bearer token; without one configured it is not routed.
+// GET /metrics
+func Metrics(c *gin.Context) {
+	token := config.AppConfig.MetricsToken
+	provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid metrics token"})
+		return
+	}
+
+	MetricsHandler().ServeHTTP(c.Writer, c.Request)
+}
+
+// MetricsHandler serves gateway metrics without authentication, for the
+// internal metrics listener
+func MetricsHandler() http.Handler {
+	registerStateMetricsOnce.Do(registerStateMetrics)
+	return metrics.Handler()
+}
+
+// registerStateMetrics adds gauges read from upstream and pricing state at scrape time
+func registerStateMetrics() {
+	metrics.NewGaugeFunc("gateway_upstream_info",
+		"Upstream metadata; always 1.", func() []metrics.GaugeSample {
+			var samples []metrics.GaugeSample
+			for _, u := range upstream.GetSelector().GetAllUpstreams() {
+				samples = append(samples, metrics.GaugeSample{
+					LabelValues: []string{metrics.UpstreamLabel(&u.ID), u.Name, u.Status},
+					Value:       1,
+				})
+			}
+			return samples
+		}, "upstream", "name", "status")
+
+	metrics.NewGaugeFunc("gateway_upstream_up",
+		"Whether the upstream passes health checks (1) or is marked unhealthy (0).", func() []metrics.GaugeSample {
+			var samples []metrics.GaugeSample
+			for _, u := range upstream.GetSelector().GetAllUpstreams() {
+				up := 0.0
+				if u.Status == "active" {
+					up = 1
+				}
+				samples = append(samples, metrics.GaugeSample{LabelValues: []string{metrics.UpstreamLabel(&u.ID)}, Value: up})
+			}
+			return samples
+		}, "upstream")
+
+	metrics.NewGaugeFunc("gateway_upstream_health_check_failures",
+		"Consecutive failed health checks.", func() []metrics.GaugeSample {
+			checker := upstream.GetHealthChecker()
+			var samples []metrics.GaugeSample
+			for _, u := range upstream.GetSelector().GetAllUpstreams() {
+				samples = append(samples, metrics.GaugeSample{
+					LabelValues: []string{metrics.UpstreamLabel(&u.ID)},
+					Value:       float64(checker.GetFailureCount(u.ID)),
+				})
+			}
+			return samples
+		}, "upstream")
+
+	circuitStates := []string{upstream.CircuitClosed, upstream.CircuitOpen, upstream.CircuitHalfOpen}
+	metrics.NewGaugeFunc("gateway_upstream_circuit_state",
+		"Circuit breaker state; 1 for the current state.", func() []metrics.GaugeSample {
+			breaker := upstream.GetCircuitBreaker()
+			var samples []metrics.GaugeSample
+			for _, u := range upstream.GetSelector().GetAllUpstreams() {
+				current := breaker.State(u.ID)
+				for _, state := range circuitStates {
+					value := 0.0
+					if state == current {
+						value = 1
+					}
+					samples = append(samples, metrics.GaugeSample{
+						LabelValues: []string{metrics.UpstreamLabel(&u.ID), state},
+						Value:       value,
+					})
+				}
+			}
+			return samples
+		}, "upstream", "state")
+
+	metrics.NewGaugeFunc("gateway_pricing_sync_age_seconds",
+		"Seconds since pricing data was last refreshed; -1 if never.", func() []metrics.GaugeSample {
+			return []metrics.GaugeSample{{Value: metrics.SecondsSince(pricing.GetService().LastUpdated())}}
+		})
+}
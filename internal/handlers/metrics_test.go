@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"codex-gateway/internal/config"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// The upstream gauges read the selector, which loads from the database
+	databasetest.Use(t, &models.CodexUpstream{}, &models.SystemSettings{})
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	tests := []struct {
+		name       string
+		token      string
+		provided   string
+		wantStatus int
+	}{
+		{"no token configured", "", "", http.StatusUnauthorized},
+		{"empty token sent to an unconfigured gateway", "", "Bearer ", http.StatusUnauthorized},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer nope", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig = &config.Config{MetricsToken: tt.token}
+			router := gin.New()
+			router.GET("/metrics", Metrics)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.provided != "" {
+				req.Header.Set("Authorization", tt.provided)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(w.Body.String(), "go_goroutines") {
+				t.Errorf("body is missing the registry's metrics:\n%s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"codex-gateway/internal/middleware"
+	"codex-gateway/internal/modelalias"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+	"codex-gateway/internal/upstream"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelInfo is an entry of the /v1/models list
+type modelInfo struct {
+	ID              string        `json:"id"`
+	Object          string        `json:"object"`
+	Created         int64         `json:"created"`
+	OwnedBy         string        `json:"owned_by"`
+	Root            string        `json:"root"` // Model the request is billed and served as
+	ContextWindow   int           `json:"context_window,omitempty"`
+	MaxOutputTokens int           `json:"max_output_tokens,omitempty"`
+	Pricing         modelPriceSet `json:"pricing"`
+}
+
+// modelPriceSet is what the gateway charges per 1k tokens, markup included
+type modelPriceSet struct {
+	InputPer1k         float64 `json:"input_per_1k"`
+	OutputPer1k        float64 `json:"output_per_1k"`
+	CacheReadPer1k     float64 `json:"cache_read_per_1k"`
+	CacheCreationPer1k float64 `json:"cache_creation_per_1k"`
+	ReasoningPer1k     float64 `json:"reasoning_per_1k,omitempty"`
+}
+
+// ListModels lists the models the calling API key can use
+// GET /v1/models
+func ListModels(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	apiKey := c.MustGet("api_key").(models.APIKey)
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   availableModels(user, apiKey),
+	})
+}
+
+// GetModel describes one model the calling API key can use
+// GET /v1/models/:model
+func GetModel(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	apiKey := c.MustGet("api_key").(models.APIKey)
+
+	id := c.Param("model")
+	for _, model := range availableModels(user, apiKey) {
+		if model.ID == id {
+			c.JSON(http.StatusOK, model)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": modelNotSupportedMessage(id)})
+}
+
+// availableModels builds the model list from priced models and their exact
+// alias rules, keeping those an active upstream serves and the key may use.
+// Prices include the caller's pricing rules.
+func availableModels(user models.User, apiKey models.APIKey) []modelInfo {
+	priced := pricing.CurrentPrices()
+	byName := make(map[string]models.ModelPricing, len(priced))
+	for _, p := range priced {
+		byName[p.ModelName] = p
+	}
+
+	// Model name → model it is billed as
+	roots := make(map[string]string, len(priced))
+	for _, p := range priced {
+		roots[p.ModelName] = p.ModelName
+	}
+	for alias, rule := range modelalias.ExactAliases() {
+		if _, ok := byName[rule.Target]; ok {
+			if _, exists := byName[alias]; !exists {
+				roots[alias] = rule.Target
+			}
+		}
+	}
+
+	var active []models.CodexUpstream
+	for _, u := range upstream.GetSelector().GetAllUpstreams() {
+		if u.Status == "active" {
+			active = append(active, u)
+		}
+	}
+
+	service := pricing.GetService()
+	subject := pricingSubject(user, apiKey)
+	result := make([]modelInfo, 0, len(roots))
+	for id, root := range roots {
+		if !middleware.KeyAllowsModel(&apiKey, root) || !servedByAny(active, root) {
+			continue
+		}
+
+		p := byName[root]
+		pricing.ApplyRule(&p, pricing.MatchRule(subject, root))
+		info := modelInfo{
+			ID:      id,
+			Object:  "model",
+			Created: p.EffectiveFrom.Unix(),
+			OwnedBy: "openai",
+			Root:    root,
+			Pricing: modelPriceSet{
+				InputPer1k:         p.InputPricePer1k * p.MarkupMultiplier,
+				OutputPer1k:        p.OutputPricePer1k * p.MarkupMultiplier,
+				CacheReadPer1k:     p.CacheReadPricePer1k * p.MarkupMultiplier,
+				CacheCreationPer1k: p.CacheCreationPricePer1k * p.MarkupMultiplier,
+				ReasoningPer1k:     p.ReasoningPricePer1k * p.MarkupMultiplier,
+			},
+		}
+		// Limits synced onto the price version win over the loaded price list
+		info.ContextWindow = p.MaxInputTokens
+		info.MaxOutputTokens = p.MaxOutputTokens
+		if limits := service.GetModelPricing(root); limits != nil {
+			if info.ContextWindow == 0 {
+				info.ContextWindow = limits.MaxInputTokens
+			}
+			if info.MaxOutputTokens == 0 {
+				info.MaxOutputTokens = limits.MaxOutputTokens
+			}
+		}
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// servedByAny reports whether an active upstream serves the model. Without
+// active upstreams requests go to the settings fallback, which serves everything.
+func servedByAny(active []models.CodexUpstream, model string) bool {
+	if len(active) == 0 {
+		return true
+	}
+	for i := range active {
+		if upstream.SupportsModel(&active[i], model) {
+			return true
+		}
+	}
+	return false
+}
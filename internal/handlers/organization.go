@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"codex-gateway/internal/billing"
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/organization"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// invitationTTL is how long an organization invitation can be accepted
+const invitationTTL = 7 * 24 * time.Hour
+
+// ListOrganizations lists the organizations the user belongs to
+func ListOrganizations(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	type orgWithRole struct {
+		models.Organization
+		Role string `json:"role"`
+	}
+	var orgs []orgWithRole
+	if err := database.DB.Model(&models.Organization{}).
+		Select("organizations.*, organization_members.role").
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", user.ID).
+		Order("organizations.created_at ASC").
+		Scan(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// CreateOrganization creates an organization owned by the user
+func CreateOrganization(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req struct {
+		Name string `json:"name" binding:"required,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org := models.Organization{Name: strings.TrimSpace(req.Name), Status: "active"}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMember{
+			OrganizationID: org.ID,
+			UserID:         user.ID,
+			Role:           organization.RoleOwner,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// GetOrganization returns an organization with its active package and the user's role
+func GetOrganization(c *gin.Context) {
+	org, member, ok := loadOrganization(c, false)
+	if !ok {
+		return
+	}
+
+	today := database.GetToday()
+	var activePackage *models.OrganizationPackage
+	var pkg models.OrganizationPackage
+	if err := database.DB.Where("organization_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		org.ID, "active", today, today).
+		Order("end_date ASC").
+		First(&pkg).Error; err == nil {
+		activePackage = &pkg
+	}
+
+	var todayUsage models.OrganizationDailyUsage
+	database.DB.Where("organization_id = ? AND date = ?", org.ID, today).First(&todayUsage)
+
+	var memberCount int64
+	database.DB.Model(&models.OrganizationMember{}).Where("organization_id = ?", org.ID).Count(&memberCount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"organization":   org,
+		"role":           member.Role,
+		"member_count":   memberCount,
+		"active_package": activePackage,
+		"today_usage":    todayUsage,
+	})
+}
+
+// UpdateOrganization renames an organization
+func UpdateOrganization(c *gin.Context) {
+	org, _, ok := loadOrganization(c, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org.Name = strings.TrimSpace(req.Name)
+	if err := database.DB.Model(org).Update("name", org.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// ListOrganizationMembers lists members with their spend of organization funds today
+func ListOrganizationMembers(c *gin.Context) {
+	org, _, ok := loadOrganization(c, false)
+	if !ok {
+		return
+	}
+
+	var members []models.OrganizationMember
+	if err := database.DB.Preload("User").
+		Where("organization_id = ?", org.ID).
+		Order("created_at ASC").
+		Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch members"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(members))
+	for _, m := range members {
+		spent, _ := billing.MemberSpendToday(database.DB, org.ID, m.UserID)
+		response = append(response, gin.H{
+			"user_id":           m.UserID,
+			"email":             m.User.Email,
+			"username":          m.User.Username,
+			"role":              m.Role,
+			"daily_spend_limit": m.DailySpendLimit,
+			"spent_today":       spent,
+			"joined_at":         m.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": response})
+}
+
+// UpdateOrganizationMember changes a member's role or daily spend cap. Only
+// owners change roles; admins may set caps on plain members.
+func UpdateOrganizationMember(c *gin.Context) {
+	org, actor, ok := loadOrganization(c, true)
+	if !ok {
+		return
+	}
+
+	target, ok := loadMember(c, org.ID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role            *string  `json:"role"`
+		DailySpendLimit *float64 `json:"daily_spend_limit"`
+		ClearSpendLimit bool     `json:"clear_spend_limit"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if actor.Role != organization.RoleOwner && target.Role != organization.RoleMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only owners can manage owners and admins"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Role != nil && *req.Role != target.Role {
+		if actor.Role != organization.RoleOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only owners can change roles"})
+			return
+		}
+		if !organization.ValidRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner, admin or member"})
+			return
+		}
+		updates["role"] = *req.Role
+	}
+	if req.DailySpendLimit != nil {
+		if *req.DailySpendLimit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "daily_spend_limit must not be negative"})
+			return
+		}
+		updates["daily_spend_limit"] = *req.DailySpendLimit
+	} else if req.ClearSpendLimit {
+		updates["daily_spend_limit"] = nil
+	}
+
+	if len(updates) > 0 {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if _, demoted := updates["role"]; demoted && target.Role == organization.RoleOwner {
+				if err := requireOtherOwner(tx, org.ID); err != nil {
+					return err
+				}
+			}
+			return tx.Model(target).Updates(updates).Error
+		})
+		if err != nil {
+			if isUserError(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update member"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, target)
+}
+
+// RemoveOrganizationMember removes a member. Members may remove themselves;
+// admins may remove plain members; owners may remove anyone but the last owner.
+func RemoveOrganizationMember(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	org, actor, ok := loadOrganization(c, false)
+	if !ok {
+		return
+	}
+
+	target, ok := loadMember(c, org.ID)
+	if !ok {
+		return
+	}
+
+	if target.UserID != user.ID {
+		if !organization.CanManage(actor.Role) ||
+			(actor.Role != organization.RoleOwner && target.Role != organization.RoleMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient organization permissions"})
+			return
+		}
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if target.Role == organization.RoleOwner {
+			if err := requireOtherOwner(tx, org.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(target).Error
+	})
+	if err != nil {
+		if isUserError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member removed"})
+}
+
+// ListOrganizationInvitations lists pending invitations
+func ListOrganizationInvitations(c *gin.Context) {
+	org, _, ok := loadOrganization(c, true)
+	if !ok {
+		return
+	}
+
+	var invitations []models.OrganizationInvitation
+	if err := database.DB.Where("organization_id = ? AND status = ? AND expires_at > ?", org.ID, "pending", time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// CreateOrganizationInvitation invites an email address to the organization.
+// The token is returned once for the inviter to share.
+func CreateOrganizationInvitation(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	org, actor, ok := loadOrganization(c, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = organization.RoleMember
+	}
+	if !organization.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner, admin or member"})
+		return
+	}
+	if actor.Role != organization.RoleOwner && req.Role != organization.RoleMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only owners can invite owners and admins"})
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate invitation"})
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	invitation := models.OrganizationInvitation{
+		OrganizationID: org.ID,
+		Email:          strings.ToLower(strings.TrimSpace(req.Email)),
+		Role:           req.Role,
+		TokenHash:      hashInvitationToken(token),
+		InvitedByID:    user.ID,
+		Status:         "pending",
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+	if err := database.DB.Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+		"token":      token,
+	})
+}
+
+// RevokeOrganizationInvitation revokes a pending invitation
+func RevokeOrganizationInvitation(c *gin.Context) {
+	org, _, ok := loadOrganization(c, true)
+	if !ok {
+		return
+	}
+
+	result := database.DB.Model(&models.OrganizationInvitation{}).
+		Where("id = ? AND organization_id = ? AND status = ?", c.Param("invitation_id"), org.ID, "pending").
+		Update("status", "revoked")
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke invitation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "invitation revoked"})
+}
+
+// AcceptOrganizationInvitation joins the organization an invitation was sent
+// for. The invitation must be addressed to the user's email.
+func AcceptOrganizationInvitation(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var member models.OrganizationMember
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var invitation models.OrganizationInvitation
+		if err := tx.Where("token_hash = ? AND status = ? AND expires_at > ?", hashInvitationToken(req.Token), "pending", time.Now()).
+			First(&invitation).Error; err != nil {
+			return newUserError("invitation is invalid or has expired")
+		}
+		if !strings.EqualFold(invitation.Email, user.Email) {
+			return newUserError("invitation was sent to a different email address")
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.OrganizationInvitation{}).
+			Where("id = ? AND status = ?", invitation.ID, "pending").
+			Updates(map[string]interface{}{"status": "accepted", "accepted_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newUserError("invitation is invalid or has expired")
+		}
+
+		if err := tx.Where("organization_id = ? AND user_id = ?", invitation.OrganizationID, user.ID).First(&member).Error; err == nil {
+			return newUserError("already a member of this organization")
+		}
+		member = models.OrganizationMember{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         user.ID,
+			Role:           invitation.Role,
+		}
+		return tx.Create(&member).Error
+	})
+	if err != nil {
+		if isUserError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// loadOrganization loads the :id organization and the user's membership,
+// responding with an error when the user is not a member (or cannot manage
+// the organization, if manage is set)
+func loadOrganization(c *gin.Context, manage bool) (*models.Organization, *models.OrganizationMember, bool) {
+	user := c.MustGet("user").(models.User)
+
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		return nil, nil, false
+	}
+
+	member, err := organization.Membership(orgID, user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+		return nil, nil, false
+	}
+	if manage && !organization.CanManage(member.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient organization permissions"})
+		return nil, nil, false
+	}
+
+	var org models.Organization
+	if err := database.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+		return nil, nil, false
+	}
+
+	return &org, member, true
+}
+
+// loadMember loads the :user_id member of the organization
+func loadMember(c *gin.Context, orgID uuid.UUID) (*models.OrganizationMember, bool) {
+	var member models.OrganizationMember
+	if err := database.DB.Where("organization_id = ? AND user_id = ?", orgID, c.Param("user_id")).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid member"})
+		}
+		return nil, false
+	}
+	return &member, true
+}
+
+// requireOtherOwner locks the organization's owner rows until tx ends and
+// fails unless there is more than one owner, so concurrent demotions and
+// removals cannot leave the organization without an owner
+func requireOtherOwner(tx *gorm.DB, orgID uuid.UUID) error {
+	var owners []models.OrganizationMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("organization_id = ? AND role = ?", orgID, organization.RoleOwner).
+		Find(&owners).Error; err != nil {
+		return err
+	}
+	if len(owners) <= 1 {
+		return newUserError("an organization needs at least one owner")
+	}
+	return nil
+}
+
+func hashInvitationToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// requireOrganizationManager responds with an error unless the user is an
+// owner or admin of the organization
+func requireOrganizationManager(c *gin.Context, orgID, userID uuid.UUID) bool {
+	member, err := organization.Membership(orgID, userID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	if !organization.CanManage(member.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient organization permissions"})
+		return false
+	}
+	return true
+}
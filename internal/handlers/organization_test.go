@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/organization"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// useOrganization creates an organization with the given number of owners
+func useOrganization(t *testing.T, owners int) (models.Organization, []models.User) {
+	t.Helper()
+	databasetest.Use(t, &models.User{}, &models.Organization{}, &models.OrganizationMember{})
+	org := models.Organization{Name: "Acme", Status: "active"}
+	create(t, &org)
+	users := make([]models.User, owners)
+	for i := range users {
+		users[i] = models.User{Email: uuid.NewString() + "@example.com"}
+		create(t, &users[i])
+		create(t, &models.OrganizationMember{OrganizationID: org.ID, UserID: users[i].ID, Role: organization.RoleOwner})
+	}
+	return org, users
+}
+
+// callMemberHandler runs handler as caller against the target member
+func callMemberHandler(handler gin.HandlerFunc, method string, org models.Organization, caller, target models.User, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/organizations/members", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: org.ID.String()}, {Key: "user_id", Value: target.ID.String()}}
+	c.Set("user", caller)
+	handler(c)
+	return w
+}
+
+func ownerCount(t *testing.T, orgID uuid.UUID) int64 {
+	t.Helper()
+	var owners int64
+	if err := database.DB.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND role = ?", orgID, organization.RoleOwner).
+		Count(&owners).Error; err != nil {
+		t.Fatal(err)
+	}
+	return owners
+}
+
+func TestLastOwnerKept(t *testing.T) {
+	tests := []struct {
+		name       string
+		owners     int
+		remove     bool
+		body       string
+		wantStatus int
+		wantOwners int64
+	}{
+		{name: "demote the only owner", owners: 1, body: `{"role":"admin"}`, wantStatus: http.StatusBadRequest, wantOwners: 1},
+		{name: "demote one of two owners", owners: 2, body: `{"role":"admin"}`, wantStatus: http.StatusOK, wantOwners: 1},
+		{name: "cap the only owner's spend", owners: 1, body: `{"role":"owner","daily_spend_limit":5}`, wantStatus: http.StatusOK, wantOwners: 1},
+		{name: "remove the only owner", owners: 1, remove: true, wantStatus: http.StatusBadRequest, wantOwners: 1},
+		{name: "remove one of two owners", owners: 2, remove: true, wantStatus: http.StatusOK, wantOwners: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org, owners := useOrganization(t, tt.owners)
+
+			var w *httptest.ResponseRecorder
+			if tt.remove {
+				w = callMemberHandler(RemoveOrganizationMember, http.MethodDelete, org, owners[0], owners[0], "")
+			} else {
+				w = callMemberHandler(UpdateOrganizationMember, http.MethodPatch, org, owners[0], owners[0], tt.body)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := ownerCount(t, org.ID); got != tt.wantOwners {
+				t.Errorf("%d owners left, want %d", got, tt.wantOwners)
+			}
+		})
+	}
+}
@@ -27,12 +27,16 @@ func PurchasePackage(c *gin.Context) {
 	packageID := c.Param("id")
 
 	var req struct {
-		CouponCode string `json:"coupon_code"`
+		CouponCode     string     `json:"coupon_code"`
+		OrganizationID *uuid.UUID `json:"organization_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	if req.OrganizationID != nil && !requireOrganizationManager(c, *req.OrganizationID, user.ID) {
+		return
+	}
 
 	var pkg models.Package
 	if err := database.DB.First(&pkg, packageID).Error; err != nil {
@@ -105,6 +109,7 @@ func PurchasePackage(c *gin.Context) {
 			Status:         "pending",
 			PaymentMethod:  "credit",
 			OrderType:      "package_purchase",
+			OrganizationID: req.OrganizationID,
 		}
 
 		if coupon != nil {
@@ -265,24 +270,32 @@ func CreditNotify(c *gin.Context) {
 		// Check if this is a recharge order (no package) or package purchase
 		if order.PackageID == nil {
 			// This is a balance recharge order
-			// Add balance to user account
-			result := tx.Model(&models.User{}).
-				Where("id = ?", order.UserID).
-				Update("balance", gorm.Expr("balance + ?", order.Amount))
+			// Add balance to the user or organization account
+			var result *gorm.DB
+			if order.OrganizationID != nil {
+				result = tx.Model(&models.Organization{}).
+					Where("id = ?", *order.OrganizationID).
+					Update("balance", gorm.Expr("balance + ?", order.Amount))
+			} else {
+				result = tx.Model(&models.User{}).
+					Where("id = ?", order.UserID).
+					Update("balance", gorm.Expr("balance + ?", order.Amount))
+			}
 
 			if result.Error != nil {
 				return fmt.Errorf("failed to update balance: %v", result.Error)
 			}
 			if result.RowsAffected == 0 {
-				return fmt.Errorf("user not found")
+				return fmt.Errorf("account not found")
 			}
 
 			// Create transaction record
 			transaction := models.Transaction{
-				UserID:      order.UserID,
-				Amount:      order.Amount,
-				Type:        "deposit",
-				Description: fmt.Sprintf("余额充值 $%.2f", order.Amount),
+				UserID:         order.UserID,
+				OrganizationID: order.OrganizationID,
+				Amount:         order.Amount,
+				Type:           "deposit",
+				Description:    fmt.Sprintf("余额充值 $%.2f", order.Amount),
 			}
 
 			if err := tx.Create(&transaction).Error; err != nil {
@@ -359,13 +372,17 @@ func CreateRechargeOrder(c *gin.Context) {
 	user := c.MustGet("user").(models.User)
 
 	var req struct {
-		Amount float64 `json:"amount" binding:"required,gt=0"`
+		Amount         float64    `json:"amount" binding:"required,gt=0"`
+		OrganizationID *uuid.UUID `json:"organization_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	if req.OrganizationID != nil && !requireOrganizationManager(c, *req.OrganizationID, user.ID) {
+		return
+	}
 
 	// Get system settings for Credit config and min recharge amount
 	var settings models.SystemSettings
@@ -398,6 +415,7 @@ func CreateRechargeOrder(c *gin.Context) {
 		Status:         "pending",
 		PaymentMethod:  "credit",
 		OrderType:      "recharge",
+		OrganizationID: req.OrganizationID,
 	}
 
 	if err := database.DB.Create(&order).Error; err != nil {
@@ -2,36 +2,35 @@ package handlers
 
 import (
 	"bufio"
-	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"codex-gateway/internal/anthropic"
 	"codex-gateway/internal/billing"
 	"codex-gateway/internal/codex"
 	"codex-gateway/internal/database"
+	"codex-gateway/internal/logger"
+	"codex-gateway/internal/metrics"
+	"codex-gateway/internal/middleware"
+	"codex-gateway/internal/modelalias"
 	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+	"codex-gateway/internal/ratelimit"
+	"codex-gateway/internal/tokenizer"
 	"codex-gateway/internal/upstream"
+	"codex-gateway/internal/usagelog"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
-var httpClient = &http.Client{
-	Timeout: 120 * time.Second,
-	Transport: &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-	},
-}
-
 type OpenAIRequest struct {
 	Model        string                   `json:"model"`
 	Messages     []map[string]interface{} `json:"messages"`
@@ -57,6 +56,9 @@ type OpenAIResponse struct {
 			CacheReadTokens     int `json:"cache_read_tokens"`
 			CacheCreationTokens int `json:"cache_creation_tokens"`
 		} `json:"prompt_tokens_details"`
+		CompletionTokenDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
 
 		// Codex/Responses API fields
 		InputTokens       int `json:"input_tokens"`
@@ -71,6 +73,9 @@ type OpenAIResponse struct {
 			CacheReadTokens     int `json:"cache_read_tokens"`
 			CacheCreationTokens int `json:"cache_creation_tokens"`
 		} `json:"input_token_details"`
+		OutputTokenDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
 	} `json:"usage"`
 	Choices []struct {
 		Message struct {
@@ -93,60 +98,168 @@ func ProxyHandler(c *gin.Context) {
 	// Get the original request path (e.g., /chat/completions, /responses, /completions)
 	requestPath := c.Request.URL.Path
 
+	pr := &proxyRequest{
+		requestID:    middleware.GetRequestID(c),
+		user:         user,
+		apiKey:       apiKey,
+		requestPath:  requestPath,
+		upstreamPath: requestPath,
+		startTime:    time.Now(),
+	}
+
+	// Chat completions and Anthropic Messages requests are served by the Responses API
+	switch {
+	case strings.HasSuffix(requestPath, "/chat/completions"):
+		pr.clientAPI = clientAPIChat
+		pr.upstreamPath = strings.TrimSuffix(requestPath, "/chat/completions") + "/responses"
+	case strings.HasSuffix(requestPath, "/messages"):
+		pr.clientAPI = clientAPIAnthropic
+		pr.upstreamPath = strings.TrimSuffix(requestPath, "/messages") + "/responses"
+	}
+
 	// Parse request body
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		pr.fail(c, http.StatusBadRequest, usagelog.ErrorInvalidRequest, "failed to read request body")
 		return
 	}
 
 	var reqBody map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &reqBody); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+		pr.fail(c, http.StatusBadRequest, usagelog.ErrorInvalidRequest, "invalid JSON")
 		return
 	}
 
-	// Only apply ChatGPT transformations for /chat/completions endpoint
-	// For Codex endpoints (/responses, /completions), pass through as-is
-	if strings.HasSuffix(requestPath, "/chat/completions") {
-		codex.TransformRequest(reqBody)
+	if pr.clientAPI != "" {
+		translated, err := pr.translateRequest(reqBody)
+		if err != nil {
+			pr.fail(c, http.StatusBadRequest, usagelog.ErrorInvalidRequest, err.Error())
+			return
+		}
+		reqBody = translated
 	}
 
-	// Pre-flight check: user must have balance OR active package
-	today := database.GetToday()
-	var activePackage models.UserPackage
-	hasActivePackage := database.DB.Where("user_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
-		user.ID, "active", today, today).
-		First(&activePackage).Error == nil
+	// Capture the output cap before transformation strips unsupported fields
+	maxOutputTokens := requestedMaxOutputTokens(reqBody)
 
-	if user.Balance <= 0 && !hasActivePackage {
-		c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient balance or active package"})
-		return
+	// Only apply Codex transformations to translated requests
+	// For Codex endpoints (/responses, /completions), pass through as-is
+	if pr.clientAPI != "" {
+		codex.TransformRequest(reqBody)
 	}
 
 	// Get model name for billing
-	model, _ := reqBody["model"].(string)
+	requestedModel, _ := reqBody["model"].(string)
+	model := requestedModel
 	if model == "" {
 		model = "gpt-5.1-codex"
 	}
 
+	// Alias rules decide which model is served and billed
+	resolution, err := modelalias.Resolve(model)
+	if err != nil {
+		pr.model = model
+		pr.fail(c, http.StatusNotFound, usagelog.ErrorModelNotSupported, modelNotSupportedMessage(model))
+		return
+	}
+	model = resolution.Model
+	if model != requestedModel {
+		reqBody["model"] = model
+	}
+	if resolution.ReasoningEffort != "" && strings.HasSuffix(pr.upstreamPath, "/responses") {
+		injectReasoningEffort(reqBody, resolution.ReasoningEffort)
+	}
+	pr.model = model
+
 	// Check if streaming is requested
 	stream, _ := reqBody["stream"].(bool)
+	pr.stream = stream
+
+	if !middleware.KeyAllowsModel(&apiKey, model) {
+		pr.fail(c, http.StatusForbidden, usagelog.ErrorKeyScope, fmt.Sprintf("api key is not allowed to use model '%s'", model))
+		return
+	}
+
+	// Enforce rate limits, charging the prompt estimate against TPM until usage is known.
+	// The prompt is counted locally, for the hold and for streams without usage,
+	// only once the request limits have admitted it.
+	lease, decision := ratelimit.Acquire(ratelimit.Request{
+		UserID:   user.ID,
+		APIKeyID: apiKey.ID,
+		Model:    model,
+		KeyRPM:   apiKey.RateLimitRPM,
+		CountTokens: func() int {
+			pr.inputTokens, _ = tokenizer.CountRequest(model, reqBody)
+			return pr.inputTokens
+		},
+	})
+	for name, value := range decision.Headers() {
+		c.Header(name, value)
+	}
+	if !decision.Allowed {
+		pr.fail(c, http.StatusTooManyRequests, usagelog.ErrorRateLimited, decision.Message())
+		return
+	}
+	defer func() { lease.Release(pr.usedTokens) }()
+
+	// Pre-flight check: the payer must have balance OR active package
+	if !billing.HasFunds(user, apiKey.OrganizationID) {
+		pr.fail(c, http.StatusPaymentRequired, usagelog.ErrorInsufficientBalance, "insufficient balance or active package")
+		return
+	}
 
-	startTime := time.Now()
+	pr.subject = pricingSubject(user, apiKey)
+
+	// Hold the estimated maximum cost and tokens so concurrent requests cannot
+	// overspend the payer or the key's budget
+	holdID, err := reserveEstimatedCost(user, apiKey, pr.subject, model, pr.inputTokens, maxOutputTokens)
+	if err != nil {
+		if errors.Is(err, billing.ErrInsufficientFunds) {
+			pr.fail(c, http.StatusPaymentRequired, usagelog.ErrorInsufficientBalance, err.Error())
+			return
+		}
+		if errors.Is(err, billing.ErrMemberSpendLimit) || errors.Is(err, billing.ErrKeyQuotaExceeded) {
+			pr.fail(c, http.StatusPaymentRequired, usagelog.ErrorQuotaExceeded, err.Error())
+			return
+		}
+		pr.fail(c, http.StatusInternalServerError, usagelog.ErrorInternal, "failed to reserve balance")
+		return
+	}
+	pr.holdID = holdID
+	// No-op once the hold has been settled by billing
+	defer billing.ReleaseHold(holdID)
+	defer keepHoldAlive(holdID, holdRefreshInterval)()
+
+	pr.startTime = time.Now()
 
 	if stream {
-		handleStreamingRequest(c, user, apiKey, reqBody, model, requestPath, startTime)
+		handleStreamingRequest(c, pr, reqBody)
 	} else {
-		handleNonStreamingRequest(c, user, apiKey, reqBody, model, requestPath, startTime)
+		handleNonStreamingRequest(c, pr, reqBody)
+	}
+}
+
+// injectReasoningEffort sets reasoning.effort unless the request already chose one
+func injectReasoningEffort(reqBody map[string]interface{}, effort string) {
+	reasoning, _ := reqBody["reasoning"].(map[string]interface{})
+	if reasoning == nil {
+		reasoning = map[string]interface{}{}
+	}
+	if current, ok := reasoning["effort"].(string); ok && current != "" {
+		return
 	}
+	reasoning["effort"] = effort
+	reqBody["reasoning"] = reasoning
 }
 
-func selectUpstreamForUser(userID uuid.UUID) (*models.CodexUpstream, error) {
-	upstreamObj, err := upstream.GetSelector().SelectForUser(userID)
+func selectUpstreamForUser(userID uuid.UUID, model string) (*models.CodexUpstream, error) {
+	upstreamObj, err := upstream.GetSelector().SelectForUser(userID, model)
 	if err == nil {
 		return upstreamObj, nil
 	}
+	if errors.Is(err, upstream.ErrModelNotSupported) {
+		return nil, err
+	}
 
 	var settings models.SystemSettings
 	if err := database.DB.First(&settings).Error; err != nil {
@@ -168,57 +281,23 @@ func selectUpstreamForUser(userID uuid.UUID) (*models.CodexUpstream, error) {
 	}, nil
 }
 
-func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIKey, reqBody map[string]interface{}, model string, requestPath string, startTime time.Time) {
-	// Select upstream for this user (consistent hashing for session affinity)
-	upstreamObj, err := selectUpstreamForUser(user.ID)
-	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no available upstream"})
-		return
-	}
-
-	baseURL := upstreamObj.BaseURL
-	apiKeyStr := upstreamObj.APIKey
+func handleStreamingRequest(c *gin.Context, pr *proxyRequest, reqBody map[string]interface{}) {
+	user := pr.user
+	model := pr.model
 
 	// Ensure stream=true for upstream
 	reqBody["stream"] = true
 
-	// Only add stream_options for ChatGPT API (not for Codex/Responses API)
-	if strings.HasSuffix(requestPath, "/chat/completions") {
-		reqBody["stream_options"] = map[string]interface{}{"include_usage": true}
-	}
-
-	// Marshal request
-	reqBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal request"})
-		return
-	}
-
-	// Create upstream request using the original request path
-	upstreamURL := baseURL + requestPath
-	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", upstreamURL, bytes.NewBuffer(reqBytes))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request"})
-		return
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+apiKeyStr)
-	httpReq.Header.Set("Accept", "text/event-stream")
-
-	// Send request
-	resp, err := httpClient.Do(httpReq)
+	// Send to the user's upstream (consistent hashing for session affinity),
+	// failing over to other upstreams before anything is streamed to the client
+	resp, upstreamObj, err := sendWithFailover(c, user.ID, reqBody, model, pr.upstreamPath, true)
+	pr.setUpstream(c, upstreamObj)
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("upstream error: %v", err)})
+		pr.failUpstream(c, err, true)
 		return
 	}
 	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		c.JSON(resp.StatusCode, gin.H{"error": fmt.Sprintf("upstream returned %d: %s", resp.StatusCode, string(bodyBytes))})
-		return
-	}
+	defer metrics.StreamStarted(model, upstreamObj.ID)()
 
 	// Set SSE headers
 	c.Header("Content-Type", "text/event-stream")
@@ -232,18 +311,21 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 		CompletionTokens    int
 		CachedTokens        int
 		CacheCreationTokens int
+		ReasoningTokens     int
 		TotalTokens         int
 	}
 
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		pr.fail(c, http.StatusInternalServerError, usagelog.ErrorInternal, "streaming not supported")
 		return
 	}
 
+	translator := pr.streamTranslator()
+
 	// Track streaming state
 	streamedChunks := 0
-	outputBytes := 0
+	var outputText strings.Builder
 	clientDisconnected := false
 
 	scanner := bufio.NewScanner(resp.Body)
@@ -263,12 +345,20 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 
 		line := scanner.Text()
 
-		// Forward SSE line
-		if _, err := fmt.Fprintf(c.Writer, "%s\n", line); err != nil {
+		// Forward SSE line, translated for chat and Messages clients
+		if translator != nil {
+			err = translator.WriteLine(c.Writer, line)
+		} else {
+			_, err = fmt.Fprintf(c.Writer, "%s\n", line)
+		}
+		if err != nil {
 			clientDisconnected = true
 			break
 		}
 		flusher.Flush()
+		if streamedChunks == 0 {
+			pr.firstToken = time.Since(pr.startTime)
+		}
 		streamedChunks++
 
 		// Parse for usage information
@@ -295,6 +385,9 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 							CacheReadTokens     int `json:"cache_read_tokens"`
 							CacheCreationTokens int `json:"cache_creation_tokens"`
 						} `json:"input_token_details"`
+						OutputTokenDetails struct {
+							ReasoningTokens int `json:"reasoning_tokens"`
+						} `json:"output_tokens_details"`
 					} `json:"usage"`
 				} `json:"response"`
 			}
@@ -320,6 +413,7 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 				lastUsage.CompletionTokens = codexEvent.Response.Usage.OutputTokens
 				lastUsage.CachedTokens = cacheReadTokens
 				lastUsage.CacheCreationTokens = cacheCreationTokens
+				lastUsage.ReasoningTokens = codexEvent.Response.Usage.OutputTokenDetails.ReasoningTokens
 				lastUsage.TotalTokens = resolveTotalTokens(lastUsage.PromptTokens, lastUsage.CompletionTokens, lastUsage.CachedTokens, lastUsage.CacheCreationTokens)
 				continue
 			}
@@ -334,7 +428,7 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 				case "response.output_text.delta":
 					var deltaText string
 					if err := json.Unmarshal(deltaEvent.Delta, &deltaText); err == nil {
-						outputBytes += len(deltaText)
+						outputText.WriteString(deltaText)
 					}
 				case "response.content_part.delta":
 					var delta struct {
@@ -342,7 +436,7 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 						Text string `json:"text"`
 					}
 					if err := json.Unmarshal(deltaEvent.Delta, &delta); err == nil {
-						outputBytes += len(delta.Text)
+						outputText.WriteString(delta.Text)
 					}
 				}
 			}
@@ -351,7 +445,7 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 			var chunk OpenAIResponse
 			if err := json.Unmarshal([]byte(data), &chunk); err == nil {
 				if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
-					outputBytes += len(chunk.Choices[0].Delta.Content)
+					outputText.WriteString(chunk.Choices[0].Delta.Content)
 				}
 				if chunk.Usage.TotalTokens > 0 {
 					lastUsage.PromptTokens = chunk.Usage.PromptTokens
@@ -363,6 +457,7 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 					cacheCreationTokens := chunk.Usage.PromptTokenDetails.CacheCreationTokens
 					lastUsage.CachedTokens = cacheReadTokens
 					lastUsage.CacheCreationTokens = cacheCreationTokens
+					lastUsage.ReasoningTokens = chunk.Usage.CompletionTokenDetails.ReasoningTokens
 					lastUsage.TotalTokens = resolveTotalTokens(lastUsage.PromptTokens, lastUsage.CompletionTokens, lastUsage.CachedTokens, lastUsage.CacheCreationTokens)
 				} else if chunk.Usage.InputTokens > 0 || chunk.Usage.OutputTokens > 0 {
 					// Direct usage format (non-event)
@@ -384,64 +479,103 @@ func handleStreamingRequest(c *gin.Context, user models.User, apiKey models.APIK
 					}
 					lastUsage.CachedTokens = cacheReadTokens
 					lastUsage.CacheCreationTokens = cacheCreationTokens
+					lastUsage.ReasoningTokens = chunk.Usage.OutputTokenDetails.ReasoningTokens
 					lastUsage.TotalTokens = resolveTotalTokens(lastUsage.PromptTokens, lastUsage.CompletionTokens, lastUsage.CachedTokens, lastUsage.CacheCreationTokens)
 				}
 			}
 		}
 	}
 
+	// Final status of the request as seen by the client
+	statusCode := http.StatusOK
+	errorClass := ""
+	if clientDisconnected || c.Request.Context().Err() != nil {
+		statusCode = usagelog.StatusClientClosedRequest
+		errorClass = usagelog.ErrorClientDisconnected
+	}
+
 	if err := scanner.Err(); err != nil {
 		// Stream already started, can't send JSON error
 		// But we should still try to bill for what was sent
-		log.Printf("[Proxy] Stream scan error: %v", err)
-	}
+		logger.FromContext(c.Request.Context()).Warn("stream scan error", "component", "Proxy", "error", err)
 
-	// Calculate latency
-	latencyMs := int(time.Since(startTime).Milliseconds())
+		// The upstream broke off mid-stream; count it against its circuit
+		if c.Request.Context().Err() == nil {
+			errorClass = usagelog.ErrorStreamInterrupted
+			if upstreamObj.ID != 0 {
+				upstream.GetCircuitBreaker().RecordFailure(upstreamObj.ID)
+			}
+		}
+	}
 
 	// Bill user after stream completes
 	if lastUsage.TotalTokens > 0 {
-		cost, err := calculateCostWithCache(model, lastUsage.PromptTokens, lastUsage.CompletionTokens, lastUsage.CachedTokens, lastUsage.CacheCreationTokens)
-		if err == nil {
-			_ = recordUsageAndBill(user.ID, apiKey.ID, model, lastUsage.PromptTokens, lastUsage.CompletionTokens, lastUsage.CachedTokens, lastUsage.CacheCreationTokens, cost, latencyMs)
-		}
-	} else if outputBytes > 0 || streamedChunks > 0 {
-		// Fallback: estimate tokens if usage info not available
-		// Approximate: ~4 bytes per token for output text, assume 10% input
-		estimatedOutput := outputBytes / 4
-		if outputBytes%4 != 0 {
-			estimatedOutput++
-		}
+		entry := pr.usageLog(statusCode, errorClass)
+		entry.InputTokens = lastUsage.PromptTokens
+		entry.OutputTokens = lastUsage.CompletionTokens
+		entry.CachedTokens = lastUsage.CachedTokens
+		entry.CacheCreationTokens = lastUsage.CacheCreationTokens
+		entry.ReasoningTokens = lastUsage.ReasoningTokens
+		entry.UsageSource = usagelog.UsageReported
+		billStream(pr, entry)
+	} else if outputText.Len() > 0 || streamedChunks > 0 {
+		// Fallback: count the prompt and the streamed text locally
+		estimatedOutput, encoding := tokenizer.Count(pr.model, outputText.String())
 		if estimatedOutput == 0 && streamedChunks > 0 {
 			estimatedOutput = streamedChunks * 10
 		}
-		estimatedInput := estimatedOutput / 10
-
-		cost, err := calculateCostWithCache(model, estimatedInput, estimatedOutput, 0, 0)
-		if err == nil {
-			_ = recordUsageAndBill(user.ID, apiKey.ID, model, estimatedInput, estimatedOutput, 0, 0, cost, latencyMs)
+		estimatedInput := pr.inputTokens
+		logger.FromContext(c.Request.Context()).Info("no usage reported for stream, billing local token counts",
+			"component", "Proxy", "input_tokens", estimatedInput, "output_tokens", estimatedOutput, "encoding", encoding)
+
+		entry := pr.usageLog(statusCode, errorClass)
+		entry.InputTokens = estimatedInput
+		entry.OutputTokens = estimatedOutput
+		entry.UsageSource = usagelog.UsageEstimated
+		billStream(pr, entry)
+	} else {
+		if errorClass == "" {
+			errorClass = usagelog.ErrorStreamInterrupted
 		}
+		pr.record(statusCode, errorClass)
 	}
 }
 
-func handleNonStreamingRequest(c *gin.Context, user models.User, apiKey models.APIKey, reqBody map[string]interface{}, model string, requestPath string, startTime time.Time) {
-	// Select upstream for this user (consistent hashing for session affinity)
-	upstreamObj, err := selectUpstreamForUser(user.ID)
-	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no available upstream"})
+// billStream prices and bills a finished stream. The response is already sent,
+// so the cost is charged even past the hold and the payer's funds, and failures
+// are recorded as unbilled usage logs instead of returned.
+func billStream(pr *proxyRequest, entry models.UsageLog) {
+	pr.usedTokens = resolveTotalTokens(entry.InputTokens, entry.OutputTokens, entry.CachedTokens, entry.CacheCreationTokens)
+	if err := priceUsage(&entry, pr.subject, pr.startTime); err != nil {
+		slog.Error("failed to price stream", "component", "Proxy", "request_id", entry.RequestID, "user_id", entry.UserID, "error", err)
+		entry.ErrorClass = usagelog.ErrorPricing
+		entry.TotalTokens = resolveTotalTokens(entry.InputTokens, entry.OutputTokens, entry.CachedTokens, entry.CacheCreationTokens)
+		usagelog.Record(&entry)
 		return
 	}
 
+	if err := recordUsageAndBill(entry, pr.holdID, true); err != nil {
+		slog.Error("failed to bill stream", "component", "Proxy", "request_id", entry.RequestID, "user_id", entry.UserID, "cost", entry.Cost, "error", err)
+		// Keep the cost so the unbilled usage can be reconciled
+		entry.ErrorClass = usagelog.ErrorBilling
+		entry.TotalTokens = resolveTotalTokens(entry.InputTokens, entry.OutputTokens, entry.CachedTokens, entry.CacheCreationTokens)
+		usagelog.Record(&entry)
+	}
+}
+
+func handleNonStreamingRequest(c *gin.Context, pr *proxyRequest, reqBody map[string]interface{}) {
 	// Force stream=false for non-streaming
 	reqBody["stream"] = false
 
-	upstreamResp, err := forwardToUpstream(c.Request.Context(), reqBody, upstreamObj.BaseURL, upstreamObj.APIKey, requestPath)
+	upstreamResp, respBody, upstreamObj, err := forwardToUpstream(c, pr.user.ID, reqBody, pr.model, pr.upstreamPath)
+	pr.setUpstream(c, upstreamObj)
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("upstream error: %v", err)})
+		pr.failUpstream(c, err, false)
 		return
 	}
 
-	latencyMs := int(time.Since(startTime).Milliseconds())
+	// The whole response arrives at once
+	pr.firstToken = time.Since(pr.startTime)
 
 	// Extract token counts (support both ChatGPT and Codex API formats)
 	inputTokens := upstreamResp.Usage.PromptTokens
@@ -490,59 +624,75 @@ func handleNonStreamingRequest(c *gin.Context, user models.User, apiKey models.A
 		}
 	}
 
-	cost, err := calculateCostWithCache(model, inputTokens, outputTokens, cachedTokens, cacheCreationTokens)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("pricing error: %v", err)})
+	reasoningTokens := upstreamResp.Usage.OutputTokenDetails.ReasoningTokens
+	if reasoningTokens == 0 {
+		reasoningTokens = upstreamResp.Usage.CompletionTokenDetails.ReasoningTokens
+	}
+
+	pr.usedTokens = resolveTotalTokens(inputTokens, outputTokens, cachedTokens, cacheCreationTokens)
+
+	entry := pr.usageLog(http.StatusOK, "")
+	entry.InputTokens = inputTokens
+	entry.OutputTokens = outputTokens
+	entry.CachedTokens = cachedTokens
+	entry.CacheCreationTokens = cacheCreationTokens
+	entry.ReasoningTokens = reasoningTokens
+	entry.UsageSource = usagelog.UsageReported
+
+	if err := priceUsage(&entry, pr.subject, pr.startTime); err != nil {
+		pr.fail(c, http.StatusBadRequest, usagelog.ErrorPricing, fmt.Sprintf("pricing error: %v", err))
 		return
 	}
 
-	if err := recordUsageAndBill(user.ID, apiKey.ID, model, inputTokens, outputTokens, cachedTokens, cacheCreationTokens, cost, latencyMs); err != nil {
+	if err := recordUsageAndBill(entry, pr.holdID, false); err != nil {
 		if strings.Contains(err.Error(), "insufficient balance") ||
-			strings.Contains(err.Error(), "api key quota exceeded") ||
 			strings.Contains(err.Error(), "daily usage limit exceeded") {
-			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+			pr.fail(c, http.StatusPaymentRequired, usagelog.ErrorInsufficientBalance, err.Error())
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "billing failed"})
+		pr.fail(c, http.StatusInternalServerError, usagelog.ErrorBilling, "billing failed")
 		return
 	}
 
-	c.JSON(http.StatusOK, upstreamResp)
-}
-
-func forwardToUpstream(ctx context.Context, reqBody map[string]interface{}, baseURL string, apiKey string, requestPath string) (*OpenAIResponse, error) {
-	reqBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	// Use the original request path
-	upstreamURL := baseURL + requestPath
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", upstreamURL, bytes.NewBuffer(reqBytes))
-	if err != nil {
-		return nil, err
+	if pr.clientAPI != "" {
+		translated, err := pr.translateResponse(respBody)
+		if err != nil {
+			// Already billed; the upstream answered with something we cannot read
+			logger.FromContext(c.Request.Context()).Error("failed to translate response", "component", "Proxy", "error", err)
+			if pr.clientAPI == clientAPIAnthropic {
+				c.JSON(http.StatusBadGateway, anthropic.ErrorBody(http.StatusBadGateway, "invalid upstream response"))
+			} else {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "invalid upstream response"})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, translated)
+		return
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	c.JSON(http.StatusOK, upstreamResp)
+}
 
-	resp, err := httpClient.Do(httpReq)
+// forwardToUpstream sends a non-streaming request and returns the decoded
+// response along with the raw body
+func forwardToUpstream(c *gin.Context, userID uuid.UUID, reqBody map[string]interface{}, model string, requestPath string) (*OpenAIResponse, []byte, *models.CodexUpstream, error) {
+	resp, upstreamObj, err := sendWithFailover(c, userID, reqBody, model, requestPath, false)
 	if err != nil {
-		return nil, err
+		return nil, nil, upstreamObj, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return nil, fmt.Errorf("upstream returned %d: %s", resp.StatusCode, string(bodyBytes))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, upstreamObj, err
 	}
 
 	var openAIResp OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
-		return nil, err
+	if err := json.Unmarshal(body, &openAIResp); err != nil {
+		return nil, nil, upstreamObj, err
 	}
 
-	return &openAIResp, nil
+	return &openAIResp, body, upstreamObj, nil
 }
 
 func resolveBillableInputTokens(inputTokens, cacheReadTokens, cacheCreationTokens int) int {
@@ -565,64 +715,119 @@ func resolveTotalTokens(inputTokens, outputTokens, cacheReadTokens, cacheCreatio
 	return total
 }
 
-func calculateCost(model string, inputTokens, outputTokens int) (float64, error) {
-	return calculateCostWithCache(model, inputTokens, outputTokens, 0, 0)
+func calculateCost(subject pricing.Subject, model string, inputTokens, outputTokens int) (float64, error) {
+	return calculateCostWithCache(subject, model, inputTokens, outputTokens, 0, 0)
+}
+
+// calculateCostWithCache prices tokens at the current price of the model with
+// the subject's most specific pricing rule applied
+func calculateCostWithCache(subject pricing.Subject, model string, inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens int) (float64, error) {
+	price, rule, err := pricing.PriceFor(subject, model, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	cost := costWithPricing(price, inputTokens, outputTokens, 0, cacheReadTokens, cacheCreationTokens)
+	return pricing.Discount(cost, resolveTotalTokens(inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens), rule), nil
+}
+
+// priceUsage sets the entry's cost from the price version in effect when the
+// request was received and the subject's pricing rule, per-token discount included,
+// recording both along with the markup charged
+func priceUsage(entry *models.UsageLog, subject pricing.Subject, receivedAt time.Time) error {
+	price, rule, err := pricing.PriceFor(subject, entry.Model, receivedAt)
+	if err != nil {
+		return err
+	}
+	cost := costWithPricing(price, entry.InputTokens, entry.OutputTokens, entry.ReasoningTokens, entry.CachedTokens, entry.CacheCreationTokens)
+	entry.Cost = pricing.Discount(cost, resolveTotalTokens(entry.InputTokens, entry.OutputTokens, entry.CachedTokens, entry.CacheCreationTokens), rule)
+	entry.PriceVersionID = &price.ID
+	if rule != nil {
+		entry.PricingRuleID = &rule.ID
+	}
+	entry.AppliedMarkup = price.MarkupMultiplier
+	return nil
 }
 
-func calculateCostWithCache(model string, inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens int) (float64, error) {
-	var pricing models.ModelPricing
-	if err := database.DB.Where("model_name = ?", model).First(&pricing).Error; err != nil {
-		return 0, fmt.Errorf("pricing not found for model: %s", model)
+func costWithPricing(pricing *models.ModelPricing, inputTokens, outputTokens, reasoningTokens, cacheReadTokens, cacheCreationTokens int) float64 {
+	inputPrice := pricing.InputPricePer1k
+	outputPrice := pricing.OutputPricePer1k
+	cacheReadPrice := pricing.CacheReadPricePer1k
+
+	// Above the tier threshold the whole request is billed at the tier prices
+	if pricing.TierThresholdTokens > 0 && inputTokens > pricing.TierThresholdTokens {
+		if pricing.TierInputPricePer1k > 0 {
+			inputPrice = pricing.TierInputPricePer1k
+		}
+		if pricing.TierOutputPricePer1k > 0 {
+			outputPrice = pricing.TierOutputPricePer1k
+		}
+		if pricing.TierCacheReadPricePer1k > 0 {
+			cacheReadPrice = pricing.TierCacheReadPricePer1k
+		}
+	}
+
+	// Reasoning tokens are part of the output; without their own price they
+	// cost the same as other output
+	if reasoningTokens > outputTokens {
+		reasoningTokens = outputTokens
+	}
+	reasoningPrice := outputPrice
+	if pricing.ReasoningPricePer1k > 0 {
+		reasoningPrice = pricing.ReasoningPricePer1k
 	}
 
 	// Calculate costs for each token type
 	// Note: cached_tokens in Codex API = cache_read_tokens (tokens read from cache)
 	// Cache read/creation tokens are billed at discounted rates.
 	billableInputTokens := resolveBillableInputTokens(inputTokens, cacheReadTokens, cacheCreationTokens)
-	inputCost := (float64(billableInputTokens) / 1000.0) * pricing.InputPricePer1k
-	cacheReadCost := (float64(cacheReadTokens) / 1000.0) * pricing.CacheReadPricePer1k
+	inputCost := (float64(billableInputTokens) / 1000.0) * inputPrice
+	cacheReadCost := (float64(cacheReadTokens) / 1000.0) * cacheReadPrice
 	cacheCreateCost := (float64(cacheCreationTokens) / 1000.0) * pricing.CacheCreationPricePer1k
-	outputCost := (float64(outputTokens) / 1000.0) * pricing.OutputPricePer1k
+	outputCost := (float64(outputTokens-reasoningTokens) / 1000.0) * outputPrice
+	reasoningCost := (float64(reasoningTokens) / 1000.0) * reasoningPrice
 
-	return (inputCost + cacheReadCost + cacheCreateCost + outputCost) * pricing.MarkupMultiplier, nil
+	return (inputCost + cacheReadCost + cacheCreateCost + outputCost + reasoningCost) * pricing.MarkupMultiplier
 }
 
-func recordUsageAndBill(userID uuid.UUID, apiKeyID uint, model string, inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens int, cost float64, latencyMs int) error {
-	return database.DB.Transaction(func(tx *gorm.DB) error {
+// recordUsageAndBill charges the entry's cost, settles the request's hold and
+// stores the usage log row in one transaction. Delivered responses are charged
+// in full even when the payer's funds run out, leaving a negative balance.
+func recordUsageAndBill(entry models.UsageLog, holdID uuid.UUID, delivered bool) error {
+	// Create assigns IDs to the attempts; should the transaction roll back, the
+	// caller's copy must still insert as new rows
+	entry.Attempts = append([]models.UpstreamAttempt(nil), entry.Attempts...)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
 		// Use new billing logic that supports package quota
-		if err := billing.DeductCost(tx, userID, cost); err != nil {
+		deductCost, deductOrganizationCost := billing.DeductCost, billing.DeductOrganizationCost
+		if delivered {
+			deductCost, deductOrganizationCost = billing.DeductDeliveredCost, billing.DeductDeliveredOrganizationCost
+		}
+		if entry.OrganizationID != nil {
+			if err := deductOrganizationCost(tx, *entry.OrganizationID, entry.Cost); err != nil {
+				return err
+			}
+		} else if err := deductCost(tx, entry.UserID, entry.Cost); err != nil {
 			return err
 		}
 
-		totalTokens := resolveTotalTokens(inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens)
-
-		log := models.UsageLog{
-			UserID:              userID,
-			APIKeyID:            apiKeyID,
-			Model:               model,
-			InputTokens:         inputTokens,
-			OutputTokens:        outputTokens,
-			CachedTokens:        cacheReadTokens,
-			CacheCreationTokens: cacheCreationTokens,
-			TotalTokens:         totalTokens,
-			Cost:                cost,
-			LatencyMs:           latencyMs,
-			StatusCode:          http.StatusOK,
-		}
-		if err := tx.Create(&log).Error; err != nil {
+		// Close the pre-authorization hold now that the real cost is charged
+		if err := billing.SettleHold(tx, holdID, entry.Cost); err != nil {
 			return err
 		}
 
-		result := tx.Model(&models.APIKey{}).
-			Where("id = ? AND (quota_limit IS NULL OR total_usage + ? <= quota_limit)", apiKeyID, totalTokens).
-			UpdateColumn("total_usage", gorm.Expr("total_usage + ?", totalTokens))
-		if result.Error != nil {
-			return result.Error
-		}
-		if result.RowsAffected == 0 {
-			return fmt.Errorf("api key quota exceeded")
+		totalTokens := resolveTotalTokens(entry.InputTokens, entry.OutputTokens, entry.CachedTokens, entry.CacheCreationTokens)
+
+		entry.TotalTokens = totalTokens
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
 		}
 
-		return nil
+		// The key budget was checked before forwarding; the spend has happened
+		return billing.ChargeKeyQuota(tx, entry.APIKeyID, entry.Cost, totalTokens)
 	})
+	if err == nil {
+		usagelog.Observe(&entry)
+	}
+	return err
 }
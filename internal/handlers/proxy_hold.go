@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"time"
+
+	"codex-gateway/internal/billing"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+
+	"github.com/google/uuid"
+)
+
+// defaultMaxOutputTokens is assumed when a request does not cap its output
+const defaultMaxOutputTokens = 8192
+
+// requestedMaxOutputTokens returns the output cap from any of the supported fields
+func requestedMaxOutputTokens(reqBody map[string]interface{}) int {
+	for _, field := range []string{"max_output_tokens", "max_completion_tokens", "max_tokens"} {
+		if value, ok := reqBody[field].(float64); ok && value > 0 {
+			return int(value)
+		}
+	}
+	return defaultMaxOutputTokens
+}
+
+// holdRefreshInterval is how often a request in flight extends its hold
+const holdRefreshInterval = billing.HoldTTL / 3
+
+// reserveEstimatedCost holds the estimated maximum cost and tokens of a
+// request: the locally counted input tokens plus the output cap. Models
+// without pricing hold no cost, which still enforces the organization member's
+// daily spend cap; billing rejects them later. The key's budget must cover the
+// estimated input.
+func reserveEstimatedCost(user models.User, apiKey models.APIKey, subject pricing.Subject, model string, inputTokens int, maxOutputTokens int) (uuid.UUID, error) {
+	estimatedCost, err := calculateCostWithCache(subject, model, inputTokens, maxOutputTokens, 0, 0)
+	if err != nil || estimatedCost < 0 {
+		estimatedCost = 0
+	}
+
+	inputCost, _ := calculateCost(subject, model, inputTokens, 0)
+	input := billing.KeyEstimate{Cost: inputCost, Tokens: inputTokens}
+	hold, err := billing.Reserve(user.ID, apiKey.OrganizationID, apiKey.ID, model, estimatedCost, inputTokens+maxOutputTokens, input)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return hold.ID, nil
+}
+
+// keepHoldAlive extends a hold every interval until the returned function is
+// called, so streams running longer than billing.HoldTTL stay held. stop
+// returns once no extension is in flight.
+func keepHoldAlive(holdID uuid.UUID, interval time.Duration) (stop func()) {
+	if holdID == uuid.Nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				billing.ExtendHold(holdID)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
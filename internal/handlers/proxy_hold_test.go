@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"codex-gateway/internal/billing"
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestKeepHoldAlive(t *testing.T) {
+	databasetest.Use(t, &models.BalanceHold{})
+	expiresAt := time.Now().Add(time.Minute)
+	hold := models.BalanceHold{UserID: uuid.New(), APIKeyID: 1, Amount: 1, Status: billing.HoldStatusHeld, ExpiresAt: expiresAt}
+	if err := database.DB.Create(&hold).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	stop := keepHoldAlive(hold.ID, 10*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	var got models.BalanceHold
+	for time.Now().Before(deadline) {
+		if err := database.DB.First(&got, "id = ?", hold.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.ExpiresAt.After(expiresAt) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	if !got.ExpiresAt.After(time.Now().Add(billing.HoldTTL - time.Minute)) {
+		t.Errorf("expires at %v, want about %v from now", got.ExpiresAt, billing.HoldTTL)
+	}
+
+	// Unreserved requests have nothing to extend
+	keepHoldAlive(uuid.Nil, time.Millisecond)()
+}
+
+func TestRecordUsageAndBillPastTheHold(t *testing.T) {
+	dailyLimit := 2.0
+	tests := []struct {
+		name         string
+		organization bool
+		dailyLimit   *float64
+		delivered    bool
+		wantErr      bool
+		wantBalance  float64
+	}{
+		{name: "stream charged past the hold and balance", delivered: true, wantBalance: -2},
+		{name: "stream charged past the daily usage limit", dailyLimit: &dailyLimit, delivered: true, wantBalance: -2},
+		{name: "organization stream charged past its balance", organization: true, delivered: true, wantBalance: -2},
+		{name: "undelivered response refused", wantErr: true, wantBalance: 1},
+		{name: "undelivered organization response refused", organization: true, wantErr: true, wantBalance: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databasetest.Use(t,
+				&models.User{}, &models.APIKey{}, &models.UsageLog{}, &models.UpstreamAttempt{}, &models.BalanceHold{},
+				&models.DailyUsage{}, &models.UserPackage{}, &models.SystemSettings{},
+				&models.Organization{}, &models.OrganizationMember{}, &models.OrganizationDailyUsage{}, &models.OrganizationPackage{},
+			)
+			// Created by a raw migration in production
+			if err := database.DB.Exec("CREATE UNIQUE INDEX idx_daily_usage_user_date_unique ON daily_usage(user_id, date)").Error; err != nil {
+				t.Fatal(err)
+			}
+			user := models.User{Email: "user@example.com", Balance: 1}
+			create(t, &user)
+			create(t, &models.SystemSettings{UserDailyUsageLimit: tt.dailyLimit})
+			var orgID *uuid.UUID
+			if tt.organization {
+				org := models.Organization{Name: "Acme", Balance: 1}
+				create(t, &org)
+				create(t, &models.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: "member"})
+				orgID = &org.ID
+			}
+			key := models.APIKey{UserID: user.ID, OrganizationID: orgID, KeyHash: "hash", KeyPrefix: "sk-test"}
+			create(t, &key)
+
+			hold, err := billing.Reserve(user.ID, orgID, key.ID, "gpt-5.1", 0.5, 1000, billing.KeyEstimate{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Output ran far past the estimate the hold was sized for
+			entry := models.UsageLog{
+				RequestID: uuid.New(), UserID: user.ID, APIKeyID: key.ID, OrganizationID: orgID,
+				Model: "gpt-5.1", InputTokens: 1000, OutputTokens: 50000, Cost: 3, StatusCode: 200,
+			}
+			err = recordUsageAndBill(entry, hold.ID, tt.delivered)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("recordUsageAndBill = %v, want error %v", err, tt.wantErr)
+			}
+
+			var balance float64
+			if tt.organization {
+				database.DB.Model(&models.Organization{}).Where("id = ?", *orgID).Select("balance").Scan(&balance)
+			} else {
+				database.DB.Model(&models.User{}).Where("id = ?", user.ID).Select("balance").Scan(&balance)
+			}
+			if balance != tt.wantBalance {
+				t.Errorf("balance = %v, want %v", balance, tt.wantBalance)
+			}
+
+			var stored models.BalanceHold
+			if err := database.DB.First(&stored, "id = ?", hold.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			var logged models.UsageLog
+			loggedErr := database.DB.First(&logged, "request_id = ?", entry.RequestID).Error
+			if tt.wantErr {
+				if stored.Status != billing.HoldStatusHeld || loggedErr == nil {
+					t.Errorf("refused charge settled the hold (%s) or logged usage", stored.Status)
+				}
+				return
+			}
+			if stored.Status != billing.HoldStatusSettled || stored.SettledAmount != 3 {
+				t.Errorf("hold = %s for %v, want settled for the full cost", stored.Status, stored.SettledAmount)
+			}
+			if loggedErr != nil || logged.Cost != 3 {
+				t.Errorf("usage log cost = %v (%v), want the full cost", logged.Cost, loggedErr)
+			}
+		})
+	}
+}
+
+func create(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := database.DB.Create(value).Error; err != nil {
+		t.Fatal(err)
+	}
+}
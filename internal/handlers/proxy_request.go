@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"codex-gateway/internal/anthropic"
+	"codex-gateway/internal/billing"
+	"codex-gateway/internal/codex"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+	"codex-gateway/internal/upstream"
+	"codex-gateway/internal/usagelog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Client APIs translated to the Responses API upstream
+const (
+	clientAPIChat      = "chat"
+	clientAPIAnthropic = "anthropic"
+)
+
+// streamTranslator rewrites upstream Responses stream lines for the client API
+type streamTranslator interface {
+	WriteLine(w io.Writer, line string) error
+}
+
+// proxyRequest carries per-request state through the proxy pipeline and
+// describes the usage log row recorded for the request
+type proxyRequest struct {
+	requestID    uuid.UUID // Assigned by middleware.RequestID; primary key of the usage log row
+	user         models.User
+	apiKey       models.APIKey
+	model        string
+	requestPath  string
+	upstreamPath string // Path forwarded upstream; differs from requestPath for translated APIs
+	clientAPI    string // API the client speaks when it is translated to the Responses API; empty when passed through
+	stream       bool
+	startTime    time.Time
+	holdID       uuid.UUID
+	upstreamID   *uint
+	attempts     []upstream.Attempt // Upstream tries in order, set by setUpstream
+	subject      pricing.Subject    // Payer matched against pricing rules
+	firstToken   time.Duration      // Time until the first byte of output reached the client
+	inputTokens  int                // Locally counted prompt tokens, billed when upstream reports no usage
+	usedTokens   int                // Tokens the upstream consumed, reconciled against the TPM estimate
+}
+
+// pricingSubject describes who pays for a request made with apiKey. The
+// payer's package is only looked up when some pricing rule targets a package.
+func pricingSubject(user models.User, apiKey models.APIKey) pricing.Subject {
+	subject := pricing.Subject{
+		UserID:         user.ID,
+		Role:           user.Role,
+		OrganizationID: apiKey.OrganizationID,
+	}
+	if pricing.UsesPackageRules() {
+		subject.PackageID = billing.ActivePackageID(user.ID, apiKey.OrganizationID)
+	}
+	return subject
+}
+
+// translateRequest converts the client's request body to a Responses request
+func (pr *proxyRequest) translateRequest(reqBody map[string]interface{}) (map[string]interface{}, error) {
+	if pr.clientAPI == clientAPIAnthropic {
+		return anthropic.ToResponsesRequest(reqBody)
+	}
+	return codex.ChatToResponsesRequest(reqBody)
+}
+
+// translateResponse converts a Responses response body for the client
+func (pr *proxyRequest) translateResponse(body []byte) (map[string]interface{}, error) {
+	if pr.clientAPI == clientAPIAnthropic {
+		return anthropic.FromResponsesResponse(body, pr.model)
+	}
+	return codex.ResponsesToChatCompletion(body, pr.model)
+}
+
+// streamTranslator returns the translator for the client's stream, or nil
+// when the upstream stream is forwarded as-is
+func (pr *proxyRequest) streamTranslator() streamTranslator {
+	switch pr.clientAPI {
+	case clientAPIAnthropic:
+		return anthropic.NewStreamTranslator(pr.model)
+	case clientAPIChat:
+		return codex.NewChatStreamTranslator(pr.model)
+	}
+	return nil
+}
+
+// setUpstream remembers which upstream served (or last failed) the request and
+// the attempts sendWithFailover made
+func (pr *proxyRequest) setUpstream(c *gin.Context, upstreamObj *models.CodexUpstream) {
+	if attempts, ok := c.Get(upstreamAttemptsKey); ok {
+		pr.attempts, _ = attempts.([]upstream.Attempt)
+	}
+	if upstreamObj == nil || upstreamObj.ID == 0 {
+		return
+	}
+	id := upstreamObj.ID
+	pr.upstreamID = &id
+}
+
+// usageLog builds the usage log row for the request
+func (pr *proxyRequest) usageLog(statusCode int, errorClass string) models.UsageLog {
+	return models.UsageLog{
+		RequestID:          pr.requestID,
+		UserID:             pr.user.ID,
+		APIKeyID:           pr.apiKey.ID,
+		Model:              pr.model,
+		LatencyMs:          int(time.Since(pr.startTime).Milliseconds()),
+		StatusCode:         statusCode,
+		ErrorClass:         errorClass,
+		UpstreamID:         pr.upstreamID,
+		RequestPath:        pr.requestPath,
+		Stream:             pr.stream,
+		TimeToFirstTokenMs: int(pr.firstToken.Milliseconds()),
+		OrganizationID:     pr.apiKey.OrganizationID,
+		Attempts:           pr.failedAttempts(),
+	}
+}
+
+// failedAttempts returns the attempts to store with the usage log: all of
+// them when any failed, none when the first attempt was served
+func (pr *proxyRequest) failedAttempts() []models.UpstreamAttempt {
+	failed := false
+	for _, attempt := range pr.attempts {
+		if attempt.Error != "" {
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+
+	rows := make([]models.UpstreamAttempt, 0, len(pr.attempts))
+	for i, attempt := range pr.attempts {
+		rows = append(rows, models.UpstreamAttempt{
+			RequestID:  pr.requestID,
+			Attempt:    i + 1,
+			UpstreamID: attempt.UpstreamID,
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			LatencyMs:  int(attempt.Duration.Milliseconds()),
+		})
+	}
+	return rows
+}
+
+// fail responds with an error and records the request as failed
+func (pr *proxyRequest) fail(c *gin.Context, statusCode int, errorClass string, message string) {
+	if pr.clientAPI == clientAPIAnthropic {
+		c.JSON(statusCode, anthropic.ErrorBody(statusCode, message))
+	} else {
+		c.JSON(statusCode, gin.H{"error": message})
+	}
+	pr.record(statusCode, errorClass)
+}
+
+// record stores an unbilled usage log row for the request
+func (pr *proxyRequest) record(statusCode int, errorClass string) {
+	entry := pr.usageLog(statusCode, errorClass)
+	usagelog.Record(&entry)
+}
+
+// failUpstream responds to an error returned by sendWithFailover. Upstream status
+// errors are passed through when passStatus is set and reported as 502 otherwise.
+func (pr *proxyRequest) failUpstream(c *gin.Context, err error, passStatus bool) {
+	var statusErr *upstreamStatusError
+	switch {
+	case errors.Is(err, upstream.ErrModelNotSupported):
+		pr.fail(c, http.StatusNotFound, usagelog.ErrorModelNotSupported, modelNotSupportedMessage(pr.model))
+	case errors.Is(err, errNoUpstream):
+		pr.fail(c, http.StatusServiceUnavailable, usagelog.ErrorNoUpstream, "no available upstream")
+	case c.Request.Context().Err() != nil:
+		pr.record(usagelog.StatusClientClosedRequest, usagelog.ErrorClientDisconnected)
+	case errors.As(err, &statusErr) && passStatus:
+		pr.fail(c, statusErr.StatusCode, usagelog.ErrorUpstreamStatus, statusErr.Error())
+	case errors.As(err, &statusErr):
+		pr.fail(c, http.StatusBadGateway, usagelog.ErrorUpstreamStatus, fmt.Sprintf("upstream error: %v", err))
+	default:
+		pr.fail(c, http.StatusBadGateway, usagelog.ErrorUpstreamConnection, fmt.Sprintf("upstream error: %v", err))
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/upstream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestUsageLogAttempts(t *testing.T) {
+	served := upstream.Attempt{UpstreamID: 2, StatusCode: 200, Duration: 900 * time.Millisecond}
+	overloaded := upstream.Attempt{UpstreamID: 1, StatusCode: 529, Error: "upstream returned 529: overloaded", Duration: 120 * time.Millisecond}
+	refused := upstream.Attempt{UpstreamID: 3, Error: "connection refused", Duration: 5 * time.Millisecond}
+
+	tests := []struct {
+		name     string
+		attempts []upstream.Attempt
+		want     []models.UpstreamAttempt
+	}{
+		{name: "not sent upstream"},
+		{name: "served first time", attempts: []upstream.Attempt{served}},
+		{
+			name:     "served after failover",
+			attempts: []upstream.Attempt{overloaded, served},
+			want: []models.UpstreamAttempt{
+				{Attempt: 1, UpstreamID: 1, StatusCode: 529, Error: "upstream returned 529: overloaded", LatencyMs: 120},
+				{Attempt: 2, UpstreamID: 2, StatusCode: 200, LatencyMs: 900},
+			},
+		},
+		{
+			name:     "every attempt failed",
+			attempts: []upstream.Attempt{refused},
+			want:     []models.UpstreamAttempt{{Attempt: 1, UpstreamID: 3, Error: "connection refused", LatencyMs: 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.attempts != nil {
+				c.Set(upstreamAttemptsKey, tt.attempts)
+			}
+
+			pr := &proxyRequest{requestID: uuid.New(), startTime: time.Now()}
+			pr.setUpstream(c, &models.CodexUpstream{ID: 2})
+			got := pr.usageLog(200, "").Attempts
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("stored %d attempts, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				want.RequestID = pr.requestID
+				if got[i] != want {
+					t.Errorf("attempt %d = %+v, want %+v", i+1, got[i], want)
+				}
+			}
+		})
+	}
+}
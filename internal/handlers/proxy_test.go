@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+)
+
+func TestCostWithPricing(t *testing.T) {
+	list := models.ModelPricing{
+		InputPricePer1k: 0.001, OutputPricePer1k: 0.01, CacheReadPricePer1k: 0.0001, ReasoningPricePer1k: 0.02,
+		TierThresholdTokens: 10000, TierInputPricePer1k: 0.002, TierOutputPricePer1k: 0.015,
+		MarkupMultiplier: 1.5,
+	}
+	markup := 1.0
+	input, output := 0.0005, 0.004
+
+	tests := []struct {
+		name                                     string
+		rule                                     *models.PricingRule
+		input, output, reasoning, cached, create int
+		want                                     float64
+	}{
+		{name: "list price", input: 1000, output: 1000, want: (0.001 + 0.01) * 1.5},
+		{name: "reasoning at its own price", input: 1000, output: 1000, reasoning: 400, want: (0.001 + 0.006 + 0.008) * 1.5},
+		{name: "cached input", input: 1000, output: 0, cached: 600, want: (0.0004 + 0.00006) * 1.5},
+		{name: "above the tier", input: 20000, output: 1000, want: (0.04 + 0.015) * 1.5},
+		{
+			name:  "percentage discount",
+			rule:  &models.PricingRule{DiscountPercent: 50},
+			input: 1000, output: 1000, want: (0.001 + 0.01) * 0.75,
+		},
+		{
+			name:  "price overrides",
+			rule:  &models.PricingRule{InputPricePer1k: &input, OutputPricePer1k: &output, MarkupMultiplier: &markup},
+			input: 1000, output: 1000, reasoning: 500, want: 0.0005 + 0.004,
+		},
+		{
+			name:  "price overrides above the tier",
+			rule:  &models.PricingRule{InputPricePer1k: &input, OutputPricePer1k: &output, MarkupMultiplier: &markup},
+			input: 20000, output: 1000, want: 0.01 + 0.004,
+		},
+		{
+			name:  "discount per 1k tokens",
+			rule:  &models.PricingRule{DiscountPer1k: 0.001},
+			input: 1000, output: 1000, want: (0.001+0.01)*1.5 - 0.002,
+		},
+		{
+			name:  "discount per 1k tokens on a small request",
+			rule:  &models.PricingRule{DiscountPer1k: 0.001},
+			input: 100, output: 10, want: (0.0001+0.0001)*1.5 - 0.00011,
+		},
+		{
+			name:  "discount per 1k tokens larger than the price",
+			rule:  &models.PricingRule{DiscountPer1k: 1},
+			input: 1000, output: 1000, want: 0,
+		},
+	}
+	for _, tt := range tests {
+		price := list
+		pricing.ApplyRule(&price, tt.rule)
+		cost := costWithPricing(&price, tt.input, tt.output, tt.reasoning, tt.cached, tt.create)
+		got := pricing.Discount(cost, resolveTotalTokens(tt.input, tt.output, tt.cached, tt.create), tt.rule)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: cost = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
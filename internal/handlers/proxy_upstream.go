@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"codex-gateway/internal/logger"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/upstream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errNoUpstream = errors.New("no available upstream")
+
+// upstreamAttemptsKey is the context key sendWithFailover stores its
+// []upstream.Attempt under
+const upstreamAttemptsKey = "upstream_attempts"
+
+// upstreamStatusError is returned when an upstream answers with a non-200 status
+type upstreamStatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream returned %d: %s", e.StatusCode, e.Body)
+}
+
+// sendWithFailover sends the request to the user's upstream and retries on other
+// upstreams for connection errors, 429s and 5xx responses. The first upstream's
+// MaxRetries bounds the retries of the whole request. Only responses with
+// status 200 are returned; nothing has been written to the client at that point,
+// so failing over is always safe. The caller must close the response body.
+func sendWithFailover(c *gin.Context, userID uuid.UUID, reqBody map[string]interface{}, model string, requestPath string, stream bool) (*http.Response, *models.CodexUpstream, error) {
+	ctx := c.Request.Context()
+
+	upstreamObj, err := selectUpstreamForUser(userID, model)
+	if err != nil {
+		if errors.Is(err, upstream.ErrModelNotSupported) {
+			return nil, nil, err
+		}
+		return nil, nil, errNoUpstream
+	}
+
+	var (
+		attempts   []upstream.Attempt
+		excludeIDs []uint
+		lastErr    error
+	)
+
+	defer func() {
+		c.Set(upstreamAttemptsKey, attempts)
+	}()
+
+	breaker := upstream.GetCircuitBreaker()
+	tracker := upstream.GetLoadTracker()
+	maxRetries := upstreamObj.MaxRetries
+
+	for retries := 0; ; retries++ {
+		reqBytes, err := marshalForUpstream(reqBody, upstreamObj, model)
+		if err != nil {
+			return nil, upstreamObj, err
+		}
+
+		start := time.Now()
+		breaker.OnAttempt(upstreamObj.ID)
+		tracker.Begin(upstreamObj.ID)
+		resp, err := sendUpstreamRequest(ctx, upstreamObj, reqBytes, requestPath, stream)
+		recordUpstreamOutcome(ctx, upstreamObj, err)
+
+		attempt := upstream.Attempt{
+			UpstreamID:   upstreamObj.ID,
+			UpstreamName: upstreamObj.Name,
+			Duration:     time.Since(start),
+		}
+		if resp != nil {
+			attempt.StatusCode = resp.StatusCode
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		attempts = append(attempts, attempt)
+
+		if err == nil {
+			// The request stays outstanding until the caller closes the body
+			tracker.ObserveLatency(upstreamObj.ID, attempt.Duration)
+			resp.Body = &loadTrackedBody{ReadCloser: resp.Body, upstreamID: upstreamObj.ID}
+
+			if len(attempts) > 1 {
+				logger.FromContext(ctx).Info("served after failover", "component", "Proxy",
+					"user_id", userID, "upstream", upstreamObj.Name, "attempts", attempts)
+			}
+			return resp, upstreamObj, nil
+		}
+		tracker.End(upstreamObj.ID)
+		lastErr = err
+
+		// Client went away; there is nobody left to retry for
+		if ctx.Err() != nil {
+			return nil, upstreamObj, lastErr
+		}
+
+		var statusErr *upstreamStatusError
+		if errors.As(err, &statusErr) && !upstream.IsRetryableStatus(statusErr.StatusCode) {
+			return nil, upstreamObj, lastErr
+		}
+
+		if retries >= maxRetries {
+			break
+		}
+
+		excludeIDs = append(excludeIDs, upstreamObj.ID)
+		next, selErr := upstream.GetSelector().SelectWithFallback(userID, model, excludeIDs)
+		if selErr != nil {
+			break
+		}
+
+		retryAfter := time.Duration(0)
+		if statusErr != nil {
+			retryAfter = statusErr.RetryAfter
+		}
+		delay := upstream.Backoff(retries+1, retryAfter)
+		logger.FromContext(ctx).Warn("upstream attempt failed, retrying", "component", "Proxy",
+			"upstream", upstreamObj.Name, "error", err, "next_upstream", next.Name, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, upstreamObj, lastErr
+		case <-timer.C:
+		}
+
+		upstreamObj = next
+	}
+
+	logger.FromContext(ctx).Error("all upstream attempts failed", "component", "Proxy",
+		"user_id", userID, "attempts", attempts, "error", lastErr)
+	return nil, upstreamObj, lastErr
+}
+
+// marshalForUpstream encodes the request body, applying the upstream's model alias
+func marshalForUpstream(reqBody map[string]interface{}, upstreamObj *models.CodexUpstream, model string) ([]byte, error) {
+	resolved := upstream.ResolveModel(upstreamObj, model)
+	if resolved == model {
+		return json.Marshal(reqBody)
+	}
+
+	rewritten := make(map[string]interface{}, len(reqBody))
+	for k, v := range reqBody {
+		rewritten[k] = v
+	}
+	rewritten["model"] = resolved
+	return json.Marshal(rewritten)
+}
+
+func modelNotSupportedMessage(model string) string {
+	return fmt.Sprintf("model '%s' is not available on this gateway", model)
+}
+
+// recordUpstreamOutcome feeds the result of a request into the upstream's circuit.
+// Client cancellations and non-retryable 4xx responses do not count as failures.
+func recordUpstreamOutcome(ctx context.Context, upstreamObj *models.CodexUpstream, err error) {
+	if upstreamObj.ID == 0 {
+		return
+	}
+	breaker := upstream.GetCircuitBreaker()
+
+	if err == nil {
+		breaker.RecordSuccess(upstreamObj.ID)
+		return
+	}
+	if ctx.Err() != nil {
+		breaker.ReleaseProbe(upstreamObj.ID)
+		return
+	}
+
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) && !upstream.IsRetryableStatus(statusErr.StatusCode) {
+		breaker.RecordSuccess(upstreamObj.ID)
+		return
+	}
+	breaker.RecordFailure(upstreamObj.ID)
+}
+
+// sendUpstreamRequest performs a single request against one upstream. Non-200
+// responses are drained and returned as *upstreamStatusError.
+func sendUpstreamRequest(ctx context.Context, upstreamObj *models.CodexUpstream, reqBytes []byte, requestPath string, stream bool) (*http.Response, error) {
+	upstreamURL := strings.TrimRight(upstreamObj.BaseURL, "/") + requestPath
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", upstreamURL, bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+upstreamObj.APIKey)
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		httpReq.Header.Set("X-Request-ID", requestID)
+	}
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := upstream.GetClientPool().ClientFor(upstreamObj).Do(httpReq, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return resp, &upstreamStatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(bodyBytes),
+			RetryAfter: upstream.ParseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return resp, nil
+}
+
+// loadTrackedBody ends the upstream's outstanding request when the body is closed
+type loadTrackedBody struct {
+	io.ReadCloser
+	upstreamID uint
+	once       sync.Once
+}
+
+func (b *loadTrackedBody) Close() error {
+	b.once.Do(func() {
+		upstream.GetLoadTracker().End(b.upstreamID)
+	})
+	return b.ReadCloser.Close()
+}
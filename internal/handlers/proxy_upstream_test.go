@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/upstream"
+	"codex-gateway/internal/usagelog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestSendWithFailoverRetryBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   []int // Per upstream, in priority order
+		wantAttempts int
+	}{
+		{name: "first upstream allows more retries than the next", maxRetries: []int{2, 1, 1}, wantAttempts: 3},
+		{name: "first upstream allows fewer retries than the next", maxRetries: []int{1, 5, 5}, wantAttempts: 2},
+		{name: "budget larger than the upstreams", maxRetries: []int{5, 1}, wantAttempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databasetest.Use(t, &models.CodexUpstream{}, &models.SystemSettings{})
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			create(t, &models.SystemSettings{UpstreamStrategy: upstream.StrategyPriority})
+			for i, maxRetries := range tt.maxRetries {
+				create(t, &models.CodexUpstream{
+					Name: "upstream", BaseURL: server.URL, APIKey: "sk-upstream",
+					Priority: i, Status: "active", MaxRetries: maxRetries,
+				})
+			}
+			if err := upstream.GetSelector().RefreshUpstreams(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				for _, u := range upstream.GetSelector().GetAllUpstreams() {
+					upstream.GetCircuitBreaker().Reset(u.ID)
+				}
+			})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+			reqBody := map[string]interface{}{"model": "gpt-5.1"}
+
+			_, _, err := sendWithFailover(c, uuid.New(), reqBody, "gpt-5.1", "/responses", false)
+			if err == nil {
+				t.Fatal("sendWithFailover succeeded against failing upstreams")
+			}
+			attempts, _ := c.Get(upstreamAttemptsKey)
+			if got := len(attempts.([]upstream.Attempt)); got != tt.wantAttempts || int(requests.Load()) != tt.wantAttempts {
+				t.Errorf("made %d attempts (%d requests), want %d", got, requests.Load(), tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestModelNotServed(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientAPI  string
+		supported  []string
+		open       bool // The serving upstream's circuit is open
+		wantStatus int
+		wantClass  string
+		wantBody   string
+	}{
+		{name: "no upstream lists the model", supported: []string{"gpt-4o"}, wantStatus: http.StatusNotFound, wantClass: usagelog.ErrorModelNotSupported, wantBody: "model 'gpt-5.1' is not available on this gateway"},
+		{name: "anthropic client", clientAPI: clientAPIAnthropic, supported: []string{"gpt-4o"}, wantStatus: http.StatusNotFound, wantClass: usagelog.ErrorModelNotSupported, wantBody: "not_found_error"},
+		{name: "serving upstream unavailable", supported: []string{"gpt-5.*"}, open: true, wantStatus: http.StatusServiceUnavailable, wantClass: usagelog.ErrorNoUpstream, wantBody: "no available upstream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databasetest.Use(t, &models.CodexUpstream{}, &models.SystemSettings{}, &models.UsageLog{}, &models.UpstreamAttempt{})
+			create(t, &models.SystemSettings{UpstreamStrategy: upstream.StrategyPriority})
+			served := models.CodexUpstream{Name: "upstream", BaseURL: "http://127.0.0.1:1", APIKey: "sk-upstream", Status: "active", SupportedModels: tt.supported}
+			create(t, &served)
+			if err := upstream.GetSelector().RefreshUpstreams(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.open {
+				for i := 0; i < 5; i++ {
+					upstream.GetCircuitBreaker().RecordFailure(served.ID)
+				}
+			}
+			t.Cleanup(func() { upstream.GetCircuitBreaker().Reset(served.ID) })
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+			pr := &proxyRequest{requestID: uuid.New(), user: models.User{ID: uuid.New()}, clientAPI: tt.clientAPI, model: "gpt-5.1"}
+
+			_, _, err := sendWithFailover(c, pr.user.ID, map[string]interface{}{"model": "gpt-5.1"}, "gpt-5.1", "/responses", false)
+			pr.failUpstream(c, err, false)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to mention %q", w.Body.String(), tt.wantBody)
+			}
+			var logged models.UsageLog
+			if err := database.DB.First(&logged, "request_id = ?", pr.requestID).Error; err != nil || logged.ErrorClass != tt.wantClass {
+				t.Errorf("usage log error class = %q (%v), want %q", logged.ErrorClass, err, tt.wantClass)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"codex-gateway/internal/config"
 	"codex-gateway/internal/database"
+	"codex-gateway/internal/modelalias"
 	"codex-gateway/internal/models"
 	"codex-gateway/internal/ratelimit"
 	"codex-gateway/internal/upstream"
@@ -54,6 +55,8 @@ func SetupInitialize(c *gin.Context) {
 		RateLimitEnabled           bool    `json:"rate_limit_enabled"`
 		RateLimitRPM               int     `json:"rate_limit_rpm"`
 		RateLimitBurst             int     `json:"rate_limit_burst"`
+		RateLimitTPM               int     `json:"rate_limit_tpm"`
+		RateLimitConcurrent        int     `json:"rate_limit_concurrent"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -95,6 +98,8 @@ func SetupInitialize(c *gin.Context) {
 			RateLimitEnabled:           req.RateLimitEnabled,
 			RateLimitRPM:               req.RateLimitRPM,
 			RateLimitBurst:             req.RateLimitBurst,
+			RateLimitTPM:               req.RateLimitTPM,
+			RateLimitConcurrent:        req.RateLimitConcurrent,
 		}
 
 		if settings.OpenAIBaseURL == "" {
@@ -176,4 +181,5 @@ func SetupInitialize(c *gin.Context) {
 	// Refresh upstream selector after setup
 	_ = upstream.GetSelector().RefreshUpstreams()
 	ratelimit.LoadFromDB()
+	modelalias.LoadFromDB()
 }
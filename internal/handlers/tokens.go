@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"codex-gateway/internal/anthropic"
+	"codex-gateway/internal/codex"
+	"codex-gateway/internal/tokenizer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CountTokens counts the input tokens of a request body without forwarding it
+// POST /v1/tokens/count
+func CountTokens(c *gin.Context) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+
+	var reqBody map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+		return
+	}
+
+	model, _ := reqBody["model"].(string)
+	if model == "" {
+		model = "gpt-5.1-codex"
+	}
+
+	inputTokens, encoding := tokenizer.CountRequest(model, reqBody)
+	c.JSON(http.StatusOK, gin.H{
+		"model":        model,
+		"input_tokens": inputTokens,
+		"encoding":     encoding,
+	})
+}
+
+// CountMessageTokens counts the input tokens of an Anthropic Messages request
+// POST /v1/messages/count_tokens
+func CountMessageTokens(c *gin.Context) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, anthropic.ErrorBody(http.StatusBadRequest, "failed to read request body"))
+		return
+	}
+
+	var reqBody map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, anthropic.ErrorBody(http.StatusBadRequest, "invalid JSON"))
+		return
+	}
+
+	translated, err := anthropic.ToResponsesRequest(reqBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, anthropic.ErrorBody(http.StatusBadRequest, err.Error()))
+		return
+	}
+	codex.TransformRequest(translated)
+
+	model, _ := translated["model"].(string)
+	inputTokens, _ := tokenizer.CountRequest(model, translated)
+	c.JSON(http.StatusOK, gin.H{"input_tokens": inputTokens})
+}
@@ -9,9 +9,11 @@ import (
 
 	"codex-gateway/internal/database"
 	"codex-gateway/internal/models"
+	"codex-gateway/internal/organization"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func GetUsageLogs(c *gin.Context) {
@@ -26,8 +28,13 @@ func GetUsageLogs(c *gin.Context) {
 		pageSize = 20
 	}
 
+	scope, ok := usageScope(c, user)
+	if !ok {
+		return
+	}
+
 	var logs []models.UsageLog
-	query := database.DB.Model(&models.UsageLog{}).Where("user_id = ?", user.ID)
+	query := database.DB.Model(&models.UsageLog{}).Scopes(scope)
 
 	if model := c.Query("model"); model != "" {
 		query = query.Where("model = ?", model)
@@ -73,16 +80,21 @@ func GetUsageStats(c *gin.Context) {
 	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, shanghaiTZ).UTC()
 	sevenDaysAgo := now.AddDate(0, 0, -7).UTC()
 
+	scope, ok := usageScope(c, user)
+	if !ok {
+		return
+	}
+
 	var todayCost, monthCost, totalCost, sevenDaysCost float64
 	var sevenDaysRequests, sevenDaysTokens int64
 
-	database.DB.Model(&models.UsageLog{}).Where("user_id = ? AND created_at >= ?", user.ID, startOfDay).Select("COALESCE(SUM(cost), 0)").Scan(&todayCost)
-	database.DB.Model(&models.UsageLog{}).Where("user_id = ? AND created_at >= ?", user.ID, startOfMonth).Select("COALESCE(SUM(cost), 0)").Scan(&monthCost)
-	database.DB.Model(&models.UsageLog{}).Where("user_id = ?", user.ID).Select("COALESCE(SUM(cost), 0)").Scan(&totalCost)
+	database.DB.Model(&models.UsageLog{}).Scopes(scope).Where("created_at >= ?", startOfDay).Select("COALESCE(SUM(cost), 0)").Scan(&todayCost)
+	database.DB.Model(&models.UsageLog{}).Scopes(scope).Where("created_at >= ?", startOfMonth).Select("COALESCE(SUM(cost), 0)").Scan(&monthCost)
+	database.DB.Model(&models.UsageLog{}).Scopes(scope).Select("COALESCE(SUM(cost), 0)").Scan(&totalCost)
 
-	database.DB.Model(&models.UsageLog{}).Where("user_id = ? AND created_at >= ?", user.ID, sevenDaysAgo).Select("COALESCE(SUM(cost), 0)").Scan(&sevenDaysCost)
-	database.DB.Model(&models.UsageLog{}).Where("user_id = ? AND created_at >= ?", user.ID, sevenDaysAgo).Count(&sevenDaysRequests)
-	database.DB.Model(&models.UsageLog{}).Where("user_id = ? AND created_at >= ?", user.ID, sevenDaysAgo).Select("COALESCE(SUM(total_tokens), 0)").Scan(&sevenDaysTokens)
+	database.DB.Model(&models.UsageLog{}).Scopes(scope).Where("created_at >= ?", sevenDaysAgo).Select("COALESCE(SUM(cost), 0)").Scan(&sevenDaysCost)
+	database.DB.Model(&models.UsageLog{}).Scopes(scope).Where("created_at >= ?", sevenDaysAgo).Count(&sevenDaysRequests)
+	database.DB.Model(&models.UsageLog{}).Scopes(scope).Where("created_at >= ?", sevenDaysAgo).Select("COALESCE(SUM(total_tokens), 0)").Scan(&sevenDaysTokens)
 
 	c.JSON(http.StatusOK, gin.H{
 		"today_cost":          todayCost,
@@ -118,6 +130,11 @@ func GetDailyTrend(c *gin.Context) {
 	user := c.MustGet("user").(models.User)
 	trendType := c.DefaultQuery("type", "cost")
 
+	scope, ok := usageScope(c, user)
+	if !ok {
+		return
+	}
+
 	type DailyData struct {
 		Date  string  `json:"date"`
 		Value float64 `json:"value"`
@@ -136,19 +153,19 @@ func GetDailyTrend(c *gin.Context) {
 		var value float64
 		switch trendType {
 		case "cost":
-			database.DB.Model(&models.UsageLog{}).
-				Where("user_id = ? AND created_at >= ? AND created_at < ?", user.ID, startOfDay, endOfDay).
+			database.DB.Model(&models.UsageLog{}).Scopes(scope).
+				Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay).
 				Select("COALESCE(SUM(cost), 0)").
 				Scan(&value)
 		case "requests":
 			var count int64
-			database.DB.Model(&models.UsageLog{}).
-				Where("user_id = ? AND created_at >= ? AND created_at < ?", user.ID, startOfDay, endOfDay).
+			database.DB.Model(&models.UsageLog{}).Scopes(scope).
+				Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay).
 				Count(&count)
 			value = float64(count)
 		case "tokens":
-			database.DB.Model(&models.UsageLog{}).
-				Where("user_id = ? AND created_at >= ? AND created_at < ?", user.ID, startOfDay, endOfDay).
+			database.DB.Model(&models.UsageLog{}).Scopes(scope).
+				Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay).
 				Select("COALESCE(SUM(total_tokens), 0)").
 				Scan(&value)
 		}
@@ -200,6 +217,19 @@ func AdminGetUsageLogs(c *gin.Context) {
 		query = query.Where("status_code = ?", statusCode)
 	}
 
+	if errorClass := strings.TrimSpace(c.Query("error_class")); errorClass != "" {
+		query = query.Where("error_class = ?", errorClass)
+	}
+
+	if upstreamIDStr := strings.TrimSpace(c.Query("upstream_id")); upstreamIDStr != "" {
+		upstreamID, err := strconv.Atoi(upstreamIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upstream_id"})
+			return
+		}
+		query = query.Where("upstream_id = ?", upstreamID)
+	}
+
 	if apiKeyIDStr := strings.TrimSpace(c.Query("api_key_id")); apiKeyIDStr != "" {
 		apiKeyID, err := strconv.Atoi(apiKeyIDStr)
 		if err != nil {
@@ -218,6 +248,24 @@ func AdminGetUsageLogs(c *gin.Context) {
 		query = query.Where("usage_logs.user_id = ?", userID)
 	}
 
+	if orgIDStr := strings.TrimSpace(c.Query("organization_id")); orgIDStr != "" {
+		orgID, err := uuid.Parse(orgIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization_id"})
+			return
+		}
+		query = query.Where("usage_logs.organization_id = ?", orgID)
+	}
+
+	if requestIDStr := strings.TrimSpace(c.Query("request_id")); requestIDStr != "" {
+		requestID, err := uuid.Parse(requestIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request_id"})
+			return
+		}
+		query = query.Where("usage_logs.request_id = ?", requestID)
+	}
+
 	if userFilter := strings.TrimSpace(c.Query("user")); userFilter != "" {
 		if userID, err := uuid.Parse(userFilter); err == nil {
 			query = query.Where("usage_logs.user_id = ?", userID)
@@ -236,6 +284,7 @@ func AdminGetUsageLogs(c *gin.Context) {
 
 	var logs []models.UsageLog
 	if err := query.Preload("User").
+		Preload("Attempts", func(db *gorm.DB) *gorm.DB { return db.Order("attempt ASC") }).
 		Order("created_at desc").
 		Limit(pageSize).
 		Offset((page - 1) * pageSize).
@@ -245,21 +294,28 @@ func AdminGetUsageLogs(c *gin.Context) {
 	}
 
 	type AdminUsageLog struct {
-		RequestID    string  `json:"request_id"`
-		UserID       string  `json:"user_id"`
-		Username     string  `json:"username"`
-		LinuxDoID    string  `json:"linuxdo_id"`
-		APIKeyID     uint    `json:"api_key_id"`
-		Model        string  `json:"model"`
-		InputTokens  int     `json:"input_tokens"`
-		OutputTokens int     `json:"output_tokens"`
-		CachedTokens int     `json:"cached_tokens"`
-		CacheCreationTokens int `json:"cache_creation_tokens"`
-		TotalTokens  int     `json:"total_tokens"`
-		Cost         float64 `json:"cost"`
-		LatencyMs    int     `json:"latency_ms"`
-		StatusCode   int     `json:"status_code"`
-		CreatedAt    string  `json:"created_at"`
+		RequestID           string                   `json:"request_id"`
+		UserID              string                   `json:"user_id"`
+		Username            string                   `json:"username"`
+		LinuxDoID           string                   `json:"linuxdo_id"`
+		APIKeyID            uint                     `json:"api_key_id"`
+		Model               string                   `json:"model"`
+		InputTokens         int                      `json:"input_tokens"`
+		OutputTokens        int                      `json:"output_tokens"`
+		CachedTokens        int                      `json:"cached_tokens"`
+		CacheCreationTokens int                      `json:"cache_creation_tokens"`
+		TotalTokens         int                      `json:"total_tokens"`
+		Cost                float64                  `json:"cost"`
+		LatencyMs           int                      `json:"latency_ms"`
+		StatusCode          int                      `json:"status_code"`
+		ErrorClass          string                   `json:"error_class"`
+		UpstreamID          *uint                    `json:"upstream_id"`
+		RequestPath         string                   `json:"request_path"`
+		Stream              bool                     `json:"stream"`
+		TimeToFirstTokenMs  int                      `json:"time_to_first_token_ms"`
+		UsageSource         string                   `json:"usage_source"`
+		Attempts            []models.UpstreamAttempt `json:"attempts,omitempty"` // Set when an upstream attempt failed
+		CreatedAt           string                   `json:"created_at"`
 	}
 
 	response := make([]AdminUsageLog, 0, len(logs))
@@ -269,21 +325,28 @@ func AdminGetUsageLogs(c *gin.Context) {
 			linuxdoID = log.User.OAuthID
 		}
 		response = append(response, AdminUsageLog{
-			RequestID:    log.RequestID.String(),
-			UserID:       log.UserID.String(),
-			Username:     log.User.Username,
-			LinuxDoID:    linuxdoID,
-			APIKeyID:     log.APIKeyID,
-			Model:        log.Model,
-			InputTokens:  log.InputTokens,
-			OutputTokens: log.OutputTokens,
-			CachedTokens: log.CachedTokens,
+			RequestID:           log.RequestID.String(),
+			UserID:              log.UserID.String(),
+			Username:            log.User.Username,
+			LinuxDoID:           linuxdoID,
+			APIKeyID:            log.APIKeyID,
+			Model:               log.Model,
+			InputTokens:         log.InputTokens,
+			OutputTokens:        log.OutputTokens,
+			CachedTokens:        log.CachedTokens,
 			CacheCreationTokens: log.CacheCreationTokens,
-			TotalTokens:  log.TotalTokens,
-			Cost:         log.Cost,
-			LatencyMs:    log.LatencyMs,
-			StatusCode:   log.StatusCode,
-			CreatedAt:    log.CreatedAt.Format(time.RFC3339),
+			TotalTokens:         log.TotalTokens,
+			Cost:                log.Cost,
+			LatencyMs:           log.LatencyMs,
+			StatusCode:          log.StatusCode,
+			ErrorClass:          log.ErrorClass,
+			UpstreamID:          log.UpstreamID,
+			RequestPath:         log.RequestPath,
+			Stream:              log.Stream,
+			TimeToFirstTokenMs:  log.TimeToFirstTokenMs,
+			UsageSource:         log.UsageSource,
+			Attempts:            log.Attempts,
+			CreatedAt:           log.CreatedAt.Format(time.RFC3339),
 		})
 	}
 
@@ -298,6 +361,49 @@ func AdminGetUsageLogs(c *gin.Context) {
 	})
 }
 
+// usageScope limits usage queries to the caller's own logs, or with
+// ?organization_id= to the organization's logs: managers see every member
+// (optionally narrowed by ?user_id=), members only their own requests.
+func usageScope(c *gin.Context, user models.User) (func(*gorm.DB) *gorm.DB, bool) {
+	orgIDStr := strings.TrimSpace(c.Query("organization_id"))
+	if orgIDStr == "" {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("usage_logs.user_id = ?", user.ID)
+		}, true
+	}
+
+	orgID, err := uuid.Parse(orgIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization_id"})
+		return nil, false
+	}
+	member, err := organization.Membership(orgID, user.ID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	var userID *uuid.UUID
+	if !organization.CanManage(member.Role) {
+		userID = &user.ID
+	} else if userIDStr := strings.TrimSpace(c.Query("user_id")); userIDStr != "" {
+		parsed, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return nil, false
+		}
+		userID = &parsed
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("usage_logs.organization_id = ?", orgID)
+		if userID != nil {
+			db = db.Where("usage_logs.user_id = ?", *userID)
+		}
+		return db
+	}, true
+}
+
 func parseDateRange(c *gin.Context) (*time.Time, *time.Time, error) {
 	startStr := strings.TrimSpace(c.Query("start_date"))
 	endStr := strings.TrimSpace(c.Query("end_date"))
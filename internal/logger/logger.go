@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Setup installs the process-wide structured logger. format is "json" or
+// "text"; level is debug, info, warn or error. Output from the standard log
+// package is routed through the same handler, so existing "[Component] ..."
+// lines become structured records with a component attribute.
+func Setup(level, format string) {
+	SetupWriter(os.Stdout, level, format)
+}
+
+// SetupWriter is Setup with an explicit destination
+func SetupWriter(w io.Writer, level, format string) {
+	opts := &slog.HandlerOptions{
+		Level:       parseLevel(level),
+		ReplaceAttr: redactAttr,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	// slog.SetDefault points the log package at the handler; replace that with
+	// a bridge that extracts the component and level from legacy lines
+	log.SetFlags(0)
+	log.SetOutput(&bridge{handler: handler})
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+var (
+	componentPattern = regexp.MustCompile(`^\[([A-Za-z]+)\]\s*`)
+	warnPattern      = regexp.MustCompile(`(?i)\b(fail\w*|error\w*|warning|unhealthy)\b|⚠️|❌`)
+)
+
+// bridge converts standard log output into slog records
+type bridge struct {
+	handler slog.Handler
+}
+
+func (b *bridge) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+
+	component := ""
+	if m := componentPattern.FindStringSubmatch(msg); m != nil {
+		component = m[1]
+		msg = msg[len(m[0]):]
+	}
+
+	level := slog.LevelInfo
+	if warnPattern.MatchString(msg) {
+		level = slog.LevelWarn
+	}
+
+	ctx := context.Background()
+	if !b.handler.Enabled(ctx, level) {
+		return len(p), nil
+	}
+
+	record := slog.NewRecord(time.Now(), level, msg, 0)
+	if component != "" {
+		record.AddAttrs(slog.String("component", component))
+	}
+	return len(p), b.handler.Handle(ctx, record)
+}
+
+// Component returns a logger tagged with a component name
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
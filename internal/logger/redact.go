@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in log output
+const Redacted = "[REDACTED]"
+
+// minSecretLength avoids redacting short, common strings registered by mistake
+const minSecretLength = 8
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = make(map[string]struct{})
+	replacer  = strings.NewReplacer()
+
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=\-]+`)
+	keyPattern    = regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{8,}`)
+)
+
+// sensitiveKeys are attribute keys whose values are always redacted
+var sensitiveKeys = []string{"api_key", "apikey", "credit_key", "authorization", "password", "secret", "token"}
+
+// RegisterSecret makes every later occurrence of value in log output redacted.
+// Upstream API keys and payment keys register themselves when loaded.
+func RegisterSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if _, ok := secrets[value]; ok {
+		return
+	}
+	secrets[value] = struct{}{}
+
+	pairs := make([]string, 0, len(secrets)*2)
+	for s := range secrets {
+		pairs = append(pairs, s, Redacted)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact removes registered secrets, bearer tokens and API-key-shaped strings from s
+func Redact(s string) string {
+	secretsMu.RLock()
+	r := replacer
+	secretsMu.RUnlock()
+
+	s = r.Replace(s)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Redacted)
+	return keyPattern.ReplaceAllString(s, "sk-"+Redacted)
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, Redact(a.Value.String()))
+	}
+	if a.Value.Kind() == slog.KindAny {
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if k == s || strings.HasSuffix(k, "_"+s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"codex-gateway/internal/pricing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+	ttfbBuckets    = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30}
+)
+
+var factory = promauto.With(Default)
+
+var (
+	RequestsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_requests_total",
+		Help: "Proxy requests by outcome.",
+	}, []string{"model", "upstream", "path", "status", "error_class"})
+	RequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_request_duration_seconds",
+		Help:    "Proxy request latency, including streaming time.",
+		Buckets: latencyBuckets,
+	}, []string{"model", "upstream", "path", "status"})
+	TimeToFirstByte = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_time_to_first_byte_seconds",
+		Help:    "Time until the first streamed byte reached the client.",
+		Buckets: ttfbBuckets,
+	}, []string{"model", "upstream", "path"})
+	InflightStreams = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_inflight_streams",
+		Help: "Streams currently being relayed to clients.",
+	}, []string{"model", "upstream"})
+	TokensTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_tokens_total",
+		Help: "Billed tokens by type (input, output, cache_read, cache_creation).",
+	}, []string{"model", "upstream", "type", "source"})
+	CostTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_cost_usd_total",
+		Help: "Billed cost in USD.",
+	}, []string{"model", "upstream"})
+	RateLimitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_rate_limit_rejections_total",
+		Help: "Requests rejected by the API key rate limiter.",
+	}, []string{"path"})
+	BillingFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_billing_failures_total",
+		Help: "Served requests that could not be priced or billed.",
+	}, []string{"model", "upstream", "reason"})
+)
+
+// StreamStarted marks a stream as in flight; call the returned func when it ends
+func StreamStarted(model string, upstreamID uint) func() {
+	gauge := InflightStreams.WithLabelValues(ModelLabel(model), UpstreamLabel(&upstreamID))
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// ModelLabel keeps model labels bounded: models without a price version,
+// which clients can name freely, are reported as "other"
+func ModelLabel(model string) string {
+	if model == "" {
+		return "none"
+	}
+	if !pricing.Known(model) {
+		return "other"
+	}
+	return model
+}
+
+// UpstreamLabel renders an upstream ID as a label value ("none" when unset)
+func UpstreamLabel(upstreamID *uint) string {
+	if upstreamID == nil || *upstreamID == 0 {
+		return "none"
+	}
+	return strconv.FormatUint(uint64(*upstreamID), 10)
+}
+
+// PathLabel collapses path parameters so labels stay bounded
+func PathLabel(path string) string {
+	if strings.HasPrefix(path, "/v1/engines/") {
+		return "/v1/engines/:engine/completions"
+	}
+	return path
+}
+
+// SecondsSince returns the age of t in seconds, or -1 when t is zero
+func SecondsSince(t time.Time) float64 {
+	if t.IsZero() {
+		return -1
+	}
+	return time.Since(t).Seconds()
+}
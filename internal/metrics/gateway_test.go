@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+)
+
+func TestModelLabel(t *testing.T) {
+	databasetest.Use(t, &models.ModelPricing{}, &models.PricingRule{})
+	if err := database.DB.Create(&models.ModelPricing{ModelName: "gpt-5.1", EffectiveFrom: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := pricing.LoadPrices(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-5.1", "gpt-5.1"},
+		{"gpt-5.1-made-up-by-a-client", "other"},
+		{"", "none"},
+	}
+	for _, tt := range tests {
+		if got := ModelLabel(tt.model); got != tt.want {
+			t.Errorf("ModelLabel(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Default is the registry served on /metrics. It also reports Go runtime and
+// process metrics.
+var Default = prometheus.NewRegistry()
+
+func init() {
+	Default.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the Default registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{})
+}
+
+// GaugeSample is one labelled value reported by a gauge func
+type GaugeSample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// gaugeFunc is a gauge family whose samples are computed at scrape time
+type gaugeFunc struct {
+	desc    *prometheus.Desc
+	collect func() []GaugeSample
+}
+
+// NewGaugeFunc registers a gauge family computed by collect on every scrape
+func NewGaugeFunc(name, help string, collect func() []GaugeSample, labels ...string) {
+	Default.MustRegister(&gaugeFunc{
+		desc:    prometheus.NewDesc(name, help, labels, nil),
+		collect: collect,
+	})
+}
+
+func (g *gaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *gaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range g.collect() {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, s.Value, s.LabelValues...)
+	}
+}
@@ -3,93 +3,139 @@ package middleware
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
+	"unicode/utf8"
 
+	"codex-gateway/internal/billing"
 	"codex-gateway/internal/database"
 	"codex-gateway/internal/models"
-	"codex-gateway/internal/ratelimit"
+	"codex-gateway/internal/organization"
+	"codex-gateway/internal/statestore"
+	"codex-gateway/internal/usagelog"
 
 	"github.com/gin-gonic/gin"
 )
 
-var (
-	lastUsedUpdate         sync.Map
-	lastUsedUpdateInterval = 5 * time.Minute
+var lastUsedUpdateInterval = 5 * time.Minute
+
+// Which secret of a rotated key authenticated a request
+const (
+	KeySecretCurrent  = "current"
+	KeySecretPrevious = "previous"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+		// Anthropic clients send the key in x-api-key instead of a bearer token
+		apiKey := c.GetHeader("x-api-key")
+		if apiKey == "" {
+			authHeader := c.GetHeader("Authorization")
+			if authHeader == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+				c.Abort()
+				return
+			}
+
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization format"})
+				c.Abort()
+				return
+			}
+			apiKey = parts[1]
+		}
+		keyHash := HashAPIKey(apiKey)
+
+		// A rotated key also accepts its previous secret until the grace period ends
+		var dbKey models.APIKey
+		if err := database.DB.Preload("User").
+			Where("status = ? AND (key_hash = ? OR (previous_key_hash = ? AND previous_key_expires_at > ?))", "active", keyHash, keyHash, time.Now()).
+			First(&dbKey).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or inactive API key"})
 			c.Abort()
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization format"})
+		if dbKey.User.Status != "active" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "user account is not active"})
 			c.Abort()
 			return
 		}
 
-		apiKey := parts[1]
-		keyHash := HashAPIKey(apiKey)
+		if KeyExpired(&dbKey, time.Now()) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "api key has expired"})
+			recordRejection(c, dbKey, http.StatusUnauthorized, usagelog.ErrorKeyExpired)
+			c.Abort()
+			return
+		}
 
-		var dbKey models.APIKey
-		if err := database.DB.Preload("User").Where("key_hash = ? AND status = ?", keyHash, "active").First(&dbKey).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or inactive API key"})
+		if !KeyAllowsIP(&dbKey, c.ClientIP()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "api key is not allowed from this IP address"})
+			recordRejection(c, dbKey, http.StatusForbidden, usagelog.ErrorKeyScope)
 			c.Abort()
 			return
 		}
 
-		if dbKey.User.Status != "active" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "user account is not active"})
+		if !KeyAllowsEndpoint(&dbKey, c.Request.URL.Path) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "api key is not allowed to call this endpoint"})
+			recordRejection(c, dbKey, http.StatusForbidden, usagelog.ErrorKeyScope)
 			c.Abort()
 			return
 		}
 
-		if dbKey.QuotaLimit != nil && float64(dbKey.TotalUsage) >= *dbKey.QuotaLimit {
+		if billing.GetKeyBudget(&dbKey, time.Now()).Exhausted() {
 			c.JSON(http.StatusPaymentRequired, gin.H{"error": "api key quota exceeded"})
+			recordRejection(c, dbKey, http.StatusPaymentRequired, usagelog.ErrorQuotaExceeded)
 			c.Abort()
 			return
 		}
 
-		if dbKey.User.Balance <= 0 {
-			// Check for active package
-			today := database.GetToday()
-			var activePackage models.UserPackage
-			hasActivePackage := database.DB.Where("user_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
-				dbKey.User.ID, "active", today, today).
-				First(&activePackage).Error == nil
-
-			if !hasActivePackage {
-				c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient balance or active package"})
+		// Organization keys stop working when their member leaves the organization
+		if dbKey.OrganizationID != nil {
+			if _, err := organization.Membership(*dbKey.OrganizationID, dbKey.UserID); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": "api key owner is no longer an active organization member"})
+				recordRejection(c, dbKey, http.StatusForbidden, usagelog.ErrorKeyScope)
 				c.Abort()
 				return
 			}
 		}
 
-		if !ratelimit.Allow(strconv.FormatUint(uint64(dbKey.ID), 10)) {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		if !billing.HasFunds(dbKey.User, dbKey.OrganizationID) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient balance or active package"})
+			recordRejection(c, dbKey, http.StatusPaymentRequired, usagelog.ErrorInsufficientBalance)
 			c.Abort()
 			return
 		}
 
-		// Update last_used_at asynchronously with throttling
+		secret := KeySecretCurrent
+		if dbKey.KeyHash != keyHash {
+			secret = KeySecretPrevious
+		}
+
+		// Update last-used telemetry asynchronously with throttling
 		// Use conditional update to prevent stampede writes
 		now := time.Now()
-		if shouldUpdateLastUsed(dbKey.ID, now) {
-			go func(keyID uint, ts time.Time) {
-				// Conditional update: only update if last_used_at is NULL or older than interval
+		if shouldUpdateLastUsed(dbKey.ID, secret, now) {
+			if secret == KeySecretPrevious {
+				log.Printf("[Auth] API key %d used with its previous secret from %s", dbKey.ID, c.ClientIP())
+			}
+			go func(keyID uint, ts time.Time, updates map[string]interface{}) {
+				// Conditional update: only update if last_used_at is NULL or older than
+				// interval, or a different secret is now in use
 				database.DB.Model(&models.APIKey{}).
-					Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", keyID, ts.Add(-lastUsedUpdateInterval)).
-					Update("last_used_at", ts)
-			}(dbKey.ID, now)
+					Where("id = ? AND (last_used_at IS NULL OR last_used_at < ? OR last_used_secret IS DISTINCT FROM ?)",
+						keyID, ts.Add(-lastUsedUpdateInterval), updates["last_used_secret"]).
+					Updates(updates)
+			}(dbKey.ID, now, map[string]interface{}{
+				"last_used_at":         now,
+				"last_used_secret":     secret,
+				"last_used_ip":         c.ClientIP(),
+				"last_used_user_agent": truncate(c.Request.UserAgent(), 255),
+			})
 		}
 
 		c.Set("user", dbKey.User)
@@ -104,14 +150,36 @@ func HashAPIKey(key string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func shouldUpdateLastUsed(keyID uint, now time.Time) bool {
-	if value, ok := lastUsedUpdate.Load(keyID); ok {
-		if last, ok := value.(int64); ok {
-			if now.Sub(time.Unix(0, last)) < lastUsedUpdateInterval {
-				return false
-			}
-		}
+// recordRejection logs a data-plane request rejected before reaching the proxy
+func recordRejection(c *gin.Context, key models.APIKey, statusCode int, errorClass string) {
+	usagelog.RecordAsync(models.UsageLog{
+		RequestID:      GetRequestID(c),
+		UserID:         key.UserID,
+		APIKeyID:       key.ID,
+		StatusCode:     statusCode,
+		ErrorClass:     errorClass,
+		RequestPath:    c.Request.URL.Path,
+		OrganizationID: key.OrganizationID,
+	})
+}
+
+// shouldUpdateLastUsed throttles last-used writes to one per interval per key
+// and secret across all replicas. Store errors fall back to writing.
+func shouldUpdateLastUsed(keyID uint, secret string, now time.Time) bool {
+	ctx, cancel := statestore.Context()
+	defer cancel()
+	key := "lastused:" + strconv.FormatUint(uint64(keyID), 10) + ":" + secret
+	acquired, err := statestore.Get().SetNX(ctx, key, strconv.FormatInt(now.Unix(), 10), lastUsedUpdateInterval)
+	return acquired || err != nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
 	}
-	lastUsedUpdate.Store(keyID, now.UnixNano())
-	return true
+	return s[:n]
 }
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustProxies sets the peers whose X-Forwarded-For and X-Real-IP headers are
+// believed, from a comma-separated list of IPs or CIDRs. With an empty list no
+// peer is trusted and the client IP is always the connecting address, so API
+// key IP allowlists cannot be bypassed with a forged header.
+func TrustProxies(router *gin.Engine, list string) error {
+	var proxies []string
+	for _, proxy := range strings.Split(list, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return router.SetTrustedProxies(proxies)
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"codex-gateway/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTrustProxiesKeyIPAllowlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key := models.APIKey{AllowedIPs: []string{"10.0.0.0/8"}}
+
+	tests := []struct {
+		name       string
+		trusted    string
+		remoteAddr string
+		forwarded  string
+		wantIP     string
+		wantStatus int
+	}{
+		{"allowed peer", "", "10.1.2.3:5000", "", "10.1.2.3", http.StatusOK},
+		{"spoofed header from an untrusted peer", "", "203.0.113.7:5000", "10.1.2.3", "203.0.113.7", http.StatusForbidden},
+		{"spoofed header from a peer not in the list", "192.0.2.1", "203.0.113.7:5000", "10.1.2.3", "203.0.113.7", http.StatusForbidden},
+		{"forwarded by a trusted proxy", "192.0.2.0/24, 127.0.0.1", "192.0.2.10:5000", "10.1.2.3", "10.1.2.3", http.StatusOK},
+		{"trusted proxy forwarding a disallowed client", "192.0.2.0/24", "192.0.2.10:5000", "203.0.113.7", "203.0.113.7", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := TrustProxies(router, tt.trusted); err != nil {
+				t.Fatal(err)
+			}
+			var clientIP string
+			// The same check AuthMiddleware makes
+			router.GET("/v1/models", func(c *gin.Context) {
+				clientIP = c.ClientIP()
+				if !KeyAllowsIP(&key, clientIP) {
+					c.Status(http.StatusForbidden)
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+				req.Header.Set("X-Real-IP", tt.forwarded)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if clientIP != tt.wantIP || w.Code != tt.wantStatus {
+				t.Errorf("client IP %s, status %d; want %s, %d", clientIP, w.Code, tt.wantIP, tt.wantStatus)
+			}
+		})
+	}
+
+	if err := TrustProxies(gin.New(), "not-an-ip"); err == nil {
+		t.Error("TrustProxies accepted an invalid proxy")
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"codex-gateway/internal/models"
+)
+
+// KeyExpired reports whether the key has passed its expiry time
+func KeyExpired(key *models.APIKey, now time.Time) bool {
+	return key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)
+}
+
+// KeyAllowsModel reports whether the key may use the model
+func KeyAllowsModel(key *models.APIKey, model string) bool {
+	if len(key.AllowedModels) == 0 {
+		return true
+	}
+	model = strings.ToLower(model)
+	for _, pattern := range key.AllowedModels {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == model {
+			return true
+		}
+		if ok, err := path.Match(pattern, model); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyAllowsEndpoint reports whether the key may call the data-plane path.
+// Allowed endpoints are written relative to /v1 and may use glob patterns.
+func KeyAllowsEndpoint(key *models.APIKey, requestPath string) bool {
+	if len(key.AllowedEndpoints) == 0 {
+		return true
+	}
+	endpoint := normalizeEndpoint(requestPath)
+	for _, pattern := range key.AllowedEndpoints {
+		pattern = normalizeEndpoint(pattern)
+		if pattern == endpoint {
+			return true
+		}
+		if ok, err := path.Match(pattern, endpoint); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyAllowsIP reports whether the key may be used from the client IP
+func KeyAllowsIP(key *models.APIKey, clientIP string) bool {
+	if len(key.AllowedIPs) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range key.AllowedIPs {
+		if network, err := parseIPRange(entry); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateKeyScopes checks restriction values before they are saved
+func ValidateKeyScopes(key *models.APIKey) error {
+	for _, pattern := range key.AllowedModels {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("invalid model pattern %q", pattern)
+		}
+	}
+	for _, pattern := range key.AllowedEndpoints {
+		if _, err := path.Match(normalizeEndpoint(pattern), ""); err != nil || normalizeEndpoint(pattern) == "/" {
+			return fmt.Errorf("invalid endpoint %q", pattern)
+		}
+	}
+	for _, entry := range key.AllowedIPs {
+		if _, err := parseIPRange(entry); err != nil {
+			return fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+	}
+	if key.RateLimitRPM < 0 {
+		return fmt.Errorf("rate_limit_rpm must not be negative")
+	}
+	return nil
+}
+
+// normalizeEndpoint maps "/v1/responses", "v1/responses" and "responses"
+// to "/responses"
+func normalizeEndpoint(p string) string {
+	p = strings.TrimSpace(p)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if p == "/v1" || strings.HasPrefix(p, "/v1/") {
+		p = strings.TrimPrefix(p, "/v1")
+	}
+	if p == "" {
+		p = "/"
+	}
+	return path.Clean(p)
+}
+
+// parseIPRange parses a CIDR range or a single IP address
+func parseIPRange(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		return network, err
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %q", entry)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"codex-gateway/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID to clients and upstreams
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID assigns every data-plane request a fresh ID. It is returned in
+// the X-Request-ID header, forwarded upstream and stored as UsageLog.RequestID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := uuid.New()
+
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID.String())
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), requestID.String()))
+
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID assigned by RequestID, or uuid.Nil
+func GetRequestID(c *gin.Context) uuid.UUID {
+	if value, ok := c.Get("request_id"); ok {
+		if requestID, ok := value.(uuid.UUID); ok {
+			return requestID
+		}
+	}
+	return uuid.Nil
+}
@@ -0,0 +1,251 @@
+package modelalias
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+	"codex-gateway/internal/pricing"
+)
+
+// Rule match types
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchRegex  = "regex"
+)
+
+// Actions for models that match no rule and have no pricing
+const (
+	UnknownReject = "reject"
+	UnknownMap    = "map"
+)
+
+// ErrUnknownModel is returned when a model matches no rule, has no pricing and
+// unknown models are rejected
+var ErrUnknownModel = errors.New("unknown model")
+
+// refreshInterval bounds how stale rules can be on other replicas
+const refreshInterval = 30 * time.Second
+
+// Resolution is the model a request is served and billed as
+type Resolution struct {
+	Model           string
+	ReasoningEffort string
+	RuleID          uint // 0 when no rule matched
+}
+
+type compiledRule struct {
+	models.ModelAliasRule
+	pattern  string
+	re       *regexp.Regexp
+	rewrites bool // Regex rule whose target refers to capture groups
+}
+
+type state struct {
+	rules         []compiledRule
+	priced        map[string]string // Lowercase name to priced model name
+	unknownAction string
+	unknownTarget string
+	loadedAt      time.Time
+}
+
+var (
+	stateValue atomic.Value
+	reloading  sync.Mutex
+)
+
+func init() {
+	stateValue.Store(state{unknownAction: UnknownReject})
+}
+
+func load() state {
+	return stateValue.Load().(state)
+}
+
+// LoadFromDB loads the enabled rules, the priced model names and the unknown
+// model setting
+func LoadFromDB() {
+	current := load()
+	next := state{
+		rules:         current.rules,
+		priced:        current.priced,
+		unknownAction: current.unknownAction,
+		unknownTarget: current.unknownTarget,
+		loadedAt:      time.Now(),
+	}
+
+	var rules []models.ModelAliasRule
+	if err := database.DB.Where("enabled = ?", true).Order("priority ASC, id ASC").Find(&rules).Error; err != nil {
+		log.Printf("[ModelAlias] Failed to load rules: %v", err)
+	} else {
+		next.rules = compile(rules)
+	}
+
+	priced := pricing.CurrentPrices()
+	next.priced = make(map[string]string, len(priced))
+	for _, version := range priced {
+		next.priced[strings.ToLower(version.ModelName)] = version.ModelName
+	}
+
+	var settings models.SystemSettings
+	if err := database.DB.First(&settings).Error; err == nil {
+		next.unknownAction = settings.UnknownModelAction
+		next.unknownTarget = settings.UnknownModelTarget
+	}
+
+	stateValue.Store(next)
+}
+
+// compile prepares rules for matching, skipping invalid regexes
+func compile(rules []models.ModelAliasRule) []compiledRule {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRule{ModelAliasRule: rule, pattern: strings.ToLower(strings.TrimSpace(rule.Pattern))}
+		if rule.MatchType == MatchRegex {
+			re, err := regexp.Compile("(?i)" + rule.Pattern)
+			if err != nil {
+				log.Printf("[ModelAlias] Skipping rule %d with invalid regex: %v", rule.ID, err)
+				continue
+			}
+			c.re = re
+			c.rewrites = strings.Contains(rule.Target, "$")
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// maybeRefresh reloads rules in the background once they are stale, so
+// changes made through another replica take effect here too
+func maybeRefresh() {
+	if time.Since(load().loadedAt) < refreshInterval {
+		return
+	}
+	if !reloading.TryLock() {
+		return
+	}
+	go func() {
+		defer reloading.Unlock()
+		LoadFromDB()
+	}()
+}
+
+// Resolve returns the model a requested model is served and billed as. The
+// first matching rule wins. A regex rule whose target refers to capture groups,
+// such as ^[^/]+/(.+)$ -> $1, rewrites the name instead, and the rules after it
+// resolve the rewritten name further. A model no alias maps is used as-is when
+// it is priced, and otherwise rejected or mapped according to the settings.
+// Names are compared case-insensitively.
+func Resolve(model string) (Resolution, error) {
+	maybeRefresh()
+	s := load()
+
+	resolved := Resolution{Model: strings.ToLower(strings.TrimSpace(model))}
+	for _, rule := range s.rules {
+		target, ok := rule.apply(resolved.Model)
+		if !ok {
+			continue
+		}
+		resolved.Model = target
+		resolved.RuleID = rule.ID
+		if rule.ReasoningEffort != "" {
+			resolved.ReasoningEffort = rule.ReasoningEffort
+		}
+		if !rule.rewrites {
+			return resolved, nil
+		}
+	}
+
+	if name, ok := s.priced[resolved.Model]; ok {
+		resolved.Model = name
+		return resolved, nil
+	}
+	if s.unknownAction == UnknownMap && s.unknownTarget != "" {
+		return Resolution{Model: s.unknownTarget}, nil
+	}
+	return Resolution{}, ErrUnknownModel
+}
+
+// ExactAliases returns the enabled exact-match rules keyed by lowercase pattern
+func ExactAliases() map[string]models.ModelAliasRule {
+	maybeRefresh()
+	aliases := make(map[string]models.ModelAliasRule)
+	for _, rule := range load().rules {
+		if rule.MatchType != MatchExact {
+			continue
+		}
+		if _, ok := aliases[rule.pattern]; !ok {
+			aliases[rule.pattern] = rule.ModelAliasRule
+		}
+	}
+	return aliases
+}
+
+// apply returns the name a lowercase model resolves to under the rule
+func (r compiledRule) apply(model string) (string, bool) {
+	if !r.matches(model) {
+		return "", false
+	}
+	if !r.rewrites {
+		return r.Target, true
+	}
+	match := r.re.FindStringSubmatchIndex(model)
+	target := strings.ToLower(strings.TrimSpace(string(r.re.ExpandString(nil, r.Target, model, match))))
+	return target, target != ""
+}
+
+func (r compiledRule) matches(model string) bool {
+	switch r.MatchType {
+	case MatchExact:
+		return model == r.pattern
+	case MatchPrefix:
+		return strings.HasPrefix(model, r.pattern)
+	case MatchRegex:
+		return r.re != nil && r.re.MatchString(model)
+	}
+	return false
+}
+
+// Validate normalizes and checks a rule before it is saved
+func Validate(rule *models.ModelAliasRule) error {
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.Target = strings.TrimSpace(rule.Target)
+	if rule.MatchType == "" {
+		rule.MatchType = MatchExact
+	}
+
+	switch rule.MatchType {
+	case MatchExact, MatchPrefix:
+	case MatchRegex:
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid regex: %v", err)
+		}
+	default:
+		return fmt.Errorf("match_type must be exact, prefix or regex")
+	}
+	if rule.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if rule.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	switch rule.ReasoningEffort {
+	case "", "minimal", "low", "medium", "high":
+	default:
+		return fmt.Errorf("reasoning_effort must be minimal, low, medium or high")
+	}
+	return nil
+}
+
+// ValidUnknownAction reports whether action is a known unknown-model action
+func ValidUnknownAction(action string) bool {
+	return action == UnknownReject || action == UnknownMap
+}
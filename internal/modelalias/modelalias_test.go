@@ -0,0 +1,118 @@
+package modelalias
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+)
+
+// useRules installs the seeded rules plus extra ones, with the given priced
+// models, without loading anything else from the database
+func useRules(t *testing.T, priced []string, unknownAction, unknownTarget string, extra ...models.ModelAliasRule) {
+	t.Helper()
+	databasetest.Use(t, &models.ModelAliasRule{})
+	if err := database.SeedModelAliasRules(); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range extra {
+		if err := database.DB.Create(&rule).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rules []models.ModelAliasRule
+	if err := database.DB.Where("enabled = ?", true).Order("priority ASC, id ASC").Find(&rules).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := state{
+		rules:         compile(rules),
+		priced:        make(map[string]string),
+		unknownAction: unknownAction,
+		unknownTarget: unknownTarget,
+		loadedAt:      time.Now(),
+	}
+	for _, name := range priced {
+		s.priced[strings.ToLower(name)] = name
+	}
+	previous := load()
+	stateValue.Store(s)
+	t.Cleanup(func() { stateValue.Store(previous) })
+}
+
+func TestResolve(t *testing.T) {
+	useRules(t, []string{"gpt-5.1-codex", "gpt-5.1", "Custom-Model"}, UnknownReject, "",
+		models.ModelAliasRule{MatchType: MatchPrefix, Pattern: "legacy-", Target: "gpt-5.1", Priority: 50, Enabled: true},
+		models.ModelAliasRule{MatchType: MatchExact, Pattern: "disabled", Target: "gpt-5.1", Priority: 50, Enabled: false},
+	)
+
+	tests := []struct {
+		model      string
+		want       string
+		wantEffort string
+		wantErr    error
+	}{
+		{model: "gpt-5.1-codex", want: "gpt-5.1-codex"},
+		{model: "GPT-5.1-Codex", want: "gpt-5.1-codex"},
+		{model: " custom-model ", want: "Custom-Model"},
+		{model: "gpt-5.1-codex-high", want: "gpt-5.1-codex", wantEffort: "high"},
+		{model: "GPT-5.1-CODEX-LOW", want: "gpt-5.1-codex", wantEffort: "low"},
+		{model: "openai/gpt-5.1-codex", want: "gpt-5.1-codex"},
+		{model: "OpenAI/GPT-5.1-Codex", want: "gpt-5.1-codex"},
+		{model: "azure/gpt-5.1-codex-medium", want: "gpt-5.1-codex", wantEffort: "medium"},
+		{model: "openai/gpt-5-codex", want: "gpt-5.1-codex"},
+		{model: "openrouter/custom-model", want: "Custom-Model"},
+		{model: "legacy-anything", want: "gpt-5.1"},
+		{model: "disabled", wantErr: ErrUnknownModel},
+		{model: "openai/unknown-model", wantErr: ErrUnknownModel},
+		{model: "unknown-model", wantErr: ErrUnknownModel},
+		{model: "openai/", wantErr: ErrUnknownModel},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.model)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Resolve(%q) error = %v, want %v", tt.model, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got.Model != tt.want || got.ReasoningEffort != tt.wantEffort) {
+			t.Errorf("Resolve(%q) = %s (effort %q), want %s (effort %q)", tt.model, got.Model, got.ReasoningEffort, tt.want, tt.wantEffort)
+		}
+	}
+}
+
+func TestResolveMapsUnknownModels(t *testing.T) {
+	useRules(t, []string{"gpt-5.1"}, UnknownMap, "gpt-5.1")
+
+	for _, model := range []string{"unknown-model", "openai/unknown-model"} {
+		got, err := Resolve(model)
+		if err != nil || got.Model != "gpt-5.1" {
+			t.Errorf("Resolve(%q) = %+v, %v; want the unknown model target", model, got, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.ModelAliasRule
+		wantErr bool
+	}{
+		{"exact by default", models.ModelAliasRule{Pattern: " gpt-5 ", Target: "gpt-5.1"}, false},
+		{"regex rewrite", models.ModelAliasRule{MatchType: MatchRegex, Pattern: "^[^/]+/(.+)$", Target: "$1"}, false},
+		{"invalid regex", models.ModelAliasRule{MatchType: MatchRegex, Pattern: "(", Target: "gpt-5.1"}, true},
+		{"unknown match type", models.ModelAliasRule{MatchType: "glob", Pattern: "gpt-*", Target: "gpt-5.1"}, true},
+		{"missing pattern", models.ModelAliasRule{Pattern: " ", Target: "gpt-5.1"}, true},
+		{"missing target", models.ModelAliasRule{Pattern: "gpt-5"}, true},
+		{"invalid effort", models.ModelAliasRule{Pattern: "gpt-5", Target: "gpt-5.1", ReasoningEffort: "max"}, true},
+	}
+	for _, tt := range tests {
+		rule := tt.rule
+		if err := Validate(&rule); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"codex-gateway/internal/logger"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -33,54 +35,184 @@ type APIKey struct {
 	KeyHash    string         `gorm:"type:varchar(64);not null;uniqueIndex:idx_key_hash" json:"-"`
 	KeyPrefix  string         `gorm:"type:varchar(16);not null" json:"key_prefix"`
 	Name       string         `gorm:"type:varchar(100)" json:"name"`
-	QuotaLimit *float64       `gorm:"type:decimal(18,6)" json:"quota_limit"`
-	TotalUsage int64          `gorm:"default:0" json:"total_usage"`
+	QuotaLimit *float64       `gorm:"type:decimal(18,6)" json:"quota_limit"` // Budget in QuotaType units per QuotaPeriod; nil = unlimited
+	TotalUsage int64          `gorm:"default:0" json:"total_usage"`          // Lifetime tokens
 	Status     string         `gorm:"type:varchar(20);default:'active'" json:"status"`
 	CreatedAt  time.Time      `json:"created_at"`
 	LastUsedAt *time.Time     `json:"last_used_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Optional restrictions (empty = unrestricted)
+	AllowedModels    []string   `gorm:"type:text;serializer:json" json:"allowed_models"`    // Model names or glob patterns
+	AllowedEndpoints []string   `gorm:"type:text;serializer:json" json:"allowed_endpoints"` // Paths under /v1, e.g. "/responses"
+	AllowedIPs       []string   `gorm:"type:text;serializer:json" json:"allowed_ips"`       // Source IPs or CIDR ranges
+	ExpiresAt        *time.Time `json:"expires_at"`
+	RateLimitRPM     int        `gorm:"default:0" json:"rate_limit_rpm"` // Per-key requests per minute, 0 = policy default
+
+	// Budget accounting for QuotaLimit
+	QuotaType        string     `gorm:"type:varchar(10);default:'cost'" json:"quota_type"`       // cost or tokens
+	QuotaPeriod      string     `gorm:"type:varchar(10);default:'lifetime'" json:"quota_period"` // lifetime, daily, weekly, monthly
+	QuotaUsed        float64    `gorm:"type:decimal(18,6);default:0" json:"quota_used"`          // Spent in the current period
+	QuotaPeriodStart *time.Time `json:"quota_period_start"`                                      // Start of the period QuotaUsed counts
+
+	// Rotation: the previous secret keeps working until PreviousKeyExpiresAt
+	PreviousKeyHash      string     `gorm:"type:varchar(64);index:idx_previous_key_hash" json:"-"`
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at"`
+	RotatedAt            *time.Time `json:"rotated_at"`
+
+	// Last-used telemetry, written at most once per throttle interval
+	LastUsedSecret    string `gorm:"type:varchar(10)" json:"last_used_secret"` // current or previous
+	LastUsedIP        string `gorm:"type:varchar(45)" json:"last_used_ip"`
+	LastUsedUserAgent string `gorm:"type:varchar(255)" json:"last_used_user_agent"`
+
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id"` // Set for keys owned by an organization; UserID is the member using it
 }
 
+// ModelPricing is one price version of a model, charged for requests made
+// from EffectiveFrom until EffectiveTo
 type ModelPricing struct {
-	ID                      uint      `gorm:"primaryKey" json:"id"`
-	ModelName               string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"model_name"`
-	InputPricePer1k         float64   `gorm:"type:decimal(10,6);not null" json:"input_price_per_1k"`
-	OutputPricePer1k        float64   `gorm:"type:decimal(10,6);not null" json:"output_price_per_1k"`
-	CacheReadPricePer1k     float64   `gorm:"type:decimal(10,6);default:0" json:"cache_read_price_per_1k"`     // Cache read tokens pricing (usually 10% of input price)
-	CacheCreationPricePer1k float64   `gorm:"type:decimal(10,6);default:0" json:"cache_creation_price_per_1k"` // Cache creation tokens pricing
-	MarkupMultiplier        float64   `gorm:"type:decimal(4,2);default:1.5" json:"markup_multiplier"`
-	EffectiveFrom           time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"effective_from"`
+	ID                      uint       `gorm:"primaryKey" json:"id"`
+	ModelName               string     `gorm:"type:varchar(100);not null;index:idx_model_pricing_window,priority:1" json:"model_name"`
+	InputPricePer1k         float64    `gorm:"type:decimal(10,6);not null" json:"input_price_per_1k"`
+	OutputPricePer1k        float64    `gorm:"type:decimal(10,6);not null" json:"output_price_per_1k"`
+	CacheReadPricePer1k     float64    `gorm:"type:decimal(10,6);default:0" json:"cache_read_price_per_1k"`     // Cache read tokens pricing (usually 10% of input price)
+	CacheCreationPricePer1k float64    `gorm:"type:decimal(10,6);default:0" json:"cache_creation_price_per_1k"` // Cache creation tokens pricing
+	ReasoningPricePer1k     float64    `gorm:"type:decimal(10,6);default:0" json:"reasoning_price_per_1k"`      // Reasoning output tokens; 0 bills them as output
+	TierThresholdTokens     int        `gorm:"default:0" json:"tier_threshold_tokens"`                          // Above this many input tokens the tier prices apply to the whole request; 0 disables the tier
+	TierInputPricePer1k     float64    `gorm:"type:decimal(10,6);default:0" json:"tier_input_price_per_1k"`
+	TierOutputPricePer1k    float64    `gorm:"type:decimal(10,6);default:0" json:"tier_output_price_per_1k"`
+	TierCacheReadPricePer1k float64    `gorm:"type:decimal(10,6);default:0" json:"tier_cache_read_price_per_1k"`
+	MaxInputTokens          int        `gorm:"default:0" json:"max_input_tokens"` // Context limits; 0 when unknown
+	MaxOutputTokens         int        `gorm:"default:0" json:"max_output_tokens"`
+	MarkupMultiplier        float64    `gorm:"type:decimal(4,2);default:1.5" json:"markup_multiplier"`
+	EffectiveFrom           time.Time  `gorm:"default:CURRENT_TIMESTAMP;index:idx_model_pricing_window,priority:2" json:"effective_from"`
+	EffectiveTo             *time.Time `json:"effective_to"` // Nil while no later version is scheduled
+	CreatedAt               time.Time  `json:"created_at"`
 }
 
 type UsageLog struct {
-	RequestID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"request_id"`
-	UserID              uuid.UUID `gorm:"type:uuid;not null;index:idx_user_created" json:"user_id"`
-	User                User      `gorm:"foreignKey:UserID" json:"-"`
-	APIKeyID            uint      `gorm:"not null;index:idx_api_key_created" json:"api_key_id"`
-	APIKey              APIKey    `gorm:"foreignKey:APIKeyID" json:"-"`
-	Model               string    `gorm:"type:varchar(100)" json:"model"`
-	InputTokens         int       `gorm:"not null" json:"input_tokens"`
-	OutputTokens        int       `gorm:"not null" json:"output_tokens"`
-	CachedTokens        int       `gorm:"default:0" json:"cached_tokens"` // Cached input tokens
-	CacheCreationTokens int       `gorm:"default:0" json:"cache_creation_tokens"`
-	TotalTokens         int       `gorm:"not null" json:"total_tokens"`
-	Cost                float64   `gorm:"type:decimal(18,6);not null" json:"cost"`
-	LatencyMs           int       `json:"latency_ms"`
-	StatusCode          int       `json:"status_code"`
-	CreatedAt           time.Time `gorm:"index:idx_user_created,idx_api_key_created" json:"created_at"`
+	RequestID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"request_id"`
+	UserID              uuid.UUID  `gorm:"type:uuid;not null;index:idx_user_created" json:"user_id"`
+	User                User       `gorm:"foreignKey:UserID" json:"-"`
+	APIKeyID            uint       `gorm:"not null;index:idx_api_key_created" json:"api_key_id"`
+	APIKey              APIKey     `gorm:"foreignKey:APIKeyID" json:"-"`
+	Model               string     `gorm:"type:varchar(100)" json:"model"`
+	InputTokens         int        `gorm:"not null" json:"input_tokens"`
+	OutputTokens        int        `gorm:"not null" json:"output_tokens"`
+	CachedTokens        int        `gorm:"default:0" json:"cached_tokens"` // Cached input tokens
+	CacheCreationTokens int        `gorm:"default:0" json:"cache_creation_tokens"`
+	ReasoningTokens     int        `gorm:"default:0" json:"reasoning_tokens"` // Part of OutputTokens
+	TotalTokens         int        `gorm:"not null" json:"total_tokens"`
+	Cost                float64    `gorm:"type:decimal(18,6);not null" json:"cost"`
+	LatencyMs           int        `json:"latency_ms"`
+	StatusCode          int        `gorm:"index" json:"status_code"`
+	ErrorClass          string     `gorm:"type:varchar(50);index" json:"error_class"` // Empty on success
+	UpstreamID          *uint      `gorm:"index" json:"upstream_id"`
+	RequestPath         string     `gorm:"type:varchar(100)" json:"request_path"`
+	Stream              bool       `gorm:"default:false" json:"stream"`
+	TimeToFirstTokenMs  int        `gorm:"default:0" json:"time_to_first_token_ms"`
+	UsageSource         string     `gorm:"type:varchar(20)" json:"usage_source"`              // reported, estimated; empty when not billed
+	OrganizationID      *uuid.UUID `gorm:"type:uuid;index" json:"organization_id"`            // Organization billed for the request
+	PriceVersionID      *uint      `gorm:"index" json:"price_version_id"`                     // ModelPricing version the cost was computed with
+	PricingRuleID       *uint      `gorm:"index" json:"pricing_rule_id"`                      // PricingRule applied to the price; nil when none matched
+	AppliedMarkup       float64    `gorm:"type:decimal(6,4);default:0" json:"applied_markup"` // Multiplier the cost was charged at, rule and discount included
+	CreatedAt           time.Time  `gorm:"index:idx_user_created,idx_api_key_created" json:"created_at"`
+
+	Attempts []UpstreamAttempt `gorm:"foreignKey:RequestID;references:RequestID" json:"attempts,omitempty"` // Stored when an upstream attempt failed
 }
 
 func (UsageLog) TableName() string {
 	return "usage_logs"
 }
 
+// UpstreamAttempt records one try of a request against an upstream. Attempts
+// are kept for requests that failed over or failed upstream.
+type UpstreamAttempt struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	RequestID  uuid.UUID `gorm:"type:uuid;not null;index" json:"request_id"`
+	Attempt    int       `gorm:"not null" json:"attempt"` // 1-based, in the order tried
+	UpstreamID uint      `gorm:"not null" json:"upstream_id"`
+	StatusCode int       `json:"status_code"` // 0 when no response was received
+	Error      string    `gorm:"type:text" json:"error"`
+	LatencyMs  int       `json:"latency_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BalanceHold reserves an estimated maximum cost while a request is in flight.
+// Held amounts count against the user's available funds until settled or released.
+type BalanceHold struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index:idx_balance_holds_user_status" json:"user_id"`
+	APIKeyID       uint       `gorm:"not null" json:"api_key_id"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id"` // Holds organization funds instead of the user's
+	Model          string     `gorm:"type:varchar(100)" json:"model"`
+	Amount         float64    `gorm:"type:decimal(18,6);not null" json:"amount"`
+	Tokens         int        `gorm:"not null;default:0" json:"tokens"` // Estimated tokens held against token budgets
+	SettledAmount  float64    `gorm:"type:decimal(18,6);default:0" json:"settled_amount"`
+	Status         string     `gorm:"type:varchar(20);default:'held';index:idx_balance_holds_user_status" json:"status"` // held, settled, released, expired
+	ExpiresAt      time.Time  `gorm:"not null;index" json:"expires_at"`
+	SettledAt      *time.Time `json:"settled_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// RateLimitPolicy overrides the system rate limits for a user, an API key or a
+// model. Zero fields inherit from the less specific level; negative means unlimited.
+type RateLimitPolicy struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Scope         string     `gorm:"type:varchar(20);not null;index" json:"scope"` // system, user, api_key
+	UserID        *uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	APIKeyID      *uint      `gorm:"index" json:"api_key_id"`
+	Model         string     `gorm:"type:varchar(100)" json:"model"` // Model name or glob pattern; empty = all models
+	RPM           int        `gorm:"default:0" json:"rpm"`
+	Burst         int        `gorm:"default:0" json:"burst"`
+	TPM           int        `gorm:"default:0" json:"tpm"`
+	MaxConcurrent int        `gorm:"default:0" json:"max_concurrent"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ModelAliasRule maps requested model names to the model that is served and
+// billed. Rules are tried by ascending priority; the first match wins.
+type ModelAliasRule struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	MatchType       string    `gorm:"type:varchar(20);not null" json:"match_type"` // exact, prefix, regex
+	Pattern         string    `gorm:"type:varchar(255);not null" json:"pattern"`   // Compared case-insensitively
+	Target          string    `gorm:"type:varchar(100);not null" json:"target"`
+	ReasoningEffort string    `gorm:"type:varchar(20)" json:"reasoning_effort"` // Injected as reasoning.effort when the request sets none
+	Priority        int       `gorm:"not null;index" json:"priority"`
+	Enabled         bool      `gorm:"not null" json:"enabled"`
+	Description     string    `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PricingRule adjusts the model price charged to a user, role, package or
+// organization. Only the most specific matching rule applies.
+type PricingRule struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Scope            string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_pricing_rule_target,priority:1" json:"scope"`       // user, organization, package, role
+	Target           string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_pricing_rule_target,priority:2" json:"target"`     // User or organization ID, package ID or role name
+	ModelName        string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_pricing_rule_target,priority:3" json:"model_name"` // Empty applies to every model
+	MarkupMultiplier *float64  `gorm:"type:decimal(4,2)" json:"markup_multiplier"`                                                  // Replaces the model's markup; nil keeps it
+	DiscountPercent  float64   `gorm:"type:decimal(5,2);not null;default:0" json:"discount_percent"`                                // Taken off the cost after markup
+	DiscountPer1k    float64   `gorm:"type:decimal(10,6);not null;default:0" json:"discount_per_1k"`                                // Taken off the cost per 1K billed tokens after the percentage, down to zero
+	InputPricePer1k  *float64  `gorm:"type:decimal(10,6)" json:"input_price_per_1k"`                                                // Replaces the model's input price before markup, tier included; model rules only
+	OutputPricePer1k *float64  `gorm:"type:decimal(10,6)" json:"output_price_per_1k"`                                               // Replaces the model's output price before markup, tier included; model rules only
+	Enabled          bool      `gorm:"not null" json:"enabled"`
+	Description      string    `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
 type Transaction struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID      uuid.UUID `gorm:"type:uuid;not null;index:idx_txn_user" json:"user_id"`
-	Amount      float64   `gorm:"type:decimal(18,6);not null" json:"amount"`
-	Type        string    `gorm:"type:varchar(20);not null" json:"type"` // deposit, refund
-	Description string    `gorm:"type:text" json:"description"`
-	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index:idx_txn_user" json:"user_id"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id"` // Set when the organization's funds changed; UserID is the member who acted
+	Amount         float64    `gorm:"type:decimal(18,6);not null" json:"amount"`
+	Type           string     `gorm:"type:varchar(20);not null" json:"type"` // deposit, refund
+	Description    string     `gorm:"type:text" json:"description"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 }
 
 type SystemSettings struct {
@@ -109,12 +241,29 @@ type SystemSettings struct {
 	RateLimitEnabled    bool     `gorm:"column:rate_limit_enabled;default:false" json:"rate_limit_enabled"`
 	RateLimitRPM        int      `gorm:"column:rate_limit_rpm;default:0" json:"rate_limit_rpm"`
 	RateLimitBurst      int      `gorm:"column:rate_limit_burst;default:0" json:"rate_limit_burst"`
+	RateLimitTPM        int      `gorm:"column:rate_limit_tpm;default:0" json:"rate_limit_tpm"`               // Tokens per minute per user
+	RateLimitConcurrent int      `gorm:"column:rate_limit_concurrent;default:0" json:"rate_limit_concurrent"` // In-flight requests per user
 	UserDailyUsageLimit *float64 `gorm:"column:user_daily_usage_limit;type:decimal(18,6)" json:"user_daily_usage_limit"`
 
+	// Upstream Routing Settings
+	UpstreamStrategy string `gorm:"column:upstream_strategy;type:varchar(30);default:'consistent_hash'" json:"upstream_strategy"` // consistent_hash, priority, weighted_random, least_loaded
+
+	// Models that match no alias rule and have no pricing
+	UnknownModelAction string `gorm:"column:unknown_model_action;type:varchar(20);default:'reject'" json:"unknown_model_action"` // reject, map
+	UnknownModelTarget string `gorm:"column:unknown_model_target;type:varchar(100)" json:"unknown_model_target"`                 // Model served when the action is map
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// AfterFind registers credentials for log redaction
+func (s *SystemSettings) AfterFind(tx *gorm.DB) error {
+	logger.RegisterSecret(s.OpenAIAPIKey)
+	logger.RegisterSecret(s.LinuxDoClientSecret)
+	logger.RegisterSecret(s.CreditKey)
+	return nil
+}
+
 type Package struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
 	Name         string    `gorm:"type:varchar(100);not null" json:"name"`
@@ -199,6 +348,7 @@ type PaymentOrder struct {
 	CouponID                *uint      `json:"coupon_id"`
 	CouponCode              string     `gorm:"type:varchar(50)" json:"coupon_code"`
 	SwitchFromUserPackageID *uuid.UUID `gorm:"type:uuid" json:"switch_from_user_package_id"`
+	OrganizationID          *uuid.UUID `gorm:"type:uuid;index" json:"organization_id"` // Fulfilled for the organization instead of the user
 	CreatedAt               time.Time  `json:"created_at"`
 	UpdatedAt               time.Time  `json:"updated_at"`
 	PaidAt                  *time.Time `json:"paid_at"`
@@ -216,14 +366,14 @@ type CouponRedemption struct {
 }
 
 type AdminLog struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	AdminID   uuid.UUID `gorm:"type:uuid;not null;index:idx_admin_logs" json:"admin_id"`
-	Admin     User      `gorm:"foreignKey:AdminID" json:"-"`
-	Action    string    `gorm:"type:varchar(100);not null" json:"action"`
-	Target    string    `gorm:"type:varchar(100)" json:"target"`
-	Details   string    `gorm:"type:text" json:"details"`
-	IPAddress string    `gorm:"type:varchar(45)" json:"ip_address"`
-	CreatedAt time.Time `gorm:"index:idx_admin_logs" json:"created_at"`
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	AdminID   *uuid.UUID `gorm:"type:uuid;index:idx_admin_logs" json:"admin_id"` // Nil for actions the system took on its own
+	Admin     User       `gorm:"foreignKey:AdminID" json:"-"`
+	Action    string     `gorm:"type:varchar(100);not null" json:"action"`
+	Target    string     `gorm:"type:varchar(100)" json:"target"`
+	Details   string     `gorm:"type:text" json:"details"`
+	IPAddress string     `gorm:"type:varchar(45)" json:"ip_address"`
+	CreatedAt time.Time  `gorm:"index:idx_admin_logs" json:"created_at"`
 }
 
 type CodexUpstream struct {
@@ -233,11 +383,96 @@ type CodexUpstream struct {
 	APIKey      string     `gorm:"type:varchar(255);not null" json:"api_key"`
 	Priority    int        `gorm:"default:0;index" json:"priority"`                 // Lower number = higher priority
 	Status      string     `gorm:"type:varchar(20);default:'active'" json:"status"` // active, disabled, unhealthy
-	Weight      int        `gorm:"default:1" json:"weight"`                         // For load balancing (not used with user affinity)
+	Weight      int        `gorm:"default:1" json:"weight"`                         // Relative share of traffic for load balancing
 	MaxRetries  int        `gorm:"default:3" json:"max_retries"`
 	Timeout     int        `gorm:"default:120" json:"timeout"`            // Seconds
 	HealthCheck string     `gorm:"type:varchar(255)" json:"health_check"` // Health check endpoint
 	LastChecked *time.Time `json:"last_checked"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Model routing (empty SupportedModels = serves every model)
+	SupportedModels []string          `gorm:"type:text;serializer:json" json:"supported_models"` // Model names or glob patterns, e.g. "gpt-5.1-codex-*"
+	ModelAliases    map[string]string `gorm:"type:text;serializer:json" json:"model_aliases"`    // Requested model → model name sent upstream
+
+	// Connection settings (0 = gateway default)
+	FirstByteTimeout int `gorm:"default:60" json:"first_byte_timeout"` // Seconds until response headers
+	IdleTimeout      int `gorm:"default:60" json:"idle_timeout"`       // Seconds allowed between stream chunks
+	MaxConns         int `gorm:"default:100" json:"max_conns"`         // Max connections to this upstream
+	MaxIdleConns     int `gorm:"default:10" json:"max_idle_conns"`     // Max idle keep-alive connections
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AfterFind registers the upstream API key for log redaction
+func (u *CodexUpstream) AfterFind(tx *gorm.DB) error {
+	logger.RegisterSecret(u.APIKey)
+	return nil
+}
+
+// Organization pools balance and packages for its members
+type Organization struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name      string         `gorm:"type:varchar(100);not null" json:"name"`
+	Balance   float64        `gorm:"type:decimal(18,6);default:0" json:"balance"`
+	Status    string         `gorm:"type:varchar(20);default:'active'" json:"status"` // active, disabled
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+type OrganizationMember struct {
+	ID              uint         `gorm:"primaryKey" json:"id"`
+	OrganizationID  uuid.UUID    `gorm:"type:uuid;not null;uniqueIndex:idx_org_member" json:"organization_id"`
+	Organization    Organization `gorm:"foreignKey:OrganizationID" json:"-"`
+	UserID          uuid.UUID    `gorm:"type:uuid;not null;uniqueIndex:idx_org_member;index" json:"user_id"`
+	User            User         `gorm:"foreignKey:UserID" json:"-"`
+	Role            string       `gorm:"type:varchar(20);not null;default:'member'" json:"role"` // owner, admin, member
+	DailySpendLimit *float64     `gorm:"type:decimal(18,6)" json:"daily_spend_limit"`            // Cap on the member's daily spend of organization funds; nil = unlimited
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+type OrganizationInvitation struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null;index" json:"organization_id"`
+	Email          string     `gorm:"type:varchar(255);not null" json:"email"`
+	Role           string     `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+	TokenHash      string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	InvitedByID    uuid.UUID  `gorm:"type:uuid;not null" json:"invited_by_id"`
+	Status         string     `gorm:"type:varchar(20);default:'pending'" json:"status"` // pending, accepted, revoked
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// OrganizationPackage is a package shared by all members of an organization
+type OrganizationPackage struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;index" json:"organization_id"`
+	PackageID      uint      `gorm:"not null" json:"package_id"`
+	PackageName    string    `gorm:"type:varchar(100);not null" json:"package_name"`
+	PackagePrice   float64   `gorm:"type:decimal(18,6);not null" json:"package_price"`
+	DurationDays   int       `gorm:"not null" json:"duration_days"`
+	DailyLimit     float64   `gorm:"type:decimal(18,6);not null" json:"daily_limit"`
+	StartDate      time.Time `gorm:"type:date;not null" json:"start_date"`
+	EndDate        time.Time `gorm:"type:date;not null" json:"end_date"`
+	Status         string    `gorm:"type:varchar(20);default:'active'" json:"status"`
+	PurchasedByID  uuid.UUID `gorm:"type:uuid;not null" json:"purchased_by_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type OrganizationDailyUsage struct {
+	ID                    uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID        uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_org_daily_usage" json:"organization_id"`
+	OrganizationPackageID *uuid.UUID `gorm:"type:uuid" json:"organization_package_id"`
+	Date                  time.Time  `gorm:"type:date;not null;uniqueIndex:idx_org_daily_usage" json:"date"`
+	UsedAmount            float64    `gorm:"type:decimal(18,6);default:0" json:"used_amount"`       // Covered by the package
+	TotalUsedAmount       float64    `gorm:"type:decimal(18,6);default:0" json:"total_used_amount"` // Package plus balance
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+func (OrganizationDailyUsage) TableName() string {
+	return "organization_daily_usage"
 }
@@ -0,0 +1,43 @@
+package organization
+
+import (
+	"errors"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Member roles
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// ErrNotMember is returned when a user is not a member of an active organization
+var ErrNotMember = errors.New("not a member of this organization")
+
+// ValidRole reports whether role is a known member role
+func ValidRole(role string) bool {
+	return role == RoleOwner || role == RoleAdmin || role == RoleMember
+}
+
+// CanManage reports whether the role may manage members, invitations and funds
+func CanManage(role string) bool {
+	return role == RoleOwner || role == RoleAdmin
+}
+
+// Membership returns the user's membership in an active organization
+func Membership(orgID, userID uuid.UUID) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := database.DB.
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_members.organization_id = ? AND organization_members.user_id = ? AND organizations.status = ?", orgID, userID, "active").
+		First(&member).Error
+	if err != nil {
+		return nil, ErrNotMember
+	}
+	return &member, nil
+}
@@ -0,0 +1,148 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/logger"
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// pricesChannel is the Postgres channel replicas announce pricing and pricing
+// rule writes on
+const pricesChannel = "model_pricing_changed"
+
+// pricesRefreshInterval bounds staleness should a change notification be missed
+const pricesRefreshInterval = 5 * time.Minute
+
+// instanceID tags this replica's notifications so it skips its own
+var instanceID = uuid.NewString()
+
+type priceCache struct {
+	versions map[string][]models.ModelPricing // Per model, newest first
+	rules    []models.PricingRule             // Enabled pricing rules
+	loadedAt time.Time
+}
+
+var (
+	prices    atomic.Value
+	reloading sync.Mutex
+)
+
+func init() {
+	prices.Store(priceCache{})
+}
+
+func loadCache() priceCache {
+	return prices.Load().(priceCache)
+}
+
+// LoadPrices replaces the cache with every price version in the database,
+// including past and scheduled ones, so lookups by time need no query, and
+// with the enabled pricing rules
+func LoadPrices() error {
+	var all []models.ModelPricing
+	if err := database.DB.Order("model_name ASC, effective_from DESC").Find(&all).Error; err != nil {
+		return err
+	}
+	var rules []models.PricingRule
+	if err := database.DB.Where("enabled = ?", true).Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	versions := make(map[string][]models.ModelPricing)
+	for _, version := range all {
+		versions[version.ModelName] = append(versions[version.ModelName], version)
+	}
+	prices.Store(priceCache{versions: versions, rules: rules, loadedAt: time.Now()})
+	return nil
+}
+
+// maybeRefresh reloads the cache in the background once it is stale
+func maybeRefresh() {
+	if time.Since(loadCache().loadedAt) < pricesRefreshInterval {
+		return
+	}
+	if !reloading.TryLock() {
+		return
+	}
+	go func() {
+		defer reloading.Unlock()
+		if err := LoadPrices(); err != nil {
+			logger.Component("Pricing").Error("failed to refresh prices", "error", err)
+		}
+	}()
+}
+
+// PriceAt returns the price version of a model in effect at the given time
+func PriceAt(model string, at time.Time) (*models.ModelPricing, error) {
+	maybeRefresh()
+	for _, version := range loadCache().versions[model] {
+		if effectiveAt(version, at) {
+			return &version, nil
+		}
+	}
+	return nil, fmt.Errorf("pricing not found for model: %s", model)
+}
+
+// Known reports whether the cache holds any price version of the model. It
+// never reloads the cache, so hot paths such as metrics labels can call it.
+func Known(model string) bool {
+	return len(loadCache().versions[model]) > 0
+}
+
+// CurrentPrices returns the price version in effect now for each model,
+// ordered by model name
+func CurrentPrices() []models.ModelPricing {
+	maybeRefresh()
+	now := time.Now()
+	current := make([]models.ModelPricing, 0)
+	for _, versions := range loadCache().versions {
+		for _, version := range versions {
+			if effectiveAt(version, now) {
+				current = append(current, version)
+				break
+			}
+		}
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i].ModelName < current[j].ModelName })
+	return current
+}
+
+func effectiveAt(version models.ModelPricing, at time.Time) bool {
+	return !version.EffectiveFrom.After(at) && (version.EffectiveTo == nil || version.EffectiveTo.After(at))
+}
+
+// Invalidate reloads the cache after a pricing write and tells the other
+// replicas to do the same
+func Invalidate() {
+	if err := LoadPrices(); err != nil {
+		logger.Component("Pricing").Error("failed to reload prices", "error", err)
+	}
+	if err := database.Notify(pricesChannel, instanceID); err != nil {
+		logger.Component("Pricing").Error("failed to announce pricing change", "error", err)
+	}
+}
+
+// ListenForChanges reloads the cache whenever another replica writes pricing
+func ListenForChanges() {
+	go database.Listen(context.Background(), pricesChannel, reloadOnChange)
+}
+
+// reloadOnChange handles a change notification. This replica's own writes were
+// reloaded by Invalidate already; an empty payload follows a reconnect.
+func reloadOnChange(payload string) {
+	if payload == instanceID {
+		return
+	}
+	if err := LoadPrices(); err != nil {
+		logger.Component("Pricing").Error("failed to reload prices", "payload", payload, "error", err)
+	}
+}
@@ -0,0 +1,190 @@
+package pricing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestEffectiveAt(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name    string
+		version models.ModelPricing
+		want    bool
+	}{
+		{"open-ended", models.ModelPricing{EffectiveFrom: past}, true},
+		{"starts now", models.ModelPricing{EffectiveFrom: now}, true},
+		{"scheduled", models.ModelPricing{EffectiveFrom: future}, false},
+		{"retired", models.ModelPricing{EffectiveFrom: past.Add(-time.Hour), EffectiveTo: &past}, false},
+		{"ends now", models.ModelPricing{EffectiveFrom: past, EffectiveTo: &now}, false},
+		{"retires later", models.ModelPricing{EffectiveFrom: past, EffectiveTo: &future}, true},
+	}
+	for _, tt := range tests {
+		if got := effectiveAt(tt.version, now); got != tt.want {
+			t.Errorf("%s: effectiveAt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPriceAt(t *testing.T) {
+	now := time.Now()
+	dayAgo, hourAgo, nextHour := now.Add(-24*time.Hour), now.Add(-time.Hour), now.Add(time.Hour)
+	useCache(t, []models.ModelPricing{
+		// Newest first, as LoadPrices orders them
+		{ID: 3, ModelName: "gpt-5.1", EffectiveFrom: nextHour},
+		{ID: 2, ModelName: "gpt-5.1", EffectiveFrom: hourAgo, EffectiveTo: &nextHour},
+		{ID: 1, ModelName: "gpt-5.1", EffectiveFrom: dayAgo, EffectiveTo: &hourAgo},
+		{ID: 4, ModelName: "gpt-5.2", EffectiveFrom: nextHour},
+	}, nil)
+
+	tests := []struct {
+		name  string
+		model string
+		at    time.Time
+		want  uint // 0 for not found
+	}{
+		{"current version", "gpt-5.1", now, 2},
+		{"past version", "gpt-5.1", now.Add(-2 * time.Hour), 1},
+		{"scheduled version", "gpt-5.1", nextHour.Add(time.Minute), 3},
+		{"before the first version", "gpt-5.1", dayAgo.Add(-time.Minute), 0},
+		{"model not priced yet", "gpt-5.2", now, 0},
+		{"unknown model", "gpt-4o", now, 0},
+	}
+	for _, tt := range tests {
+		price, err := PriceAt(tt.model, tt.at)
+		got := uint(0)
+		if err == nil {
+			got = price.ID
+		}
+		if got != tt.want {
+			t.Errorf("%s: PriceAt = version %d (%v), want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestCurrentPrices(t *testing.T) {
+	now := time.Now()
+	hourAgo, nextHour := now.Add(-time.Hour), now.Add(time.Hour)
+	useCache(t, []models.ModelPricing{
+		{ID: 1, ModelName: "gpt-5.1-codex", EffectiveFrom: hourAgo},
+		{ID: 3, ModelName: "gpt-5.1", EffectiveFrom: nextHour},
+		{ID: 2, ModelName: "gpt-5.1", EffectiveFrom: hourAgo},
+		{ID: 4, ModelName: "gpt-5.2", EffectiveFrom: nextHour},
+		{ID: 5, ModelName: "gpt-4o", EffectiveFrom: now.Add(-2 * time.Hour), EffectiveTo: &hourAgo},
+	}, nil)
+
+	current := CurrentPrices()
+	var got []uint
+	for _, version := range current {
+		got = append(got, version.ID)
+	}
+	if len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Errorf("CurrentPrices = versions %v, want [2 1]", got)
+	}
+}
+
+// captureNotifications records the payloads sent on the pricing channel
+func captureNotifications(t *testing.T, db *gorm.DB) *[]string {
+	t.Helper()
+	var payloads []string
+	err := db.Callback().Raw().Before("gorm:raw").Register("test:notify", func(tx *gorm.DB) {
+		if strings.Contains(tx.Statement.SQL.String(), "pg_notify") && len(tx.Statement.Vars) == 2 && tx.Statement.Vars[0] == pricesChannel {
+			payloads = append(payloads, tx.Statement.Vars[1].(string))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &payloads
+}
+
+func TestInvalidate(t *testing.T) {
+	useCache(t, nil, nil)
+	db := useDB(t)
+	notifications := captureNotifications(t, db)
+	addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: 0.001, MarkupMultiplier: 1.5})
+	rule := models.PricingRule{Scope: ScopeRole, Target: "user", Enabled: true}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPrices(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes are not served until the cache is invalidated
+	addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: 0.002, MarkupMultiplier: 1.5})
+	if err := database.DB.Model(&rule).Update("enabled", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if price, _ := PriceAt("gpt-5.1", time.Now()); price == nil || price.InputPricePer1k != 0.001 {
+		t.Fatalf("PriceAt before invalidation = %+v, want the cached version", price)
+	}
+
+	Invalidate()
+
+	if price, _ := PriceAt("gpt-5.1", time.Now()); price == nil || price.InputPricePer1k != 0.002 {
+		t.Errorf("PriceAt after invalidation = %+v, want the new version", price)
+	}
+	if rules := loadCache().rules; len(rules) != 0 {
+		t.Errorf("cached rules = %+v, want the disabled rule dropped", rules)
+	}
+	if len(*notifications) != 1 || (*notifications)[0] != instanceID {
+		t.Errorf("notifications = %q, want this replica's id", *notifications)
+	}
+}
+
+func TestReloadOnChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		payload    string
+		wantReload bool
+	}{
+		{"own write", instanceID, false},
+		{"another replica's write", "other-replica", true},
+		{"reconnected", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCache(t, nil, nil)
+			useDB(t)
+			addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: 0.001, MarkupMultiplier: 1.5})
+
+			reloadOnChange(tt.payload)
+
+			_, err := PriceAt("gpt-5.1", time.Now())
+			if reloaded := err == nil; reloaded != tt.wantReload {
+				t.Errorf("reloaded = %v, want %v", reloaded, tt.wantReload)
+			}
+		})
+	}
+}
+
+func TestStaleCacheRefreshes(t *testing.T) {
+	useCache(t, nil, nil)
+	useDB(t)
+	addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: 0.001, MarkupMultiplier: 1.5})
+	prices.Store(priceCache{loadedAt: time.Now().Add(-pricesRefreshInterval)})
+
+	// The stale lookup misses and starts a reload in the background
+	PriceAt("gpt-5.1", time.Now())
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := PriceAt("gpt-5.1", time.Now()); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale cache was not refreshed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Let the reload release its lock before the database is swapped back
+	reloading.Lock()
+	reloading.Unlock()
+}
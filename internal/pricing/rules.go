@@ -0,0 +1,186 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Pricing rule scopes, most specific first
+const (
+	ScopeUser         = "user"
+	ScopeOrganization = "organization"
+	ScopePackage      = "package"
+	ScopeRole         = "role"
+)
+
+// scopeRank orders scopes by specificity
+var scopeRank = map[string]int{
+	ScopeUser:         4,
+	ScopeOrganization: 3,
+	ScopePackage:      2,
+	ScopeRole:         1,
+}
+
+// Subject is who a request is charged to, as matched by pricing rules
+type Subject struct {
+	UserID         uuid.UUID
+	Role           string
+	OrganizationID *uuid.UUID // Organization paying for the request
+	PackageID      uint       // Package of the payer active today; 0 when none
+}
+
+// ValidateRule checks a rule's scope, target and adjustments, normalizing
+// the target and model name
+func ValidateRule(rule *models.PricingRule) error {
+	rule.Target = strings.TrimSpace(rule.Target)
+	rule.ModelName = strings.ToLower(strings.TrimSpace(rule.ModelName))
+
+	switch rule.Scope {
+	case ScopeUser, ScopeOrganization:
+		id, err := uuid.Parse(rule.Target)
+		if err != nil {
+			return fmt.Errorf("target must be a %s ID", rule.Scope)
+		}
+		rule.Target = id.String()
+	case ScopePackage:
+		if id, err := strconv.ParseUint(rule.Target, 10, 64); err != nil || id == 0 {
+			return fmt.Errorf("target must be a package ID")
+		}
+	case ScopeRole:
+		if rule.Target == "" {
+			return fmt.Errorf("target must be a role")
+		}
+	default:
+		return fmt.Errorf("scope must be user, organization, package or role")
+	}
+
+	if rule.MarkupMultiplier != nil && *rule.MarkupMultiplier <= 0 {
+		return fmt.Errorf("markup_multiplier must be positive")
+	}
+	if rule.DiscountPercent < 0 || rule.DiscountPercent > 100 {
+		return fmt.Errorf("discount_percent must be between 0 and 100")
+	}
+	if rule.DiscountPer1k < 0 {
+		return fmt.Errorf("discount_per_1k cannot be negative")
+	}
+	if (rule.InputPricePer1k != nil && *rule.InputPricePer1k < 0) || (rule.OutputPricePer1k != nil && *rule.OutputPricePer1k < 0) {
+		return fmt.Errorf("prices cannot be negative")
+	}
+	if (rule.InputPricePer1k != nil || rule.OutputPricePer1k != nil) && rule.ModelName == "" {
+		return fmt.Errorf("price overrides require a model_name")
+	}
+	if rule.MarkupMultiplier == nil && rule.DiscountPercent == 0 && rule.DiscountPer1k == 0 &&
+		rule.InputPricePer1k == nil && rule.OutputPricePer1k == nil {
+		return fmt.Errorf("rule must set a markup, discount or price override")
+	}
+	return nil
+}
+
+// UsesPackageRules reports whether any enabled rule targets a package, so
+// callers can skip looking up the payer's package when none does
+func UsesPackageRules() bool {
+	maybeRefresh()
+	for _, rule := range loadCache().rules {
+		if rule.Scope == ScopePackage {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchRule returns the most specific enabled rule for the subject and model,
+// or nil. User rules beat organization rules, which beat package and then role
+// rules; within a scope a rule for the model beats one for every model.
+func MatchRule(subject Subject, model string) *models.PricingRule {
+	maybeRefresh()
+	rules := loadCache().rules
+	model = strings.ToLower(strings.TrimSpace(model))
+
+	var best *models.PricingRule
+	bestScore := 0
+	for i, rule := range rules {
+		if rule.ModelName != "" && strings.ToLower(rule.ModelName) != model {
+			continue
+		}
+		if !subject.matches(rule) {
+			continue
+		}
+		score := scopeRank[rule.Scope] * 2
+		if rule.ModelName != "" {
+			score++
+		}
+		if score > bestScore {
+			best = &rules[i]
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func (s Subject) matches(rule models.PricingRule) bool {
+	switch rule.Scope {
+	case ScopeUser:
+		return rule.Target == s.UserID.String()
+	case ScopeOrganization:
+		return s.OrganizationID != nil && rule.Target == s.OrganizationID.String()
+	case ScopePackage:
+		return s.PackageID != 0 && rule.Target == strconv.FormatUint(uint64(s.PackageID), 10)
+	case ScopeRole:
+		return rule.Target == s.Role
+	}
+	return false
+}
+
+// PriceFor returns the price version of a model in effect at the given time
+// with the subject's pricing rule applied, and the rule if any. The rule's
+// per-token discount is left to Discount.
+func PriceFor(subject Subject, model string, at time.Time) (*models.ModelPricing, *models.PricingRule, error) {
+	price, err := PriceAt(model, at)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := MatchRule(subject, model)
+	ApplyRule(price, rule)
+	return price, rule, nil
+}
+
+// ApplyRule replaces the price's input and output prices with the rule's
+// overrides and folds its markup and percentage discount into the price's
+// markup. A nil rule leaves the price unchanged.
+func ApplyRule(price *models.ModelPricing, rule *models.PricingRule) {
+	if rule == nil {
+		return
+	}
+	// Overrides hold above the tier threshold too, and the output override
+	// covers reasoning output
+	if rule.InputPricePer1k != nil {
+		price.InputPricePer1k = *rule.InputPricePer1k
+		price.TierInputPricePer1k = 0
+	}
+	if rule.OutputPricePer1k != nil {
+		price.OutputPricePer1k = *rule.OutputPricePer1k
+		price.TierOutputPricePer1k = 0
+		price.ReasoningPricePer1k = 0
+	}
+	if rule.MarkupMultiplier != nil {
+		price.MarkupMultiplier = *rule.MarkupMultiplier
+	}
+	price.MarkupMultiplier *= 1 - rule.DiscountPercent/100
+}
+
+// Discount takes a rule's per-1K-token discount off the cost of a request
+// billing the given tokens, down to zero. A nil rule leaves the cost unchanged.
+func Discount(cost float64, tokens int, rule *models.PricingRule) float64 {
+	if rule == nil {
+		return cost
+	}
+	return math.Max(0, cost-rule.DiscountPer1k*float64(tokens)/1000)
+}
@@ -0,0 +1,213 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// useCache installs price versions and enabled rules without touching the
+// database
+func useCache(t *testing.T, versions []models.ModelPricing, rules []models.PricingRule) {
+	t.Helper()
+	byModel := make(map[string][]models.ModelPricing)
+	for _, version := range versions {
+		byModel[version.ModelName] = append(byModel[version.ModelName], version)
+	}
+	previous := loadCache()
+	prices.Store(priceCache{versions: byModel, rules: rules, loadedAt: time.Now()})
+	t.Cleanup(func() { prices.Store(previous) })
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func TestValidateRule(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name    string
+		rule    models.PricingRule
+		wantErr bool
+	}{
+		{"user", models.PricingRule{Scope: ScopeUser, Target: " " + userID.String() + " ", DiscountPercent: 10}, false},
+		{"user with bad id", models.PricingRule{Scope: ScopeUser, Target: "alice", DiscountPercent: 10}, true},
+		{"organization", models.PricingRule{Scope: ScopeOrganization, Target: userID.String(), DiscountPercent: 10}, false},
+		{"package", models.PricingRule{Scope: ScopePackage, Target: "3", DiscountPercent: 10}, false},
+		{"package zero", models.PricingRule{Scope: ScopePackage, Target: "0", DiscountPercent: 10}, true},
+		{"role", models.PricingRule{Scope: ScopeRole, Target: "admin", DiscountPercent: 10}, false},
+		{"role empty", models.PricingRule{Scope: ScopeRole, Target: " ", DiscountPercent: 10}, true},
+		{"unknown scope", models.PricingRule{Scope: "team", Target: "x", DiscountPercent: 10}, true},
+		{"no adjustment", models.PricingRule{Scope: ScopeRole, Target: "user"}, true},
+		{"no adjustment for a model", models.PricingRule{Scope: ScopeRole, Target: "user", ModelName: "gpt-5.1"}, true},
+		{"markup only", models.PricingRule{Scope: ScopeRole, Target: "user", MarkupMultiplier: float(1.2)}, false},
+		{"zero markup", models.PricingRule{Scope: ScopeRole, Target: "user", MarkupMultiplier: float(0)}, true},
+		{"discount over 100", models.PricingRule{Scope: ScopeRole, Target: "user", DiscountPercent: 101}, true},
+		{"discount per 1k only", models.PricingRule{Scope: ScopeRole, Target: "user", DiscountPer1k: 0.001}, false},
+		{"negative discount per 1k", models.PricingRule{Scope: ScopeRole, Target: "user", DiscountPer1k: -1}, true},
+		{"price override", models.PricingRule{Scope: ScopeRole, Target: "user", ModelName: "gpt-5.1", InputPricePer1k: float(0.001), OutputPricePer1k: float(0)}, false},
+		{"negative price override", models.PricingRule{Scope: ScopeRole, Target: "user", ModelName: "gpt-5.1", OutputPricePer1k: float(-0.001)}, true},
+		{"price override for every model", models.PricingRule{Scope: ScopeRole, Target: "user", InputPricePer1k: float(0.001)}, true},
+	}
+	for _, tt := range tests {
+		rule := tt.rule
+		if err := ValidateRule(&rule); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateRule = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	rule := models.PricingRule{Scope: ScopeUser, Target: " " + userID.String() + " ", ModelName: " GPT-5.1-Codex ", DiscountPercent: 10}
+	if err := ValidateRule(&rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Target != userID.String() || rule.ModelName != "gpt-5.1-codex" {
+		t.Errorf("normalized rule = %q, %q", rule.Target, rule.ModelName)
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	userID, otherUserID, orgID := uuid.New(), uuid.New(), uuid.New()
+	useCache(t, nil, []models.PricingRule{
+		{ID: 1, Scope: ScopeRole, Target: "user"},
+		{ID: 2, Scope: ScopeRole, Target: "user", ModelName: "gpt-5.1-codex"},
+		{ID: 3, Scope: ScopePackage, Target: "7"},
+		{ID: 4, Scope: ScopeOrganization, Target: orgID.String()},
+		{ID: 5, Scope: ScopeUser, Target: userID.String(), ModelName: "gpt-5.1"},
+		// Stored before model names were normalized
+		{ID: 6, Scope: ScopeUser, Target: otherUserID.String(), ModelName: "GPT-5.2"},
+	})
+
+	tests := []struct {
+		name    string
+		subject Subject
+		model   string
+		want    uint // 0 for no rule
+	}{
+		{"role rule for every model", Subject{UserID: uuid.New(), Role: "user"}, "gpt-5.2", 1},
+		{"role rule for the model", Subject{UserID: uuid.New(), Role: "user"}, "gpt-5.1-codex", 2},
+		{"model matched case-insensitively", Subject{UserID: uuid.New(), Role: "user"}, "GPT-5.1-Codex", 2},
+		{"package beats role", Subject{UserID: uuid.New(), Role: "user", PackageID: 7}, "gpt-5.1-codex", 3},
+		{"organization beats package", Subject{UserID: uuid.New(), Role: "user", PackageID: 7, OrganizationID: &orgID}, "gpt-5.1", 4},
+		{"user beats organization", Subject{UserID: userID, Role: "user", OrganizationID: &orgID}, "gpt-5.1", 5},
+		{"user rule for another model", Subject{UserID: userID, Role: "user", OrganizationID: &orgID}, "gpt-5.2", 4},
+		{"stored model name in upper case", Subject{UserID: otherUserID, Role: "admin"}, "gpt-5.2", 6},
+		{"no match", Subject{UserID: uuid.New(), Role: "admin"}, "gpt-5.1", 0},
+	}
+	for _, tt := range tests {
+		rule := MatchRule(tt.subject, tt.model)
+		got := uint(0)
+		if rule != nil {
+			got = rule.ID
+		}
+		if got != tt.want {
+			t.Errorf("%s: matched rule %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyRule(t *testing.T) {
+	base := models.ModelPricing{
+		InputPricePer1k: 0.001, OutputPricePer1k: 0.01, ReasoningPricePer1k: 0.02,
+		TierThresholdTokens: 1000, TierInputPricePer1k: 0.002, TierOutputPricePer1k: 0.015,
+		MarkupMultiplier: 1.5,
+	}
+	tests := []struct {
+		name string
+		rule *models.PricingRule
+		want models.ModelPricing
+	}{
+		{"no rule", nil, base},
+		{
+			name: "markup replaced",
+			rule: &models.PricingRule{MarkupMultiplier: float(1.2)},
+			want: func() models.ModelPricing { p := base; p.MarkupMultiplier = 1.2; return p }(),
+		},
+		{
+			name: "discount on the model markup",
+			rule: &models.PricingRule{DiscountPercent: 20},
+			want: func() models.ModelPricing { p := base; p.MarkupMultiplier = 1.2; return p }(),
+		},
+		{
+			name: "input override clears the tier input price",
+			rule: &models.PricingRule{InputPricePer1k: float(0.0005)},
+			want: func() models.ModelPricing {
+				p := base
+				p.InputPricePer1k, p.TierInputPricePer1k = 0.0005, 0
+				return p
+			}(),
+		},
+		{
+			name: "output override covers tier and reasoning output",
+			rule: &models.PricingRule{OutputPricePer1k: float(0.008), MarkupMultiplier: float(1)},
+			want: func() models.ModelPricing {
+				p := base
+				p.OutputPricePer1k, p.TierOutputPricePer1k, p.ReasoningPricePer1k, p.MarkupMultiplier = 0.008, 0, 0, 1
+				return p
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		got := base
+		ApplyRule(&got, tt.rule)
+		if math.Abs(got.MarkupMultiplier-tt.want.MarkupMultiplier) > 1e-9 {
+			t.Errorf("%s: markup = %v, want %v", tt.name, got.MarkupMultiplier, tt.want.MarkupMultiplier)
+		}
+		got.MarkupMultiplier = tt.want.MarkupMultiplier
+		if got != tt.want {
+			t.Errorf("%s: price = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	perK := &models.PricingRule{DiscountPer1k: 0.001}
+	tests := []struct {
+		cost   float64
+		tokens int
+		rule   *models.PricingRule
+		want   float64
+	}{
+		{0.5, 1000, nil, 0.5},
+		{0.5, 1000, &models.PricingRule{}, 0.5},
+		{0.5, 1000, perK, 0.499},
+		{0.5, 100000, perK, 0.4},
+		// Small requests get a proportionally small discount rather than
+		// being free
+		{0.0005, 100, perK, 0.0004},
+		{0.0005, 1000, perK, 0},
+	}
+	for _, tt := range tests {
+		if got := Discount(tt.cost, tt.tokens, tt.rule); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Discount(%v, %d, %+v) = %v, want %v", tt.cost, tt.tokens, tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestPriceForLeavesCachedVersionUnchanged(t *testing.T) {
+	from := time.Now().Add(-time.Hour)
+	useCache(t, []models.ModelPricing{
+		{ID: 1, ModelName: "gpt-5.1", InputPricePer1k: 0.001, OutputPricePer1k: 0.01, MarkupMultiplier: 1.5, EffectiveFrom: from},
+	}, []models.PricingRule{
+		{ID: 9, Scope: ScopeRole, Target: "user", ModelName: "gpt-5.1", InputPricePer1k: float(0.0005), MarkupMultiplier: float(1)},
+	})
+
+	price, rule, err := PriceFor(Subject{UserID: uuid.New(), Role: "user"}, "gpt-5.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule == nil || rule.ID != 9 || price.InputPricePer1k != 0.0005 || price.MarkupMultiplier != 1 {
+		t.Errorf("PriceFor = %+v, rule %+v; want the rule's override", price, rule)
+	}
+
+	price, rule, err = PriceFor(Subject{UserID: uuid.New(), Role: "admin"}, "gpt-5.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule != nil || price.InputPricePer1k != 0.001 || price.MarkupMultiplier != 1.5 {
+		t.Errorf("PriceFor without a rule = %+v; the cached version was modified", price)
+	}
+}
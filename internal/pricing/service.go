@@ -6,9 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,7 +14,6 @@ import (
 	"time"
 
 	"codex-gateway/internal/database"
-	"codex-gateway/internal/models"
 )
 
 const (
@@ -28,15 +25,25 @@ const (
 	checkInterval  = 10 * time.Minute
 
 	// Cache directory
-	cacheDir = "./data/pricing"
+	defaultCacheDir = "./data/pricing"
 )
 
 // ModelPricing represents LiteLLM pricing data
 type LiteLLMPricing struct {
-	InputCostPerToken  float64 `json:"input_cost_per_token"`
-	OutputCostPerToken float64 `json:"output_cost_per_token"`
-	MaxInputTokens     int     `json:"max_input_tokens"`
-	MaxOutputTokens    int     `json:"max_output_tokens"`
+	InputCostPerToken           float64 `json:"input_cost_per_token" yaml:"input_cost_per_token"`
+	OutputCostPerToken          float64 `json:"output_cost_per_token" yaml:"output_cost_per_token"`
+	CacheReadInputTokenCost     float64 `json:"cache_read_input_token_cost" yaml:"cache_read_input_token_cost"`
+	CacheCreationInputTokenCost float64 `json:"cache_creation_input_token_cost" yaml:"cache_creation_input_token_cost"`
+	OutputCostPerReasoningToken float64 `json:"output_cost_per_reasoning_token" yaml:"output_cost_per_reasoning_token"`
+	MaxInputTokens              int     `json:"max_input_tokens" yaml:"max_input_tokens"`
+	MaxOutputTokens             int     `json:"max_output_tokens" yaml:"max_output_tokens"`
+
+	// Prices for requests above TierThresholdTokens input tokens, read from
+	// LiteLLM's *_above_<N>k_tokens fields
+	TierThresholdTokens         int     `json:"tier_threshold_tokens" yaml:"tier_threshold_tokens"`
+	TierInputCostPerToken       float64 `json:"tier_input_cost_per_token" yaml:"tier_input_cost_per_token"`
+	TierOutputCostPerToken      float64 `json:"tier_output_cost_per_token" yaml:"tier_output_cost_per_token"`
+	TierCacheReadInputTokenCost float64 `json:"tier_cache_read_input_token_cost" yaml:"tier_cache_read_input_token_cost"`
 }
 
 // PricingService manages automatic pricing updates
@@ -45,6 +52,9 @@ type PricingService struct {
 	pricingData map[string]*LiteLLMPricing
 	lastUpdated time.Time
 	localHash   string
+	source      Source
+	loadedFrom  string // Source the current data came from, or "cache"
+	cacheDir    string
 	stopCh      chan struct{}
 	wg          sync.WaitGroup
 }
@@ -59,16 +69,41 @@ func GetService() *PricingService {
 	once.Do(func() {
 		service = &PricingService{
 			pricingData: make(map[string]*LiteLLMPricing),
+			source:      &urlSource{url: defaultPricingURL},
+			cacheDir:    defaultCacheDir,
 			stopCh:      make(chan struct{}),
 		}
 	})
 	return service
 }
 
+// Configure sets where pricing data comes from; call before Initialize
+func (s *PricingService) Configure(opts Options) error {
+	source, err := NewSource(opts.Source, opts)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.source = source
+	if opts.CacheDir != "" {
+		s.cacheDir = opts.CacheDir
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Source returns the configured pricing source
+func (s *PricingService) Source() Source {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.source
+}
+
 // Initialize starts the pricing service
 func (s *PricingService) Initialize() error {
 	// Ensure cache directory exists
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+	if err := os.MkdirAll(s.cacheDir, 0755); err != nil {
 		log.Printf("[Pricing] Failed to create cache directory: %v", err)
 	}
 
@@ -92,9 +127,10 @@ func (s *PricingService) Stop() {
 	log.Println("[Pricing] Service stopped")
 }
 
-// loadPricing loads pricing from cache or downloads it
+// loadPricing loads pricing from cache or fetches it. When the source is
+// unreachable, stale cached prices are used, then the bundled manifest.
 func (s *PricingService) loadPricing() error {
-	cacheFile := filepath.Join(cacheDir, "pricing.json")
+	cacheFile := filepath.Join(s.cacheDir, "pricing.json")
 
 	// Check if cache exists and is recent
 	if info, err := os.Stat(cacheFile); err == nil {
@@ -108,54 +144,112 @@ func (s *PricingService) loadPricing() error {
 		}
 	}
 
-	// Download fresh pricing
-	log.Println("[Pricing] Downloading fresh pricing data...")
-	return s.downloadPricing()
-}
+	// Fetch fresh pricing
+	err := s.refresh()
+	if err == nil {
+		return nil
+	}
+	log.Printf("[Pricing] Fetching from %s source failed: %v", s.Source().Name(), err)
 
-// downloadPricing downloads pricing from LiteLLM
-func (s *PricingService) downloadPricing() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if cacheErr := s.loadFromFile(cacheFile); cacheErr == nil {
+		log.Println("[Pricing] Using stale cached pricing")
+		return nil
+	}
+	if s.Source().Name() == SourceManifest {
+		return err
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", defaultPricingURL, nil)
-	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+	// Kept in memory only, so the configured source is retried on the next check
+	data, manifestErr := manifestSource{}.Fetch(context.Background())
+	if manifestErr != nil {
+		return err
 	}
+	s.mu.Lock()
+	s.pricingData = data
+	s.loadedFrom = SourceManifest
+	s.mu.Unlock()
+	log.Printf("[Pricing] Using the bundled manifest with %d models", len(data))
+	return nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// refresh fetches pricing from the configured source and syncs it to the database
+func (s *PricingService) refresh() error {
+	source := s.Source()
+	log.Printf("[Pricing] Fetching fresh pricing data from %s source...", source.Name())
+
+	data, err := source.Fetch(context.Background())
 	if err != nil {
-		return fmt.Errorf("download failed: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
+	s.store(data, source.Name())
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
-	}
+	// Sync to database
+	go s.syncToDatabase()
 
-	body, err := io.ReadAll(resp.Body)
+	log.Printf("[Pricing] Fetched %d models successfully", len(data))
+	return nil
+}
+
+// SyncResult is what a pricing preview or sync found, and what it applied
+type SyncResult struct {
+	DryRun     bool          `json:"dry_run"`
+	Source     string        `json:"source"`
+	ModelCount int           `json:"model_count"`
+	Changes    []PriceChange `json:"changes"`
+	Applied    int           `json:"applied"`
+}
+
+// Preview fetches pricing from a source and returns the database changes a
+// sync would make, without applying them
+func (s *PricingService) Preview(ctx context.Context, source Source) (*SyncResult, error) {
+	data, err := source.Fetch(ctx)
 	if err != nil {
-		return fmt.Errorf("read body: %w", err)
+		return nil, err
 	}
+	return &SyncResult{
+		DryRun:     true,
+		Source:     source.Name(),
+		ModelCount: len(data),
+		Changes:    planSync(data),
+	}, nil
+}
 
-	// Parse pricing data
-	data, err := s.parsePricing(body)
+// Sync fetches pricing from a source, makes it the service's data and applies
+// the resulting changes to the database
+func (s *PricingService) Sync(ctx context.Context, source Source) (*SyncResult, error) {
+	data, err := source.Fetch(ctx)
 	if err != nil {
-		return fmt.Errorf("parse pricing: %w", err)
+		return nil, err
 	}
+	s.store(data, source.Name())
+
+	changes := planSync(data)
+	return &SyncResult{
+		Source:     source.Name(),
+		ModelCount: len(data),
+		Changes:    changes,
+		Applied:    applySync(changes),
+	}, nil
+}
 
-	// Save to cache
-	cacheFile := filepath.Join(cacheDir, "pricing.json")
-	if err := os.WriteFile(cacheFile, body, 0644); err != nil {
-		log.Printf("[Pricing] Failed to save cache: %v", err)
+// store replaces the in-memory pricing and caches it as LiteLLM JSON, so
+// restarts without access to the source keep the last prices
+func (s *PricingService) store(data map[string]*LiteLLMPricing, sourceName string) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("[Pricing] Failed to encode cache: %v", err)
 	}
 
 	// Calculate and save hash
 	hash := sha256.Sum256(body)
 	hashStr := hex.EncodeToString(hash[:])
-	hashFile := filepath.Join(cacheDir, "pricing.sha256")
-	if err := os.WriteFile(hashFile, []byte(hashStr), 0644); err != nil {
-		log.Printf("[Pricing] Failed to save hash: %v", err)
+	if err == nil {
+		if err := os.WriteFile(filepath.Join(s.cacheDir, "pricing.json"), body, 0644); err != nil {
+			log.Printf("[Pricing] Failed to save cache: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(s.cacheDir, "pricing.sha256"), []byte(hashStr), 0644); err != nil {
+			log.Printf("[Pricing] Failed to save hash: %v", err)
+		}
 	}
 
 	// Update in-memory data
@@ -163,13 +257,8 @@ func (s *PricingService) downloadPricing() error {
 	s.pricingData = data
 	s.lastUpdated = time.Now()
 	s.localHash = hashStr
+	s.loadedFrom = sourceName
 	s.mu.Unlock()
-
-	// Sync to database
-	go s.syncToDatabase()
-
-	log.Printf("[Pricing] Downloaded %d models successfully", len(data))
-	return nil
 }
 
 // loadFromFile loads pricing from a local file
@@ -179,7 +268,7 @@ func (s *PricingService) loadFromFile(filePath string) error {
 		return fmt.Errorf("read file: %w", err)
 	}
 
-	pricingData, err := s.parsePricing(data)
+	pricingData, err := parseLiteLLM(data)
 	if err != nil {
 		return fmt.Errorf("parse pricing: %w", err)
 	}
@@ -191,6 +280,7 @@ func (s *PricingService) loadFromFile(filePath string) error {
 	s.mu.Lock()
 	s.pricingData = pricingData
 	s.localHash = hashStr
+	s.loadedFrom = "cache"
 	if info, err := os.Stat(filePath); err == nil {
 		s.lastUpdated = info.ModTime()
 	}
@@ -199,87 +289,34 @@ func (s *PricingService) loadFromFile(filePath string) error {
 	return nil
 }
 
-// parsePricing parses LiteLLM pricing JSON
-func (s *PricingService) parsePricing(data []byte) (map[string]*LiteLLMPricing, error) {
-	var rawData map[string]json.RawMessage
-	if err := json.Unmarshal(data, &rawData); err != nil {
-		return nil, err
-	}
-
-	result := make(map[string]*LiteLLMPricing)
-
-	for modelName, rawEntry := range rawData {
-		// Skip documentation entries
-		if modelName == "sample_spec" {
-			continue
-		}
-
-		var pricing LiteLLMPricing
-		if err := json.Unmarshal(rawEntry, &pricing); err != nil {
-			continue
-		}
-
-		// Only keep entries with valid pricing
-		if pricing.InputCostPerToken > 0 || pricing.OutputCostPerToken > 0 {
-			result[strings.ToLower(modelName)] = &pricing
-		}
-	}
-
-	return result, nil
-}
-
-// syncToDatabase syncs pricing to database
+// syncToDatabase syncs pricing to database, auditing any changes
 func (s *PricingService) syncToDatabase() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	log.Println("[Pricing] Syncing to database...")
 
-	synced := 0
-	updated := 0
+	s.mu.RLock()
+	changes := planSync(s.pricingData)
+	source := s.loadedFrom
+	s.mu.RUnlock()
 
-	for modelName, pricing := range s.pricingData {
-		// Only sync Codex models
-		if !strings.Contains(modelName, "codex") && !strings.Contains(modelName, "gpt-5") {
-			continue
+	synced := 0
+	for _, change := range changes {
+		if change.Action == ChangeCreate {
+			synced++
 		}
+	}
+	applied := applySync(changes)
 
-		inputPrice := pricing.InputCostPerToken * 1000  // Convert to per 1K
-		outputPrice := pricing.OutputCostPerToken * 1000
-
-		// Check if model exists
-		var existing models.ModelPricing
-		result := database.DB.Where("model_name = ?", modelName).First(&existing)
+	log.Printf("[Pricing] Synced %d new models, updated %d existing models", synced, len(changes)-synced)
+	if applied < len(changes) {
+		log.Printf("[Pricing] %d changes failed to apply", len(changes)-applied)
+	}
 
-		if result.Error != nil {
-			// Create new pricing entry
-			newPricing := models.ModelPricing{
-				ModelName:        modelName,
-				InputPricePer1k:  inputPrice,
-				OutputPricePer1k: outputPrice,
-				MarkupMultiplier: 1.5,
-			}
-			if err := database.DB.Create(&newPricing).Error; err != nil {
-				log.Printf("[Pricing] Failed to create %s: %v", modelName, err)
-				continue
-			}
-			synced++
-		} else {
-			// Update existing pricing if changed
-			if existing.InputPricePer1k != inputPrice || existing.OutputPricePer1k != outputPrice {
-				existing.InputPricePer1k = inputPrice
-				existing.OutputPricePer1k = outputPrice
-				if err := database.DB.Save(&existing).Error; err != nil {
-					log.Printf("[Pricing] Failed to update %s: %v", modelName, err)
-					continue
-				}
-				updated++
-				log.Printf("[Pricing] Updated %s: input=$%.6f, output=$%.6f", modelName, inputPrice/1000, outputPrice/1000)
-			}
+	if len(changes) > 0 {
+		entry := SyncAuditLog(source, changes, applied)
+		if err := database.DB.Create(&entry).Error; err != nil {
+			log.Printf("[Pricing] Failed to audit sync: %v", err)
 		}
 	}
-
-	log.Printf("[Pricing] Synced %d new models, updated %d existing models", synced, updated)
 }
 
 // startUpdater starts the background update task
@@ -305,7 +342,7 @@ func (s *PricingService) startUpdater() {
 	log.Printf("[Pricing] Background updater started (check every %v)", checkInterval)
 }
 
-// checkAndUpdate checks if update is needed and downloads if necessary
+// checkAndUpdate checks if update is needed and fetches if necessary
 func (s *PricingService) checkAndUpdate() error {
 	s.mu.RLock()
 	lastUpdate := s.lastUpdated
@@ -316,8 +353,8 @@ func (s *PricingService) checkAndUpdate() error {
 		return nil
 	}
 
-	log.Println("[Pricing] Update interval reached, downloading...")
-	return s.downloadPricing()
+	log.Println("[Pricing] Update interval reached, fetching...")
+	return s.refresh()
 }
 
 // GetModelPricing returns pricing for a model (with fuzzy matching)
@@ -350,6 +387,13 @@ func (s *PricingService) GetModelPricing(modelName string) *LiteLLMPricing {
 	return nil
 }
 
+// LastUpdated returns when pricing data was last fetched or loaded from cache
+func (s *PricingService) LastUpdated() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastUpdated
+}
+
 // GetStatus returns service status
 func (s *PricingService) GetStatus() map[string]interface{} {
 	s.mu.RLock()
@@ -359,6 +403,8 @@ func (s *PricingService) GetStatus() map[string]interface{} {
 		"model_count":  len(s.pricingData),
 		"last_updated": s.lastUpdated,
 		"local_hash":   s.localHash[:min(8, len(s.localHash))],
+		"source":       s.source.Name(),
+		"loaded_from":  s.loadedFrom,
 	}
 }
 
@@ -0,0 +1,289 @@
+package pricing
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source names accepted by NewSource
+const (
+	SourceLiteLLM  = "litellm"
+	SourceFile     = "file"
+	SourceManifest = "manifest"
+)
+
+// manifestYAML is the price list shipped with the gateway, used on hosts that
+// cannot reach LiteLLM
+//
+//go:embed manifest.yaml
+var manifestYAML []byte
+
+// Source supplies model prices in LiteLLM's per-token form
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) (map[string]*LiteLLMPricing, error)
+}
+
+// Options configures where the pricing service gets its data
+type Options struct {
+	Source   string // litellm, file or manifest
+	URL      string // LiteLLM JSON URL; the public LiteLLM list when empty
+	Path     string // File or directory read by the file source
+	CacheDir string // Where the last fetched prices are kept
+}
+
+// NewSource returns the named source configured from opts
+func NewSource(name string, opts Options) (Source, error) {
+	switch name {
+	case SourceLiteLLM, "":
+		url := opts.URL
+		if url == "" {
+			url = defaultPricingURL
+		}
+		return &urlSource{url: url}, nil
+	case SourceFile:
+		if opts.Path == "" {
+			return nil, fmt.Errorf("PRICING_PATH is required for the file pricing source")
+		}
+		return &fileSource{path: opts.Path}, nil
+	case SourceManifest:
+		return manifestSource{}, nil
+	}
+	return nil, fmt.Errorf("unknown pricing source %q", name)
+}
+
+// NewUploadSource returns a source serving an uploaded file. YAML manifests
+// are recognised by their .yaml or .yml extension; anything else is read as
+// LiteLLM JSON.
+func NewUploadSource(filename string, data []byte) Source {
+	return &uploadSource{filename: filename, data: data}
+}
+
+// urlSource downloads LiteLLM's model_prices_and_context_window.json format
+type urlSource struct {
+	url string
+}
+
+func (s *urlSource) Name() string {
+	return SourceLiteLLM
+}
+
+func (s *urlSource) Fetch(ctx context.Context) (map[string]*LiteLLMPricing, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return parseLiteLLM(body)
+}
+
+// fileSource reads a price file, or every .json, .yaml and .yml file in a
+// directory with later files (by name) overriding earlier ones
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) Name() string {
+	return SourceFile
+}
+
+func (s *fileSource) Fetch(ctx context.Context) (map[string]*LiteLLMPricing, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readPriceFile(s.path)
+	}
+
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no pricing files in %s", s.path)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]*LiteLLMPricing)
+	for _, name := range names {
+		data, err := readPriceFile(filepath.Join(s.path, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for model, pricing := range data {
+			result[model] = pricing
+		}
+	}
+	return result, nil
+}
+
+func readPriceFile(path string) (map[string]*LiteLLMPricing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseByName(path, data)
+}
+
+// manifestSource serves the embedded manifest.yaml
+type manifestSource struct{}
+
+func (manifestSource) Name() string {
+	return SourceManifest
+}
+
+func (manifestSource) Fetch(ctx context.Context) (map[string]*LiteLLMPricing, error) {
+	return parseManifest(manifestYAML)
+}
+
+// uploadSource serves a file an admin uploaded
+type uploadSource struct {
+	filename string
+	data     []byte
+}
+
+func (s *uploadSource) Name() string {
+	return "upload"
+}
+
+func (s *uploadSource) Fetch(ctx context.Context) (map[string]*LiteLLMPricing, error) {
+	return parseByName(s.filename, s.data)
+}
+
+// parseByName parses YAML manifests by extension and LiteLLM JSON otherwise
+func parseByName(name string, data []byte) (map[string]*LiteLLMPricing, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return parseManifest(data)
+	}
+	return parseLiteLLM(data)
+}
+
+// parseLiteLLM parses LiteLLM pricing JSON, keeping entries with a price
+func parseLiteLLM(data []byte) (map[string]*LiteLLMPricing, error) {
+	var rawData map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rawData); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*LiteLLMPricing)
+	for modelName, rawEntry := range rawData {
+		// Skip documentation entries
+		if modelName == "sample_spec" {
+			continue
+		}
+
+		var pricing LiteLLMPricing
+		if err := json.Unmarshal(rawEntry, &pricing); err != nil {
+			continue
+		}
+		if pricing.TierThresholdTokens == 0 {
+			parseTier(rawEntry, &pricing)
+		}
+		if pricing.InputCostPerToken > 0 || pricing.OutputCostPerToken > 0 {
+			result[strings.ToLower(modelName)] = &pricing
+		}
+	}
+	return result, nil
+}
+
+// tierFieldPattern matches LiteLLM's tiered price fields, such as
+// input_cost_per_token_above_200k_tokens
+var tierFieldPattern = regexp.MustCompile(`^(input_cost_per_token|output_cost_per_token|cache_read_input_token_cost)_above_(\d+)k_tokens$`)
+
+// parseTier fills the tier from a LiteLLM entry's *_above_<N>k_tokens fields.
+// Only the lowest threshold is kept.
+func parseTier(rawEntry json.RawMessage, pricing *LiteLLMPricing) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rawEntry, &fields); err != nil {
+		return
+	}
+
+	tiers := make(map[int]map[string]float64)
+	for name, raw := range fields {
+		match := tierFieldPattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		var cost float64
+		if err := json.Unmarshal(raw, &cost); err != nil || cost <= 0 {
+			continue
+		}
+		threshold, _ := strconv.Atoi(match[2])
+		threshold *= 1000
+		if tiers[threshold] == nil {
+			tiers[threshold] = make(map[string]float64)
+		}
+		tiers[threshold][match[1]] = cost
+	}
+
+	for threshold, costs := range tiers {
+		if pricing.TierThresholdTokens != 0 && threshold > pricing.TierThresholdTokens {
+			continue
+		}
+		pricing.TierThresholdTokens = threshold
+		pricing.TierInputCostPerToken = costs["input_cost_per_token"]
+		pricing.TierOutputCostPerToken = costs["output_cost_per_token"]
+		pricing.TierCacheReadInputTokenCost = costs["cache_read_input_token_cost"]
+	}
+}
+
+// parseManifest parses a YAML manifest: a map of model name to LiteLLM fields
+func parseManifest(data []byte) (map[string]*LiteLLMPricing, error) {
+	var raw map[string]*LiteLLMPricing
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*LiteLLMPricing, len(raw))
+	for modelName, pricing := range raw {
+		if pricing == nil {
+			continue
+		}
+		if pricing.InputCostPerToken < 0 || pricing.OutputCostPerToken < 0 {
+			return nil, fmt.Errorf("negative price for %s", modelName)
+		}
+		result[strings.ToLower(modelName)] = pricing
+	}
+	return result, nil
+}
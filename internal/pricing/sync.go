@@ -0,0 +1,238 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Price change actions
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+)
+
+// PriceChange is a ModelPricing row a sync would create or give a new version
+type PriceChange struct {
+	ModelName string        `json:"model_name"`
+	Action    string        `json:"action"` // create, update
+	Fields    []FieldChange `json:"fields"`
+
+	current *models.ModelPricing // Version in effect when planned; nil on create
+	next    models.ModelPricing
+}
+
+// FieldChange is one ModelPricing column a sync changes
+type FieldChange struct {
+	Field string   `json:"field"`
+	Old   *float64 `json:"old,omitempty"` // Nil on create
+	New   float64  `json:"new"`
+}
+
+// syncedModel reports whether a model's price is synced to the database
+func syncedModel(modelName string) bool {
+	// Only sync Codex models
+	return strings.Contains(modelName, "codex") || strings.Contains(modelName, "gpt-5")
+}
+
+// per1k converts a per-token cost to the per-1K price stored in the database,
+// rounded to its precision so unchanged prices compare equal
+func per1k(costPerToken float64) float64 {
+	return math.Round(costPerToken*1000*1e6) / 1e6
+}
+
+// applyTo copies the prices and limits the source provides onto a version.
+// Fields the source leaves empty keep their current value.
+func (p *LiteLLMPricing) applyTo(version *models.ModelPricing) {
+	set := func(dst *float64, costPerToken float64) {
+		if costPerToken > 0 {
+			*dst = per1k(costPerToken)
+		}
+	}
+	set(&version.InputPricePer1k, p.InputCostPerToken)
+	set(&version.OutputPricePer1k, p.OutputCostPerToken)
+	set(&version.CacheReadPricePer1k, p.CacheReadInputTokenCost)
+	set(&version.CacheCreationPricePer1k, p.CacheCreationInputTokenCost)
+	set(&version.ReasoningPricePer1k, p.OutputCostPerReasoningToken)
+
+	if p.TierThresholdTokens > 0 {
+		version.TierThresholdTokens = p.TierThresholdTokens
+		set(&version.TierInputPricePer1k, p.TierInputCostPerToken)
+		set(&version.TierOutputPricePer1k, p.TierOutputCostPerToken)
+		set(&version.TierCacheReadPricePer1k, p.TierCacheReadInputTokenCost)
+	}
+
+	if p.MaxInputTokens > 0 {
+		version.MaxInputTokens = p.MaxInputTokens
+	}
+	if p.MaxOutputTokens > 0 {
+		version.MaxOutputTokens = p.MaxOutputTokens
+	}
+}
+
+// syncedFields lists the columns a sync compares, in display order
+func syncedFields(v *models.ModelPricing) []FieldChange {
+	return []FieldChange{
+		{Field: "input_price_per_1k", New: v.InputPricePer1k},
+		{Field: "output_price_per_1k", New: v.OutputPricePer1k},
+		{Field: "cache_read_price_per_1k", New: v.CacheReadPricePer1k},
+		{Field: "cache_creation_price_per_1k", New: v.CacheCreationPricePer1k},
+		{Field: "reasoning_price_per_1k", New: v.ReasoningPricePer1k},
+		{Field: "tier_threshold_tokens", New: float64(v.TierThresholdTokens)},
+		{Field: "tier_input_price_per_1k", New: v.TierInputPricePer1k},
+		{Field: "tier_output_price_per_1k", New: v.TierOutputPricePer1k},
+		{Field: "tier_cache_read_price_per_1k", New: v.TierCacheReadPricePer1k},
+		{Field: "max_input_tokens", New: float64(v.MaxInputTokens)},
+		{Field: "max_output_tokens", New: float64(v.MaxOutputTokens)},
+	}
+}
+
+// planSync compares source prices with the prices in effect, returning the
+// changes a sync would make ordered by model name
+func planSync(data map[string]*LiteLLMPricing) []PriceChange {
+	var changes []PriceChange
+	for modelName, pricing := range data {
+		if !syncedModel(modelName) {
+			continue
+		}
+
+		existing, err := database.PriceAt(modelName, time.Now())
+		if err != nil {
+			next := models.ModelPricing{ModelName: modelName, MarkupMultiplier: 1.5}
+			pricing.applyTo(&next)
+			// Without cache prices from the source, cached tokens cost as much
+			// as other input rather than nothing
+			if next.CacheReadPricePer1k == 0 {
+				next.CacheReadPricePer1k = next.InputPricePer1k
+			}
+			if next.CacheCreationPricePer1k == 0 {
+				next.CacheCreationPricePer1k = next.InputPricePer1k
+			}
+
+			var fields []FieldChange
+			for _, field := range syncedFields(&next) {
+				if field.New != 0 {
+					fields = append(fields, field)
+				}
+			}
+			changes = append(changes, PriceChange{ModelName: modelName, Action: ChangeCreate, Fields: fields, next: next})
+			continue
+		}
+
+		next := *existing
+		pricing.applyTo(&next)
+
+		var fields []FieldChange
+		old := syncedFields(existing)
+		for i, field := range syncedFields(&next) {
+			if field.New != old[i].New {
+				field.Old = &old[i].New
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			changes = append(changes, PriceChange{ModelName: modelName, Action: ChangeUpdate, Fields: fields, current: existing, next: next})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ModelName < changes[j].ModelName })
+	return changes
+}
+
+// errPriceChanged is returned when the price in effect changed between
+// planning and applying a sync, so the planned version would overwrite it
+var errPriceChanged = errors.New("price changed since the sync was planned")
+
+// applySync writes planned changes as new price versions effective now,
+// keeping the old versions for past usage. Each change is applied in its own
+// transaction, so a failure leaves the model's versions as they were and the
+// other changes still apply. Returns the number applied.
+func applySync(changes []PriceChange) int {
+	applied := 0
+	for _, change := range changes {
+		version := change.next
+		version.EffectiveFrom = time.Time{}
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := checkUnchanged(tx, change); err != nil {
+				return err
+			}
+			return database.AddPriceVersion(tx, &version)
+		})
+		if err != nil {
+			log.Printf("[Pricing] Failed to %s %s: %v", change.Action, change.ModelName, err)
+			continue
+		}
+		if change.Action == ChangeUpdate {
+			log.Printf("[Pricing] Updated %s: input=$%.6f, output=$%.6f", change.ModelName, version.InputPricePer1k/1000, version.OutputPricePer1k/1000)
+		}
+		applied++
+	}
+
+	if applied > 0 {
+		Invalidate()
+	}
+	return applied
+}
+
+// checkUnchanged verifies that the version in effect is still the one the
+// change was planned against, locking it until the transaction ends
+func checkUnchanged(tx *gorm.DB, change PriceChange) error {
+	var current models.ModelPricing
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Scopes(database.EffectiveAt(time.Now())).
+		Where("model_name = ?", change.ModelName).
+		Order("effective_from DESC").
+		First(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if change.current != nil {
+			return errPriceChanged
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if change.current == nil || change.current.ID != current.ID {
+		return errPriceChanged
+	}
+	return nil
+}
+
+// SyncAuditLog builds the admin log entry recording a sync from source. The
+// caller sets the admin and IP address when an admin started the sync.
+func SyncAuditLog(source string, changes []PriceChange, applied int) models.AdminLog {
+	created := 0
+	for _, change := range changes {
+		if change.Action == ChangeCreate {
+			created++
+		}
+	}
+
+	details, err := json.Marshal(map[string]interface{}{
+		"created": created,
+		"updated": len(changes) - created,
+		"failed":  len(changes) - applied,
+		"changes": changes,
+	})
+	if err != nil {
+		details = []byte(fmt.Sprintf("created %d, updated %d", created, len(changes)-created))
+	}
+
+	return models.AdminLog{
+		Action:  "sync_pricing",
+		Target:  source,
+		Details: string(details),
+	}
+}
@@ -0,0 +1,165 @@
+package pricing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/database/databasetest"
+	"codex-gateway/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// useDB gives a test an empty pricing database
+func useDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return databasetest.Use(t, &models.ModelPricing{}, &models.PricingRule{})
+}
+
+// addVersion stores a price version that took effect an hour ago
+func addVersion(t *testing.T, version models.ModelPricing) models.ModelPricing {
+	t.Helper()
+	version.EffectiveFrom = time.Now().Add(-time.Hour)
+	if err := database.AddPriceVersion(database.DB, &version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestPlanSync(t *testing.T) {
+	useDB(t)
+	addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: 0.00125, OutputPricePer1k: 0.01, MarkupMultiplier: 1.5})
+	addVersion(t, models.ModelPricing{ModelName: "gpt-5.1-codex", InputPricePer1k: 0.00125, OutputPricePer1k: 0.01, MarkupMultiplier: 1.5})
+
+	changes := planSync(map[string]*LiteLLMPricing{
+		// New model without cache prices
+		"gpt-5.2": {InputCostPerToken: 0.00000175, OutputCostPerToken: 0.000014},
+		// Output price raised
+		"gpt-5.1": {InputCostPerToken: 0.00000125, OutputCostPerToken: 0.000012},
+		// Unchanged
+		"gpt-5.1-codex": {InputCostPerToken: 0.00000125, OutputCostPerToken: 0.00001},
+		// Not synced
+		"claude-sonnet-4-5": {InputCostPerToken: 0.000003, OutputCostPerToken: 0.000015},
+	})
+
+	old := 0.01
+	want := []PriceChange{
+		{ModelName: "gpt-5.1", Action: ChangeUpdate, Fields: []FieldChange{
+			{Field: "output_price_per_1k", Old: &old, New: 0.012},
+		}},
+		{ModelName: "gpt-5.2", Action: ChangeCreate, Fields: []FieldChange{
+			{Field: "input_price_per_1k", New: 0.00175},
+			{Field: "output_price_per_1k", New: 0.014},
+			{Field: "cache_read_price_per_1k", New: 0.00175},
+			{Field: "cache_creation_price_per_1k", New: 0.00175},
+		}},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("planned %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i := range want {
+		got := changes[i]
+		if got.ModelName != want[i].ModelName || got.Action != want[i].Action || !reflect.DeepEqual(got.Fields, want[i].Fields) {
+			t.Errorf("change %d = %s %s %+v, want %s %s %+v", i, got.Action, got.ModelName, got.Fields,
+				want[i].Action, want[i].ModelName, want[i].Fields)
+		}
+	}
+}
+
+func TestApplySync(t *testing.T) {
+	useDB(t)
+	previous := addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", InputPricePer1k: 0.00125, OutputPricePer1k: 0.01, MarkupMultiplier: 1.5})
+
+	changes := planSync(map[string]*LiteLLMPricing{
+		"gpt-5.1": {InputCostPerToken: 0.00000125, OutputCostPerToken: 0.000012},
+		"gpt-5.2": {InputCostPerToken: 0.00000175, OutputCostPerToken: 0.000014},
+	})
+	if applied := applySync(changes); applied != 2 {
+		t.Fatalf("applied %d changes, want 2", applied)
+	}
+
+	var old models.ModelPricing
+	if err := database.DB.First(&old, previous.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if old.EffectiveTo == nil {
+		t.Error("the superseded version was not ended")
+	}
+	if old.OutputPricePer1k != 0.01 {
+		t.Errorf("the superseded version was rewritten: output = %v", old.OutputPricePer1k)
+	}
+
+	for model, wantOutput := range map[string]float64{"gpt-5.1": 0.012, "gpt-5.2": 0.014} {
+		current, err := PriceAt(model, time.Now())
+		if err != nil || current.OutputPricePer1k != wantOutput {
+			t.Errorf("cached %s price = %v, %v; want output %v", model, current, err, wantOutput)
+		}
+	}
+}
+
+func TestApplySyncSkipsPriceChangedSincePlanning(t *testing.T) {
+	useDB(t)
+	addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", OutputPricePer1k: 0.01, MarkupMultiplier: 1.5})
+
+	changes := planSync(map[string]*LiteLLMPricing{
+		"gpt-5.1": {OutputCostPerToken: 0.000012},
+		"gpt-5.2": {OutputCostPerToken: 0.000014},
+	})
+
+	// An admin edits gpt-5.1 and creates gpt-5.2 before the sync applies
+	for _, model := range []string{"gpt-5.1", "gpt-5.2"} {
+		edit := models.ModelPricing{ModelName: model, OutputPricePer1k: 0.02, MarkupMultiplier: 2}
+		if err := database.AddPriceVersion(database.DB, &edit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if applied := applySync(changes); applied != 0 {
+		t.Errorf("applied %d changes over the admin's edits", applied)
+	}
+	for _, model := range []string{"gpt-5.1", "gpt-5.2"} {
+		current, err := database.PriceAt(model, time.Now())
+		if err != nil || current.OutputPricePer1k != 0.02 {
+			t.Errorf("%s price = %v, %v; want the admin's edit kept", model, current, err)
+		}
+	}
+}
+
+func TestApplySyncRollsBackFailedChange(t *testing.T) {
+	db := useDB(t)
+	previous := addVersion(t, models.ModelPricing{ModelName: "gpt-5.1-codex", OutputPricePer1k: 0.01, MarkupMultiplier: 1.5})
+	addVersion(t, models.ModelPricing{ModelName: "gpt-5.1", OutputPricePer1k: 0.01, MarkupMultiplier: 1.5})
+
+	changes := planSync(map[string]*LiteLLMPricing{
+		"gpt-5.1-codex": {OutputCostPerToken: 0.000012},
+		"gpt-5.1":       {OutputCostPerToken: 0.000012},
+	})
+
+	// Fail inserting the new gpt-5.1-codex version, after its predecessor was ended
+	err := db.Callback().Create().Before("gorm:create").Register("test:fail_codex", func(tx *gorm.DB) {
+		if version, ok := tx.Statement.Dest.(*models.ModelPricing); ok && version.ModelName == "gpt-5.1-codex" {
+			tx.AddError(errors.New("insert failed"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if applied := applySync(changes); applied != 1 {
+		t.Fatalf("applied %d changes, want only gpt-5.1", applied)
+	}
+
+	var versions []models.ModelPricing
+	if err := database.DB.Where("model_name = ?", "gpt-5.1-codex").Find(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].ID != previous.ID || versions[0].EffectiveTo != nil {
+		t.Errorf("gpt-5.1-codex versions = %+v, want the previous version still open", versions)
+	}
+	if current, err := database.PriceAt("gpt-5.1", time.Now()); err != nil || current.OutputPricePer1k != 0.012 {
+		t.Errorf("gpt-5.1 price = %v, %v; want the synced price", current, err)
+	}
+}
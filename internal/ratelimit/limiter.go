@@ -0,0 +1,284 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"codex-gateway/internal/logger"
+	"codex-gateway/internal/statestore"
+
+	"github.com/google/uuid"
+)
+
+// slotTTL is how long a concurrency slot is held at most, reclaiming slots held
+// by a replica that died mid-request. Requests running longer stop counting
+// against the concurrency limit.
+const slotTTL = 10 * time.Minute
+
+// Rejection reasons
+const (
+	ReasonRequests    = "requests"
+	ReasonTokens      = "tokens"
+	ReasonConcurrency = "concurrency"
+)
+
+// Request describes a request to admit
+type Request struct {
+	UserID          uuid.UUID
+	APIKeyID        uint
+	Model           string
+	EstimatedTokens int // Counted against TPM up front, reconciled on Release
+	KeyRPM          int // The key's own requests-per-minute cap, 0 = none
+
+	// CountTokens, when set, replaces EstimatedTokens. It is called once the
+	// request limits have passed, so rejected requests are never tokenized.
+	CountTokens func() int
+}
+
+// Decision is the outcome of Acquire, with the values reported in headers
+type Decision struct {
+	Allowed    bool
+	Reason     string        // Which limit rejected the request
+	RetryAfter time.Duration // When the rejected request could succeed
+
+	// Tightest request and token budgets seen (limit 0 = not limited)
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration
+}
+
+// Message describes a rejection for the client
+func (d Decision) Message() string {
+	switch d.Reason {
+	case ReasonTokens:
+		return fmt.Sprintf("rate limit exceeded: tokens per minute (limit %d)", d.LimitTokens)
+	case ReasonConcurrency:
+		return "rate limit exceeded: too many concurrent requests"
+	default:
+		return fmt.Sprintf("rate limit exceeded: requests per minute (limit %d)", d.LimitRequests)
+	}
+}
+
+// Headers returns the x-ratelimit-* headers (and Retry-After when rejected)
+func (d Decision) Headers() map[string]string {
+	headers := make(map[string]string)
+	if d.LimitRequests > 0 {
+		headers["x-ratelimit-limit-requests"] = strconv.Itoa(d.LimitRequests)
+		headers["x-ratelimit-remaining-requests"] = strconv.Itoa(d.RemainingRequests)
+		headers["x-ratelimit-reset-requests"] = formatReset(d.ResetRequests)
+	}
+	if d.LimitTokens > 0 {
+		headers["x-ratelimit-limit-tokens"] = strconv.Itoa(d.LimitTokens)
+		headers["x-ratelimit-remaining-tokens"] = strconv.Itoa(d.RemainingTokens)
+		headers["x-ratelimit-reset-tokens"] = formatReset(d.ResetTokens)
+	}
+	if !d.Allowed {
+		headers["Retry-After"] = strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds())))
+	}
+	return headers
+}
+
+type tokenDebit struct {
+	key      string
+	rate     float64
+	capacity float64
+	amount   float64
+}
+
+// Lease holds what an admitted request took; Release returns it
+type Lease struct {
+	id       string       // Holds the lease's concurrency slots
+	requests []tokenDebit // Only refunded when the request is rejected
+	slots    []string
+	tokens   []tokenDebit
+}
+
+// Acquire checks every applicable limit and takes a request, the estimated
+// tokens and a concurrency slot from each. Request limits are checked across
+// all scopes first. On rejection nothing stays taken. State store errors fail open.
+func Acquire(req Request) (*Lease, Decision) {
+	lease := &Lease{id: uuid.NewString()}
+	decision := Decision{Allowed: true}
+
+	maybeRefresh()
+	scopes := resolve(GetConfig(), Policies(), req)
+
+	if !lease.takeRequests(scopes, &decision) {
+		return lease.reject(decision, ReasonRequests, decision.RetryAfter)
+	}
+
+	if req.CountTokens != nil {
+		req.EstimatedTokens = req.CountTokens()
+	}
+	if len(scopes) == 0 {
+		return lease, decision
+	}
+
+	store := statestore.Get()
+	ctx, cancel := statestore.Context()
+	defer cancel()
+
+	for _, scope := range scopes {
+		limits := scope.limits
+
+		if limits.TPM > 0 {
+			capacity := float64(limits.TPM)
+			rate := capacity / 60
+			amount := math.Min(float64(req.EstimatedTokens), capacity)
+			key := "ratelimit:tpm:" + scope.key
+			result, err := store.TakeTokens(ctx, key, rate, capacity, amount)
+			if err != nil {
+				logger.Component("RateLimit").Warn("state store error, allowing request", "limit", "tpm", "key", key, "error", err)
+				continue
+			}
+			decision.observeTokens(limits.TPM, result.Remaining, capacity, rate)
+			if !result.Allowed {
+				return lease.reject(decision, ReasonTokens, waitFor(amount, result.Remaining, rate))
+			}
+			lease.tokens = append(lease.tokens, tokenDebit{key: key, rate: rate, capacity: capacity, amount: amount})
+		}
+
+		if limits.MaxConcurrent > 0 {
+			key := "ratelimit:concurrent:" + scope.key
+			acquired, err := store.AcquireSlot(ctx, key, lease.id, limits.MaxConcurrent, slotTTL)
+			if err != nil {
+				logger.Component("RateLimit").Warn("state store error, allowing request", "limit", "concurrency", "key", key, "error", err)
+				continue
+			}
+			if !acquired {
+				return lease.reject(decision, ReasonConcurrency, time.Second)
+			}
+			lease.slots = append(lease.slots, key)
+		}
+	}
+
+	return lease, decision
+}
+
+// takeRequests takes one request from the RPM bucket of each scope. It
+// returns false, with the wait in decision.RetryAfter, when a bucket is empty.
+func (l *Lease) takeRequests(scopes []scopedLimits, decision *Decision) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+
+	store := statestore.Get()
+	ctx, cancel := statestore.Context()
+	defer cancel()
+
+	for _, scope := range scopes {
+		limits := scope.limits
+		if limits.RPM <= 0 {
+			continue
+		}
+
+		capacity := float64(limits.Burst)
+		if capacity <= 0 {
+			capacity = float64(limits.RPM)
+		}
+		rate := float64(limits.RPM) / 60
+		key := "ratelimit:rpm:" + scope.key
+		result, err := store.TakeTokens(ctx, key, rate, capacity, 1)
+		if err != nil {
+			logger.Component("RateLimit").Warn("state store error, allowing request", "limit", "rpm", "key", key, "error", err)
+			continue
+		}
+		decision.observeRequests(limits.RPM, result.Remaining, capacity, rate)
+		if !result.Allowed {
+			decision.RetryAfter = waitFor(1, result.Remaining, rate)
+			return false
+		}
+		l.requests = append(l.requests, tokenDebit{key: key, rate: rate, capacity: capacity, amount: 1})
+	}
+	return true
+}
+
+// Release frees the request's concurrency slots and reconciles the token
+// estimate with actual usage (0 when the request consumed nothing)
+func (l *Lease) Release(actualTokens int) {
+	if l == nil || (len(l.slots) == 0 && len(l.tokens) == 0) {
+		return
+	}
+
+	store := statestore.Get()
+	ctx, cancel := statestore.Context()
+	defer cancel()
+
+	for _, key := range l.slots {
+		if err := store.ReleaseSlot(ctx, key, l.id); err != nil {
+			logger.Component("RateLimit").Error("failed to release slot", "key", key, "error", err)
+		}
+	}
+	for _, debit := range l.tokens {
+		delta := float64(actualTokens) - debit.amount
+		if delta == 0 {
+			continue
+		}
+		if err := store.AdjustTokens(ctx, debit.key, debit.rate, debit.capacity, delta); err != nil {
+			logger.Component("RateLimit").Error("failed to reconcile tokens", "key", debit.key, "delta", delta, "error", err)
+		}
+	}
+	l.slots = nil
+	l.tokens = nil
+}
+
+// reject returns everything taken so far and builds the rejection
+func (l *Lease) reject(decision Decision, reason string, retryAfter time.Duration) (*Lease, Decision) {
+	if len(l.requests) > 0 {
+		store := statestore.Get()
+		ctx, cancel := statestore.Context()
+		for _, debit := range l.requests {
+			if err := store.AdjustTokens(ctx, debit.key, debit.rate, debit.capacity, -debit.amount); err != nil {
+				logger.Component("RateLimit").Error("failed to refund request", "key", debit.key, "error", err)
+			}
+		}
+		cancel()
+		l.requests = nil
+	}
+	l.Release(0)
+	decision.Allowed = false
+	decision.Reason = reason
+	decision.RetryAfter = retryAfter
+	return l, decision
+}
+
+// observeRequests keeps the tightest request budget for the response headers
+func (d *Decision) observeRequests(limit int, remaining, capacity, rate float64) {
+	if d.LimitRequests > 0 && int(remaining) >= d.RemainingRequests {
+		return
+	}
+	d.LimitRequests = limit
+	d.RemainingRequests = int(math.Max(0, remaining))
+	d.ResetRequests = waitFor(capacity, remaining, rate)
+}
+
+// observeTokens keeps the tightest token budget for the response headers
+func (d *Decision) observeTokens(limit int, remaining, capacity, rate float64) {
+	if d.LimitTokens > 0 && int(remaining) >= d.RemainingTokens {
+		return
+	}
+	d.LimitTokens = limit
+	d.RemainingTokens = int(math.Max(0, remaining))
+	d.ResetTokens = waitFor(capacity, remaining, rate)
+}
+
+// waitFor returns how long until a bucket holding remaining tokens has want
+func waitFor(want, remaining, rate float64) time.Duration {
+	if remaining >= want || rate <= 0 {
+		return 0
+	}
+	return time.Duration((want - remaining) / rate * float64(time.Second))
+}
+
+// formatReset renders a reset duration the way OpenAI does (e.g. "1s", "6m0s")
+func formatReset(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// useState installs limits for a test without touching the database
+func useState(t *testing.T, cfg Config, policies []models.RateLimitPolicy) {
+	t.Helper()
+	previous := load()
+	stateValue.Store(state{config: cfg, policies: policies, loadedAt: time.Now()})
+	t.Cleanup(func() { stateValue.Store(previous) })
+}
+
+// lastKeyID backs newKeyID
+var lastKeyID atomic.Uint32
+
+// newKeyID returns an API key ID no earlier test used. Counters outlive a
+// test in the process-wide state store, so repeated runs need fresh keys.
+func newKeyID() uint {
+	return uint(1000 + lastKeyID.Add(1))
+}
+
+func TestAcquireAppliesPoliciesWhileDisabled(t *testing.T) {
+	userID := uuid.New()
+	useState(t, Config{Enabled: false, RequestsPerMinute: 1}, []models.RateLimitPolicy{
+		{Scope: ScopeUser, UserID: &userID, RPM: 2},
+	})
+
+	req := Request{UserID: userID, APIKeyID: 1, Model: "gpt-5.1"}
+	for i := 0; i < 2; i++ {
+		lease, decision := Acquire(req)
+		if !decision.Allowed {
+			t.Fatalf("request %d rejected: %s", i+1, decision.Message())
+		}
+		lease.Release(0)
+	}
+
+	_, decision := Acquire(req)
+	if decision.Allowed {
+		t.Fatal("third request allowed past the user policy")
+	}
+	if decision.Reason != ReasonRequests || decision.LimitRequests != 2 {
+		t.Errorf("decision = %+v, want requests limit 2", decision)
+	}
+	if decision.Headers()["Retry-After"] == "" {
+		t.Error("rejection has no Retry-After header")
+	}
+}
+
+func TestAcquireAppliesKeyRPMWhileDisabled(t *testing.T) {
+	useState(t, Config{Enabled: false}, nil)
+
+	req := Request{UserID: uuid.New(), APIKeyID: newKeyID(), Model: "gpt-5.1", KeyRPM: 1}
+	if _, decision := Acquire(req); !decision.Allowed {
+		t.Fatalf("first request rejected: %s", decision.Message())
+	}
+	if _, decision := Acquire(req); decision.Allowed {
+		t.Fatal("second request allowed past the key's RPM")
+	}
+}
+
+func TestAcquireSkipsSystemDefaultsWhileDisabled(t *testing.T) {
+	useState(t, Config{Enabled: false, RequestsPerMinute: 1}, []models.RateLimitPolicy{
+		{Scope: ScopeSystem, RPM: 1},
+	})
+
+	req := Request{UserID: uuid.New(), APIKeyID: 43, Model: "gpt-5.1"}
+	for i := 0; i < 3; i++ {
+		if _, decision := Acquire(req); !decision.Allowed {
+			t.Fatalf("request %d rejected by disabled system limits", i+1)
+		}
+	}
+}
+
+func TestAcquireConcurrencyReleasedOnRelease(t *testing.T) {
+	userID := uuid.New()
+	useState(t, Config{Enabled: true, MaxConcurrent: 1}, nil)
+
+	req := Request{UserID: userID, APIKeyID: 44, Model: "gpt-5.1"}
+	lease, decision := Acquire(req)
+	if !decision.Allowed {
+		t.Fatal("first request rejected")
+	}
+	if _, decision := Acquire(req); decision.Allowed || decision.Reason != ReasonConcurrency {
+		t.Fatalf("second concurrent request: %+v, want concurrency rejection", decision)
+	}
+
+	lease.Release(0)
+	if _, decision := Acquire(req); !decision.Allowed {
+		t.Fatal("request rejected after the slot was released")
+	}
+}
+
+func TestAcquireRejectionRefundsEarlierScopes(t *testing.T) {
+	userID := uuid.New()
+	keyID := newKeyID()
+	// The user scope allows two requests; the key scope rejects the second,
+	// which must not keep the user scope's request
+	useState(t, Config{Enabled: true, RequestsPerMinute: 2}, []models.RateLimitPolicy{
+		{Scope: ScopeAPIKey, APIKeyID: &keyID, RPM: 1},
+	})
+
+	if _, decision := Acquire(Request{UserID: userID, APIKeyID: keyID}); !decision.Allowed {
+		t.Fatal("first request rejected")
+	}
+	if _, decision := Acquire(Request{UserID: userID, APIKeyID: keyID}); decision.Allowed {
+		t.Fatal("second request allowed past the key limit")
+	}
+	if _, decision := Acquire(Request{UserID: userID, APIKeyID: newKeyID()}); !decision.Allowed {
+		t.Fatal("user scope kept the rejected request")
+	}
+}
+
+func TestAcquireCountsTokensAfterRequestLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           Config
+		earlierTokens int // Tokens of an earlier request in the same minute; -1 for none
+		wantAllowed   bool
+		wantCounted   bool
+		wantReason    string
+	}{
+		{"nothing limited", Config{Enabled: false}, -1, true, true, ""},
+		{"admitted", Config{Enabled: true, RequestsPerMinute: 5, TokensPerMinute: 1000}, -1, true, true, ""},
+		{"rejected by requests", Config{Enabled: true, RequestsPerMinute: 1, TokensPerMinute: 1000}, 0, false, false, ReasonRequests},
+		{"rejected by counted tokens", Config{Enabled: true, RequestsPerMinute: 5, TokensPerMinute: 600}, 500, false, true, ReasonTokens},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useState(t, tt.cfg, nil)
+			userID, keyID := uuid.New(), uint(60+i)
+			if tt.earlierTokens >= 0 {
+				Acquire(Request{UserID: userID, APIKeyID: keyID, EstimatedTokens: tt.earlierTokens})
+			}
+
+			counted := false
+			_, decision := Acquire(Request{
+				UserID:   userID,
+				APIKeyID: keyID,
+				Model:    "gpt-5.1",
+				CountTokens: func() int {
+					counted = true
+					return 500
+				},
+			})
+			if decision.Allowed != tt.wantAllowed || decision.Reason != tt.wantReason {
+				t.Errorf("decision = %+v, want allowed %v, reason %q", decision, tt.wantAllowed, tt.wantReason)
+			}
+			if counted != tt.wantCounted {
+				t.Errorf("counted = %v, want %v", counted, tt.wantCounted)
+			}
+		})
+	}
+}
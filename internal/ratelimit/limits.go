@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"path"
+	"strconv"
+
+	"codex-gateway/internal/models"
+)
+
+// Limits is one set of limits enforced against one counter (0 = unlimited)
+type Limits struct {
+	RPM           int
+	Burst         int
+	TPM           int
+	MaxConcurrent int
+}
+
+func (l Limits) empty() bool {
+	return l.RPM <= 0 && l.TPM <= 0 && l.MaxConcurrent <= 0
+}
+
+// overlay applies a policy's non-zero fields on top of l
+func (l Limits) overlay(p *models.RateLimitPolicy) Limits {
+	if p == nil {
+		return l
+	}
+	if p.RPM != 0 {
+		l.RPM = p.RPM
+	}
+	if p.Burst != 0 {
+		l.Burst = p.Burst
+	}
+	if p.TPM != 0 {
+		l.TPM = p.TPM
+	}
+	if p.MaxConcurrent != 0 {
+		l.MaxConcurrent = p.MaxConcurrent
+	}
+	return l
+}
+
+// scopedLimits pairs limits with the state-store key prefix they count against
+type scopedLimits struct {
+	key    string
+	limits Limits
+}
+
+// resolve returns every set of limits that applies to a request:
+//
+//	per user, all models:   system settings ← system policy ← user policy
+//	per user, this model:   system model policy ← user model policy
+//	per key, all models:    key policy, capped by the key's own RPM
+//	per key, this model:    key model policy
+//
+// Counting system defaults per user stops users multiplying their limit by
+// creating more keys. The global switch only gates the system defaults: user
+// and key policies and the key's own RPM apply while it is off.
+func resolve(cfg Config, policies []models.RateLimitPolicy, req Request) []scopedLimits {
+	userID, apiKeyID, model := req.UserID, req.APIKeyID, req.Model
+	userKey := "user:" + userID.String()
+	apiKey := "key:" + strconv.FormatUint(uint64(apiKeyID), 10)
+
+	var base Limits
+	if cfg.Enabled {
+		base = Limits{
+			RPM:           cfg.RequestsPerMinute,
+			Burst:         cfg.Burst,
+			TPM:           cfg.TokensPerMinute,
+			MaxConcurrent: cfg.MaxConcurrent,
+		}
+	}
+
+	var (
+		systemAll, systemModel, userAll, userModel, keyAll, keyModel *models.RateLimitPolicy
+	)
+	for i := range policies {
+		p := &policies[i]
+		switch {
+		case p.Scope == ScopeSystem && cfg.Enabled:
+			pickPolicy(p, model, &systemAll, &systemModel)
+		case p.Scope == ScopeUser && p.UserID != nil && *p.UserID == userID:
+			pickPolicy(p, model, &userAll, &userModel)
+		case p.Scope == ScopeAPIKey && p.APIKeyID != nil && *p.APIKeyID == apiKeyID:
+			pickPolicy(p, model, &keyAll, &keyModel)
+		}
+	}
+
+	var result []scopedLimits
+	add := func(key string, limits Limits) {
+		if !limits.empty() {
+			result = append(result, scopedLimits{key: key, limits: limits})
+		}
+	}
+
+	add(userKey, base.overlay(systemAll).overlay(userAll))
+	if systemModel != nil || userModel != nil {
+		add(userKey+":model:"+model, Limits{}.overlay(systemModel).overlay(userModel))
+	}
+	keyLimits := Limits{}.overlay(keyAll)
+	if req.KeyRPM > 0 && (keyLimits.RPM <= 0 || req.KeyRPM < keyLimits.RPM) {
+		keyLimits.RPM = req.KeyRPM
+		if keyLimits.Burst > req.KeyRPM {
+			keyLimits.Burst = req.KeyRPM
+		}
+	}
+	add(apiKey, keyLimits)
+	if keyModel != nil {
+		add(apiKey+":model:"+model, Limits{}.overlay(keyModel))
+	}
+	return result
+}
+
+// pickPolicy files p as the all-models or model-specific policy of its scope.
+// An exact model match wins over a glob; otherwise the first match wins.
+func pickPolicy(p *models.RateLimitPolicy, model string, all, specific **models.RateLimitPolicy) {
+	if p.Model == "" {
+		if *all == nil {
+			*all = p
+		}
+		return
+	}
+	if p.Model == model {
+		if *specific == nil || (*specific).Model != model {
+			*specific = p
+		}
+		return
+	}
+	if *specific == nil {
+		if matched, _ := path.Match(p.Model, model); matched {
+			*specific = p
+		}
+	}
+}
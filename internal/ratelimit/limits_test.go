@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"reflect"
+	"testing"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestResolve(t *testing.T) {
+	userID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	otherUser := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	keyID := uint(7)
+	otherKey := uint(8)
+
+	userKey := "user:" + userID.String()
+	apiKey := "key:7"
+
+	enabled := Config{Enabled: true, RequestsPerMinute: 60, Burst: 10, TokensPerMinute: 1000, MaxConcurrent: 4}
+	disabled := enabled
+	disabled.Enabled = false
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		policies []models.RateLimitPolicy
+		keyRPM   int
+		want     []scopedLimits
+	}{
+		{
+			name: "system defaults per user",
+			cfg:  enabled,
+			want: []scopedLimits{
+				{key: userKey, limits: Limits{RPM: 60, Burst: 10, TPM: 1000, MaxConcurrent: 4}},
+			},
+		},
+		{
+			name: "nothing while disabled without policies",
+			cfg:  disabled,
+		},
+		{
+			name: "system policy ignored while disabled",
+			cfg:  disabled,
+			policies: []models.RateLimitPolicy{
+				{Scope: ScopeSystem, RPM: 5},
+				{Scope: ScopeSystem, Model: "gpt-5.1", TPM: 50},
+			},
+		},
+		{
+			name:   "key rpm while disabled",
+			cfg:    disabled,
+			keyRPM: 10,
+			want: []scopedLimits{
+				{key: apiKey, limits: Limits{RPM: 10}},
+			},
+		},
+		{
+			name: "user policy while disabled",
+			cfg:  disabled,
+			policies: []models.RateLimitPolicy{
+				{Scope: ScopeUser, UserID: &userID, RPM: 5, TPM: 100},
+				{Scope: ScopeUser, UserID: &otherUser, RPM: 1},
+			},
+			want: []scopedLimits{
+				{key: userKey, limits: Limits{RPM: 5, TPM: 100}},
+			},
+		},
+		{
+			name: "user model policy while disabled",
+			cfg:  disabled,
+			policies: []models.RateLimitPolicy{
+				{Scope: ScopeUser, UserID: &userID, Model: "gpt-5*", MaxConcurrent: 2},
+			},
+			want: []scopedLimits{
+				{key: userKey + ":model:gpt-5.1", limits: Limits{MaxConcurrent: 2}},
+			},
+		},
+		{
+			name: "key policies while disabled",
+			cfg:  disabled,
+			policies: []models.RateLimitPolicy{
+				{Scope: ScopeAPIKey, APIKeyID: &keyID, RPM: 30},
+				{Scope: ScopeAPIKey, APIKeyID: &keyID, Model: "gpt-5.1", TPM: 500},
+				{Scope: ScopeAPIKey, APIKeyID: &otherKey, RPM: 1},
+			},
+			want: []scopedLimits{
+				{key: apiKey, limits: Limits{RPM: 30}},
+				{key: apiKey + ":model:gpt-5.1", limits: Limits{TPM: 500}},
+			},
+		},
+		{
+			name: "user policy overlays system defaults",
+			cfg:  enabled,
+			policies: []models.RateLimitPolicy{
+				{Scope: ScopeSystem, TPM: 2000},
+				{Scope: ScopeUser, UserID: &userID, RPM: 120},
+			},
+			want: []scopedLimits{
+				{key: userKey, limits: Limits{RPM: 120, Burst: 10, TPM: 2000, MaxConcurrent: 4}},
+			},
+		},
+		{
+			name: "exact model beats glob",
+			cfg:  disabled,
+			policies: []models.RateLimitPolicy{
+				{Scope: ScopeUser, UserID: &userID, Model: "gpt-*", RPM: 1},
+				{Scope: ScopeUser, UserID: &userID, Model: "gpt-5.1", RPM: 2},
+			},
+			want: []scopedLimits{
+				{key: userKey + ":model:gpt-5.1", limits: Limits{RPM: 2}},
+			},
+		},
+		{
+			name:   "key rpm caps key policy and burst",
+			cfg:    disabled,
+			keyRPM: 10,
+			policies: []models.RateLimitPolicy{
+				{Scope: ScopeAPIKey, APIKeyID: &keyID, RPM: 30, Burst: 20},
+			},
+			want: []scopedLimits{
+				{key: apiKey, limits: Limits{RPM: 10, Burst: 10}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolve(tt.cfg, tt.policies, Request{UserID: userID, APIKeyID: keyID, Model: "gpt-5.1", KeyRPM: tt.keyRPM})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,119 +6,100 @@ import (
 	"time"
 
 	"codex-gateway/internal/database"
+	"codex-gateway/internal/logger"
 	"codex-gateway/internal/models"
 )
 
+// Config holds the system-wide limits, applied per user across all of their keys
 type Config struct {
-	Enabled           bool
+	Enabled           bool // Gates these system defaults and system policies; user and key limits always apply
 	RequestsPerMinute int
 	Burst             int
+	TokensPerMinute   int
+	MaxConcurrent     int
 }
 
-type limiter struct {
-	mu       sync.Mutex
-	tokens   float64
-	last     time.Time
-	lastSeen time.Time
+// Policy scopes
+const (
+	ScopeSystem = "system"
+	ScopeUser   = "user"
+	ScopeAPIKey = "api_key"
+)
+
+// policyRefreshInterval bounds how stale policies can be on other replicas
+const policyRefreshInterval = 30 * time.Second
+
+type state struct {
+	config   Config
+	policies []models.RateLimitPolicy
+	loadedAt time.Time
 }
 
 var (
-	configValue atomic.Value
-	limiters    sync.Map
-	cleanupOnce sync.Once
+	stateValue atomic.Value
+	reloading  sync.Mutex
 )
 
 func init() {
-	configValue.Store(Config{Enabled: false})
+	stateValue.Store(state{config: Config{Enabled: false}})
 }
 
 func SetConfig(cfg Config) {
-	configValue.Store(cfg)
+	current := load()
+	current.config = cfg
+	stateValue.Store(current)
 }
 
 func GetConfig() Config {
-	value := configValue.Load()
-	if value == nil {
-		return Config{}
-	}
-	return value.(Config)
+	return load().config
+}
+
+// Policies returns the loaded rate limit policies
+func Policies() []models.RateLimitPolicy {
+	return load().policies
 }
 
+func load() state {
+	return stateValue.Load().(state)
+}
+
+// LoadFromDB loads the system limits and policy overrides
 func LoadFromDB() {
 	var settings models.SystemSettings
 	if err := database.DB.First(&settings).Error; err != nil {
 		return
 	}
 
-	SetConfig(Config{
-		Enabled:           settings.RateLimitEnabled,
-		RequestsPerMinute: settings.RateLimitRPM,
-		Burst:             settings.RateLimitBurst,
-	})
-}
-
-func Allow(key string) bool {
-	cfg := GetConfig()
-	if !cfg.Enabled || cfg.RequestsPerMinute <= 0 {
-		return true
-	}
-	if key == "" {
-		return true
-	}
-
-	startCleanup()
-
-	capacity := float64(cfg.Burst)
-	if capacity <= 0 {
-		capacity = float64(cfg.RequestsPerMinute)
+	var policies []models.RateLimitPolicy
+	if err := database.DB.Order("id ASC").Find(&policies).Error; err != nil {
+		logger.Component("RateLimit").Error("failed to load policies, keeping the previous ones", "error", err)
+		policies = load().policies
 	}
-	rate := float64(cfg.RequestsPerMinute) / 60.0
-	now := time.Now()
 
-	value, _ := limiters.LoadOrStore(key, &limiter{
-		tokens:   capacity,
-		last:     now,
-		lastSeen: now,
+	stateValue.Store(state{
+		config: Config{
+			Enabled:           settings.RateLimitEnabled,
+			RequestsPerMinute: settings.RateLimitRPM,
+			Burst:             settings.RateLimitBurst,
+			TokensPerMinute:   settings.RateLimitTPM,
+			MaxConcurrent:     settings.RateLimitConcurrent,
+		},
+		policies: policies,
+		loadedAt: time.Now(),
 	})
-	bucket := value.(*limiter)
-
-	bucket.mu.Lock()
-	elapsed := now.Sub(bucket.last).Seconds()
-	if elapsed > 0 {
-		bucket.tokens += elapsed * rate
-		if bucket.tokens > capacity {
-			bucket.tokens = capacity
-		}
-	}
-
-	allowed := bucket.tokens >= 1
-	if allowed {
-		bucket.tokens -= 1
-	}
-	bucket.last = now
-	bucket.lastSeen = now
-	bucket.mu.Unlock()
-
-	return allowed
 }
 
-func startCleanup() {
-	cleanupOnce.Do(func() {
-		go func() {
-			ticker := time.NewTicker(10 * time.Minute)
-			for range ticker.C {
-				cutoff := time.Now().Add(-1 * time.Hour)
-				limiters.Range(func(key, value any) bool {
-					bucket := value.(*limiter)
-					bucket.mu.Lock()
-					lastSeen := bucket.lastSeen
-					bucket.mu.Unlock()
-					if lastSeen.Before(cutoff) {
-						limiters.Delete(key)
-					}
-					return true
-				})
-			}
-		}()
-	})
+// maybeRefresh reloads policies in the background once they are stale, so
+// changes made through another replica take effect here too
+func maybeRefresh() {
+	if time.Since(load().loadedAt) < policyRefreshInterval {
+		return
+	}
+	if !reloading.TryLock() {
+		return
+	}
+	go func() {
+		defer reloading.Unlock()
+		LoadFromDB()
+	}()
 }
@@ -0,0 +1,230 @@
+package statestore
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often expired keys and idle buckets are dropped
+const memorySweepInterval = 10 * time.Minute
+
+type memoryBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type memoryValue struct {
+	value     string
+	expiresAt time.Time // Zero = no expiry
+}
+
+// MemoryStore is a process-local Store for single-replica deployments
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	values  map[string]memoryValue
+	slots   map[string]map[string]time.Time // Key → holder → expiry
+}
+
+// NewMemoryStore creates an in-memory store and starts its sweeper
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+		values:  make(map[string]memoryValue),
+		slots:   make(map[string]map[string]time.Time),
+	}
+	go s.sweep()
+	return s
+}
+
+// Name implements Store
+func (s *MemoryStore) Name() string {
+	return "memory"
+}
+
+// TakeTokens implements Store
+func (s *MemoryStore) TakeTokens(ctx context.Context, key string, rate, capacity, n float64) (BucketResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket := s.refill(key, rate, capacity)
+	remaining, allowed := takeFromBucket(bucket.tokens, capacity, n)
+	bucket.tokens = remaining
+	return BucketResult{Allowed: allowed, Remaining: remaining}, nil
+}
+
+// AdjustTokens implements Store
+func (s *MemoryStore) AdjustTokens(ctx context.Context, key string, rate, capacity, delta float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket := s.refill(key, rate, capacity)
+	bucket.tokens -= delta
+	if bucket.tokens > capacity {
+		bucket.tokens = capacity
+	}
+	return nil
+}
+
+// refill returns the bucket at key topped up for the elapsed time; the caller holds s.mu
+func (s *MemoryStore) refill(key string, rate, capacity float64) *memoryBucket {
+	now := time.Now()
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: capacity, last: now}
+		s.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens += elapsed * rate
+		if bucket.tokens > capacity {
+			bucket.tokens = capacity
+		}
+	}
+	bucket.last = now
+	return bucket
+}
+
+// AcquireSlot implements Store
+func (s *MemoryStore) AcquireSlot(ctx context.Context, key, holder string, limit int, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	holders := s.slots[key]
+	if holders == nil {
+		holders = make(map[string]time.Time)
+		s.slots[key] = holders
+	}
+	pruneSlots(holders, now)
+	if _, held := holders[holder]; !held && len(holders) >= limit {
+		return false, nil
+	}
+	holders[holder] = now.Add(ttl)
+	return true, nil
+}
+
+// ReleaseSlot implements Store
+func (s *MemoryStore) ReleaseSlot(ctx context.Context, key, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.slots[key], holder)
+	if len(s.slots[key]) == 0 {
+		delete(s.slots, key)
+	}
+	return nil
+}
+
+// pruneSlots drops expired slots; the caller holds s.mu
+func pruneSlots(holders map[string]time.Time, now time.Time) {
+	for holder, expiresAt := range holders {
+		if now.After(expiresAt) {
+			delete(holders, holder)
+		}
+	}
+}
+
+// SetNX implements Store
+func (s *MemoryStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lookup(key, time.Now()); ok {
+		return false, nil
+	}
+	s.values[key] = newMemoryValue(value, ttl)
+	return true, nil
+}
+
+// Set implements Store
+func (s *MemoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = newMemoryValue(value, ttl)
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(ctx context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.lookup(key, time.Now())
+	return v.value, ok, nil
+}
+
+// Incr implements Store
+func (s *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	if v, ok := s.lookup(key, time.Now()); ok {
+		var err error
+		if n, err = strconv.ParseInt(v.value, 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	s.values[key] = newMemoryValue(strconv.FormatInt(n, 10), ttl)
+	return n, nil
+}
+
+// Del implements Store
+func (s *MemoryStore) Del(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	delete(s.buckets, key)
+	return nil
+}
+
+// lookup returns an unexpired value; the caller holds s.mu
+func (s *MemoryStore) lookup(key string, now time.Time) (memoryValue, bool) {
+	v, ok := s.values[key]
+	if !ok {
+		return memoryValue{}, false
+	}
+	if !v.expiresAt.IsZero() && now.After(v.expiresAt) {
+		delete(s.values, key)
+		return memoryValue{}, false
+	}
+	return v, true
+}
+
+func newMemoryValue(value string, ttl time.Duration) memoryValue {
+	v := memoryValue{value: value}
+	if ttl > 0 {
+		v.expiresAt = time.Now().Add(ttl)
+	}
+	return v
+}
+
+func (s *MemoryStore) sweep() {
+	ticker := time.NewTicker(memorySweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		idleCutoff := now.Add(-time.Hour)
+
+		s.mu.Lock()
+		for key, v := range s.values {
+			if !v.expiresAt.IsZero() && now.After(v.expiresAt) {
+				delete(s.values, key)
+			}
+		}
+		for key, b := range s.buckets {
+			if b.last.Before(idleCutoff) {
+				delete(s.buckets, key)
+			}
+		}
+		for key, holders := range s.slots {
+			pruneSlots(holders, now)
+			if len(holders) == 0 {
+				delete(s.slots, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,46 @@
+package statestore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemorySlots(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	steps := []struct {
+		action string // acquire, release or wait
+		holder string
+		want   bool
+	}{
+		{"acquire", "a", true},
+		{"acquire", "b", true},
+		{"acquire", "c", false},
+		{"acquire", "a", true},
+		{"release", "a", false},
+		{"release", "a", false},
+		{"acquire", "c", true},
+		{"acquire", "d", false},
+		{"wait", "", false}, // b and c leak past their TTL
+		{"acquire", "d", true},
+		{"acquire", "e", true},
+	}
+	for i, step := range steps {
+		switch step.action {
+		case "acquire":
+			acquired, err := store.AcquireSlot(ctx, "slots", step.holder, 2, 50*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if acquired != step.want {
+				t.Errorf("step %d: acquire by %s = %v, want %v", i, step.holder, acquired, step.want)
+			}
+		case "release":
+			store.ReleaseSlot(ctx, "slots", step.holder)
+		case "wait":
+			time.Sleep(60 * time.Millisecond)
+		}
+	}
+}
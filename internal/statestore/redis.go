@@ -0,0 +1,212 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisPoolSize    = 16
+	redisDialTimeout = 2 * time.Second
+)
+
+// tokenBucketScript refills a token bucket and takes ARGV[3] tokens from it
+// atomically, using the Redis clock so replicas with skewed clocks agree. With
+// ARGV[4] = 1 the take is unconditional (usage reconciliation). Buckets expire
+// once they would be full again; buckets that never refill expire after an
+// hour idle, like the in-memory store's. Returns {allowed, remaining}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local force = ARGV[4] == '1'
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+if rate > 0 then
+	tokens = math.min(capacity, tokens + math.max(0, now - ts) / 1000 * rate)
+end
+local allowed = 0
+if force then
+	tokens = math.min(capacity, tokens - n)
+	allowed = 1
+else
+	n = math.min(n, capacity)
+	if tokens >= n then
+		tokens = tokens - n
+		allowed = 1
+	end
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+local ttl = 3600000
+if rate > 0 then
+	ttl = math.ceil((capacity - tokens) / rate * 1000) + 1000
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+// acquireSlotScript takes a concurrency slot for holder ARGV[3] if fewer than
+// ARGV[1] are in use. Slots are members of a sorted set scored by when they
+// expire, ARGV[2] ms after they were taken; expired ones are pruned first.
+var acquireSlotScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local ttl = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if not redis.call('ZSCORE', KEYS[1], ARGV[3]) and redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + ttl, ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ttl)
+return 1
+`)
+
+// releaseSlotScript returns holder ARGV[1]'s slot, deleting the set when none
+// are in use
+var releaseSlotScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+if redis.call('ZCARD', KEYS[1]) == 0 then
+	redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+// incrScript increments a counter and refreshes its TTL in one round trip
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// RedisStore is a Store backed by Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to redis://[user:password@]host:port[/db] (rediss://
+// for TLS) and verifies it with PING
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	opts.PoolSize = redisPoolSize
+	opts.DialTimeout = redisDialTimeout
+
+	s := &RedisStore{client: redis.NewClient(opts)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisDialTimeout)
+	defer cancel()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		s.client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name implements Store
+func (s *RedisStore) Name() string {
+	return "redis"
+}
+
+// TakeTokens implements Store
+func (s *RedisStore) TakeTokens(ctx context.Context, key string, rate, capacity, n float64) (BucketResult, error) {
+	return s.runBucket(ctx, key, rate, capacity, n, false)
+}
+
+// AdjustTokens implements Store
+func (s *RedisStore) AdjustTokens(ctx context.Context, key string, rate, capacity, delta float64) error {
+	_, err := s.runBucket(ctx, key, rate, capacity, delta, true)
+	return err
+}
+
+func (s *RedisStore) runBucket(ctx context.Context, key string, rate, capacity, n float64, force bool) (BucketResult, error) {
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	reply, err := tokenBucketScript.Run(ctx, s.client, []string{key},
+		formatFloat(rate), formatFloat(capacity), formatFloat(n), forceArg).Slice()
+	if err != nil {
+		return BucketResult{}, err
+	}
+
+	if len(reply) != 2 {
+		return BucketResult{}, fmt.Errorf("redis: unexpected token bucket reply %v", reply)
+	}
+	allowed, _ := reply[0].(int64)
+	remainingStr, _ := reply[1].(string)
+	remaining, err := strconv.ParseFloat(remainingStr, 64)
+	if err != nil {
+		return BucketResult{}, fmt.Errorf("redis: invalid token count %q", remainingStr)
+	}
+	return BucketResult{Allowed: allowed == 1, Remaining: remaining}, nil
+}
+
+// AcquireSlot implements Store
+func (s *RedisStore) AcquireSlot(ctx context.Context, key, holder string, limit int, ttl time.Duration) (bool, error) {
+	n, err := acquireSlotScript.Run(ctx, s.client, []string{key}, limit, ttl.Milliseconds(), holder).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseSlot implements Store
+func (s *RedisStore) ReleaseSlot(ctx context.Context, key, holder string) error {
+	return releaseSlotScript.Run(ctx, s.client, []string{key}, holder).Err()
+}
+
+// SetNX implements Store
+func (s *RedisStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// Set implements Store
+func (s *RedisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Get implements Store
+func (s *RedisStore) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := s.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// Incr implements Store
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+// Del implements Store
+func (s *RedisStore) Del(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
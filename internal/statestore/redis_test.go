@@ -0,0 +1,250 @@
+package statestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedis(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + server.Addr() + "/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.client.Close() })
+	return store, server
+}
+
+func TestNewRedisStoreRejectsBadURL(t *testing.T) {
+	for _, url := range []string{"http://localhost:6379", "redis://localhost:6379/notadb"} {
+		if _, err := NewRedisStore(url); err == nil {
+			t.Errorf("NewRedisStore(%q) succeeded", url)
+		}
+	}
+}
+
+func TestRedisTakeTokens(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		n             float64
+		wantAllowed   bool
+		wantRemaining float64
+	}{
+		{n: 3, wantAllowed: true, wantRemaining: 2},
+		{n: 2, wantAllowed: true, wantRemaining: 0},
+		{n: 1, wantAllowed: false, wantRemaining: 0},
+	}
+	for i, tt := range tests {
+		result, err := store.TakeTokens(ctx, "bucket", 0.001, 5, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != tt.wantAllowed || result.Remaining < tt.wantRemaining || result.Remaining > tt.wantRemaining+0.01 {
+			t.Errorf("take %d: %+v, want allowed=%v remaining≈%v", i+1, result, tt.wantAllowed, tt.wantRemaining)
+		}
+	}
+
+	if ttl := server.TTL("bucket"); ttl <= 0 {
+		t.Errorf("bucket TTL = %v, want it to expire once refilled", ttl)
+	}
+}
+
+func TestRedisTakeTokensLargerThanCapacity(t *testing.T) {
+	store, _ := newTestRedis(t)
+
+	result, err := store.TakeTokens(context.Background(), "bucket", 1, 10, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("oversized take on a full bucket: %+v, want allowed with nothing left", result)
+	}
+}
+
+func TestRedisTakeTokensZeroRate(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+
+	for i, wantAllowed := range []bool{true, false} {
+		result, err := store.TakeTokens(ctx, "frozen", 0, 1, 1)
+		if err != nil {
+			t.Fatalf("take %d: %v", i+1, err)
+		}
+		if result.Allowed != wantAllowed {
+			t.Errorf("take %d: allowed = %v, want %v", i+1, result.Allowed, wantAllowed)
+		}
+	}
+	if ttl := server.TTL("frozen"); ttl != time.Hour {
+		t.Errorf("zero-rate bucket TTL = %v, want 1h", ttl)
+	}
+}
+
+func TestRedisAdjustTokens(t *testing.T) {
+	store, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	if _, err := store.TakeTokens(ctx, "tpm", 0.001, 100, 40); err != nil {
+		t.Fatal(err)
+	}
+	// Actual usage exceeded the estimate by 80: the bucket goes into debt
+	if err := store.AdjustTokens(ctx, "tpm", 0.001, 100, 80); err != nil {
+		t.Fatal(err)
+	}
+	result, err := store.TakeTokens(ctx, "tpm", 0.001, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.Remaining > -19.9 {
+		t.Errorf("after debt: %+v, want rejected at about -20", result)
+	}
+
+	// Refunds are capped at capacity
+	if err := store.AdjustTokens(ctx, "tpm", 0.001, 100, -500); err != nil {
+		t.Fatal(err)
+	}
+	result, err = store.TakeTokens(ctx, "tpm", 0.001, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Remaining > 100 {
+		t.Errorf("remaining = %v after refund, want at most capacity", result.Remaining)
+	}
+}
+
+func TestRedisSlots(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		holder string
+		want   bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"c", false},
+		{"a", true}, // Renewing a held slot needs no free one
+	}
+	for _, tt := range tests {
+		acquired, err := store.AcquireSlot(ctx, "slots", tt.holder, 2, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if acquired != tt.want {
+			t.Errorf("acquire by %s = %v, want %v", tt.holder, acquired, tt.want)
+		}
+	}
+	if ttl := server.TTL("slots"); ttl != time.Minute {
+		t.Errorf("slot TTL = %v, want 1m", ttl)
+	}
+
+	if err := store.ReleaseSlot(ctx, "slots", "a"); err != nil {
+		t.Fatal(err)
+	}
+	// Releasing a slot that is not held frees nothing
+	store.ReleaseSlot(ctx, "slots", "a")
+	if acquired, _ := store.AcquireSlot(ctx, "slots", "c", 2, time.Minute); !acquired {
+		t.Error("slot not available after release")
+	}
+	if acquired, _ := store.AcquireSlot(ctx, "slots", "d", 2, time.Minute); acquired {
+		t.Error("double release freed a second slot")
+	}
+
+	store.ReleaseSlot(ctx, "slots", "b")
+	store.ReleaseSlot(ctx, "slots", "c")
+	if server.Exists("slots") {
+		t.Error("slot set kept after every slot was released")
+	}
+}
+
+func TestRedisSlotsRecoverFromCrash(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+	server.SetTime(now)
+
+	// A replica died holding one of the two slots
+	if acquired, _ := store.AcquireSlot(ctx, "busy", "crashed", 2, time.Minute); !acquired {
+		t.Fatal("first acquire failed")
+	}
+
+	// Steady traffic keeps the key alive past the leaked slot's expiry
+	for elapsed := 30 * time.Second; elapsed <= 2*time.Minute; elapsed += 30 * time.Second {
+		server.SetTime(now.Add(elapsed))
+		server.FastForward(30 * time.Second)
+		if acquired, _ := store.AcquireSlot(ctx, "busy", "live", 2, time.Minute); !acquired {
+			t.Fatalf("acquire after %v failed", elapsed)
+		}
+		store.ReleaseSlot(ctx, "busy", "live")
+	}
+
+	for _, holder := range []string{"first", "second"} {
+		if acquired, _ := store.AcquireSlot(ctx, "busy", holder, 2, time.Minute); !acquired {
+			t.Errorf("acquire by %s failed; the leaked slot was not reclaimed", holder)
+		}
+	}
+}
+
+func TestRedisSlotsExpire(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+
+	if acquired, _ := store.AcquireSlot(ctx, "leaked", "crashed", 1, time.Minute); !acquired {
+		t.Fatal("first acquire failed")
+	}
+	// Nothing touched the key after the replica died
+	server.FastForward(2 * time.Minute)
+	if acquired, _ := store.AcquireSlot(ctx, "leaked", "next", 1, time.Minute); !acquired {
+		t.Error("leaked slot not reclaimed after its TTL")
+	}
+}
+
+func TestRedisKeyValue(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+
+	if set, err := store.SetNX(ctx, "marker", "a", time.Minute); err != nil || !set {
+		t.Fatalf("first SetNX = %v, %v", set, err)
+	}
+	if set, err := store.SetNX(ctx, "marker", "b", time.Minute); err != nil || set {
+		t.Fatalf("second SetNX = %v, %v", set, err)
+	}
+
+	value, ok, err := store.Get(ctx, "marker")
+	if err != nil || !ok || value != "a" {
+		t.Errorf("Get = %q, %v, %v; want a", value, ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "missing"); err != nil || ok {
+		t.Errorf("Get(missing) = %v, %v", ok, err)
+	}
+
+	if err := store.Set(ctx, "circuit", "1", 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	server.FastForward(31 * time.Second)
+	if _, ok, _ := store.Get(ctx, "circuit"); ok {
+		t.Error("key outlived its TTL")
+	}
+
+	for want := int64(1); want <= 2; want++ {
+		n, err := store.Incr(ctx, "failures", time.Hour)
+		if err != nil || n != want {
+			t.Errorf("Incr = %d, %v; want %d", n, err, want)
+		}
+	}
+	if ttl := server.TTL("failures"); ttl != time.Hour {
+		t.Errorf("counter TTL = %v, want 1h", ttl)
+	}
+
+	if err := store.Del(ctx, "failures"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists("failures") {
+		t.Error("Del left the key")
+	}
+}
@@ -0,0 +1,107 @@
+package statestore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"codex-gateway/internal/logger"
+)
+
+// Store holds state that must be shared by every gateway replica: rate-limit
+// buckets, throttling markers, health-check failure counts and circuit state.
+type Store interface {
+	// TakeTokens consumes n tokens from the bucket at key, which refills at
+	// rate tokens per second up to capacity, if that many are available
+	TakeTokens(ctx context.Context, key string, rate, capacity, n float64) (BucketResult, error)
+
+	// AdjustTokens consumes delta tokens unconditionally (negative refunds),
+	// letting the bucket go into debt when actual usage exceeded an estimate
+	AdjustTokens(ctx context.Context, key string, rate, capacity, delta float64) error
+
+	// AcquireSlot takes one of limit concurrent slots at key for holder. Each
+	// slot expires ttl after it was taken, so slots leaked by a crashed replica
+	// recover however busy the key stays. Acquiring a slot holder already has
+	// renews it.
+	AcquireSlot(ctx context.Context, key, holder string, limit int, ttl time.Duration) (bool, error)
+
+	// ReleaseSlot returns holder's slot taken by AcquireSlot
+	ReleaseSlot(ctx context.Context, key, holder string) error
+
+	// SetNX sets key with a TTL only if it does not exist and reports whether it was set
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+
+	// Set sets key with a TTL (0 = no expiry)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+
+	// Get returns the value of key and whether it exists
+	Get(ctx context.Context, key string) (string, bool, error)
+
+	// Incr increments the integer at key, refreshing its TTL (0 = no expiry)
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+
+	// Del removes key
+	Del(ctx context.Context, key string) error
+
+	// Name identifies the backend ("memory" or "redis")
+	Name() string
+}
+
+// BucketResult describes a token bucket after TakeTokens
+type BucketResult struct {
+	Allowed   bool
+	Remaining float64 // Tokens left in the bucket
+}
+
+// takeFromBucket takes n from a bucket holding tokens (already refilled) and
+// returns the tokens left and whether the take succeeded
+func takeFromBucket(tokens, capacity, n float64) (float64, bool) {
+	if n > capacity {
+		// A request larger than the bucket is admitted once the bucket is full
+		n = capacity
+	}
+	if tokens >= n {
+		return tokens - n, true
+	}
+	return tokens, false
+}
+
+// operationTimeout bounds a single store call made on the request path
+const operationTimeout = 250 * time.Millisecond
+
+var (
+	store   Store = NewMemoryStore()
+	storeMu sync.RWMutex
+)
+
+// Init selects the backend: Redis when redisURL is set, otherwise in-memory.
+// A Redis backend that cannot be reached at startup falls back to memory.
+func Init(redisURL string) {
+	if redisURL == "" {
+		logger.Component("StateStore").Info("using in-memory backend (single replica)")
+		return
+	}
+
+	redisStore, err := NewRedisStore(redisURL)
+	if err != nil {
+		logger.Component("StateStore").Warn("redis unavailable, using in-memory backend", "error", err)
+		return
+	}
+
+	storeMu.Lock()
+	store = redisStore
+	storeMu.Unlock()
+	logger.Component("StateStore").Info("using redis backend")
+}
+
+// Get returns the active backend
+func Get() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
+
+// Context returns a context bounded by the per-operation timeout
+func Context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), operationTimeout)
+}
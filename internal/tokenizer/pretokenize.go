@@ -0,0 +1,162 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// splitPieces splits text the way the tiktoken pre-tokenizer regexes do before
+// BPE is applied. Go's regexp lacks the lookahead those patterns need, so the
+// cl100k/o200k rules are implemented by hand:
+//
+//	contractions ('s 't 're 've 'm 'll 'd)
+//	an optional non-letter prefix followed by a letter run
+//	numbers in groups of up to three digits
+//	an optional space followed by a punctuation run (plus trailing newlines)
+//	newline runs with their leading whitespace
+//	whitespace runs, leaving the last space to prefix the next word
+//
+// With caseSplit set (o200k), letter runs also break on lower→upper transitions.
+func splitPieces(text string, caseSplit bool) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		n := matchPiece(text[i:], caseSplit)
+		if n <= 0 {
+			_, n = utf8.DecodeRuneInString(text[i:])
+		}
+		pieces = append(pieces, text[i:i+n])
+		i += n
+	}
+	return pieces
+}
+
+func matchPiece(s string, caseSplit bool) int {
+	if n := matchContraction(s); n > 0 {
+		return n
+	}
+
+	r, size := utf8.DecodeRuneInString(s)
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if isLetter(r) {
+		return size + letterRun(s[size:], r, caseSplit)
+	}
+	if r != '\r' && r != '\n' && !isNumber(r) && size < len(s) {
+		next, nsize := utf8.DecodeRuneInString(s[size:])
+		if isLetter(next) {
+			return size + nsize + letterRun(s[size+nsize:], next, caseSplit)
+		}
+	}
+
+	// \p{N}{1,3}
+	if isNumber(r) {
+		n := size
+		for count := 1; count < 3 && n < len(s); count++ {
+			next, nsize := utf8.DecodeRuneInString(s[n:])
+			if !isNumber(next) {
+				break
+			}
+			n += nsize
+		}
+		return n
+	}
+
+	// ' ?[^\s\p{L}\p{N}]+[\r\n]*'
+	start := 0
+	if r == ' ' && size < len(s) {
+		next, _ := utf8.DecodeRuneInString(s[size:])
+		if isPunct(next) {
+			start = size
+		}
+	}
+	if start > 0 || isPunct(r) {
+		n := start
+		for n < len(s) {
+			next, nsize := utf8.DecodeRuneInString(s[n:])
+			if !isPunct(next) {
+				break
+			}
+			n += nsize
+		}
+		for n < len(s) && (s[n] == '\r' || s[n] == '\n' || caseSplit && s[n] == '/') {
+			n++
+		}
+		return n
+	}
+
+	// Whitespace: \s*[\r\n]+ | \s+(?!\S) | \s+
+	if unicode.IsSpace(r) {
+		n := 0
+		lastNewline := -1
+		for n < len(s) {
+			next, nsize := utf8.DecodeRuneInString(s[n:])
+			if !unicode.IsSpace(next) {
+				break
+			}
+			n += nsize
+			if next == '\r' || next == '\n' {
+				lastNewline = n
+			}
+		}
+		if lastNewline > 0 {
+			return lastNewline
+		}
+		// Leave one trailing space to attach to the following word
+		if n < len(s) && n > size {
+			_, lastSize := utf8.DecodeLastRuneInString(s[:n])
+			return n - lastSize
+		}
+		return n
+	}
+
+	return size
+}
+
+var contractions = []string{"'s", "'t", "'re", "'ve", "'m", "'ll", "'d"}
+
+func matchContraction(s string) int {
+	if len(s) < 2 || s[0] != '\'' {
+		return 0
+	}
+	lower := strings.ToLower(s[:min(len(s), 3)])
+	for _, c := range contractions {
+		if strings.HasPrefix(lower, c) {
+			return len(c)
+		}
+	}
+	return 0
+}
+
+// letterRun returns the byte length of the letter run following first
+func letterRun(s string, first rune, caseSplit bool) int {
+	n := 0
+	prev := first
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !isLetter(r) {
+			break
+		}
+		if caseSplit && unicode.IsLower(prev) && unicode.IsUpper(r) {
+			break
+		}
+		prev = r
+		n += size
+	}
+	if caseSplit {
+		n += matchContraction(s[n:])
+	}
+	return n
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.M, r)
+}
+
+func isNumber(r rune) bool {
+	return unicode.IsNumber(r)
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !isLetter(r) && !isNumber(r)
+}
@@ -0,0 +1,113 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Per-message framing overhead used by the chat format
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// CountRequest counts the input tokens of a chat, responses or completions
+// request body: messages/input, instructions, prompt and tool definitions.
+// It returns the count and the encoding used.
+func CountRequest(model string, reqBody map[string]interface{}) (int, string) {
+	var text strings.Builder
+	overhead := 0
+
+	if instructions, ok := reqBody["instructions"].(string); ok {
+		text.WriteString(instructions)
+		text.WriteByte('\n')
+	}
+
+	if messages, ok := reqBody["messages"].([]interface{}); ok {
+		for _, msg := range messages {
+			writeItem(&text, msg)
+			overhead += tokensPerMessage
+		}
+		overhead += tokensPerReply
+	}
+
+	switch input := reqBody["input"].(type) {
+	case string:
+		text.WriteString(input)
+		text.WriteByte('\n')
+	case []interface{}:
+		for _, item := range input {
+			writeItem(&text, item)
+			overhead += tokensPerMessage
+		}
+		overhead += tokensPerReply
+	}
+
+	switch prompt := reqBody["prompt"].(type) {
+	case string:
+		text.WriteString(prompt)
+	case []interface{}:
+		for _, p := range prompt {
+			if s, ok := p.(string); ok {
+				text.WriteString(s)
+				text.WriteByte('\n')
+			}
+		}
+	}
+
+	// Tool schemas are sent to the model as text; their JSON is a close proxy
+	if tools, ok := reqBody["tools"]; ok {
+		if encoded, err := json.Marshal(tools); err == nil {
+			text.Write(encoded)
+		}
+	}
+
+	count, encoding := Count(model, text.String())
+	return count + overhead, encoding
+}
+
+// writeItem appends the countable text of a message or input item
+func writeItem(text *strings.Builder, item interface{}) {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		if s, ok := item.(string); ok {
+			text.WriteString(s)
+			text.WriteByte('\n')
+		}
+		return
+	}
+
+	for _, field := range []string{"role", "name", "arguments", "output"} {
+		if s, ok := m[field].(string); ok {
+			text.WriteString(s)
+			text.WriteByte('\n')
+		}
+	}
+	writeContent(text, m["content"])
+
+	if calls, ok := m["tool_calls"]; ok {
+		if encoded, err := json.Marshal(calls); err == nil {
+			text.Write(encoded)
+		}
+	}
+}
+
+// writeContent appends string content or the text parts of multi-part content
+func writeContent(text *strings.Builder, content interface{}) {
+	switch c := content.(type) {
+	case string:
+		text.WriteString(c)
+		text.WriteByte('\n')
+	case []interface{}:
+		for _, part := range c {
+			p, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if s, ok := p["text"].(string); ok {
+				text.WriteString(s)
+				text.WriteByte('\n')
+			}
+		}
+	}
+}
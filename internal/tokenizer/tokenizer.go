@@ -0,0 +1,324 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"codex-gateway/internal/logger"
+
+	"github.com/pkoukk/tiktoken-go-loader/assets"
+)
+
+// Encoding names, matching the tiktoken vocabulary files <name>.tiktoken
+const (
+	O200kBase  = "o200k_base"
+	Cl100kBase = "cl100k_base"
+
+	// Approximate is reported when no vocabulary could be loaded
+	Approximate = "approximate"
+)
+
+// pieceCacheSize bounds the per-encoding cache of BPE results for common pieces
+const pieceCacheSize = 50000
+
+// maxPieceBytes caps the input of a single BPE merge. Longer pieces (a run of
+// letters with no spaces, base64 blobs) are counted in chunks, which keeps the
+// cost linear in the input while barely changing the count.
+const maxPieceBytes = 256
+
+// Encoding is a byte-level BPE encoding loaded from a tiktoken vocabulary
+type Encoding struct {
+	name      string
+	ranks     map[string]int
+	caseSplit bool
+
+	cacheMu sync.RWMutex
+	cache   map[string]int
+}
+
+var (
+	dataDir   = "./data/tokenizer"
+	dataDirMu sync.RWMutex
+
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*Encoding)
+	loadFailed  = make(map[string]bool)
+)
+
+// SetDataDir sets where <encoding>.tiktoken vocabulary files are looked up.
+// Files found there replace the vocabularies bundled with the gateway.
+func SetDataDir(dir string) {
+	dataDirMu.Lock()
+	dataDir = dir
+	dataDirMu.Unlock()
+}
+
+// Get returns the named encoding, loading it on first use. Nil is returned when
+// the vocabulary cannot be loaded; callers then fall back to approximation.
+func Get(name string) *Encoding {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return enc
+	}
+	if loadFailed[name] {
+		return nil
+	}
+
+	dataDirMu.RLock()
+	path := filepath.Join(dataDir, name+".tiktoken")
+	dataDirMu.RUnlock()
+
+	source := path
+	enc, err := Load(name, path)
+	if errors.Is(err, fs.ErrNotExist) {
+		source = "bundled vocabulary"
+		enc, err = loadBundled(name)
+	}
+	if err != nil {
+		logger.Component("Tokenizer").Warn("encoding unavailable, using approximate counts", "encoding", name, "error", err)
+		loadFailed[name] = true
+		return nil
+	}
+
+	logger.Component("Tokenizer").Info("loaded encoding", "encoding", name, "source", source, "tokens", len(enc.ranks))
+	encodings[name] = enc
+	return enc
+}
+
+// Load reads a tiktoken vocabulary file ("<base64 token> <rank>" per line)
+func Load(name, path string) (*Encoding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseVocabulary(name, file)
+}
+
+// loadBundled reads the vocabulary shipped with the gateway
+func loadBundled(name string) (*Encoding, error) {
+	file, err := assets.Assets.Open(name + ".tiktoken")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseVocabulary(name, file)
+}
+
+func parseVocabulary(name string, r io.Reader) (*Encoding, error) {
+	ranks := make(map[string]int, 200000)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line: %q", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q: %w", fields[0], err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank %q: %w", fields[1], err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("empty vocabulary")
+	}
+
+	return &Encoding{
+		name:      name,
+		ranks:     ranks,
+		caseSplit: name == O200kBase,
+		cache:     make(map[string]int),
+	}, nil
+}
+
+// Name returns the encoding name
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Count returns the number of tokens in text
+func (e *Encoding) Count(text string) int {
+	total := 0
+	for _, piece := range splitPieces(text, e.caseSplit) {
+		for len(piece) > maxPieceBytes {
+			n := maxPieceBytes
+			// Cut on a rune boundary
+			for n > 0 && !utf8.RuneStart(piece[n]) {
+				n--
+			}
+			total += e.countPiece(piece[:n])
+			piece = piece[n:]
+		}
+		total += e.countPiece(piece)
+	}
+	return total
+}
+
+func (e *Encoding) countPiece(piece string) int {
+	if _, ok := e.ranks[piece]; ok {
+		return 1
+	}
+
+	e.cacheMu.RLock()
+	n, ok := e.cache[piece]
+	e.cacheMu.RUnlock()
+	if ok {
+		return n
+	}
+
+	n = e.bytePairMerge(piece)
+
+	e.cacheMu.Lock()
+	if len(e.cache) >= pieceCacheSize {
+		e.cache = make(map[string]int)
+	}
+	e.cache[piece] = n
+	e.cacheMu.Unlock()
+
+	return n
+}
+
+// mergePart is a part boundary during a merge: the part starts at byte start
+// and merging it with the next part has the given rank
+type mergePart struct {
+	start int
+	rank  int
+}
+
+const noRank = int(^uint(0) >> 1)
+
+// bytePairMerge repeatedly merges the adjacent pair with the lowest rank,
+// starting from single bytes, and returns the number of resulting parts.
+// Parts are byte offsets into piece, as in tiktoken, so merging allocates nothing.
+func (e *Encoding) bytePairMerge(piece string) int {
+	parts := make([]mergePart, len(piece)+1)
+	for i := range parts {
+		parts[i] = mergePart{start: i, rank: noRank}
+	}
+	// rankAt returns the rank of merging parts i and i+1, given that
+	// parts[i+1] is about to be removed
+	rankAt := func(i int) int {
+		if i+3 < len(parts) {
+			if rank, ok := e.ranks[piece[parts[i].start:parts[i+3].start]]; ok {
+				return rank
+			}
+		}
+		return noRank
+	}
+	for i := 0; i+2 < len(parts); i++ {
+		if rank, ok := e.ranks[piece[i:i+2]]; ok {
+			parts[i].rank = rank
+		}
+	}
+
+	for len(parts) > 2 {
+		best := -1
+		bestRank := noRank
+		for i := 0; i+1 < len(parts); i++ {
+			if parts[i].rank < bestRank {
+				best = i
+				bestRank = parts[i].rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best].rank = rankAt(best)
+		if best > 0 {
+			parts[best-1].rank = rankAt(best - 1)
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts) - 1
+}
+
+// EncodingForModel returns the encoding name a model uses
+func EncodingForModel(model string) string {
+	m := strings.ToLower(model)
+	if idx := strings.LastIndex(m, "/"); idx >= 0 {
+		m = m[idx+1:]
+	}
+	switch {
+	case strings.HasPrefix(m, "gpt-4o"), strings.HasPrefix(m, "gpt-4.1"), strings.HasPrefix(m, "gpt-5"),
+		strings.HasPrefix(m, "o1"), strings.HasPrefix(m, "o3"), strings.HasPrefix(m, "o4"),
+		strings.Contains(m, "codex"):
+		return O200kBase
+	default:
+		return Cl100kBase
+	}
+}
+
+// Count returns the number of tokens in text for the model, and the encoding
+// used (Approximate when the vocabulary could not be loaded)
+func Count(model, text string) (int, string) {
+	if text == "" {
+		return 0, EncodingForModel(model)
+	}
+	name := EncodingForModel(model)
+	if enc := Get(name); enc != nil {
+		return enc.Count(text), name
+	}
+	return approximateCount(text, name == O200kBase), Approximate
+}
+
+// approximateCount estimates tokens without a vocabulary. It reuses the
+// pre-tokenizer and prices each piece by script: short Latin words are one
+// token, long ones about four characters per token, and CJK, kana and hangul
+// about one token per character.
+func approximateCount(text string, caseSplit bool) int {
+	total := 0
+	for _, piece := range splitPieces(text, caseSplit) {
+		total += approximatePiece(piece)
+	}
+	return total
+}
+
+func approximatePiece(piece string) int {
+	wide := 0
+	narrow := 0
+	for _, r := range piece {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			wide++
+		case r >= utf8.RuneSelf:
+			// Other non-ASCII (accents, Cyrillic, emoji) tends to split into ~2 chars per token
+			narrow += 2
+		default:
+			narrow++
+		}
+	}
+
+	tokens := wide
+	if narrow > 0 {
+		if narrow <= 6 {
+			tokens++
+		} else {
+			tokens += (narrow + 3) / 4
+		}
+	}
+	return tokens
+}
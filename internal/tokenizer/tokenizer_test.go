@@ -0,0 +1,179 @@
+package tokenizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reference counts produced by OpenAI's tiktoken for each encoding
+var referenceCounts = []struct {
+	text   string
+	o200k  int
+	cl100k int
+}{
+	{"hello world", 2, 2},
+	{"tiktoken is great!", 6, 6},
+	{"Hello, World! How's it going?", 9, 9},
+	{"The quick brown fox jumps over the lazy dog.", 10, 10},
+	{"  leading spaces and trailing   ", 6, 6},
+	{"line one\nline two\n\n\tindented", 9, 9},
+	{"12345678 and 3.14159", 9, 9},
+	{"func main() {\n\tfmt.Println(\"hi\")\n}\n", 10, 10},
+	{"CamelCaseIdentifier getHTTPResponse", 6, 7},
+	{"我们今天去公园散步。", 8, 11},
+	{"こんにちは世界", 2, 4},
+	{"Ünïcödé çharacters: naïve café", 12, 14},
+	{"emoji 😀🎉 test", 5, 6},
+	{"I'm sure they'll say we'd've done it", 8, 11},
+	{"URL: https://example.com/path?query=1&x=2", 15, 15},
+	{"    def foo(self):\n        return None\n", 9, 9},
+	{"a  b   c    d", 7, 7},
+	{"!!!???...", 3, 3},
+	{"// comment\n/* block */", 6, 6},
+	{"Привет, мир!", 5, 7},
+}
+
+func TestBundledEncodingsMatchTiktoken(t *testing.T) {
+	SetDataDir(t.TempDir())
+
+	for _, encoding := range []string{O200kBase, Cl100kBase} {
+		enc := Get(encoding)
+		if enc == nil {
+			t.Fatalf("%s: bundled vocabulary not loaded", encoding)
+		}
+		for _, tt := range referenceCounts {
+			want := tt.cl100k
+			if encoding == O200kBase {
+				want = tt.o200k
+			}
+			if got := enc.Count(tt.text); got != want {
+				t.Errorf("%s: Count(%q) = %d, want %d", encoding, tt.text, got, want)
+			}
+		}
+	}
+}
+
+func TestCountUsesModelEncoding(t *testing.T) {
+	tests := []struct {
+		model    string
+		text     string
+		want     int
+		encoding string
+	}{
+		{"gpt-5.1-codex", "こんにちは世界", 2, O200kBase},
+		{"openai/gpt-4o-mini", "こんにちは世界", 2, O200kBase},
+		{"gpt-4", "こんにちは世界", 4, Cl100kBase},
+		{"gpt-5.1", "", 0, O200kBase},
+	}
+	for _, tt := range tests {
+		got, encoding := Count(tt.model, tt.text)
+		if got != tt.want || encoding != tt.encoding {
+			t.Errorf("Count(%q, %q) = %d, %s; want %d, %s", tt.model, tt.text, got, encoding, tt.want, tt.encoding)
+		}
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-5.1-codex":      O200kBase,
+		"gpt-5.2":            O200kBase,
+		"GPT-4o":             O200kBase,
+		"gpt-4.1-mini":       O200kBase,
+		"o3-mini":            O200kBase,
+		"azure/codex-mini":   O200kBase,
+		"gpt-4":              Cl100kBase,
+		"gpt-3.5-turbo":      Cl100kBase,
+		"text-embedding-3-s": Cl100kBase,
+	}
+	for model, want := range tests {
+		if got := EncodingForModel(model); got != want {
+			t.Errorf("EncodingForModel(%q) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestLoadFromDataDir(t *testing.T) {
+	// "a"=0, "b"=1, "ab"=2
+	path := filepath.Join(t.TempDir(), "tiny.tiktoken")
+	if err := os.WriteFile(path, []byte("YQ== 0\nYg== 1\nYWI= 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := Load("tiny", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := enc.Count("abab"); got != 2 {
+		t.Errorf("Count(abab) = %d, want 2", got)
+	}
+
+	if err := os.WriteFile(path, []byte("not-a-vocabulary\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load("tiny", path); err == nil {
+		t.Error("Load accepted an invalid vocabulary")
+	}
+}
+
+func TestCountRequest(t *testing.T) {
+	body := map[string]interface{}{
+		"model": "gpt-5.1-codex",
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": "hello world"},
+		},
+	}
+	// "user\nhello world\n" plus message and reply framing
+	want := Get(O200kBase).Count("user\nhello world\n") + tokensPerMessage + tokensPerReply
+
+	got, encoding := CountRequest("gpt-5.1-codex", body)
+	if got != want || encoding != O200kBase {
+		t.Errorf("CountRequest = %d, %s; want %d, %s", got, encoding, want, O200kBase)
+	}
+}
+
+func TestApproximateCount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello world", 2},
+		{"我们今天", 4},
+		{"internationalization", 5},
+	}
+	for _, tt := range tests {
+		if got := approximateCount(tt.text, true); got != tt.want {
+			t.Errorf("approximateCount(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCountLongPiecesInTime(t *testing.T) {
+	SetDataDir(t.TempDir())
+	enc := Get(O200kBase)
+	if enc == nil {
+		t.Fatal("bundled vocabulary not loaded")
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"one long word", strings.Repeat("abcdefghij", 20000)},
+		{"one repeated letter", strings.Repeat("a", 200000)},
+		{"long CJK run", strings.Repeat("我们今天去公园散步", 10000)},
+		{"long base64 blob", strings.Repeat("QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo0NTY3ODkrLw", 4000)},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		got := enc.Count(tt.text)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: Count of %d bytes took %v", tt.name, len(tt.text), elapsed)
+		}
+		if got <= 0 || got > len(tt.text) {
+			t.Errorf("%s: Count = %d for %d bytes", tt.name, got, len(tt.text))
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package upstream
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"codex-gateway/internal/logger"
+	"codex-gateway/internal/statestore"
+)
+
+// Circuit states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+const (
+	circuitBucketWidth = 10 * time.Second
+	circuitBucketCount = 6 // 60s rolling window
+
+	// circuitRemoteRefresh is how long another replica's open marker is cached
+	circuitRemoteRefresh = time.Second
+)
+
+// CircuitConfig controls when circuits trip and recover
+type CircuitConfig struct {
+	ConsecutiveFailures int           // Trip after this many failures in a row
+	ErrorRateThreshold  float64       // Trip when the window error rate reaches this (0-1)
+	MinRequests         int           // Minimum requests in the window before the error rate applies
+	OpenDuration        time.Duration // How long to reject traffic before probing
+	HalfOpenProbes      int           // Concurrent requests allowed while half-open
+}
+
+// CircuitSnapshot is a point-in-time view of one upstream's circuit
+type CircuitSnapshot struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	WindowRequests      int        `json:"window_requests"`
+	WindowFailures      int        `json:"window_failures"`
+	ErrorRate           float64    `json:"error_rate"`
+	OpenedAt            *time.Time `json:"opened_at"`
+	LastFailure         *time.Time `json:"last_failure"`
+	RemoteOpen          bool       `json:"remote_open"` // Opened by another replica
+}
+
+type circuitBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+type circuit struct {
+	state               string
+	consecutiveFailures int
+	buckets             [circuitBucketCount]circuitBucket
+	openedAt            time.Time
+	lastFailure         time.Time
+	probes              int
+	probeStarted        time.Time // When the latest half-open probe was sent
+}
+
+type remoteCircuit struct {
+	open      bool
+	checkedAt time.Time
+}
+
+// CircuitBreaker tracks per-upstream circuits fed by live proxy traffic.
+// Opening a circuit is published to the shared state store so every replica
+// stops routing to the upstream for OpenDuration.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	config   CircuitConfig
+	circuits map[uint]*circuit
+	remote   map[uint]remoteCircuit
+}
+
+var (
+	circuitBreaker     *CircuitBreaker
+	circuitBreakerOnce sync.Once
+)
+
+// GetCircuitBreaker returns the singleton circuit breaker
+func GetCircuitBreaker() *CircuitBreaker {
+	circuitBreakerOnce.Do(func() {
+		circuitBreaker = &CircuitBreaker{
+			config: CircuitConfig{
+				ConsecutiveFailures: 5,
+				ErrorRateThreshold:  0.5,
+				MinRequests:         20,
+				OpenDuration:        30 * time.Second,
+				HalfOpenProbes:      1,
+			},
+			circuits: make(map[uint]*circuit),
+			remote:   make(map[uint]remoteCircuit),
+		}
+	})
+	return circuitBreaker
+}
+
+// Available reports whether traffic may be routed to the upstream.
+// An open circuit becomes half-open once OpenDuration has elapsed.
+func (cb *CircuitBreaker) Available(upstreamID uint) bool {
+	if !cb.availableLocally(upstreamID) {
+		return false
+	}
+	return !cb.remoteOpen(upstreamID)
+}
+
+// remoteOpen reports whether any replica has published an open circuit for
+// the upstream. Results are cached briefly; store errors count as closed.
+func (cb *CircuitBreaker) remoteOpen(upstreamID uint) bool {
+	now := time.Now()
+	cb.mu.Lock()
+	cached, ok := cb.remote[upstreamID]
+	cb.mu.Unlock()
+	if ok && now.Sub(cached.checkedAt) < circuitRemoteRefresh {
+		return cached.open
+	}
+
+	ctx, cancel := statestore.Context()
+	defer cancel()
+	_, open, err := statestore.Get().Get(ctx, circuitOpenKey(upstreamID))
+	if err != nil {
+		open = false
+	}
+
+	cb.mu.Lock()
+	cb.remote[upstreamID] = remoteCircuit{open: open, checkedAt: now}
+	cb.mu.Unlock()
+	return open
+}
+
+func (cb *CircuitBreaker) availableLocally(upstreamID uint) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.circuits[upstreamID]
+	if !ok {
+		return true
+	}
+	cb.advance(upstreamID, c, time.Now())
+
+	switch c.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		// A probe whose outcome was never recorded stops holding its slot
+		// after OpenDuration so the upstream cannot stay half-open forever
+		if c.probes > 0 && time.Since(c.probeStarted) >= cb.config.OpenDuration {
+			c.probes = 0
+		}
+		return c.probes < cb.config.HalfOpenProbes
+	default:
+		return true
+	}
+}
+
+// OnAttempt must be called before a request is sent so half-open probes can be limited
+func (cb *CircuitBreaker) OnAttempt(upstreamID uint) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.get(upstreamID)
+	if c.state == CircuitHalfOpen {
+		c.probes++
+		c.probeStarted = time.Now()
+	}
+}
+
+// ReleaseProbe frees the half-open probe slot of an attempt that ended without
+// an outcome, such as one the client cancelled
+func (cb *CircuitBreaker) ReleaseProbe(upstreamID uint) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.circuits[upstreamID]
+	if ok && c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// RecordSuccess records a successful request against the upstream
+func (cb *CircuitBreaker) RecordSuccess(upstreamID uint) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	c := cb.get(upstreamID)
+	cb.advance(upstreamID, c, now)
+	c.bucket(now).requests++
+	c.consecutiveFailures = 0
+
+	if c.state == CircuitHalfOpen {
+		cb.transition(upstreamID, c, CircuitClosed, now)
+	}
+}
+
+// RecordFailure records a failed request (connection error, 429 or 5xx) against the upstream
+func (cb *CircuitBreaker) RecordFailure(upstreamID uint) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	c := cb.get(upstreamID)
+	cb.advance(upstreamID, c, now)
+	b := c.bucket(now)
+	b.requests++
+	b.failures++
+	c.consecutiveFailures++
+	c.lastFailure = now
+
+	switch c.state {
+	case CircuitHalfOpen:
+		cb.transition(upstreamID, c, CircuitOpen, now)
+	case CircuitClosed:
+		requests, failures := c.window(now)
+		tripRate := requests >= cb.config.MinRequests &&
+			float64(failures)/float64(requests) >= cb.config.ErrorRateThreshold
+		if c.consecutiveFailures >= cb.config.ConsecutiveFailures || tripRate {
+			cb.transition(upstreamID, c, CircuitOpen, now)
+		}
+	}
+}
+
+// State returns the current circuit state for an upstream
+func (cb *CircuitBreaker) State(upstreamID uint) string {
+	return cb.Snapshot(upstreamID).State
+}
+
+// Snapshot returns the current circuit statistics for an upstream
+func (cb *CircuitBreaker) Snapshot(upstreamID uint) CircuitSnapshot {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.circuits[upstreamID]
+	if !ok {
+		return CircuitSnapshot{State: CircuitClosed}
+	}
+
+	now := time.Now()
+	cb.advance(upstreamID, c, now)
+	requests, failures := c.window(now)
+
+	snapshot := CircuitSnapshot{
+		State:               c.state,
+		ConsecutiveFailures: c.consecutiveFailures,
+		WindowRequests:      requests,
+		WindowFailures:      failures,
+	}
+	if requests > 0 {
+		snapshot.ErrorRate = float64(failures) / float64(requests)
+	}
+	if c.state != CircuitClosed {
+		openedAt := c.openedAt
+		snapshot.OpenedAt = &openedAt
+	}
+	if !c.lastFailure.IsZero() {
+		lastFailure := c.lastFailure
+		snapshot.LastFailure = &lastFailure
+	}
+	snapshot.RemoteOpen = cb.remote[upstreamID].open && c.state == CircuitClosed
+	return snapshot
+}
+
+// Reset closes the circuit for an upstream, e.g. after an admin re-enables it
+func (cb *CircuitBreaker) Reset(upstreamID uint) {
+	cb.mu.Lock()
+	delete(cb.circuits, upstreamID)
+	delete(cb.remote, upstreamID)
+	cb.mu.Unlock()
+
+	go publishCircuit(upstreamID, false, 0)
+}
+
+func (cb *CircuitBreaker) get(upstreamID uint) *circuit {
+	c, ok := cb.circuits[upstreamID]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		cb.circuits[upstreamID] = c
+	}
+	return c
+}
+
+// advance moves an open circuit to half-open once its cooldown has elapsed
+func (cb *CircuitBreaker) advance(upstreamID uint, c *circuit, now time.Time) {
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= cb.config.OpenDuration {
+		cb.transition(upstreamID, c, CircuitHalfOpen, now)
+	}
+}
+
+func (cb *CircuitBreaker) transition(upstreamID uint, c *circuit, state string, now time.Time) {
+	if c.state == state {
+		return
+	}
+	level := slog.LevelInfo
+	if state == CircuitOpen {
+		level = slog.LevelWarn
+	}
+	logger.Component("Circuit").Log(context.Background(), level, "circuit state changed",
+		"upstream_id", upstreamID, "from", c.state, "to", state)
+
+	c.state = state
+	c.probes = 0
+	switch state {
+	case CircuitOpen:
+		c.openedAt = now
+		go publishCircuit(upstreamID, true, cb.config.OpenDuration)
+	case CircuitClosed:
+		c.consecutiveFailures = 0
+		c.buckets = [circuitBucketCount]circuitBucket{}
+		delete(cb.remote, upstreamID)
+		go publishCircuit(upstreamID, false, 0)
+	}
+}
+
+// publishCircuit shares an opened or closed circuit with other replicas
+func publishCircuit(upstreamID uint, open bool, ttl time.Duration) {
+	ctx, cancel := statestore.Context()
+	defer cancel()
+
+	var err error
+	if open {
+		err = statestore.Get().Set(ctx, circuitOpenKey(upstreamID), "1", ttl)
+	} else {
+		err = statestore.Get().Del(ctx, circuitOpenKey(upstreamID))
+	}
+	if err != nil {
+		logger.Component("Circuit").Error("failed to publish circuit state", "upstream_id", upstreamID, "open", open, "error", err)
+	}
+}
+
+func circuitOpenKey(upstreamID uint) string {
+	return "circuit:open:" + strconv.FormatUint(uint64(upstreamID), 10)
+}
+
+// bucket returns the rolling-window bucket for now, recycling stale buckets
+func (c *circuit) bucket(now time.Time) *circuitBucket {
+	start := now.Truncate(circuitBucketWidth)
+	idx := int(start.Unix()/int64(circuitBucketWidth/time.Second)) % circuitBucketCount
+	b := &c.buckets[idx]
+	if !b.start.Equal(start) {
+		*b = circuitBucket{start: start}
+	}
+	return b
+}
+
+// window sums requests and failures across buckets still inside the rolling window
+func (c *circuit) window(now time.Time) (requests, failures int) {
+	cutoff := now.Add(-circuitBucketWidth * circuitBucketCount)
+	for _, b := range c.buckets {
+		if b.start.After(cutoff) {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
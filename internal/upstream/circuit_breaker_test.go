@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	config := CircuitConfig{ConsecutiveFailures: 3, ErrorRateThreshold: 0.5, MinRequests: 6, OpenDuration: time.Minute, HalfOpenProbes: 1}
+	then := func(steps []string, more ...string) []string {
+		return append(append([]string{}, steps...), more...)
+	}
+	trip := []string{"fail", "fail", "fail"}
+	probe := then(trip, "cooldown", "attempt")
+
+	tests := []struct {
+		name          string
+		steps         []string
+		wantState     string
+		wantAvailable bool
+	}{
+		{"closed by default", nil, CircuitClosed, true},
+		{"failures below the streak", []string{"fail", "fail"}, CircuitClosed, true},
+		{"failure streak trips", trip, CircuitOpen, false},
+		{"success resets the streak", []string{"fail", "fail", "ok", "fail"}, CircuitClosed, true},
+		{"error rate trips", []string{"ok", "fail", "ok", "fail", "ok", "fail"}, CircuitOpen, false},
+		{"error rate below the minimum requests", []string{"ok", "fail", "ok", "fail"}, CircuitClosed, true},
+		{"half-open after the cooldown", then(trip, "cooldown"), CircuitHalfOpen, true},
+		{"half-open probes are limited", probe, CircuitHalfOpen, false},
+		{"released probe frees its slot", then(probe, "release"), CircuitHalfOpen, true},
+		{"stale probe frees its slot", then(probe, "probe timeout"), CircuitHalfOpen, true},
+		{"probe success closes", then(probe, "ok"), CircuitClosed, true},
+		{"probe failure reopens", then(probe, "fail"), CircuitOpen, false},
+		{"release while closed is a no-op", []string{"attempt", "release"}, CircuitClosed, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := newReplica(config)
+			upstreamID := uint(100 + i)
+			for _, step := range tt.steps {
+				switch step {
+				case "ok":
+					cb.RecordSuccess(upstreamID)
+				case "fail":
+					cb.RecordFailure(upstreamID)
+				case "attempt":
+					// Requests are only sent to upstreams the selector found available
+					if cb.availableLocally(upstreamID) {
+						cb.OnAttempt(upstreamID)
+					}
+				case "release":
+					cb.ReleaseProbe(upstreamID)
+				case "cooldown":
+					cb.circuits[upstreamID].openedAt = time.Now().Add(-config.OpenDuration)
+				case "probe timeout":
+					cb.circuits[upstreamID].probeStarted = time.Now().Add(-config.OpenDuration)
+				}
+			}
+
+			if got := cb.availableLocally(upstreamID); got != tt.wantAvailable {
+				t.Errorf("available = %v, want %v", got, tt.wantAvailable)
+			}
+			if got := cb.State(upstreamID); got != tt.wantState {
+				t.Errorf("state = %s, want %s", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerReset(t *testing.T) {
+	cb := newReplica(CircuitConfig{ConsecutiveFailures: 1, OpenDuration: time.Minute, HalfOpenProbes: 1})
+	const upstreamID = 150
+	cb.RecordFailure(upstreamID)
+	if cb.State(upstreamID) != CircuitOpen {
+		t.Fatalf("state = %s, want open", cb.State(upstreamID))
+	}
+
+	cb.Reset(upstreamID)
+	if snapshot := cb.Snapshot(upstreamID); snapshot.State != CircuitClosed || snapshot.WindowFailures != 0 {
+		t.Errorf("snapshot after reset = %+v, want a fresh closed circuit", snapshot)
+	}
+}
@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+
+	"codex-gateway/internal/statestore"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newReplica returns a circuit breaker sharing state with others through the
+// package's state store, as another gateway replica would
+func newReplica(config CircuitConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		config:   config,
+		circuits: make(map[uint]*circuit),
+		remote:   make(map[uint]remoteCircuit),
+	}
+}
+
+func TestCircuitStateSharedThroughRedis(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stays the package's store for the rest of the run
+	statestore.Init("redis://" + server.Addr())
+	if statestore.Get().Name() != "redis" {
+		t.Fatal("redis store not selected")
+	}
+
+	config := CircuitConfig{ConsecutiveFailures: 2, ErrorRateThreshold: 1, MinRequests: 100, OpenDuration: time.Minute, HalfOpenProbes: 1}
+	replicaA := newReplica(config)
+	replicaB := newReplica(config)
+	const upstreamID = 901
+
+	replicaA.RecordFailure(upstreamID)
+	replicaA.RecordFailure(upstreamID)
+	if replicaA.State(upstreamID) != CircuitOpen {
+		t.Fatalf("replica A state = %s, want open", replicaA.State(upstreamID))
+	}
+
+	key := circuitOpenKey(upstreamID)
+	waitFor(t, func() bool { return server.Exists(key) })
+	if ttl := server.TTL(key); ttl != time.Minute {
+		t.Errorf("open marker TTL = %v, want the open duration", ttl)
+	}
+
+	if replicaB.Available(upstreamID) {
+		t.Error("replica B routes to an upstream replica A opened")
+	}
+
+	// A local success does not override the shared marker
+	replicaB.RecordSuccess(upstreamID)
+	if !replicaB.Snapshot(upstreamID).RemoteOpen {
+		t.Error("replica B snapshot does not report the remote open circuit")
+	}
+	if replicaB.Available(upstreamID) {
+		t.Error("replica B routes to the upstream after a local success")
+	}
+
+	// Closing the circuit clears the marker for everyone
+	replicaA.Reset(upstreamID)
+	waitFor(t, func() bool { return !server.Exists(key) })
+	replicaB.remote = make(map[uint]remoteCircuit)
+	if !replicaB.Available(upstreamID) {
+		t.Error("replica B still avoids the upstream after it was reset")
+	}
+}
+
+// waitFor polls cond until it holds, for state published in the background
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,254 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"codex-gateway/internal/logger"
+	"codex-gateway/internal/models"
+)
+
+const (
+	defaultRequestTimeout   = 120 * time.Second
+	defaultFirstByteTimeout = 60 * time.Second
+	defaultIdleTimeout      = 60 * time.Second
+	defaultMaxConns         = 100
+	defaultMaxIdleConns     = 10
+)
+
+// ErrStreamStalled is returned by stream body reads when the upstream sends
+// nothing within the first-byte or idle timeout
+var ErrStreamStalled = errors.New("upstream stream stalled")
+
+// ClientSettings holds the HTTP settings derived from an upstream's configuration
+type ClientSettings struct {
+	RequestTimeout   time.Duration // Whole request for non-streaming calls
+	FirstByteTimeout time.Duration // Until response headers, then for streams until the first body byte
+	IdleTimeout      time.Duration // Waiting on any later stream read
+	MaxConns         int
+	MaxIdleConns     int
+}
+
+// SettingsFor resolves client settings for an upstream, applying defaults for unset values
+func SettingsFor(upstream *models.CodexUpstream) ClientSettings {
+	settings := ClientSettings{
+		RequestTimeout:   seconds(upstream.Timeout, defaultRequestTimeout),
+		FirstByteTimeout: seconds(upstream.FirstByteTimeout, defaultFirstByteTimeout),
+		IdleTimeout:      seconds(upstream.IdleTimeout, defaultIdleTimeout),
+		MaxConns:         upstream.MaxConns,
+		MaxIdleConns:     upstream.MaxIdleConns,
+	}
+	if settings.MaxConns <= 0 {
+		settings.MaxConns = defaultMaxConns
+	}
+	if settings.MaxIdleConns <= 0 {
+		settings.MaxIdleConns = defaultMaxIdleConns
+	}
+	if settings.FirstByteTimeout > settings.RequestTimeout {
+		settings.FirstByteTimeout = settings.RequestTimeout
+	}
+	return settings
+}
+
+func seconds(value int, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return time.Duration(value) * time.Second
+}
+
+// UpstreamClient is the HTTP client set used to talk to one upstream
+type UpstreamClient struct {
+	Settings ClientSettings
+
+	// client enforces RequestTimeout; streamClient does not, since a healthy
+	// stream may legitimately outlive it. Both share one transport.
+	client       *http.Client
+	streamClient *http.Client
+	transport    *http.Transport
+}
+
+func newUpstreamClient(settings ClientSettings) *UpstreamClient {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: settings.FirstByteTimeout,
+		MaxConnsPerHost:       settings.MaxConns,
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConns,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &UpstreamClient{
+		Settings: settings,
+		client: &http.Client{
+			Timeout:   settings.RequestTimeout,
+			Transport: transport,
+		},
+		streamClient: &http.Client{
+			Transport: transport,
+		},
+		transport: transport,
+	}
+}
+
+// Do sends a request. For streaming requests the response body is wrapped so
+// that a read waiting longer than FirstByteTimeout for the first byte, or
+// IdleTimeout for later ones, aborts the request with ErrStreamStalled.
+func (uc *UpstreamClient) Do(req *http.Request, stream bool) (*http.Response, error) {
+	if !stream {
+		return uc.client.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := uc.streamClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = newIdleTimeoutBody(resp.Body, uc.Settings.FirstByteTimeout, uc.Settings.IdleTimeout, cancel)
+	return resp, nil
+}
+
+// ClientPool keeps one UpstreamClient per upstream ID
+type ClientPool struct {
+	mu      sync.RWMutex
+	clients map[uint]*UpstreamClient
+	def     *UpstreamClient
+}
+
+var (
+	clientPool     *ClientPool
+	clientPoolOnce sync.Once
+)
+
+// GetClientPool returns the singleton client pool
+func GetClientPool() *ClientPool {
+	clientPoolOnce.Do(func() {
+		clientPool = &ClientPool{
+			clients: make(map[uint]*UpstreamClient),
+			def:     newUpstreamClient(SettingsFor(&models.CodexUpstream{})),
+		}
+	})
+	return clientPool
+}
+
+// ClientFor returns the client for an upstream, creating it on first use.
+// Upstreams without an ID (e.g. the settings fallback) share a default client.
+func (p *ClientPool) ClientFor(upstream *models.CodexUpstream) *UpstreamClient {
+	if upstream.ID == 0 {
+		return p.def
+	}
+
+	settings := SettingsFor(upstream)
+
+	p.mu.RLock()
+	client, ok := p.clients[upstream.ID]
+	p.mu.RUnlock()
+	if ok && client.Settings == settings {
+		return client
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[upstream.ID]; ok {
+		if client.Settings == settings {
+			return client
+		}
+		client.transport.CloseIdleConnections()
+	}
+	client = newUpstreamClient(settings)
+	p.clients[upstream.ID] = client
+	return client
+}
+
+// Sync rebuilds clients whose settings changed and drops clients for upstreams
+// that no longer exist
+func (p *ClientPool) Sync(upstreams []models.CodexUpstream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := make(map[uint]bool, len(upstreams))
+	for i := range upstreams {
+		upstream := &upstreams[i]
+		seen[upstream.ID] = true
+
+		settings := SettingsFor(upstream)
+		if client, ok := p.clients[upstream.ID]; ok {
+			if client.Settings == settings {
+				continue
+			}
+			client.transport.CloseIdleConnections()
+			logger.Component("Upstream").Info("rebuilding HTTP client", "upstream", upstream.Name, "upstream_id", upstream.ID)
+		}
+		p.clients[upstream.ID] = newUpstreamClient(settings)
+	}
+
+	for id, client := range p.clients {
+		if !seen[id] {
+			client.transport.CloseIdleConnections()
+			delete(p.clients, id)
+		}
+	}
+}
+
+// idleTimeoutBody cancels the request when a read waits too long for data.
+// Only time spent inside Read counts, so a slow client does not stall the
+// upstream.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	firstByteTimeout time.Duration
+	idleTimeout      time.Duration
+	received         bool
+	stalled          atomic.Bool
+	cancel           context.CancelFunc
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, firstByteTimeout, idleTimeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	return &idleTimeoutBody{
+		ReadCloser:       body,
+		firstByteTimeout: firstByteTimeout,
+		idleTimeout:      idleTimeout,
+		cancel:           cancel,
+	}
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	timeout := b.idleTimeout
+	if !b.received {
+		timeout = b.firstByteTimeout
+	}
+	timer := time.AfterFunc(timeout, func() {
+		b.stalled.Store(true)
+		b.cancel()
+	})
+	n, err := b.ReadCloser.Read(p)
+	timer.Stop()
+
+	if n > 0 {
+		b.received = true
+	}
+	if err != nil && b.stalled.Load() {
+		err = fmt.Errorf("%w: no data for %v", ErrStreamStalled, timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,173 @@
+package upstream
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/models"
+)
+
+func TestSettingsFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream models.CodexUpstream
+		want     ClientSettings
+	}{
+		{
+			name:     "defaults",
+			upstream: models.CodexUpstream{},
+			want:     ClientSettings{defaultRequestTimeout, defaultFirstByteTimeout, defaultIdleTimeout, defaultMaxConns, defaultMaxIdleConns},
+		},
+		{
+			name:     "configured",
+			upstream: models.CodexUpstream{Timeout: 300, FirstByteTimeout: 20, IdleTimeout: 15, MaxConns: 5, MaxIdleConns: 2},
+			want:     ClientSettings{300 * time.Second, 20 * time.Second, 15 * time.Second, 5, 2},
+		},
+		{
+			name:     "first byte capped by the request timeout",
+			upstream: models.CodexUpstream{Timeout: 30, FirstByteTimeout: 90},
+			want:     ClientSettings{30 * time.Second, 30 * time.Second, defaultIdleTimeout, defaultMaxConns, defaultMaxIdleConns},
+		},
+	}
+	for _, tt := range tests {
+		if got := SettingsFor(&tt.upstream); got != tt.want {
+			t.Errorf("%s: SettingsFor = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientPoolReuse(t *testing.T) {
+	pool := &ClientPool{clients: make(map[uint]*UpstreamClient), def: newUpstreamClient(SettingsFor(&models.CodexUpstream{}))}
+	upstream := models.CodexUpstream{ID: 1, Timeout: 60}
+
+	first := pool.ClientFor(&upstream)
+	if pool.ClientFor(&upstream) != first {
+		t.Error("unchanged upstream got a new client")
+	}
+	if pool.ClientFor(&models.CodexUpstream{}) != pool.def {
+		t.Error("upstream without an ID did not get the default client")
+	}
+
+	upstream.Timeout = 90
+	changed := pool.ClientFor(&upstream)
+	if changed == first || changed.Settings.RequestTimeout != 90*time.Second {
+		t.Errorf("changed timeout kept the old client (%v)", changed.Settings.RequestTimeout)
+	}
+
+	// Sync rebuilds changed clients, keeps unchanged ones and drops removed upstreams
+	other := models.CodexUpstream{ID: 2}
+	pool.ClientFor(&other)
+	upstream.IdleTimeout = 5
+	pool.Sync([]models.CodexUpstream{upstream})
+	synced := pool.ClientFor(&upstream)
+	if synced == changed || synced.Settings.IdleTimeout != 5*time.Second {
+		t.Error("Sync kept a client whose settings changed")
+	}
+	pool.Sync([]models.CodexUpstream{upstream})
+	if pool.ClientFor(&upstream) != synced {
+		t.Error("Sync rebuilt an unchanged client")
+	}
+	if _, ok := pool.clients[other.ID]; ok {
+		t.Error("Sync kept the client of a removed upstream")
+	}
+}
+
+// stallingServer serves a response that stops after the given steps, until
+// the client gives up
+func stallingServer(t *testing.T, steps ...string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, step := range steps {
+			switch step {
+			case "headers":
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+			case "chunk":
+				io.WriteString(w, "data: {}\n\n")
+				w.(http.Flusher).Flush()
+			case "pause":
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpstreamClientTimeouts(t *testing.T) {
+	settings := ClientSettings{
+		RequestTimeout:   200 * time.Millisecond,
+		FirstByteTimeout: 100 * time.Millisecond,
+		IdleTimeout:      100 * time.Millisecond,
+		MaxConns:         4,
+		MaxIdleConns:     4,
+	}
+	tests := []struct {
+		name        string
+		stream      bool
+		steps       []string
+		readPause   time.Duration // Between client reads
+		wantDoErr   bool
+		wantStalled bool
+		wantChunks  int
+	}{
+		{name: "no headers", stream: true, wantDoErr: true},
+		{name: "no first byte", stream: true, steps: []string{"headers"}, wantStalled: true},
+		{name: "stalls mid-stream", stream: true, steps: []string{"headers", "chunk", "chunk"}, wantStalled: true, wantChunks: 2},
+		{name: "steady stream", stream: true, steps: []string{"headers", "chunk", "pause", "chunk", "pause", "chunk"}, wantStalled: true, wantChunks: 3},
+		{name: "slow client", stream: true, steps: []string{"headers", "chunk", "chunk"}, readPause: 150 * time.Millisecond, wantStalled: true, wantChunks: 2},
+		{name: "request timeout", steps: []string{"headers", "chunk"}, wantChunks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := stallingServer(t, tt.steps...)
+			client := newUpstreamClient(settings)
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+			start := time.Now()
+			resp, err := client.Do(req, tt.stream)
+			if tt.wantDoErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("Do succeeded without response headers")
+				}
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("gave up after %v, want about the first-byte timeout", elapsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			chunks := 0
+			buf := make([]byte, len("data: {}\n\n"))
+			for {
+				time.Sleep(tt.readPause)
+				_, err = io.ReadFull(resp.Body, buf)
+				if err != nil {
+					break
+				}
+				chunks++
+			}
+			if chunks != tt.wantChunks {
+				t.Errorf("read %d chunks, want %d", chunks, tt.wantChunks)
+			}
+			if stalled := errors.Is(err, ErrStreamStalled); stalled != tt.wantStalled {
+				t.Errorf("read error = %v, want stalled %v", err, tt.wantStalled)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("took %v, want the stall detected by a timeout", elapsed)
+			}
+		})
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"codex-gateway/internal/database"
 	"codex-gateway/internal/models"
+	"codex-gateway/internal/statestore"
 )
 
 // HealthChecker manages upstream health checks
@@ -20,7 +24,6 @@ type HealthChecker struct {
 	checkInterval time.Duration
 	timeout       time.Duration
 	maxFailures   int
-	failureCounts map[uint]int
 	stopCh        chan struct{}
 	wg            sync.WaitGroup
 }
@@ -37,7 +40,6 @@ func GetHealthChecker() *HealthChecker {
 			checkInterval: 60 * time.Second, // Check every minute
 			timeout:       10 * time.Second, // 10 second timeout
 			maxFailures:   3,                // Mark unhealthy after 3 consecutive failures
-			failureCounts: make(map[uint]int),
 			stopCh:        make(chan struct{}),
 		}
 	})
@@ -77,11 +79,16 @@ func (hc *HealthChecker) Stop() {
 
 // CheckAllUpstreams checks health of all upstreams (exported for manual trigger)
 func (hc *HealthChecker) CheckAllUpstreams() {
-	hc.checkAllUpstreams()
+	hc.checkUpstreams(true)
 }
 
-// checkAllUpstreams checks health of all upstreams
+// checkAllUpstreams runs a scheduled check. With several replicas sharing a
+// state store, only the replica holding an upstream's lease checks it.
 func (hc *HealthChecker) checkAllUpstreams() {
+	hc.checkUpstreams(false)
+}
+
+func (hc *HealthChecker) checkUpstreams(force bool) {
 	var upstreams []models.CodexUpstream
 
 	// Load all upstreams (including disabled ones, but we'll only check active/unhealthy)
@@ -97,6 +104,9 @@ func (hc *HealthChecker) checkAllUpstreams() {
 		upstream := &upstreams[i]
 		// Only check active or unhealthy upstreams (skip manually disabled ones)
 		if upstream.Status == "active" || upstream.Status == "unhealthy" {
+			if !force && !hc.acquireLease(upstream.ID) {
+				continue
+			}
 			log.Printf("[HealthCheck] Checking upstream: %s (status: %s, base_url: %s)",
 				upstream.Name, upstream.Status, upstream.BaseURL)
 			go hc.checkUpstream(upstream)
@@ -118,7 +128,7 @@ func (hc *HealthChecker) checkUpstream(upstream *models.CodexUpstream) {
 
 	if healthy {
 		// Reset failure count
-		hc.failureCounts[upstream.ID] = 0
+		hc.resetFailures(upstream.ID)
 
 		// If was unhealthy, mark as active
 		if upstream.Status == "unhealthy" {
@@ -142,8 +152,7 @@ func (hc *HealthChecker) checkUpstream(upstream *models.CodexUpstream) {
 		}
 	} else {
 		// Increment failure count
-		hc.failureCounts[upstream.ID]++
-		failCount := hc.failureCounts[upstream.ID]
+		failCount := hc.incrFailures(upstream.ID)
 
 		log.Printf("[HealthCheck] ❌ Upstream %s check failed (failures: %d/%d)",
 			upstream.Name, failCount, hc.maxFailures)
@@ -205,7 +214,6 @@ func (hc *HealthChecker) performHealthCheck(upstream *models.CodexUpstream) bool
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+upstream.APIKey)
-	log.Printf("[HealthCheck] Using API Key: %s...", upstream.APIKey[:min(20, len(upstream.APIKey))])
 
 	// Send request
 	client := &http.Client{
@@ -226,7 +234,8 @@ func (hc *HealthChecker) performHealthCheck(upstream *models.CodexUpstream) bool
 		return false
 	}
 
-	log.Printf("[HealthCheck] Response from %s: status=%d, body=%s", upstream.Name, resp.StatusCode, string(body))
+	slog.Debug("health check response", "component", "HealthCheck",
+		"upstream", upstream.Name, "status", resp.StatusCode, "body", string(body))
 
 	// Check status code
 	if resp.StatusCode >= 200 && resp.StatusCode < 500 {
@@ -250,7 +259,45 @@ func min(a, b int) int {
 
 // GetFailureCount returns the current failure count for an upstream
 func (hc *HealthChecker) GetFailureCount(upstreamID uint) int {
-	hc.mu.RLock()
-	defer hc.mu.RUnlock()
-	return hc.failureCounts[upstreamID]
+	ctx, cancel := statestore.Context()
+	defer cancel()
+	value, ok, err := statestore.Get().Get(ctx, healthFailuresKey(upstreamID))
+	if err != nil || !ok {
+		return 0
+	}
+	count, _ := strconv.Atoi(value)
+	return count
+}
+
+// acquireLease claims this interval's check of an upstream for this replica.
+// Store errors fail open so checks keep running without shared state.
+func (hc *HealthChecker) acquireLease(upstreamID uint) bool {
+	ctx, cancel := statestore.Context()
+	defer cancel()
+	key := fmt.Sprintf("health:lease:%d", upstreamID)
+	acquired, err := statestore.Get().SetNX(ctx, key, "1", hc.checkInterval-time.Second)
+	return acquired || err != nil
+}
+
+func (hc *HealthChecker) incrFailures(upstreamID uint) int {
+	ctx, cancel := statestore.Context()
+	defer cancel()
+	count, err := statestore.Get().Incr(ctx, healthFailuresKey(upstreamID), 24*time.Hour)
+	if err != nil {
+		log.Printf("[HealthCheck] Failed to record failure for upstream %d: %v", upstreamID, err)
+		return 1
+	}
+	return int(count)
+}
+
+func (hc *HealthChecker) resetFailures(upstreamID uint) {
+	ctx, cancel := statestore.Context()
+	defer cancel()
+	if err := statestore.Get().Del(ctx, healthFailuresKey(upstreamID)); err != nil {
+		log.Printf("[HealthCheck] Failed to reset failures for upstream %d: %v", upstreamID, err)
+	}
+}
+
+func healthFailuresKey(upstreamID uint) string {
+	return fmt.Sprintf("health:failures:%d", upstreamID)
 }
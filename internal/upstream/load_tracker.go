@@ -0,0 +1,90 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// ewmaAlpha weights the newest latency sample
+const ewmaAlpha = 0.2
+
+type upstreamLoad struct {
+	inFlight int
+	ewma     time.Duration
+}
+
+// LoadTracker tracks outstanding requests and EWMA latency per upstream
+type LoadTracker struct {
+	mu    sync.Mutex
+	loads map[uint]*upstreamLoad
+}
+
+var (
+	loadTracker     *LoadTracker
+	loadTrackerOnce sync.Once
+)
+
+// GetLoadTracker returns the singleton load tracker
+func GetLoadTracker() *LoadTracker {
+	loadTrackerOnce.Do(func() {
+		loadTracker = &LoadTracker{loads: make(map[uint]*upstreamLoad)}
+	})
+	return loadTracker
+}
+
+// Begin marks a request to the upstream as outstanding
+func (lt *LoadTracker) Begin(upstreamID uint) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.get(upstreamID).inFlight++
+}
+
+// End marks an outstanding request as finished
+func (lt *LoadTracker) End(upstreamID uint) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if load := lt.get(upstreamID); load.inFlight > 0 {
+		load.inFlight--
+	}
+}
+
+// ObserveLatency folds a time-to-first-byte sample into the upstream's EWMA
+func (lt *LoadTracker) ObserveLatency(upstreamID uint, latency time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	load := lt.get(upstreamID)
+	if load.ewma == 0 {
+		load.ewma = latency
+		return
+	}
+	load.ewma = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(load.ewma))
+}
+
+// InFlight returns the number of outstanding requests to the upstream
+func (lt *LoadTracker) InFlight(upstreamID uint) int {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if load, ok := lt.loads[upstreamID]; ok {
+		return load.inFlight
+	}
+	return 0
+}
+
+// Latency returns the upstream's EWMA latency, or 0 when unknown
+func (lt *LoadTracker) Latency(upstreamID uint) time.Duration {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if load, ok := lt.loads[upstreamID]; ok {
+		return load.ewma
+	}
+	return 0
+}
+
+func (lt *LoadTracker) get(upstreamID uint) *upstreamLoad {
+	load, ok := lt.loads[upstreamID]
+	if !ok {
+		load = &upstreamLoad{}
+		lt.loads[upstreamID] = load
+	}
+	return load
+}
@@ -0,0 +1,57 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadTrackerLatency(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    time.Duration
+	}{
+		{"unknown", nil, 0},
+		{"first sample", []time.Duration{100 * ms}, 100 * ms},
+		{"slower sample", []time.Duration{100 * ms, 200 * ms}, 120 * ms},
+		{"keeps moving", []time.Duration{100 * ms, 200 * ms, 200 * ms}, 136 * ms},
+		{"recovers", []time.Duration{500 * ms, 100 * ms}, 420 * ms},
+	}
+	for _, tt := range tests {
+		lt := &LoadTracker{loads: make(map[uint]*upstreamLoad)}
+		for _, sample := range tt.samples {
+			lt.ObserveLatency(1, sample)
+		}
+		if got := lt.Latency(1); got != tt.want {
+			t.Errorf("%s: latency = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadTrackerInFlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps string // b = Begin, e = End
+		want  int
+	}{
+		{"idle", "", 0},
+		{"outstanding", "bbb", 3},
+		{"finished", "bbe", 1},
+		{"never negative", "beee", 0},
+		{"counts again after extra ends", "eeb", 1},
+	}
+	for _, tt := range tests {
+		lt := &LoadTracker{loads: make(map[uint]*upstreamLoad)}
+		for _, step := range tt.steps {
+			if step == 'b' {
+				lt.Begin(1)
+			} else {
+				lt.End(1)
+			}
+		}
+		if got := lt.InFlight(1); got != tt.want {
+			t.Errorf("%s: in flight = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package upstream
+
+import (
+	"path"
+	"strings"
+
+	"codex-gateway/internal/models"
+)
+
+// SupportsModel reports whether the upstream can serve the requested model,
+// either through its allowlist or an alias. An empty allowlist serves everything.
+func SupportsModel(upstream *models.CodexUpstream, model string) bool {
+	if model == "" || len(upstream.SupportedModels) == 0 {
+		return true
+	}
+	if _, ok := upstream.ModelAliases[model]; ok {
+		return true
+	}
+	return matchesModel(upstream.SupportedModels, model)
+}
+
+// ResolveModel returns the model name to send to the upstream after alias rewrites
+func ResolveModel(upstream *models.CodexUpstream, model string) string {
+	if alias, ok := upstream.ModelAliases[model]; ok && alias != "" {
+		return alias
+	}
+	return model
+}
+
+// matchesModel checks a model against exact names and glob patterns
+func matchesModel(patterns []string, model string) bool {
+	model = strings.ToLower(model)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if pattern == model {
+			return true
+		}
+		if ok, err := path.Match(pattern, model); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package upstream
+
+import (
+	"testing"
+
+	"codex-gateway/internal/models"
+)
+
+func TestSupportsModel(t *testing.T) {
+	codex := models.CodexUpstream{
+		SupportedModels: []string{"gpt-5.1", " GPT-5.1-codex-* ", "", "o[3"},
+		ModelAliases:    map[string]string{"codex-latest": "gpt-5.1-codex-max"},
+	}
+	tests := []struct {
+		name     string
+		upstream models.CodexUpstream
+		model    string
+		want     bool
+	}{
+		{"empty allowlist serves everything", models.CodexUpstream{}, "anything", true},
+		{"no model requested", codex, "", true},
+		{"exact match", codex, "gpt-5.1", true},
+		{"exact match ignores case", codex, "GPT-5.1", true},
+		{"exact name is not a prefix", codex, "gpt-5.1-mini", false},
+		{"glob match", codex, "gpt-5.1-codex-mini", true},
+		{"glob match ignores case and padding", codex, "gpt-5.1-Codex-Max", true},
+		{"glob needs its prefix", codex, "gpt-5.1-codex", false},
+		{"glob does not cross slashes", codex, "gpt-5.1-codex-a/b", false},
+		{"alias served", codex, "codex-latest", true},
+		{"invalid pattern matches only itself", codex, "o[3", true},
+		{"invalid pattern is not a glob", codex, "o3", false},
+		{"unlisted model", codex, "gpt-4o", false},
+	}
+	for _, tt := range tests {
+		if got := SupportsModel(&tt.upstream, tt.model); got != tt.want {
+			t.Errorf("%s: SupportsModel(%q) = %v, want %v", tt.name, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestResolveModel(t *testing.T) {
+	openai := models.CodexUpstream{ModelAliases: map[string]string{"codex-latest": "gpt-5.1-codex-max", "blank": ""}}
+	azure := models.CodexUpstream{ModelAliases: map[string]string{"codex-latest": "codex-deployment"}}
+	tests := []struct {
+		name     string
+		upstream models.CodexUpstream
+		model    string
+		want     string
+	}{
+		{"alias rewritten", openai, "codex-latest", "gpt-5.1-codex-max"},
+		{"same alias mapped per upstream", azure, "codex-latest", "codex-deployment"},
+		{"unaliased model kept", openai, "gpt-5.1", "gpt-5.1"},
+		{"empty alias keeps the model", openai, "blank", "blank"},
+		{"no aliases", models.CodexUpstream{}, "codex-latest", "codex-latest"},
+	}
+	for _, tt := range tests {
+		if got := ResolveModel(&tt.upstream, tt.model); got != tt.want {
+			t.Errorf("%s: ResolveModel(%q) = %q, want %q", tt.name, tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package upstream
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// Attempt records a single try of a proxied request against one upstream
+type Attempt struct {
+	UpstreamID   uint          `json:"upstream_id"`
+	UpstreamName string        `json:"upstream_name"`
+	StatusCode   int           `json:"status_code"` // 0 when no response was received
+	Error        string        `json:"error,omitempty"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// IsRetryableStatus reports whether a response status should be retried on another upstream
+func IsRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Backoff returns the delay before the given retry (1-based), using exponential
+// backoff with jitter. A Retry-After hint from the upstream is honored up to the cap.
+func Backoff(retry int, retryAfter time.Duration) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+	delay := retryBaseDelay << (retry - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	// Full jitter on the upper half to avoid synchronized retries
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// ParseRetryAfter parses a Retry-After header given in seconds
+func ParseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
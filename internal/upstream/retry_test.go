@@ -0,0 +1,75 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsRetryableStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{200, false},
+		{400, false},
+		{401, false},
+		{404, false},
+		{429, true},
+		{500, true},
+		{502, true},
+		{529, true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryableStatus(tt.status); got != tt.want {
+			t.Errorf("IsRetryableStatus(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		retry      int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{name: "first retry", retry: 1, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{name: "retry below one", retry: 0, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{name: "second retry", retry: 2, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{name: "third retry", retry: 3, min: 400 * time.Millisecond, max: 800 * time.Millisecond},
+		{name: "capped", retry: 10, min: retryMaxDelay / 2, max: retryMaxDelay},
+		{name: "shift overflow", retry: 100, min: retryMaxDelay / 2, max: retryMaxDelay},
+		{name: "retry-after honored", retry: 1, retryAfter: time.Second, min: time.Second, max: time.Second},
+		{name: "retry-after capped", retry: 1, retryAfter: time.Minute, min: retryMaxDelay, max: retryMaxDelay},
+		{name: "shorter retry-after ignored", retry: 3, retryAfter: time.Millisecond, min: 400 * time.Millisecond, max: 800 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		// Jitter is random; sample enough to cover its range
+		for i := 0; i < 100; i++ {
+			if got := Backoff(tt.retry, tt.retryAfter); got < tt.min || got > tt.max {
+				t.Errorf("%s: Backoff = %v, want between %v and %v", tt.name, got, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{" 12 ", 12 * time.Second},
+		{"0", 0},
+		{"-5", 0},
+		{"1.5", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
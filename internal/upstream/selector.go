@@ -1,8 +1,7 @@
 package upstream
 
 import (
-	"crypto/sha256"
-	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -14,6 +13,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrModelNotSupported is returned when no configured upstream offers the requested model
+var ErrModelNotSupported = errors.New("model not supported by any upstream")
+
 // UpstreamSelector manages Codex upstream selection with user affinity
 type UpstreamSelector struct {
 	mu              sync.RWMutex
@@ -22,6 +24,7 @@ type UpstreamSelector struct {
 	refreshInterval time.Duration
 	refreshMu       sync.Mutex
 	refreshing      bool
+	strategy        string
 }
 
 var (
@@ -35,6 +38,7 @@ func GetSelector() *UpstreamSelector {
 		selector = &UpstreamSelector{
 			upstreams:       make([]models.CodexUpstream, 0),
 			refreshInterval: 30 * time.Second,
+			strategy:        StrategyConsistentHash,
 		}
 		selector.RefreshUpstreams()
 	})
@@ -52,72 +56,99 @@ func (s *UpstreamSelector) RefreshUpstreams() error {
 		return fmt.Errorf("failed to load upstreams: %w", err)
 	}
 
+	// Load the deployment-wide load-balancing strategy
+	strategy := StrategyConsistentHash
+	var settings models.SystemSettings
+	if err := database.DB.Select("upstream_strategy").First(&settings).Error; err == nil && ValidStrategy(settings.UpstreamStrategy) {
+		strategy = settings.UpstreamStrategy
+	}
+
 	s.mu.Lock()
 	s.upstreams = upstreams
+	s.strategy = strategy
 	s.lastRefresh = time.Now()
 	s.mu.Unlock()
 
-	log.Printf("[Upstream] Loaded %d upstreams", len(upstreams))
+	// Rebuild HTTP clients whose timeout or connection settings changed
+	GetClientPool().Sync(upstreams)
+
+	log.Printf("[Upstream] Loaded %d upstreams (strategy: %s)", len(upstreams), strategy)
 	return nil
 }
 
-// SelectForUser selects an upstream for a specific user using consistent hashing
-// This ensures the same user always gets the same upstream (session affinity)
-func (s *UpstreamSelector) SelectForUser(userID uuid.UUID) (*models.CodexUpstream, error) {
-	s.maybeRefresh()
-
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// Filter active upstreams
-	activeUpstreams := make([]models.CodexUpstream, 0)
-	for _, upstream := range s.upstreams {
-		if upstream.Status == "active" {
-			activeUpstreams = append(activeUpstreams, upstream)
+// SelectForUser selects an upstream that serves the model for a specific user using
+// the configured strategy. The default consistent-hash strategy keeps each user on
+// the same upstream (session affinity) even as upstreams are added or removed.
+func (s *UpstreamSelector) SelectForUser(userID uuid.UUID, model string) (*models.CodexUpstream, error) {
+	selected, err := s.selectFrom(userID, model, nil)
+	if err != nil {
+		if errors.Is(err, ErrModelNotSupported) {
+			return nil, err
 		}
-	}
-
-	if len(activeUpstreams) == 0 {
 		return nil, fmt.Errorf("no active upstreams available")
 	}
 
-	// Use consistent hashing to select upstream based on user ID
-	hash := hashUserID(userID)
-	index := int(hash % uint64(len(activeUpstreams)))
-
-	selected := &activeUpstreams[index]
 	log.Printf("[Upstream] User %s → Upstream %s (%s)", userID, selected.Name, selected.BaseURL)
-
 	return selected, nil
 }
 
 // SelectWithFallback selects an upstream with fallback to next priority
-func (s *UpstreamSelector) SelectWithFallback(userID uuid.UUID, excludeIDs []uint) (*models.CodexUpstream, error) {
+func (s *UpstreamSelector) SelectWithFallback(userID uuid.UUID, model string, excludeIDs []uint) (*models.CodexUpstream, error) {
+	selected, err := s.selectFrom(userID, model, excludeIDs)
+	if err != nil {
+		if errors.Is(err, ErrModelNotSupported) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no available upstreams (all failed or disabled)")
+	}
+
+	log.Printf("[Upstream] User %s → Fallback Upstream %s (%s)", userID, selected.Name, selected.BaseURL)
+	return selected, nil
+}
+
+// selectFrom picks among active upstreams that serve the model, are not excluded
+// and whose circuit is closed. ErrModelNotSupported is returned when upstreams are
+// configured but none of them offers the model at all.
+func (s *UpstreamSelector) selectFrom(userID uuid.UUID, model string, excludeIDs []uint) (*models.CodexUpstream, error) {
 	s.maybeRefresh()
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Filter active upstreams excluding failed ones
-	availableUpstreams := make([]models.CodexUpstream, 0)
-	for _, upstream := range s.upstreams {
-		if upstream.Status == "active" && !contains(excludeIDs, upstream.ID) {
-			availableUpstreams = append(availableUpstreams, upstream)
+	breaker := GetCircuitBreaker()
+	active := 0
+	serving := 0
+	candidates := make([]models.CodexUpstream, 0, len(s.upstreams))
+	for i := range s.upstreams {
+		upstream := &s.upstreams[i]
+		if upstream.Status != "active" {
+			continue
+		}
+		active++
+		if !SupportsModel(upstream, model) {
+			continue
+		}
+		serving++
+		if !contains(excludeIDs, upstream.ID) && breaker.Available(upstream.ID) {
+			candidates = append(candidates, *upstream)
 		}
 	}
 
-	if len(availableUpstreams) == 0 {
-		return nil, fmt.Errorf("no available upstreams (all failed or disabled)")
+	if active > 0 && serving == 0 {
+		return nil, ErrModelNotSupported
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidate upstreams")
 	}
 
-	// Use consistent hashing
-	hash := hashUserID(userID)
-	index := int(hash % uint64(len(availableUpstreams)))
-
-	selected := &availableUpstreams[index]
-	log.Printf("[Upstream] User %s → Fallback Upstream %s (%s)", userID, selected.Name, selected.BaseURL)
+	return pickUpstream(s.strategy, userID, candidates), nil
+}
 
-	return selected, nil
+// Strategy returns the active load-balancing strategy
+func (s *UpstreamSelector) Strategy() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.strategy
 }
 
 // GetAllUpstreams returns all upstreams (for admin management)
@@ -130,12 +161,6 @@ func (s *UpstreamSelector) GetAllUpstreams() []models.CodexUpstream {
 	return result
 }
 
-// hashUserID creates a consistent hash from user ID
-func hashUserID(userID uuid.UUID) uint64 {
-	h := sha256.Sum256(userID[:])
-	return binary.BigEndian.Uint64(h[:8])
-}
-
 // contains checks if a slice contains a value
 func contains(slice []uint, val uint) bool {
 	for _, item := range slice {
@@ -0,0 +1,60 @@
+package upstream
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestSelectFromModelRouting(t *testing.T) {
+	upstreams := []models.CodexUpstream{
+		{ID: 201, Status: "active", Priority: 0, SupportedModels: []string{"gpt-5.1-codex-*"}},
+		{ID: 202, Status: "active", Priority: 1, SupportedModels: []string{"gpt-5.1"}, ModelAliases: map[string]string{"codex-latest": "gpt-5.1-codex-max"}},
+		{ID: 203, Status: "disabled", SupportedModels: []string{"gpt-4o"}},
+	}
+	tests := []struct {
+		name      string
+		upstreams []models.CodexUpstream
+		model     string
+		exclude   []uint
+		want      uint
+		wantErr   error // nil with want 0 means any other error
+	}{
+		{name: "glob match", upstreams: upstreams, model: "gpt-5.1-codex-mini", want: 201},
+		{name: "exact match", upstreams: upstreams, model: "gpt-5.1", want: 202},
+		{name: "alias match", upstreams: upstreams, model: "codex-latest", want: 202},
+		{name: "served only by a disabled upstream", upstreams: upstreams, model: "gpt-4o", wantErr: ErrModelNotSupported},
+		{name: "served by no upstream", upstreams: upstreams, model: "claude-sonnet", wantErr: ErrModelNotSupported},
+		{name: "serving upstream excluded", upstreams: upstreams, model: "gpt-5.1", exclude: []uint{202}},
+		{name: "no active upstreams", upstreams: upstreams[2:], model: "gpt-5.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &UpstreamSelector{
+				upstreams:       tt.upstreams,
+				lastRefresh:     time.Now(),
+				refreshInterval: time.Hour,
+				strategy:        StrategyPriority,
+			}
+			got, err := s.selectFrom(uuid.New(), tt.model, tt.exclude)
+			switch {
+			case tt.want != 0:
+				if err != nil || got.ID != tt.want {
+					t.Errorf("selected %+v (%v), want upstream %d", got, err, tt.want)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || errors.Is(err, ErrModelNotSupported) {
+					t.Errorf("error = %v, want no available upstream", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Load-balancing strategies
+const (
+	StrategyConsistentHash = "consistent_hash" // Weighted rendezvous hashing on user ID
+	StrategyPriority       = "priority"        // Strict priority tiers with spillover
+	StrategyWeightedRandom = "weighted_random" // Random, proportional to weight
+	StrategyLeastLoaded    = "least_loaded"    // Fewest outstanding requests, scaled by EWMA latency
+)
+
+// ValidStrategy reports whether name is a known load-balancing strategy
+func ValidStrategy(name string) bool {
+	switch name {
+	case StrategyConsistentHash, StrategyPriority, StrategyWeightedRandom, StrategyLeastLoaded:
+		return true
+	}
+	return false
+}
+
+// pickUpstream chooses one of the candidates according to the strategy.
+// candidates must be non-empty and already filtered for availability.
+func pickUpstream(strategy string, userID uuid.UUID, candidates []models.CodexUpstream) *models.CodexUpstream {
+	switch strategy {
+	case StrategyPriority:
+		return pickByPriority(userID, candidates)
+	case StrategyWeightedRandom:
+		return pickWeightedRandom(candidates)
+	case StrategyLeastLoaded:
+		return pickLeastLoaded(candidates)
+	default:
+		return pickRendezvous(userID, candidates)
+	}
+}
+
+// pickRendezvous uses weighted rendezvous (highest random weight) hashing.
+// Each user keeps its upstream when others are added or removed; only users
+// of a removed upstream move, and they spread in proportion to weight.
+func pickRendezvous(userID uuid.UUID, candidates []models.CodexUpstream) *models.CodexUpstream {
+	best := -1
+	bestScore := math.Inf(-1)
+	for i := range candidates {
+		h := rendezvousHash(userID, candidates[i].ID)
+		// Map the hash into (0, 1) and apply the weighted score -w/ln(h)
+		u := (float64(h>>11) + 0.5) / float64(1<<53)
+		score := -float64(effectiveWeight(&candidates[i])) / math.Log(u)
+		if score > bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+	return &candidates[best]
+}
+
+// pickByPriority keeps traffic on the lowest priority number that has capacity.
+// A tier spills over to the next one when every upstream in it is at MaxConns.
+func pickByPriority(userID uuid.UUID, candidates []models.CodexUpstream) *models.CodexUpstream {
+	sorted := make([]models.CodexUpstream, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+
+	tracker := GetLoadTracker()
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+
+		tier := make([]models.CodexUpstream, 0, end-start)
+		for _, u := range sorted[start:end] {
+			if tracker.InFlight(u.ID) < SettingsFor(&u).MaxConns {
+				tier = append(tier, u)
+			}
+		}
+		if len(tier) > 0 {
+			return pickRendezvous(userID, tier)
+		}
+		start = end
+	}
+
+	// Every tier is saturated; stay on the top tier rather than failing
+	return pickRendezvous(userID, sorted[:1])
+}
+
+// randIntn picks weighted random upstreams; tests replace it with a seeded source
+var randIntn = rand.Intn
+
+func pickWeightedRandom(candidates []models.CodexUpstream) *models.CodexUpstream {
+	total := 0
+	for i := range candidates {
+		total += effectiveWeight(&candidates[i])
+	}
+	n := randIntn(total)
+	for i := range candidates {
+		n -= effectiveWeight(&candidates[i])
+		if n < 0 {
+			return &candidates[i]
+		}
+	}
+	return &candidates[len(candidates)-1]
+}
+
+// pickLeastLoaded scores each upstream by (outstanding+1) × EWMA latency / weight
+// and picks the lowest. Upstreams without latency data are tried first.
+func pickLeastLoaded(candidates []models.CodexUpstream) *models.CodexUpstream {
+	tracker := GetLoadTracker()
+	best := -1
+	bestScore := math.Inf(1)
+	for i := range candidates {
+		latency := tracker.Latency(candidates[i].ID)
+		if latency <= 0 {
+			latency = time.Millisecond
+		}
+		score := float64(tracker.InFlight(candidates[i].ID)+1) * float64(latency) / float64(effectiveWeight(&candidates[i]))
+		if score < bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+	return &candidates[best]
+}
+
+func effectiveWeight(upstream *models.CodexUpstream) int {
+	if upstream.Weight <= 0 {
+		return 1
+	}
+	return upstream.Weight
+}
+
+// rendezvousHash hashes a (user, upstream) pair
+func rendezvousHash(userID uuid.UUID, upstreamID uint) uint64 {
+	var buf [24]byte
+	copy(buf[:16], userID[:])
+	binary.BigEndian.PutUint64(buf[16:], uint64(upstreamID))
+	h := sha256.Sum256(buf[:])
+	return binary.BigEndian.Uint64(h[:8])
+}
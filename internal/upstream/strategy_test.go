@@ -0,0 +1,167 @@
+package upstream
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"codex-gateway/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// useLoad sets the shared tracker's in-flight count and latency for upstreams
+// until the test ends
+func useLoad(t *testing.T, inFlight map[uint]int, latency map[uint]time.Duration) {
+	t.Helper()
+	tracker := GetLoadTracker()
+	tracker.mu.Lock()
+	saved := tracker.loads
+	tracker.loads = make(map[uint]*upstreamLoad)
+	for id, n := range inFlight {
+		tracker.get(id).inFlight = n
+	}
+	for id, ewma := range latency {
+		tracker.get(id).ewma = ewma
+	}
+	tracker.mu.Unlock()
+	t.Cleanup(func() {
+		tracker.mu.Lock()
+		tracker.loads = saved
+		tracker.mu.Unlock()
+	})
+}
+
+// seededUsers returns n user IDs that are the same on every run
+func seededUsers(n int) []uuid.UUID {
+	source := rand.New(rand.NewSource(1))
+	users := make([]uuid.UUID, n)
+	for i := range users {
+		users[i], _ = uuid.NewRandomFromReader(source)
+	}
+	return users
+}
+
+func TestPickByPriority(t *testing.T) {
+	upstreams := func(specs ...[3]int) []models.CodexUpstream {
+		var result []models.CodexUpstream
+		for _, s := range specs {
+			result = append(result, models.CodexUpstream{ID: uint(s[0]), Priority: s[1], MaxConns: s[2]})
+		}
+		return result
+	}
+	tests := []struct {
+		name       string
+		candidates []models.CodexUpstream // {id, priority, max conns}
+		inFlight   map[uint]int
+		want       []uint // Acceptable picks
+	}{
+		{"lowest priority number wins", upstreams([3]int{1, 2, 10}, [3]int{2, 0, 10}, [3]int{3, 1, 10}), nil, []uint{2}},
+		{"busy but not full stays", upstreams([3]int{1, 0, 10}, [3]int{2, 1, 10}), map[uint]int{1: 9}, []uint{1}},
+		{"full tier spills over", upstreams([3]int{1, 0, 2}, [3]int{2, 1, 10}), map[uint]int{1: 2}, []uint{2}},
+		{"spills past every full tier", upstreams([3]int{1, 0, 2}, [3]int{2, 1, 2}, [3]int{3, 2, 2}), map[uint]int{1: 2, 2: 3}, []uint{3}},
+		{"full member skipped within its tier", upstreams([3]int{1, 0, 2}, [3]int{2, 0, 10}, [3]int{3, 1, 10}), map[uint]int{1: 2}, []uint{2}},
+		{"everything full stays on top", upstreams([3]int{1, 1, 2}, [3]int{2, 0, 2}), map[uint]int{1: 2, 2: 2}, []uint{2}},
+		{"tier shared by rendezvous", upstreams([3]int{1, 0, 10}, [3]int{2, 0, 10}, [3]int{3, 1, 10}), nil, []uint{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useLoad(t, tt.inFlight, nil)
+			for _, user := range seededUsers(20) {
+				got := pickByPriority(user, tt.candidates).ID
+				if !containsID(tt.want, got) {
+					t.Fatalf("picked %d, want one of %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWeightDistribution(t *testing.T) {
+	t.Cleanup(func() { randIntn = rand.Intn })
+	const picks = 20000
+	tests := []struct {
+		name    string
+		weights []int
+		want    []float64 // Share per upstream
+	}{
+		{"equal", []int{1, 1}, []float64{0.5, 0.5}},
+		{"proportional", []int{1, 3}, []float64{0.25, 0.75}},
+		{"unset weight counts as one", []int{0, 1, 2}, []float64{0.25, 0.25, 0.5}},
+	}
+	for _, tt := range tests {
+		candidates := make([]models.CodexUpstream, len(tt.weights))
+		for i, weight := range tt.weights {
+			candidates[i] = models.CodexUpstream{ID: uint(i + 1), Weight: weight}
+		}
+
+		strategies := map[string]func(i int, user uuid.UUID) *models.CodexUpstream{
+			StrategyWeightedRandom: func(int, uuid.UUID) *models.CodexUpstream { return pickWeightedRandom(candidates) },
+			StrategyConsistentHash: func(_ int, user uuid.UUID) *models.CodexUpstream { return pickRendezvous(user, candidates) },
+		}
+		for strategy, pick := range strategies {
+			randIntn = rand.New(rand.NewSource(1)).Intn
+			counts := make(map[uint]int)
+			for i, user := range seededUsers(picks) {
+				counts[pick(i, user).ID]++
+			}
+			for i, want := range tt.want {
+				got := float64(counts[uint(i+1)]) / picks
+				if math.Abs(got-want) > 0.02 {
+					t.Errorf("%s %s: upstream %d share = %.3f, want %.2f", strategy, tt.name, i+1, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestRendezvousKeepsUsers(t *testing.T) {
+	all := []models.CodexUpstream{{ID: 1}, {ID: 2}, {ID: 3}}
+	withoutThird := all[:2]
+	for _, user := range seededUsers(1000) {
+		before := pickRendezvous(user, all).ID
+		after := pickRendezvous(user, withoutThird).ID
+		if before != 3 && after != before {
+			t.Fatalf("user %s moved from %d to %d when upstream 3 was removed", user, before, after)
+		}
+	}
+}
+
+func TestPickLeastLoaded(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		weights  []int
+		inFlight map[uint]int
+		latency  map[uint]time.Duration
+		want     uint
+	}{
+		{"fastest", []int{1, 1}, nil, map[uint]time.Duration{1: 300 * ms, 2: 100 * ms}, 2},
+		{"fast but busy", []int{1, 1}, map[uint]int{2: 3}, map[uint]time.Duration{1: 300 * ms, 2: 100 * ms}, 1},
+		{"equal latency, fewer outstanding", []int{1, 1}, map[uint]int{1: 2, 2: 1}, map[uint]time.Duration{1: 100 * ms, 2: 100 * ms}, 2},
+		{"weight scales the score", []int{4, 1}, map[uint]int{1: 2}, map[uint]time.Duration{1: 100 * ms, 2: 100 * ms}, 1},
+		{"unmeasured upstream tried first", []int{1, 1}, nil, map[uint]time.Duration{1: 50 * ms}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useLoad(t, tt.inFlight, tt.latency)
+			candidates := make([]models.CodexUpstream, len(tt.weights))
+			for i, weight := range tt.weights {
+				candidates[i] = models.CodexUpstream{ID: uint(i + 1), Weight: weight}
+			}
+			if got := pickLeastLoaded(candidates).ID; got != tt.want {
+				t.Errorf("picked %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package usagelog
+
+import (
+	"strconv"
+
+	"codex-gateway/internal/metrics"
+	"codex-gateway/internal/models"
+)
+
+// Observe feeds a finished request's usage log row into the gateway metrics
+func Observe(entry *models.UsageLog) {
+	model := modelLabel(entry)
+	upstream := metrics.UpstreamLabel(entry.UpstreamID)
+	path := metrics.PathLabel(entry.RequestPath)
+	status := strconv.Itoa(entry.StatusCode)
+
+	metrics.RequestsTotal.WithLabelValues(model, upstream, path, status, entry.ErrorClass).Inc()
+
+	switch entry.ErrorClass {
+	case ErrorRateLimited:
+		metrics.RateLimitRejections.WithLabelValues(path).Inc()
+	case ErrorPricing, ErrorBilling:
+		metrics.BillingFailures.WithLabelValues(model, upstream, entry.ErrorClass).Inc()
+	}
+
+	// Rejected before reaching an upstream; no latency worth recording
+	if entry.UpstreamID == nil {
+		return
+	}
+
+	metrics.RequestDuration.WithLabelValues(model, upstream, path, status).Observe(float64(entry.LatencyMs) / 1000)
+	if entry.Stream && entry.TimeToFirstTokenMs > 0 {
+		metrics.TimeToFirstByte.WithLabelValues(model, upstream, path).Observe(float64(entry.TimeToFirstTokenMs) / 1000)
+	}
+
+	if entry.Cost > 0 {
+		metrics.TokensTotal.WithLabelValues(model, upstream, "input", entry.UsageSource).Add(float64(entry.InputTokens))
+		metrics.TokensTotal.WithLabelValues(model, upstream, "output", entry.UsageSource).Add(float64(entry.OutputTokens))
+		metrics.TokensTotal.WithLabelValues(model, upstream, "cache_read", entry.UsageSource).Add(float64(entry.CachedTokens))
+		metrics.TokensTotal.WithLabelValues(model, upstream, "cache_creation", entry.UsageSource).Add(float64(entry.CacheCreationTokens))
+		metrics.CostTotal.WithLabelValues(model, upstream).Add(entry.Cost)
+	}
+}
+
+// modelLabel keeps client-supplied model names out of labels: only the
+// resolved model, when it is priced, is reported
+func modelLabel(entry *models.UsageLog) string {
+	switch entry.ErrorClass {
+	case ErrorModelNotSupported, ErrorInvalidRequest:
+		return "unsupported"
+	}
+	return metrics.ModelLabel(entry.Model)
+}
@@ -0,0 +1,52 @@
+package usagelog
+
+import (
+	"log/slog"
+
+	"codex-gateway/internal/database"
+	"codex-gateway/internal/models"
+)
+
+// Error classes recorded on usage logs. Successful requests have no class.
+const (
+	ErrorInvalidRequest      = "invalid_request"
+	ErrorInsufficientBalance = "insufficient_balance"
+	ErrorQuotaExceeded       = "quota_exceeded"
+	ErrorRateLimited         = "rate_limited"
+	ErrorKeyExpired          = "key_expired"
+	ErrorKeyScope            = "key_scope"
+	ErrorModelNotSupported   = "model_not_supported"
+	ErrorNoUpstream          = "no_upstream"
+	ErrorUpstreamStatus      = "upstream_status"
+	ErrorUpstreamConnection  = "upstream_connection"
+	ErrorClientDisconnected  = "client_disconnected"
+	ErrorStreamInterrupted   = "stream_interrupted"
+	ErrorPricing             = "pricing_error"
+	ErrorBilling             = "billing_failed"
+	ErrorInternal            = "internal_error"
+)
+
+// Usage sources: where the billed token counts came from
+const (
+	UsageReported  = "reported"  // Usage returned by the upstream
+	UsageEstimated = "estimated" // Estimated from streamed output
+)
+
+// StatusClientClosedRequest is recorded when the client disconnects mid-request
+const StatusClientClosedRequest = 499
+
+// Record stores a usage log row for a request that was not billed
+// (rejected, failed or aborted). Errors are logged, not returned, so
+// recording never changes the response sent to the client.
+func Record(entry *models.UsageLog) {
+	Observe(entry)
+	if err := database.DB.Create(entry).Error; err != nil {
+		slog.Error("failed to record usage log", "component", "UsageLog",
+			"request_id", entry.RequestID, "user_id", entry.UserID, "error_class", entry.ErrorClass, "error", err)
+	}
+}
+
+// RecordAsync stores a usage log row without blocking the caller
+func RecordAsync(entry models.UsageLog) {
+	go Record(&entry)
+}